@@ -19,24 +19,35 @@
 package api_in
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
+	"io"
 	"io/ioutil"
+	"mime"
 	"net/http"
 	"reflect"
 	"regexp"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/pkg/errors"
 
 	"github.com/mortenterhart/trivial-tickets/api/api_out"
+	"github.com/mortenterhart/trivial-tickets/assignment"
+	"github.com/mortenterhart/trivial-tickets/customers"
+	"github.com/mortenterhart/trivial-tickets/duplicates"
 	"github.com/mortenterhart/trivial-tickets/globals"
 	"github.com/mortenterhart/trivial-tickets/log"
 	"github.com/mortenterhart/trivial-tickets/mail_events"
+	"github.com/mortenterhart/trivial-tickets/mail_guard"
+	"github.com/mortenterhart/trivial-tickets/rules"
 	"github.com/mortenterhart/trivial-tickets/structs"
 	"github.com/mortenterhart/trivial-tickets/ticket"
 	"github.com/mortenterhart/trivial-tickets/util/filehandler"
 	"github.com/mortenterhart/trivial-tickets/util/httptools"
+	"github.com/mortenterhart/trivial-tickets/util/random"
 )
 
 /*
@@ -53,10 +64,15 @@ import (
  * Web API for incoming mails to create new tickets or answers
  */
 
+// ErrIgnored is the cause of the error returned for mails
+// which are ignored to prevent mail loops. They are neither
+// turned into tickets nor answered.
+var ErrIgnored = errors.New("mail ignored")
+
 // answerSubjectRegex is a regular expression
 // defining the syntax of a subject that creates
 // a new answer to an existing ticket.
-var answerSubjectRegex = regexp.MustCompile(`\[Ticket "([A-Za-z0-9]+)"\].*`)
+var answerSubjectRegex = regexp.MustCompile(`\[Ticket "([A-Za-z0-9-]+)"\].*`)
 
 // emailRegex defines the syntax of valid email
 // addresses.
@@ -94,13 +110,20 @@ var apiParameters = parameterMap{
 // tickets and answers out of mails. The mail is passed as JSON
 // to this handler and requires the exact properties "from" (the
 // sender's email address), "subject" (the ticket subject) and
-// "message" (the ticket's message body).
+// "message" (the ticket's message body). Alternatively, the raw
+// message can be passed with the content type message/rfc822.
 func ReceiveMail(writer http.ResponseWriter, request *http.Request) {
 	log.APIRequest(request)
 
 	// Only accept POST requests
 	if request.Method == "POST" {
 
+		// Raw messages are parsed instead of JSON
+		if mediaType, _, _ := mime.ParseMediaType(request.Header.Get("Content-Type")); mediaType == rawMessageType {
+			receiveRawMail(writer, request)
+			return
+		}
+
 		// Read the request body
 		body, readErr := ioutil.ReadAll(request.Body)
 		if readErr != nil {
@@ -148,70 +171,21 @@ func ReceiveMail(writer http.ResponseWriter, request *http.Request) {
 		}
 
 		// Validate the email address syntax using the above regular expression
-		if !validEmailAddress(mail.From) {
+		if !ValidEmailAddress(mail.From) {
 			httptools.StatusCodeError(writer, fmt.Sprintf("invalid email address given: '%s'", mail.From),
 				http.StatusBadRequest)
 			return
 		}
 
-		// Container for the created or updated ticket
-		var createdTicket structs.Ticket
-
-		// Flag indicating that an incoming request belongs to an answer
-		isAnswerMail := false
-
-		// Determine if the email's subject is compliant to the answer
-		// regular expression
-		if ticketID, matchesAnswerRegex := matchAnswerSubject(mail.Subject); matchesAnswerRegex {
-
-			// If so lookup the subject's ticket id in the ticket storage
-			// and check if this ticket exists
-			if existingTicket, ticketExists := globals.Tickets[ticketID]; ticketExists {
-				isAnswerMail = true
-
-				// If the ticket status was already closed, open it again
-				if existingTicket.Status == structs.StatusClosed {
-					existingTicket.Status = structs.StatusOpen
-					log.Infof(`Reopened ticket '%s' (subject "%s") because it was closed`,
-						existingTicket.ID, existingTicket.Subject)
-				}
-
-				// Update the ticket with a new comment consisting of the
-				// email address and message from the mail
-				log.Infof(`Attaching new answer from '%s' to ticket '%s' (subject "%s")`,
-					mail.From, existingTicket.ID, existingTicket.Subject)
-				createdTicket = ticket.UpdateTicket(convertStatusToString(existingTicket.Status),
-					mail.From, mail.Message, "extern", existingTicket)
-
-				// Send mail notification to customer that a new answer
-				// has been created
-				api_out.SendMail(mail_events.NewAnswer, createdTicket)
-			} else {
-				// The subject is formatted like an answering mail, but the
-				// ticket id does not exist
-				log.Warnf("Ticket id '%s' does not belong to an existing ticket, creating "+
-					"new ticket out of mail", ticketID)
+		// Create a new ticket or answer out of the mail. Ignored
+		// mails are confirmed so that they are not sent again.
+		if _, processErr := ProcessMail(mail); processErr != nil {
+			if IsIgnored(processErr) {
+				respondIgnored(writer, processErr)
+				return
 			}
-		}
 
-		// If the mail is not an answer create a new ticket in
-		// every other case
-		if !isAnswerMail {
-			createdTicket = ticket.CreateTicket(mail.From, mail.Subject, mail.Message)
-			log.Infof(`Creating new ticket "%s" (id '%s') out of mail from '%s'`,
-				createdTicket.Subject, createdTicket.ID, mail.From)
-
-			// Send mail notification to customer that a new ticket
-			// has been created
-			api_out.SendMail(mail_events.NewTicket, createdTicket)
-		}
-
-		// Push the created or updated ticket to the ticket storage
-		// and write it into its own file
-		globals.Tickets[createdTicket.ID] = createdTicket
-		if writeErr := filehandler.WriteTicketFile(globals.ServerConfig.Tickets, &createdTicket); writeErr != nil {
-			httptools.StatusCodeError(writer, fmt.Sprintf("failed to write file for ticket '%s'", createdTicket.ID),
-				http.StatusInternalServerError)
+			httptools.StatusCodeError(writer, processErr.Error(), http.StatusInternalServerError)
 			return
 		}
 
@@ -234,6 +208,246 @@ func ReceiveMail(writer http.ResponseWriter, request *http.Request) {
 		http.StatusText(http.StatusMethodNotAllowed), request.Method)
 }
 
+// rawMessageType is the content type of requests which
+// contain a raw RFC 5322 message.
+const rawMessageType string = "message/rfc822"
+
+// receiveRawMail parses the raw message in the request body
+// and creates a new ticket or answer out of it. The size of
+// the message is limited to the maximum mail size.
+func receiveRawMail(writer http.ResponseWriter, request *http.Request) {
+	body := io.Reader(request.Body)
+	if globals.ServerConfig.MaxMailSize > 0 {
+		body = http.MaxBytesReader(writer, request.Body, globals.ServerConfig.MaxMailSize)
+	}
+
+	data, readErr := ioutil.ReadAll(body)
+	if readErr != nil {
+		httptools.StatusCodeError(writer, fmt.Sprintf("unable to read message: %v", readErr),
+			http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	message, parseErr := ParseMessage(bytes.NewReader(data))
+	if parseErr != nil {
+		httptools.StatusCodeError(writer, fmt.Sprintf("unable to parse message: %v", parseErr),
+			http.StatusBadRequest)
+		return
+	}
+
+	if !ValidEmailAddress(message.Mail.From) {
+		httptools.StatusCodeError(writer, fmt.Sprintf("invalid email address given: '%s'", message.Mail.From),
+			http.StatusBadRequest)
+		return
+	}
+
+	createdTicket, processErr := ProcessMessage(message)
+	if IsIgnored(processErr) {
+		respondIgnored(writer, processErr)
+		return
+	}
+	if processErr != nil {
+		httptools.StatusCodeError(writer, processErr.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	httptools.JSONResponse(writer, structs.JSONMap{
+		"status":      http.StatusOK,
+		"message":     http.StatusText(http.StatusOK),
+		"ticket":      createdTicket.ID,
+		"attachments": len(message.Files),
+	})
+	log.Infof("%d %s: Raw mail request was processed successfully", http.StatusOK, http.StatusText(http.StatusOK))
+}
+
+// respondIgnored confirms an ignored mail with status OK
+// and the reason for ignoring it.
+func respondIgnored(writer http.ResponseWriter, ignoreErr error) {
+	httptools.JSONResponse(writer, structs.JSONMap{
+		"status":  http.StatusOK,
+		"message": ignoreErr.Error(),
+	})
+	log.Infof("%d %s: Mail request was ignored", http.StatusOK, http.StatusText(http.StatusOK))
+}
+
+// ProcessMail creates a new ticket out of the given mail or
+// attaches it as answer to an existing ticket if the subject
+// references the ticket. The created or updated ticket is
+// stored and returned. The sender's address has to be valid.
+func ProcessMail(mail structs.Mail) (structs.Ticket, error) {
+	return ProcessMessage(Message{Mail: mail})
+}
+
+// ProcessMessage processes the mail of the message like
+// ProcessMail and stores the attached files as attachments
+// of the new entry. A message replying to a mail of a ticket
+// is attached to this ticket regardless of the subject.
+// Mails from the ticket system itself, auto-generated mails
+// and mails of senders exceeding the rate limit are ignored
+// with an error caused by ErrIgnored.
+func ProcessMessage(message Message) (structs.Ticket, error) {
+	mail := message.Mail
+
+	if ignoreErr := checkIgnored(message); ignoreErr != nil {
+		log.Warnf(`Ignoring mail "%s" from '%s': %v`, mail.Subject, mail.From, ignoreErr)
+		return structs.Ticket{}, ignoreErr
+	}
+
+	// Container for the created or updated ticket
+	var createdTicket structs.Ticket
+
+	// Flag indicating that an incoming request belongs to an answer
+	isAnswerMail := false
+
+	// Determine the ticket the message replies to by the threading
+	// headers and fall back to the answer regular expression on
+	// the email's subject
+	ticketID, isReply := matchReferences(message.References)
+	if !isReply {
+		ticketID, isReply = matchAnswerSubject(mail.Subject)
+	}
+
+	if isReply {
+
+		// If so lookup the ticket id in the ticket storage and
+		// check if this ticket exists
+		if existingTicket, ticketExists := globals.Tickets[ticketID]; ticketExists {
+			isAnswerMail = true
+
+			// If the ticket status was already closed, open it again
+			if existingTicket.Status == structs.StatusClosed {
+				existingTicket.Status = structs.StatusOpen
+				log.Infof(`Reopened ticket '%s' (subject "%s") because it was closed`,
+					existingTicket.ID, existingTicket.Subject)
+			}
+
+			// Update the ticket with a new comment consisting of the
+			// email address and message from the mail
+			log.Infof(`Attaching new answer from '%s' to ticket '%s' (subject "%s")`,
+				mail.From, existingTicket.ID, existingTicket.Subject)
+			// Quoted text and the signature are removed, but the
+			// full message is kept on the entry
+			reply := stripReply(mail.Message)
+			createdTicket = ticket.UpdateTicket(convertStatusToString(existingTicket.Status),
+				mail.From, reply, structs.ReplyExternal, existingTicket)
+			if reply != strings.TrimSpace(mail.Message) {
+				createdTicket = keepFullText(createdTicket, mail.Message)
+			}
+			createdTicket = attachFiles(createdTicket, message.Files)
+			createdTicket = recordMessageID(createdTicket, message.MessageID)
+
+			// The answer resets the timer of the stale ticket policy
+			createdTicket = ticket.ResetStaleTimer(createdTicket)
+
+			// Apply the automation rules for replies
+			createdTicket = rules.Apply(rules.EventReply, createdTicket)
+
+			// Send mail notification to customer that a new answer
+			// has been created and inform the assigned editor
+			api_out.SendMail(mail_events.NewAnswer, createdTicket)
+			api_out.SendMail(mail_events.CustomerReply, createdTicket)
+		} else {
+			// The mail looks like an answering mail, but the ticket
+			// id does not exist
+			log.Warnf("Ticket id '%s' does not belong to an existing ticket, creating "+
+				"new ticket out of mail", ticketID)
+		}
+	}
+
+	// If the mail is not an answer create a new ticket in
+	// every other case
+	if !isAnswerMail {
+		createdTicket = customers.Link(ticket.CreateTicket(mail.From, mail.Subject, mail.Message))
+		createdTicket = attachFiles(createdTicket, message.Files)
+		createdTicket = recordMessageID(createdTicket, message.MessageID)
+		log.Infof(`Creating new ticket "%s" (id '%s') out of mail from '%s'`,
+			createdTicket.Subject, createdTicket.ID, mail.From)
+
+		// Look for an open ticket which the new ticket duplicates
+		var original structs.Ticket
+		var merged bool
+		createdTicket, original, merged = duplicates.Check(createdTicket, time.Now())
+
+		// Apply the automation rules and assign the ticket to
+		// an editor if no rule did and automatic assignment
+		// is enabled
+		assigned := false
+		if !merged {
+			createdTicket = rules.Apply(rules.EventCreated, createdTicket)
+
+			assigned = createdTicket.User.ID != ""
+			if !assigned {
+				createdTicket, assigned = assignment.AutoAssign(createdTicket)
+			}
+		}
+
+		// Send mail notification to customer that a new ticket
+		// has been created. A merged ticket is an answer to the
+		// original ticket instead.
+		if merged {
+			globals.Tickets[original.ID] = original
+			filehandler.WriteTicketFile(globals.ServerConfig.Tickets, &original)
+			api_out.SendMail(mail_events.NewAnswer, original)
+			api_out.SendMail(mail_events.CustomerReply, original)
+		} else {
+			api_out.SendMail(mail_events.NewTicket, createdTicket)
+		}
+
+		if assigned {
+			log.Infof("Automatically assigned user '%s' (username '%s') to ticket '%s'",
+				createdTicket.User.Name, createdTicket.User.Username, createdTicket.ID)
+			api_out.SendMail(mail_events.AssignedTicket, createdTicket)
+			api_out.SendMail(mail_events.AgentAssigned, createdTicket)
+		}
+	}
+
+	// The ticket number is used now, so the sequence has to be
+	// persisted to avoid reusing it after a restart
+	if !isAnswerMail {
+		if saveErr := ticket.SaveSequence(); saveErr != nil {
+			log.Error("Unable to save the ticket sequence:", saveErr)
+		}
+	}
+
+	// Push the created or updated ticket to the ticket storage
+	// and write it into its own file
+	globals.Tickets[createdTicket.ID] = createdTicket
+	if writeErr := filehandler.WriteTicketFile(globals.ServerConfig.Tickets, &createdTicket); writeErr != nil {
+		return createdTicket, fmt.Errorf("failed to write file for ticket '%s'", createdTicket.ID)
+	}
+
+	return createdTicket, nil
+}
+
+// attachFiles stores the files in the attachment directory
+// and adds them as attachments to the latest entry of the
+// ticket. Files which cannot be stored are left out.
+func attachFiles(currentTicket structs.Ticket, files []File) structs.Ticket {
+	if len(files) == 0 || len(currentTicket.Entries) == 0 {
+		return currentTicket
+	}
+
+	latest := &currentTicket.Entries[len(currentTicket.Entries)-1]
+	for _, file := range files {
+		attachment := structs.Attachment{
+			ID:          random.CreateRandomID(structs.RandomIDLength),
+			Name:        file.Name,
+			ContentType: file.ContentType,
+			Size:        len(file.Data),
+		}
+
+		if writeErr := filehandler.WriteAttachmentFile(globals.ServerConfig.Attachments, attachment.ID, file.Data); writeErr != nil {
+			log.Errorf("unable to store attachment '%s' of ticket '%s': %v", file.Name, currentTicket.ID, writeErr)
+			continue
+		}
+
+		log.Infof("Attached file '%s' (%d bytes) to ticket '%s'", attachment.Name, attachment.Size, currentTicket.ID)
+		latest.Attachments = append(latest.Attachments, attachment)
+	}
+
+	return currentTicket
+}
+
 // convertStatusToString converts a status enum constant which is
 // an integer to a string considering correct string conversion.
 // Casting the integer to a string is not an option since the string
@@ -258,10 +472,80 @@ func matchAnswerSubject(subject string) (string, bool) {
 	return "", false
 }
 
-// validEmailAddress checks the given email address against the
+// checkIgnored returns an error caused by ErrIgnored if the
+// message has to be ignored to prevent a mail loop.
+func checkIgnored(message Message) error {
+	if strings.EqualFold(message.Mail.From, api_out.NoReplyAddress) {
+		return errors.Wrap(ErrIgnored, "sent by the ticket system itself")
+	}
+
+	// Auto-replies must not use up the rate limit of the sender
+	if message.AutoGenerated {
+		return errors.Wrap(ErrIgnored, "auto-generated mail")
+	}
+
+	if !mail_guard.Allow(message.Mail.From, time.Now()) {
+		return errors.Wrap(ErrIgnored, "sender exceeded the rate limit")
+	}
+
+	return nil
+}
+
+// IsIgnored reports whether the error was returned for an
+// ignored mail.
+func IsIgnored(err error) bool {
+	return errors.Cause(err) == ErrIgnored
+}
+
+// matchReferences returns the id of the ticket one of the
+// referenced mails belongs to. Those are outgoing mails whose
+// Message-ID was sent about the ticket or incoming mails
+// whose Message-ID was recorded on an entry of the ticket.
+func matchReferences(references []string) (string, bool) {
+	for _, reference := range references {
+		if ticketID, isSent := api_out.TicketOfMessageID(reference); isSent {
+			return ticketID, true
+		}
+
+		for _, existingTicket := range globals.Tickets {
+			for _, entry := range existingTicket.Entries {
+				if entry.MessageID == reference {
+					return existingTicket.ID, true
+				}
+			}
+		}
+	}
+
+	return "", false
+}
+
+// keepFullText stores the full text of the mail on the latest
+// entry of the ticket whose text was shortened.
+func keepFullText(currentTicket structs.Ticket, fullText string) structs.Ticket {
+	if len(currentTicket.Entries) == 0 {
+		return currentTicket
+	}
+
+	currentTicket.Entries[len(currentTicket.Entries)-1].FullText = fullText
+	return currentTicket
+}
+
+// recordMessageID stores the Message-ID of an incoming mail
+// on the latest entry of the ticket so that replies to the
+// mail can be threaded as well.
+func recordMessageID(currentTicket structs.Ticket, messageID string) structs.Ticket {
+	if messageID == "" || len(currentTicket.Entries) == 0 {
+		return currentTicket
+	}
+
+	currentTicket.Entries[len(currentTicket.Entries)-1].MessageID = messageID
+	return currentTicket
+}
+
+// ValidEmailAddress checks the given email address against the
 // email regular expression and examines if the supplied email
 // address is valid or not.
-func validEmailAddress(email string) bool {
+func ValidEmailAddress(email string) bool {
 	return emailRegex.Match([]byte(email))
 }
 
@@ -27,12 +27,16 @@ import (
 	"os"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 
+	"github.com/mortenterhart/trivial-tickets/api/api_out"
 	"github.com/mortenterhart/trivial-tickets/globals"
 	"github.com/mortenterhart/trivial-tickets/log"
 	"github.com/mortenterhart/trivial-tickets/log/testlog"
+	"github.com/mortenterhart/trivial-tickets/mail_events"
+	"github.com/mortenterhart/trivial-tickets/mail_guard"
 	"github.com/mortenterhart/trivial-tickets/structs"
 	"github.com/mortenterhart/trivial-tickets/structs/defaults"
 	"github.com/mortenterhart/trivial-tickets/ticket"
@@ -100,6 +104,10 @@ func setupAndCleanup() teardownFunc {
 	logConfig := testLogConfig()
 	globals.LogConfig = &logConfig
 
+	if loadErr := mail_events.LoadTemplates(config.MailTemplates, config.MailLanguage); loadErr != nil {
+		testlog.Debug("ERROR: cannot load mail templates:", loadErr)
+	}
+
 	return func() {
 		cleanupTestFiles(config)
 	}
@@ -108,13 +116,18 @@ func setupAndCleanup() teardownFunc {
 // testServerConfig returns a test server configuration.
 func testServerConfig() structs.ServerConfig {
 	return structs.ServerConfig{
-		Port:    defaults.TestPort,
-		Tickets: "testtickets",
-		Users:   defaults.TestUsers,
-		Mails:   "testmails",
-		Cert:    defaults.TestCertificate,
-		Key:     defaults.TestKey,
-		Web:     defaults.TestWeb,
+		Port:        defaults.TestPort,
+		Tickets:     "testtickets",
+		Users:       defaults.TestUsers,
+		Mails:       "testmails",
+		Attachments: "testattachments",
+		Cert:        defaults.TestCertificate,
+		Key:         defaults.TestKey,
+		Web:         defaults.TestWeb,
+		MaxMailSize: 2048,
+
+		MailTemplates: defaults.TestMailTmpl,
+		MailLanguage:  defaults.ServerMailLang,
 	}
 }
 
@@ -143,6 +156,13 @@ func cleanupTestFiles(config structs.ServerConfig) {
 			log.Error("ERROR: cannot remove test mail directory:", removeErr)
 		}
 	}
+
+	if filehandler.DirectoryExists(config.Attachments) {
+		testlog.Debug("Deferred: Removing test attachment directory", config.Attachments)
+		if removeErr := os.RemoveAll(config.Attachments); removeErr != nil {
+			log.Error("ERROR: cannot remove test attachment directory:", removeErr)
+		}
+	}
 }
 
 // createTestServer creates a test server with the given
@@ -825,6 +845,75 @@ func TestReceiveMailCreateAnswerClosedTicket(t *testing.T) {
 	})
 }
 
+func TestReceiveMailCreateAnswerResetsStaleTimer(t *testing.T) {
+	testlog.BeginTest()
+	defer testlog.EndTest()
+
+	cleanupFiles := setupAndCleanup()
+	defer cleanupFiles()
+
+	setupHandler := newSetupHandler(ReceiveMail)
+
+	testServer := createTestServer(setupHandler)
+	defer testServer.Close()
+
+	// Create a ticket whose customer was reminded to answer
+	testTicket := ticket.CreateTicket("customer@mail.com", "Issue with Computer", "My computer is broken")
+	testTicket.Status = structs.StatusInProgress
+	testTicket.StaleReminded = time.Now()
+
+	globals.Tickets[testTicket.ID] = testTicket
+
+	answerSubject := fmt.Sprintf(`[Ticket \"%s\"] Issue with Computer`, testTicket.ID)
+
+	answerJSON := fmt.Sprintf(`{"from":"%s","subject":"%s","message":"Here is my answer"}`,
+		testTicket.Customer, answerSubject)
+
+	response, err := http.Post(testServer.URL, jsonContentTypeTest, createReader(answerJSON))
+	defer func() {
+		if err == nil {
+			response.Body.Close()
+		}
+	}()
+
+	t.Run("POSTError", func(t *testing.T) {
+		assert.NoError(t, err, "POST request should be successful")
+	})
+
+	t.Run("timerReset", func(t *testing.T) {
+		assert.True(t, globals.Tickets[testTicket.ID].StaleReminded.IsZero(), "answer should reset the stale timer")
+	})
+}
+
+func TestProcessMessageNotifiesEditor(t *testing.T) {
+	testlog.BeginTest()
+	defer testlog.EndTest()
+
+	cleanupFiles := setupAndCleanup()
+	defer cleanupFiles()
+
+	editor := structs.User{ID: "editor1", Name: "Editor", Username: "editor", Mail: "editor@mail.com"}
+
+	testTicket := ticket.CreateTicket("customer@mail.com", "Printer broken", "It does not print.")
+	testTicket = ticket.AssignTicket(editor, testTicket)
+	globals.Tickets[testTicket.ID] = testTicket
+	defer delete(globals.Tickets, testTicket.ID)
+
+	_, err := ProcessMail(structs.Mail{From: "customer@mail.com",
+		Subject: fmt.Sprintf(`[Ticket "%s"] Printer broken`, testTicket.ID), Message: "Still broken."})
+
+	assert.NoError(t, err)
+
+	editorMails := 0
+	for _, mail := range globals.Mails {
+		if mail.To == editor.Mail {
+			editorMails++
+			assert.Contains(t, mail.Message, "the customer has answered", "editor should be told about the answer")
+		}
+	}
+	assert.Equal(t, 1, editorMails, "assigned editor should be notified")
+}
+
 // * ------------------------------------------- *
 //          Tests for helper functions
 //               of ReceiveMail()
@@ -845,6 +934,19 @@ func TestMatchAnswerSubject(t *testing.T) {
 	t.Run("equalTicketId", func(t *testing.T) {
 		assert.Equal(t, ticketID, extractedID, "extracted id should be identical to test id")
 	})
+
+	t.Run("sequentialTicketId", func(t *testing.T) {
+		sequentialID, sequentialMatching := matchAnswerSubject(`[Ticket "TT-2019-000123"] Ticket subject`)
+
+		assert.True(t, sequentialMatching, "subject with sequential id should match the answering schema")
+		assert.Equal(t, "TT-2019-000123", sequentialID, "extracted id should contain the whole ticket number")
+	})
+
+	t.Run("randomTicketId", func(t *testing.T) {
+		randomID, _ := matchAnswerSubject(`[Ticket "1z9JcEUnW3"] Ticket subject`)
+
+		assert.Equal(t, "1z9JcEUnW3", randomID, "ids of old tickets should still be extracted")
+	})
 }
 
 func TestValidEmailAddress(t *testing.T) {
@@ -853,7 +955,7 @@ func TestValidEmailAddress(t *testing.T) {
 
 	email := "admin@example.com"
 
-	assert.True(t, validEmailAddress(email), "email should be valid")
+	assert.True(t, ValidEmailAddress(email), "email should be valid")
 }
 
 func TestCheckRequiredPropertiesSet(t *testing.T) {
@@ -987,3 +1089,253 @@ func TestWriteJsonProperty(t *testing.T) {
 		assert.Equal(t, expectedEmail, actualEmail, "actual json email should match expected json")
 	})
 }
+
+func TestReceiveMailRawMessage(t *testing.T) {
+	testlog.BeginTest()
+	defer testlog.EndTest()
+
+	cleanupFiles := setupAndCleanup()
+	defer cleanupFiles()
+
+	testServer := createTestServer(newSetupHandler(ReceiveMail))
+	defer testServer.Close()
+
+	t.Run("withAttachment", func(t *testing.T) {
+		response, err := http.Post(testServer.URL, rawMessageType, createReader(crlf("From: customer@mail.com\n"+
+			"Subject: Screenshot of the error\n"+
+			"Content-Type: multipart/mixed; boundary=\"frontier\"\n"+
+			"\n"+
+			"--frontier\n"+
+			"Content-Type: text/plain\n"+
+			"\n"+
+			"See the attached screenshot.\n"+
+			"--frontier\n"+
+			"Content-Type: image/png; name=\"error.png\"\n"+
+			"Content-Transfer-Encoding: base64\n"+
+			"\n"+
+			"iVBORw0KGgo=\n"+
+			"--frontier--\n")))
+		if !assert.NoError(t, err, "POST request should be successful") {
+			return
+		}
+		defer response.Body.Close()
+
+		assert.Equal(t, http.StatusOK, response.StatusCode, "raw message should be accepted")
+
+		var createdTicket structs.Ticket
+		for _, ticket := range globals.Tickets {
+			if ticket.Subject == "Screenshot of the error" {
+				createdTicket = ticket
+			}
+		}
+
+		if assert.Len(t, createdTicket.Entries, 1, "ticket should be created") &&
+			assert.Len(t, createdTicket.Entries[0].Attachments, 1, "entry should have the attachment") {
+
+			attachment := createdTicket.Entries[0].Attachments[0]
+			assert.Equal(t, "error.png", attachment.Name)
+			assert.Equal(t, "image/png", attachment.ContentType)
+			assert.Equal(t, 8, attachment.Size)
+			assert.True(t, filehandler.FileExists(filehandler.AttachmentPath(globals.ServerConfig.Attachments, attachment.ID)),
+				"attachment should be written")
+		}
+	})
+
+	t.Run("tooLarge", func(t *testing.T) {
+		response, err := http.Post(testServer.URL, rawMessageType, createReader(crlf("From: customer@mail.com\n"+
+			"Subject: Large\n"+
+			"\n"+
+			strings.Repeat("x", 4096)+"\n")))
+		if !assert.NoError(t, err, "POST request should be successful") {
+			return
+		}
+		defer response.Body.Close()
+
+		assert.Equal(t, http.StatusRequestEntityTooLarge, response.StatusCode, "large message should be rejected")
+	})
+
+	t.Run("unparsable", func(t *testing.T) {
+		response, err := http.Post(testServer.URL, rawMessageType, createReader("no message at all"))
+		if !assert.NoError(t, err, "POST request should be successful") {
+			return
+		}
+		defer response.Body.Close()
+
+		assert.Equal(t, http.StatusBadRequest, response.StatusCode, "invalid message should be rejected")
+	})
+}
+
+func TestProcessMessageThreading(t *testing.T) {
+	testlog.BeginTest()
+	defer testlog.EndTest()
+
+	cleanupFiles := setupAndCleanup()
+	defer cleanupFiles()
+
+	globals.Tickets = make(map[string]structs.Ticket)
+	defer func() {
+		globals.Tickets = make(map[string]structs.Ticket)
+	}()
+
+	original, createErr := ProcessMessage(Message{
+		Mail:      structs.Mail{From: "customer@mail.com", Subject: "Printer broken", Message: "It does not print"},
+		MessageID: "<first@mail.example.com>",
+	})
+	if !assert.NoError(t, createErr) {
+		return
+	}
+
+	api_out.RecordMessageID(structs.Mail{ID: "mail123", TicketID: original.ID,
+		MessageID: api_out.NewMessageID("mail123", original.ID)})
+
+	t.Run("inReplyToOwnMail", func(t *testing.T) {
+		answered, err := ProcessMessage(Message{
+			Mail:       structs.Mail{From: "customer@mail.com", Subject: "Re: my printer", Message: "Still broken"},
+			References: []string{api_out.NewMessageID("mail123", original.ID)},
+		})
+
+		assert.NoError(t, err)
+		assert.Equal(t, original.ID, answered.ID, "reply should be attached to the ticket of the mail")
+		assert.Len(t, globals.Tickets, 1, "no new ticket should be created")
+	})
+
+	t.Run("referencesCustomerMail", func(t *testing.T) {
+		answered, err := ProcessMessage(Message{
+			Mail:       structs.Mail{From: "customer@mail.com", Subject: "Forgot something", Message: "Model X"},
+			References: []string{"<unknown@mail.example.com>", "<first@mail.example.com>"},
+		})
+
+		assert.NoError(t, err)
+		assert.Equal(t, original.ID, answered.ID, "reply should be attached to the ticket of the first mail")
+		assert.Len(t, globals.Tickets, 1, "no new ticket should be created")
+	})
+
+	t.Run("subjectFallback", func(t *testing.T) {
+		answered, err := ProcessMessage(Message{
+			Mail: structs.Mail{From: "customer@mail.com",
+				Subject: fmt.Sprintf(`[Ticket "%s"] Printer broken`, original.ID), Message: "Any news?"},
+			References: []string{api_out.NewMessageID("mail123", "deleted")},
+		})
+
+		assert.NoError(t, err)
+		assert.Equal(t, original.ID, answered.ID, "subject should be used if the references are unknown")
+	})
+
+	t.Run("newTicket", func(t *testing.T) {
+		created, err := ProcessMessage(Message{
+			Mail:       structs.Mail{From: "other@mail.com", Subject: "Other issue", Message: "Hello"},
+			References: []string{"<unknown@mail.example.com>"},
+		})
+
+		assert.NoError(t, err)
+		assert.NotEqual(t, original.ID, created.ID, "unrelated mail should create a new ticket")
+	})
+
+	t.Run("forgedMessageID", func(t *testing.T) {
+		created, err := ProcessMessage(Message{
+			Mail:       structs.Mail{From: "attacker@mail.com", Subject: "Hello", Message: "Please reopen"},
+			References: []string{api_out.NewMessageID("guessed", original.ID)},
+		})
+
+		assert.NoError(t, err)
+		assert.NotEqual(t, original.ID, created.ID, "unsent Message-IDs should not be threaded")
+		assert.Len(t, globals.Tickets[original.ID].Entries, 4, "the ticket should not get an answer")
+	})
+}
+
+func TestProcessMessageStripsQuotedText(t *testing.T) {
+	testlog.BeginTest()
+	defer testlog.EndTest()
+
+	cleanupFiles := setupAndCleanup()
+	defer cleanupFiles()
+
+	globals.Tickets = make(map[string]structs.Ticket)
+	defer func() {
+		globals.Tickets = make(map[string]structs.Ticket)
+	}()
+
+	original, createErr := ProcessMail(structs.Mail{From: "customer@mail.com", Subject: "Printer broken",
+		Message: "It does not print.\n\nOn Monday Max wrote:\n> something"})
+	if !assert.NoError(t, createErr) {
+		return
+	}
+
+	assert.Contains(t, original.Entries[0].Text, "> something", "new tickets should keep the whole text")
+
+	fullText := "Still broken.\n\nOn Mon, 7 Jan 2019, Support wrote:\n> Please restart the printer."
+	answered, err := ProcessMail(structs.Mail{From: "customer@mail.com",
+		Subject: fmt.Sprintf(`[Ticket "%s"] Printer broken`, original.ID), Message: fullText})
+
+	assert.NoError(t, err)
+	if assert.Len(t, answered.Entries, 2) {
+		assert.Equal(t, "Still broken.", answered.Entries[1].Text, "quoted text should be removed")
+		assert.Equal(t, fullText, answered.Entries[1].FullText, "full message should be kept")
+	}
+}
+
+func TestProcessMessageIgnored(t *testing.T) {
+	testlog.BeginTest()
+	defer testlog.EndTest()
+
+	cleanupFiles := setupAndCleanup()
+	defer cleanupFiles()
+
+	globals.ServerConfig.MailRateLimit = 2
+	defer mail_guard.Reset()
+
+	globals.Tickets = make(map[string]structs.Ticket)
+	globals.Mails = make(map[string]structs.Mail)
+	defer func() {
+		globals.Tickets = make(map[string]structs.Ticket)
+		globals.Mails = make(map[string]structs.Mail)
+	}()
+
+	t.Run("ownAddress", func(t *testing.T) {
+		_, err := ProcessMail(structs.Mail{From: api_out.NoReplyAddress, Subject: "New ticket", Message: "Hello"})
+
+		assert.True(t, IsIgnored(err), "mails of the ticket system itself should be ignored")
+		assert.Empty(t, globals.Tickets)
+	})
+
+	t.Run("autoGenerated", func(t *testing.T) {
+		_, err := ProcessMessage(Message{
+			Mail:          structs.Mail{From: "holiday@mail.com", Subject: "Out of office", Message: "On holiday"},
+			AutoGenerated: true,
+		})
+
+		assert.True(t, IsIgnored(err), "auto-generated mails should be ignored")
+		assert.Empty(t, globals.Tickets)
+	})
+
+	t.Run("rateLimit", func(t *testing.T) {
+		for count := 1; count <= 2; count++ {
+			_, err := ProcessMail(structs.Mail{From: "loop@mail.com", Subject: "Loop", Message: "Again"})
+			assert.NoError(t, err, "mails within the rate limit should be processed")
+		}
+
+		mailCount := len(globals.Mails)
+
+		loopingTicket, err := ProcessMail(structs.Mail{From: "loop@mail.com", Subject: "Loop", Message: "Again"})
+		assert.True(t, IsIgnored(err), "mails above the rate limit should be ignored")
+		assert.Empty(t, loopingTicket.ID)
+
+		for _, existingTicket := range globals.Tickets {
+			api_out.SendMail(mail_events.UpdatedTicket, existingTicket)
+		}
+		assert.Len(t, globals.Mails, mailCount, "no notifications should be sent to a looping address")
+	})
+
+	t.Run("autoGeneratedWithinLimit", func(t *testing.T) {
+		for count := 1; count <= 3; count++ {
+			ProcessMessage(Message{
+				Mail:          structs.Mail{From: "customer@mail.com", Subject: "Out of office", Message: "On holiday"},
+				AutoGenerated: true,
+			})
+		}
+
+		_, err := ProcessMail(structs.Mail{From: "customer@mail.com", Subject: "Printer", Message: "Broken"})
+
+		assert.NoError(t, err, "auto-replies should not use up the rate limit of the sender")
+	})
+}
@@ -0,0 +1,119 @@
+// Trivial Tickets Ticketsystem
+// Copyright (C) 2019 The Contributors
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+// Package api_in implements a web interface for incoming mails
+// to create new tickets or answers
+package api_in
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/pkg/errors"
+)
+
+/*
+ * Ticketsystem Trivial Tickets
+ *
+ * Matriculation numbers: 3040018, 6694964, 3478222
+ * Lecture:               Programmieren II, INF16B
+ * Lecturer:              Herr Prof. Dr. Helmut Neemann
+ * Institute:             Duale Hochschule Baden-Württemberg Mosbach
+ *
+ * ---------------
+ *
+ * Package api_in
+ * Conversion of the common mail charsets to UTF-8
+ */
+
+// windows1252 maps the bytes 0x80 to 0x9F of Windows-1252
+// to their runes. All other bytes equal ISO-8859-1.
+var windows1252 = [32]rune{
+	'€', '�', '‚', 'ƒ', '„', '…', '†', '‡', 'ˆ', '‰', 'Š', '‹', 'Œ', '�', 'Ž', '�',
+	'�', '‘', '’', '“', '”', '•', '–', '—', '˜', '™', 'š', '›', 'œ', '�', 'ž', 'Ÿ',
+}
+
+// iso885915 maps the bytes of ISO-8859-15 which differ
+// from ISO-8859-1 to their runes.
+var iso885915 = map[byte]rune{
+	0xA4: '€', 0xA6: 'Š', 0xA8: 'š', 0xB4: 'Ž', 0xB8: 'ž', 0xBC: 'Œ', 0xBD: 'œ', 0xBE: 'Ÿ',
+}
+
+// decodeCharset converts text in the given charset to
+// UTF-8. Besides UTF-8 and US-ASCII, the Western European
+// charsets ISO-8859-1, ISO-8859-15 and Windows-1252 are
+// supported.
+func decodeCharset(charset string, data []byte) (string, error) {
+	switch strings.ToLower(strings.TrimSpace(charset)) {
+	case "", "utf-8", "utf8", "us-ascii", "ascii":
+		if !utf8.Valid(data) {
+			return string([]rune(string(data))), nil
+		}
+		return string(data), nil
+
+	case "iso-8859-1", "iso8859-1", "latin1":
+		return decodeSingleByte(data, func(b byte) rune { return rune(b) }), nil
+
+	case "iso-8859-15", "iso8859-15", "latin9":
+		return decodeSingleByte(data, func(b byte) rune {
+			if r, differs := iso885915[b]; differs {
+				return r
+			}
+			return rune(b)
+		}), nil
+
+	case "windows-1252", "cp1252":
+		return decodeSingleByte(data, func(b byte) rune {
+			if b >= 0x80 && b <= 0x9F {
+				return windows1252[b-0x80]
+			}
+			return rune(b)
+		}), nil
+
+	default:
+		return "", errors.Errorf("unsupported charset '%s'", charset)
+	}
+}
+
+// decodeSingleByte converts every byte of the data to
+// the rune given by the mapping.
+func decodeSingleByte(data []byte, mapping func(byte) rune) string {
+	var text strings.Builder
+	for _, b := range data {
+		text.WriteRune(mapping(b))
+	}
+
+	return text.String()
+}
+
+// charsetReader converts the charsets of encoded words in
+// headers to UTF-8. It is used by the header decoder.
+func charsetReader(charset string, input io.Reader) (io.Reader, error) {
+	data, readErr := ioutil.ReadAll(input)
+	if readErr != nil {
+		return nil, readErr
+	}
+
+	text, decodeErr := decodeCharset(charset, data)
+	if decodeErr != nil {
+		return nil, decodeErr
+	}
+
+	return bytes.NewReader([]byte(text)), nil
+}
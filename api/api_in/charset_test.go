@@ -0,0 +1,73 @@
+// Trivial Tickets Ticketsystem
+// Copyright (C) 2019 The Contributors
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+// Package api_in implements a web interface for incoming mails
+// to create new tickets or answers
+package api_in
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mortenterhart/trivial-tickets/log/testlog"
+)
+
+/*
+ * Ticketsystem Trivial Tickets
+ *
+ * Matriculation numbers: 3040018, 6694964, 3478222
+ * Lecture:               Programmieren II, INF16B
+ * Lecturer:              Herr Prof. Dr. Helmut Neemann
+ * Institute:             Duale Hochschule Baden-Württemberg Mosbach
+ *
+ * ---------------
+ *
+ * Package api_in [tests]
+ * Decoding of character sets
+ */
+
+func TestDecodeCharset(t *testing.T) {
+	testlog.BeginTest()
+	defer testlog.EndTest()
+
+	t.Run("utf8", func(t *testing.T) {
+		text, err := decodeCharset("UTF-8", []byte("Grüße"))
+
+		assert.NoError(t, err)
+		assert.Equal(t, "Grüße", text)
+	})
+
+	t.Run("latin1", func(t *testing.T) {
+		text, err := decodeCharset("iso-8859-1", []byte("Gr\xfc\xdfe"))
+
+		assert.NoError(t, err)
+		assert.Equal(t, "Grüße", text)
+	})
+
+	t.Run("windows1252", func(t *testing.T) {
+		text, err := decodeCharset("windows-1252", []byte("\x80 5"))
+
+		assert.NoError(t, err)
+		assert.Equal(t, "€ 5", text)
+	})
+
+	t.Run("unknown", func(t *testing.T) {
+		_, err := decodeCharset("koi8-r", []byte("text"))
+
+		assert.Error(t, err)
+	})
+}
@@ -0,0 +1,344 @@
+// Trivial Tickets Ticketsystem
+// Copyright (C) 2019 The Contributors
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+// Package api_in implements a web interface for incoming mails
+// to create new tickets or answers
+package api_in
+
+import (
+	"encoding/base64"
+	"fmt"
+	"html"
+	"io"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/mortenterhart/trivial-tickets/structs"
+)
+
+/*
+ * Ticketsystem Trivial Tickets
+ *
+ * Matriculation numbers: 3040018, 6694964, 3478222
+ * Lecture:               Programmieren II, INF16B
+ * Lecturer:              Herr Prof. Dr. Helmut Neemann
+ * Institute:             Duale Hochschule Baden-Württemberg Mosbach
+ *
+ * ---------------
+ *
+ * Package api_in
+ * Parsing of raw RFC 5322 and MIME messages
+ */
+
+// maxPartDepth limits the nesting of multipart bodies.
+const maxPartDepth int = 10
+
+// headerDecoder decodes MIME encoded words in headers
+// such as the subject.
+var headerDecoder = &mime.WordDecoder{CharsetReader: charsetReader}
+
+// Message is an incoming mail together with the files
+// attached to it. References holds the Message-IDs of the
+// mails the message replies to, the most recent first.
+// AutoGenerated marks auto-replies and bulk mails which
+// must not be answered.
+type Message struct {
+	Mail          structs.Mail
+	Files         []File
+	MessageID     string
+	References    []string
+	AutoGenerated bool
+}
+
+// File is a file attached to an incoming mail.
+type File struct {
+	Name        string
+	ContentType string
+	Data        []byte
+}
+
+// header is implemented by the headers of messages and
+// of the parts of multipart bodies.
+type header interface {
+	Get(key string) string
+}
+
+// messageBody collects the texts and files found while
+// walking through the parts of a message.
+type messageBody struct {
+	plain string
+	html  string
+	files []File
+}
+
+// ParseMessage reads a raw RFC 5322 message and converts it
+// to a mail with the sender's address, the decoded subject
+// and the text of the message. Multipart bodies are searched
+// for a text/plain part, an HTML part is converted to text if
+// there is none. Attachments are returned as files and the
+// Message-IDs of the threading headers are kept. Messages
+// with auto-reply or bulk headers are marked as such.
+func ParseMessage(reader io.Reader) (Message, error) {
+	message, readErr := mail.ReadMessage(reader)
+	if readErr != nil {
+		return Message{}, errors.Wrap(readErr, "invalid message")
+	}
+
+	from, addressErr := mail.ParseAddress(decodeHeader(message.Header.Get("From")))
+	if addressErr != nil {
+		return Message{}, errors.Wrap(addressErr, "invalid From header")
+	}
+
+	var body messageBody
+	if walkErr := body.walk(message.Header, message.Body, 0); walkErr != nil {
+		return Message{}, walkErr
+	}
+
+	text := body.plain
+	if strings.TrimSpace(text) == "" && body.html != "" {
+		text = htmlToText(body.html)
+	}
+
+	return Message{
+		Mail: structs.Mail{
+			From:    from.Address,
+			Subject: strings.TrimSpace(decodeHeader(message.Header.Get("Subject"))),
+			Message: strings.TrimSpace(text),
+		},
+		Files:         body.files,
+		MessageID:     firstMessageID(message.Header.Get("Message-ID")),
+		References:    references(message.Header),
+		AutoGenerated: isAutoGenerated(message.Header),
+	}, nil
+}
+
+// isAutoGenerated reports whether the headers mark the
+// message as generated automatically, e.g. by an out of
+// office assistant or a mailing list (RFC 3834).
+func isAutoGenerated(messageHeader mail.Header) bool {
+	autoSubmitted := strings.ToLower(strings.TrimSpace(messageHeader.Get("Auto-Submitted")))
+	if autoSubmitted != "" && autoSubmitted != "no" {
+		return true
+	}
+
+	switch strings.ToLower(strings.TrimSpace(messageHeader.Get("Precedence"))) {
+	case "bulk", "junk", "list", "auto_reply":
+		return true
+	}
+
+	return messageHeader.Get("X-Autoreply") != "" || messageHeader.Get("X-Autorespond") != ""
+}
+
+// messageIDRegex matches a single Message-ID in angle
+// brackets.
+var messageIDRegex = regexp.MustCompile(`<[^<>\s]+>`)
+
+// firstMessageID returns the first Message-ID in the
+// header value or an empty string if there is none.
+func firstMessageID(value string) string {
+	return messageIDRegex.FindString(value)
+}
+
+// references collects the Message-IDs of the In-Reply-To
+// and References headers. The References header lists the
+// oldest mail first, so it is reversed to try the most
+// recent mails first.
+func references(messageHeader mail.Header) []string {
+	ids := messageIDRegex.FindAllString(messageHeader.Get("In-Reply-To"), -1)
+
+	referenced := messageIDRegex.FindAllString(messageHeader.Get("References"), -1)
+	for index := len(referenced) - 1; index >= 0; index-- {
+		ids = append(ids, referenced[index])
+	}
+
+	return ids
+}
+
+// decodeHeader decodes the encoded words in the header
+// value. The value is returned unchanged if it cannot be
+// decoded.
+func decodeHeader(value string) string {
+	decoded, decodeErr := headerDecoder.DecodeHeader(value)
+	if decodeErr != nil {
+		return value
+	}
+
+	return decoded
+}
+
+// walk inspects a part with the given header and body.
+// Multipart bodies are walked recursively, the first
+// text/plain and text/html parts become the text of the
+// message and every other part becomes a file.
+func (body *messageBody) walk(partHeader header, partBody io.Reader, depth int) error {
+	if depth > maxPartDepth {
+		return errors.New("multipart body is nested too deeply")
+	}
+
+	mediaType, params := "text/plain", map[string]string{}
+	if contentType := partHeader.Get("Content-Type"); contentType != "" {
+		var parseErr error
+		if mediaType, params, parseErr = mime.ParseMediaType(contentType); parseErr != nil {
+			// Treat parts with invalid content types as binary data
+			mediaType, params = "application/octet-stream", map[string]string{}
+		}
+	}
+
+	if strings.HasPrefix(mediaType, "multipart/") {
+		parts := multipart.NewReader(partBody, params["boundary"])
+		for {
+			part, partErr := parts.NextPart()
+			if partErr == io.EOF {
+				return nil
+			}
+			if partErr != nil {
+				return errors.Wrap(partErr, "invalid multipart body")
+			}
+
+			if walkErr := body.walk(part.Header, part, depth+1); walkErr != nil {
+				return walkErr
+			}
+		}
+	}
+
+	data, readErr := ioutil.ReadAll(decodeTransferEncoding(partHeader.Get("Content-Transfer-Encoding"), partBody))
+	if readErr != nil {
+		return errors.Wrap(readErr, "unable to decode message body")
+	}
+
+	disposition, dispositionParams, _ := mime.ParseMediaType(partHeader.Get("Content-Disposition"))
+	name := fileName(dispositionParams["filename"], params["name"])
+	isAttachment := disposition == "attachment" || (name != "" && !strings.HasPrefix(mediaType, "text/"))
+
+	if !isAttachment && (mediaType == "text/plain" || mediaType == "text/html") {
+		text, decodeErr := decodeCharset(params["charset"], data)
+		if decodeErr != nil {
+			// Keep the text readable as far as possible
+			text, _ = decodeCharset("utf-8", data)
+		}
+
+		if mediaType == "text/plain" && body.plain == "" {
+			body.plain = text
+			return nil
+		}
+		if mediaType == "text/html" && body.html == "" {
+			body.html = text
+			return nil
+		}
+	}
+
+	if len(data) == 0 {
+		return nil
+	}
+
+	if name == "" {
+		name = fmt.Sprintf("attachment-%d%s", len(body.files)+1, extension(mediaType))
+	}
+
+	body.files = append(body.files, File{Name: name, ContentType: mediaType, Data: data})
+	return nil
+}
+
+// fileName returns the decoded base name of the first non
+// empty of the given file names.
+func fileName(names ...string) string {
+	for _, name := range names {
+		name = strings.TrimSpace(decodeHeader(name))
+		if name == "" {
+			continue
+		}
+
+		name = path.Base(strings.Replace(name, `\`, "/", -1))
+		if name != "." && name != "/" {
+			return name
+		}
+	}
+
+	return ""
+}
+
+// extension returns a file extension for the media type
+// of an attachment without name.
+func extension(mediaType string) string {
+	if mediaType == "message/rfc822" {
+		return ".eml"
+	}
+
+	if extensions, _ := mime.ExtensionsByType(mediaType); len(extensions) > 0 {
+		return extensions[0]
+	}
+
+	return ".bin"
+}
+
+// decodeTransferEncoding wraps the body in a reader decoding
+// the quoted-printable or base64 transfer encoding.
+func decodeTransferEncoding(transferEncoding string, body io.Reader) io.Reader {
+	switch strings.ToLower(strings.TrimSpace(transferEncoding)) {
+	case "quoted-printable":
+		return quotedprintable.NewReader(body)
+	case "base64":
+		return base64.NewDecoder(base64.StdEncoding, body)
+	default:
+		return body
+	}
+}
+
+// Regular expressions used to convert HTML to text.
+var (
+	// invisibleRegex matches elements whose content is
+	// not displayed.
+	invisibleRegex = regexp.MustCompile(`(?is)<(script|style|head|title)\b.*?</(script|style|head|title)\s*>`)
+
+	// lineBreakRegex matches elements which end a line.
+	lineBreakRegex = regexp.MustCompile(`(?i)<br\s*/?>|</(p|div|li|tr|h[1-6]|blockquote|pre|table)\s*>`)
+
+	// listItemRegex matches the start of list items.
+	listItemRegex = regexp.MustCompile(`(?i)<li\b[^>]*>`)
+
+	// tagRegex matches all remaining tags and comments.
+	tagRegex = regexp.MustCompile(`(?s)<!--.*?-->|<[^>]*>`)
+
+	// blankLinesRegex matches more than one empty line.
+	blankLinesRegex = regexp.MustCompile(`\n{3,}`)
+)
+
+// htmlToText converts an HTML body to plain text by
+// removing the tags while keeping the line breaks of
+// paragraphs and list items.
+func htmlToText(htmlBody string) string {
+	text := invisibleRegex.ReplaceAllString(htmlBody, "")
+	text = strings.NewReplacer("\r\n", " ", "\n", " ", "\r", " ").Replace(text)
+	text = listItemRegex.ReplaceAllString(text, "- ")
+	text = lineBreakRegex.ReplaceAllString(text, "\n")
+	text = tagRegex.ReplaceAllString(text, "")
+	text = html.UnescapeString(text)
+
+	lines := strings.Split(text, "\n")
+	for index, line := range lines {
+		lines[index] = strings.Join(strings.Fields(line), " ")
+	}
+
+	return strings.TrimSpace(blankLinesRegex.ReplaceAllString(strings.Join(lines, "\n"), "\n\n"))
+}
@@ -0,0 +1,196 @@
+// Trivial Tickets Ticketsystem
+// Copyright (C) 2019 The Contributors
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+// Package api_in implements a web interface for incoming mails
+// to create new tickets or answers
+package api_in
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mortenterhart/trivial-tickets/log/testlog"
+)
+
+/*
+ * Ticketsystem Trivial Tickets
+ *
+ * Matriculation numbers: 3040018, 6694964, 3478222
+ * Lecture:               Programmieren II, INF16B
+ * Lecturer:              Herr Prof. Dr. Helmut Neemann
+ * Institute:             Duale Hochschule Baden-Württemberg Mosbach
+ *
+ * ---------------
+ *
+ * Package api_in [tests]
+ * Parsing of raw RFC 5322 messages
+ */
+
+// crlf converts the line endings of a test message
+// to CRLF.
+func crlf(message string) string {
+	return strings.Replace(message, "\n", "\r\n", -1)
+}
+
+func TestParseMessage(t *testing.T) {
+	testlog.BeginTest()
+	defer testlog.EndTest()
+
+	t.Run("plain", func(t *testing.T) {
+		message, err := ParseMessage(strings.NewReader(crlf("From: Max Mustermann <max@example.com>\n" +
+			"To: support@trivial-tickets.com\n" +
+			"Subject: Printer is broken\n" +
+			"\n" +
+			"The printer does not print.\n")))
+
+		assert.NoError(t, err)
+		assert.Equal(t, "max@example.com", message.Mail.From)
+		assert.Equal(t, "Printer is broken", message.Mail.Subject)
+		assert.Equal(t, "The printer does not print.", message.Mail.Message)
+	})
+
+	t.Run("encoded", func(t *testing.T) {
+		message, err := ParseMessage(strings.NewReader(crlf("From: max@example.com\n" +
+			"Subject: =?utf-8?q?Drucker_l=C3=A4uft_nicht?=\n" +
+			"Content-Type: text/plain; charset=utf-8\n" +
+			"Content-Transfer-Encoding: quoted-printable\n" +
+			"\n" +
+			"Der Drucker l=C3=A4uft nicht.\n")))
+
+		assert.NoError(t, err)
+		assert.Equal(t, "Drucker läuft nicht", message.Mail.Subject)
+		assert.Equal(t, "Der Drucker läuft nicht.", message.Mail.Message)
+	})
+
+	t.Run("multipart", func(t *testing.T) {
+		message, err := ParseMessage(strings.NewReader(crlf("From: max@example.com\n" +
+			"Subject: Printer\n" +
+			"MIME-Version: 1.0\n" +
+			"Content-Type: multipart/alternative; boundary=\"frontier\"\n" +
+			"\n" +
+			"--frontier\n" +
+			"Content-Type: text/html\n" +
+			"\n" +
+			"<p>HTML text</p>\n" +
+			"--frontier\n" +
+			"Content-Type: text/plain\n" +
+			"Content-Transfer-Encoding: base64\n" +
+			"\n" +
+			"UGxhaW4gdGV4dA==\n" +
+			"--frontier--\n")))
+
+		assert.NoError(t, err)
+		assert.Equal(t, "Plain text", message.Mail.Message)
+	})
+
+	t.Run("htmlOnly", func(t *testing.T) {
+		message, err := ParseMessage(strings.NewReader(crlf("From: max@example.com\n" +
+			"Subject: Printer\n" +
+			"Content-Type: text/html; charset=iso-8859-1\n" +
+			"\n" +
+			"<html><head><style>p {}</style></head><body><p>Gr\xfc&szlig;e</p><ul><li>One</li></ul></body></html>\n")))
+
+		assert.NoError(t, err)
+		assert.Equal(t, "Grüße\n- One", message.Mail.Message)
+	})
+
+	t.Run("attachments", func(t *testing.T) {
+		message, err := ParseMessage(strings.NewReader(crlf("From: max@example.com\n" +
+			"Subject: Printer\n" +
+			"Content-Type: multipart/mixed; boundary=\"outer\"\n" +
+			"\n" +
+			"--outer\n" +
+			"Content-Type: multipart/alternative; boundary=\"inner\"\n" +
+			"\n" +
+			"--inner\n" +
+			"Content-Type: text/plain\n" +
+			"\n" +
+			"See attachments.\n" +
+			"--inner--\n" +
+			"--outer\n" +
+			"Content-Type: text/plain\n" +
+			"Content-Disposition: attachment; filename=\"../log.txt\"\n" +
+			"\n" +
+			"error log\n" +
+			"--outer\n" +
+			"Content-Type: application/pdf\n" +
+			"Content-Transfer-Encoding: base64\n" +
+			"\n" +
+			"JVBERi0=\n" +
+			"--outer--\n")))
+
+		assert.NoError(t, err)
+		assert.Equal(t, "See attachments.", message.Mail.Message)
+		if assert.Len(t, message.Files, 2) {
+			assert.Equal(t, "log.txt", message.Files[0].Name)
+			assert.Equal(t, "error log", string(message.Files[0].Data))
+			assert.Equal(t, "attachment-2.pdf", message.Files[1].Name)
+			assert.Equal(t, "application/pdf", message.Files[1].ContentType)
+			assert.Equal(t, "%PDF-", string(message.Files[1].Data))
+		}
+	})
+
+	t.Run("threading", func(t *testing.T) {
+		message, err := ParseMessage(strings.NewReader(crlf("From: max@example.com\n" +
+			"Subject: Re: Printer\n" +
+			"Message-ID: <third@example.com>\n" +
+			"In-Reply-To: <second@example.com>\n" +
+			"References: <first@example.com>\n" +
+			" <second@example.com>\n" +
+			"\n" +
+			"Text\n")))
+
+		assert.NoError(t, err)
+		assert.Equal(t, "<third@example.com>", message.MessageID)
+		assert.Equal(t, []string{"<second@example.com>", "<second@example.com>", "<first@example.com>"},
+			message.References, "references should be ordered from the most recent mail")
+	})
+
+	t.Run("autoGenerated", func(t *testing.T) {
+		headers := map[string]bool{
+			"Auto-Submitted: auto-replied": true,
+			"Auto-Submitted: no":           false,
+			"Precedence: bulk":             true,
+			"Precedence: first-class":      false,
+			"X-Autoreply: yes":             true,
+		}
+
+		for header, expected := range headers {
+			message, err := ParseMessage(strings.NewReader(crlf("From: max@example.com\n" +
+				header + "\n" +
+				"Subject: Out of office\n" +
+				"\n" +
+				"Text\n")))
+
+			assert.NoError(t, err)
+			assert.Equal(t, expected, message.AutoGenerated, header)
+		}
+	})
+
+	t.Run("missingFrom", func(t *testing.T) {
+		_, err := ParseMessage(strings.NewReader(crlf("Subject: Printer\n\nText\n")))
+
+		assert.Error(t, err)
+	})
+
+	t.Run("noHeaders", func(t *testing.T) {
+		_, err := ParseMessage(strings.NewReader("no message at all"))
+
+		assert.Error(t, err)
+	})
+}
@@ -0,0 +1,119 @@
+// Trivial Tickets Ticketsystem
+// Copyright (C) 2019 The Contributors
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+// Package api_in implements a web interface for incoming mails
+// to create new tickets or answers
+package api_in
+
+import (
+	"regexp"
+	"strings"
+)
+
+/*
+ * Ticketsystem Trivial Tickets
+ *
+ * Matriculation numbers: 3040018, 6694964, 3478222
+ * Lecture:               Programmieren II, INF16B
+ * Lecturer:              Herr Prof. Dr. Helmut Neemann
+ * Institute:             Duale Hochschule Baden-Württemberg Mosbach
+ *
+ * ---------------
+ *
+ * Package api_in
+ * Removal of quoted history and signatures from replies
+ */
+
+// maxValedictionLines is the number of non-empty lines
+// which may follow a valediction such as "Best regards"
+// for it to be treated as the start of the signature.
+const maxValedictionLines int = 5
+
+// Regular expressions used to find the end of the reply.
+var (
+	// quoteHeaderRegex matches the attribution line of a
+	// quoted mail in English and German, which may be wrapped
+	// onto a second line, e.g. "On Mon, 1 Jan 2019, Max
+	// <max@example.com> wrote:" or "Am 01.01.2019 schrieb
+	// Max <max@example.com>:".
+	quoteHeaderRegex = regexp.MustCompile(`(?m)^[ \t]*(?:On|Am)[ \t][^\n]*(?:\n[^\n]*)?\b(?:wrote|schrieb)\b[^\n]*:[ \t]*$`)
+
+	// separatorRegex matches the separators which Outlook
+	// and other clients place above the quoted mail.
+	separatorRegex = regexp.MustCompile(`(?mi)^[ \t]*(?:-{3,}[ \t]*(?:Original Message|Ursprüngliche Nachricht|Forwarded message|Weitergeleitete Nachricht)[ \t]*-{3,}|_{20,})[ \t]*$`)
+
+	// outlookHeaderRegex matches the header block Outlook
+	// writes above the quoted mail without separator.
+	outlookHeaderRegex = regexp.MustCompile(`(?mi)^[ \t]*\*?(?:From|Von):\*?[ \t].*\n[ \t]*\*?(?:Sent|Date|Gesendet|Datum):\*?[ \t]`)
+
+	// signatureRegex matches the signature delimiter and
+	// the signatures added by mobile mail clients.
+	signatureRegex = regexp.MustCompile(`(?mi)^(?:-- ?|Sent from my [^\n]+|Von meinem [^\n]+ gesendet|Get Outlook for [^\n]+)[ \t]*$`)
+
+	// valedictionRegex matches common closing lines which
+	// are followed by the name and signature of the sender.
+	valedictionRegex = regexp.MustCompile(`(?mi)^[ \t]*(?:best regards|kind regards|regards|best wishes|cheers|mit freundlichen grüßen|freundliche grüße|viele grüße|beste grüße|liebe grüße|mfg)[,.!]?[ \t]*$`)
+)
+
+// stripReply removes the quoted history and the signature
+// from the text of a reply. Everything after the first
+// attribution line, separator or signature is cut off and
+// the remaining quoted lines starting with ">" are removed.
+// The text is returned unchanged if nothing would remain.
+func stripReply(text string) string {
+	text = strings.Replace(text, "\r\n", "\n", -1)
+	reply := text
+
+	for _, marker := range []*regexp.Regexp{quoteHeaderRegex, separatorRegex, outlookHeaderRegex, signatureRegex} {
+		if location := marker.FindStringIndex(reply); location != nil {
+			reply = reply[:location[0]]
+		}
+	}
+
+	for _, location := range valedictionRegex.FindAllStringIndex(reply, -1) {
+		if countNonEmptyLines(reply[location[1]:]) <= maxValedictionLines {
+			reply = reply[:location[0]]
+			break
+		}
+	}
+
+	var lines []string
+	for _, line := range strings.Split(reply, "\n") {
+		if !strings.HasPrefix(strings.TrimSpace(line), ">") {
+			lines = append(lines, line)
+		}
+	}
+
+	reply = strings.TrimSpace(strings.Join(lines, "\n"))
+	if reply == "" {
+		return strings.TrimSpace(text)
+	}
+
+	return reply
+}
+
+// countNonEmptyLines counts the lines of the text which
+// contain more than white space.
+func countNonEmptyLines(text string) int {
+	count := 0
+	for _, line := range strings.Split(text, "\n") {
+		if strings.TrimSpace(line) != "" {
+			count++
+		}
+	}
+
+	return count
+}
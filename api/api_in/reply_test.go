@@ -0,0 +1,120 @@
+// Trivial Tickets Ticketsystem
+// Copyright (C) 2019 The Contributors
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+// Package api_in implements a web interface for incoming mails
+// to create new tickets or answers
+package api_in
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mortenterhart/trivial-tickets/log/testlog"
+)
+
+/*
+ * Ticketsystem Trivial Tickets
+ *
+ * Matriculation numbers: 3040018, 6694964, 3478222
+ * Lecture:               Programmieren II, INF16B
+ * Lecturer:              Herr Prof. Dr. Helmut Neemann
+ * Institute:             Duale Hochschule Baden-Württemberg Mosbach
+ *
+ * ---------------
+ *
+ * Package api_in [tests]
+ * Removal of quoted history and signatures from replies
+ */
+
+func TestStripReply(t *testing.T) {
+	testlog.BeginTest()
+	defer testlog.EndTest()
+
+	tests := []struct {
+		name     string
+		text     string
+		expected string
+	}{
+		{
+			name:     "plain",
+			text:     "The printer works again.\n\nThank you!",
+			expected: "The printer works again.\n\nThank you!",
+		},
+		{
+			name: "onWrote",
+			text: "It works now.\r\n\r\nOn Mon, 7 Jan 2019 at 10:00, Trivial Tickets\r\n" +
+				"<no-reply@trivial-tickets.com> wrote:\r\n> Please restart the printer.\r\n",
+			expected: "It works now.",
+		},
+		{
+			name:     "amSchrieb",
+			text:     "Es funktioniert.\n\nAm 07.01.2019 um 10:00 schrieb Support <support@example.com>:\n> Bitte neu starten.",
+			expected: "Es funktioniert.",
+		},
+		{
+			name:     "quotedLines",
+			text:     "> Did you restart it?\nYes, twice.\n> Which model?\nModel X",
+			expected: "Yes, twice.\nModel X",
+		},
+		{
+			name:     "outlookSeparator",
+			text:     "Still broken.\n\n-----Original Message-----\nFrom: Support\nSubject: Printer",
+			expected: "Still broken.",
+		},
+		{
+			name:     "outlookHeader",
+			text:     "Still broken.\n________________________________\nVon: Support\nGesendet: Montag",
+			expected: "Still broken.",
+		},
+		{
+			name:     "outlookHeaderWithoutSeparator",
+			text:     "Still broken.\n\nFrom: Support <support@example.com>\nSent: Monday, January 7, 2019",
+			expected: "Still broken.",
+		},
+		{
+			name:     "signatureDelimiter",
+			text:     "Still broken.\n-- \nMax Mustermann\nExample Inc.",
+			expected: "Still broken.",
+		},
+		{
+			name:     "mobileSignature",
+			text:     "Still broken.\n\nSent from my iPhone",
+			expected: "Still broken.",
+		},
+		{
+			name:     "valediction",
+			text:     "Still broken.\n\nMit freundlichen Grüßen\nMax Mustermann\nExample GmbH",
+			expected: "Still broken.",
+		},
+		{
+			name:     "valedictionInText",
+			text:     "Regards\n1\n2\n3\n4\n5\n6",
+			expected: "Regards\n1\n2\n3\n4\n5\n6",
+		},
+		{
+			name:     "onlyQuote",
+			text:     "> Please restart the printer.",
+			expected: "> Please restart the printer.",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assert.Equal(t, test.expected, stripReply(test.text))
+		})
+	}
+}
@@ -22,10 +22,13 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"time"
 
 	"github.com/mortenterhart/trivial-tickets/globals"
 	"github.com/mortenterhart/trivial-tickets/log"
 	"github.com/mortenterhart/trivial-tickets/mail_events"
+	"github.com/mortenterhart/trivial-tickets/mail_guard"
+	"github.com/mortenterhart/trivial-tickets/mail_mime"
 	"github.com/mortenterhart/trivial-tickets/structs"
 	"github.com/mortenterhart/trivial-tickets/util/filehandler"
 	"github.com/mortenterhart/trivial-tickets/util/httptools"
@@ -51,17 +54,117 @@ import (
 // json responses
 const jsonContentType string = "application/json; charset=utf-8"
 
+// formatParameter is the optional parameter of the
+// FetchMails handler selecting the response format.
+const formatParameter string = "format"
+
+// Formats of the fetched mails. The MIME format adds
+// the complete MIME message to each mail.
+const (
+	jsonFormat string = "json"
+	mimeFormat string = "mime"
+)
+
+// NoReplyAddress is the sender address of all mails sent
+// by the ticket system.
+const NoReplyAddress string = "no-reply@trivial-tickets.com"
+
 // SendMail takes a mail event and a specified ticket
 // and constructs a new mail which is then saved into
-// its own file. The message of the mail is wrapped
-// inside a mail template depending on the event.
+// its own file. Subject and message of the mail are
+// created from the mail templates of the event. The
+// mail is sent to the customer of the ticket unless
+// the event is meant for the assigned editor. Every
+// mail gets a Message-ID identifying the ticket so that
+// replies can be threaded. No mail is sent to looping
+// addresses.
 func SendMail(mailEvent mail_events.Event, ticket structs.Ticket) {
+	if mailEvent.IsForEditor() {
+		NotifyEditor(mailEvent, ticket, ticket.User)
+		return
+	}
+
+	content, mailErr := mail_events.NewMail(mailEvent, ticket)
+	if mailErr != nil {
+		log.Errorf("unable to create mail to '%s' for %s: %v", ticket.Customer, mailEvent.String(), mailErr)
+		return
+	}
+
+	saveMail(mailEvent, ticket.Customer, ticket.ID, content)
+}
+
+// NotifyEditor sends the mail of an event meant for editors
+// about the ticket to the given user. No mail is sent if the
+// ticket is not assigned to an editor or if the user has
+// turned off the notifications of the event. The current
+// preferences of the user are used since the user of a
+// ticket is a copy made at the assignment.
+func NotifyEditor(mailEvent mail_events.Event, ticket structs.Ticket, user structs.User) {
+	if currentUser, userExists := globals.Users[user.Username]; userExists && currentUser.ID == user.ID {
+		user = currentUser
+	}
+
+	if user.ID == "" || user.Mail == "" {
+		log.Infof("Not sending %s of ticket '%s' because it is not assigned to an editor",
+			mailEvent.String(), ticket.ID)
+		return
+	}
+
+	if mailEvent.IsMutedBy(user) {
+		log.Infof("User '%s' has turned off notifications for %s", user.Username, mailEvent.String())
+		return
+	}
+
+	content, mailErr := mail_events.NewMailTo(mailEvent, ticket, user)
+	if mailErr != nil {
+		log.Errorf("unable to create mail to '%s' for %s: %v", user.Mail, mailEvent.String(), mailErr)
+		return
+	}
+
+	saveMail(mailEvent, user.Mail, ticket.ID, content)
+}
+
+// SendDigest sends the daily digest summarizing the open
+// and overdue tickets to the user unless the user has turned
+// off the digest.
+func SendDigest(user structs.User, tickets []structs.Ticket, overdue []structs.Ticket) {
+	if mail_events.DailyDigest.IsMutedBy(user) {
+		log.Infof("User '%s' has turned off notifications for %s", user.Username, mail_events.DailyDigest.String())
+		return
+	}
+
+	content, mailErr := mail_events.NewDigest(user, tickets, overdue)
+	if mailErr != nil {
+		log.Errorf("unable to create mail to '%s' for %s: %v", user.Mail, mail_events.DailyDigest.String(), mailErr)
+		return
+	}
+
+	saveMail(mail_events.DailyDigest, user.Mail, "", content)
+}
+
+// saveMail caches the mail with the content to the recipient
+// and saves it into its own file. Mails about a ticket get a
+// Message-ID identifying the ticket.
+func saveMail(mailEvent mail_events.Event, recipient string, ticketID string, content mail_events.Content) {
+	if mail_guard.IsLooping(recipient, time.Now()) {
+		log.Warnf("Suppressing notification mail to '%s' for %s because the address is looping",
+			recipient, mailEvent.String())
+		return
+	}
+
+	mailID := random.CreateRandomID(structs.RandomIDLength)
 	newMail := structs.Mail{
-		ID:      random.CreateRandomID(structs.RandomIDLength),
-		From:    "no-reply@trivial-tickets.com",
-		To:      ticket.Customer,
-		Subject: fmt.Sprintf("[trivial-tickets] %s", ticket.Subject),
-		Message: mail_events.NewMailBody(mailEvent, ticket),
+		ID:          mailID,
+		From:        NoReplyAddress,
+		To:          recipient,
+		Subject:     content.Subject,
+		Message:     content.Text,
+		HTMLMessage: content.HTML,
+		TicketID:    ticketID,
+	}
+
+	if ticketID != "" {
+		newMail.MessageID = NewMessageID(mailID, ticketID)
 	}
 
 	log.Infof(`Composing notification mail (id "%s") to '%s' for %s`,
@@ -72,21 +175,27 @@ func SendMail(mailEvent mail_events.Event, ticket structs.Ticket) {
 	log.Info("Saving new mail as", globals.ServerConfig.Mails+"/"+newMail.ID+".json")
 	writeErr := filehandler.WriteMailFile(globals.ServerConfig.Mails, &newMail)
 	if writeErr != nil {
-		log.Errorf("unable to send mail to '%s': %v", ticket.Customer, writeErr)
+		log.Errorf("unable to send mail to '%s': %v", newMail.To, writeErr)
 	}
 }
 
 // FetchMails is an endpoint to the outgoing Mail
 // API and sends all mails which are currently cached
 // and ready to be sent. The response is in JSON format.
+// With the GET parameter "format=mime" each mail also
+// contains its complete MIME message.
 //
-//     Takes: no parameters
+//     Takes: optional parameter "format" ("json" or "mime")
 //     Returns: {
 //         "<mail_id>": {
 //             "from": "",
+//             "htmlMessage": "",
 //             "id": "",
 //             "message": "",
+//             "messageId": "",
+//             "mime": "",
 //             "subject": "",
+//             "ticketId": "",
 //             "to": ""
 //         }
 //     }
@@ -97,6 +206,21 @@ func FetchMails(writer http.ResponseWriter, request *http.Request) {
 
 		mails := globals.Mails
 
+		switch format := request.FormValue(formatParameter); format {
+		case "", jsonFormat:
+
+		case mimeFormat:
+			mails = withMIME(globals.Mails, time.Now())
+
+		default:
+			httptools.JSONError(writer, structs.JSONMap{
+				"status":  http.StatusBadRequest,
+				"message": fmt.Sprintf("unknown format '%s', expecting '%s' or '%s'", format, jsonFormat, mimeFormat),
+			}, http.StatusBadRequest)
+			log.Errorf("%d %s: unknown format '%s'", http.StatusBadRequest, http.StatusText(http.StatusBadRequest), format)
+			return
+		}
+
 		jsonResponse, marshalErr := json.MarshalIndent(&mails, "", "    ")
 		if marshalErr != nil {
 			httptools.StatusCodeError(writer, marshalErr.Error(), http.StatusInternalServerError)
@@ -118,6 +242,18 @@ func FetchMails(writer http.ResponseWriter, request *http.Request) {
 		http.StatusText(http.StatusMethodNotAllowed), request.Method)
 }
 
+// withMIME returns copies of the mails with their MIME
+// message composed at the given date.
+func withMIME(mails map[string]structs.Mail, date time.Time) map[string]structs.Mail {
+	mimeMails := make(map[string]structs.Mail, len(mails))
+	for id, mail := range mails {
+		mail.MIME = string(mail_mime.Compose(mail, date))
+		mimeMails[id] = mail
+	}
+
+	return mimeMails
+}
+
 // idParameter is the required id parameter for the
 // VerifyMailSent handler. It has to be passed as
 // JSON formatted string and requires the string data
@@ -162,7 +298,8 @@ func VerifyMailSent(writer http.ResponseWriter, request *http.Request) {
 		}
 
 		mailID := jsonProperties[idParameter].(string)
-		if _, mailExists := globals.Mails[mailID]; !mailExists {
+		sentMail, mailExists := globals.Mails[mailID]
+		if !mailExists {
 			writer.Header().Set("Content-Type", jsonContentType)
 			httptools.JSONResponse(writer, structs.JSONMap{
 				"verified": false,
@@ -174,6 +311,8 @@ func VerifyMailSent(writer http.ResponseWriter, request *http.Request) {
 			return
 		}
 
+		RecordMessageID(sentMail)
+
 		log.Infof("Removing mail '%s' from global mail storage", mailID)
 		delete(globals.Mails, mailID)
 
@@ -69,6 +69,9 @@ func testServerConfig() structs.ServerConfig {
 		Cert:    defaults.TestCertificate,
 		Key:     defaults.TestKey,
 		Web:     defaults.TestWeb,
+
+		MailTemplates: defaults.TestMailTmpl,
+		MailLanguage:  defaults.ServerMailLang,
 	}
 }
 
@@ -89,6 +92,10 @@ func initializeConfig() {
 
 	logConfig := testLogConfig()
 	globals.LogConfig = &logConfig
+
+	if loadErr := mail_events.LoadTemplates(config.MailTemplates, config.MailLanguage); loadErr != nil {
+		testlog.Debug("ERROR: cannot load mail templates:", loadErr)
+	}
 }
 
 //revive:disable:deep-exit
@@ -182,6 +189,13 @@ func TestSendMail(t *testing.T) {
 		assert.Equal(t, 1, len(globals.Mails), "sent mail should be stored in the global mail storage")
 	})
 
+	t.Run("textAndHTML", func(t *testing.T) {
+		for _, mail := range globals.Mails {
+			assert.Contains(t, mail.Message, testTicket.ID, "mail should contain a plain text message")
+			assert.Contains(t, mail.HTMLMessage, "<html", "mail should contain an HTML message")
+		}
+	})
+
 	// Usually, the t.Run() function should block until the
 	// subtest finished. However, there were issues that the
 	// deferred cleanup function was executed before the
@@ -230,6 +244,96 @@ func TestSendMail(t *testing.T) {
 // * ------------------------------------------- *
 //          Tests for API FetchMails()
 
+func TestSendMailToEditor(t *testing.T) {
+	testlog.BeginTest()
+	defer testlog.EndTest()
+
+	defer cleanupMails()
+
+	testTicket := mockTicket()
+	testTicket.User = structs.User{ID: "1", Name: "Editor", Mail: "editor@example.com"}
+
+	SendMail(mail_events.ReminderTicket, testTicket)
+
+	for _, mail := range globals.Mails {
+		assert.Equal(t, "editor@example.com", mail.To, "reminder should be sent to the editor")
+	}
+	assert.Len(t, globals.Mails, 1, "sent mail should be stored in the global mail storage")
+}
+
+func TestNotifyEditor(t *testing.T) {
+	testlog.BeginTest()
+	defer testlog.EndTest()
+
+	testTicket := mockTicket()
+	mentioned := structs.User{ID: "2", Name: "Max", Username: "max4711", Mail: "max@example.com"}
+
+	t.Run("mention", func(t *testing.T) {
+		defer cleanupMails()
+
+		NotifyEditor(mail_events.Mention, testTicket, mentioned)
+
+		if assert.Len(t, globals.Mails, 1, "mention should be sent") {
+			for _, mail := range globals.Mails {
+				assert.Equal(t, "max@example.com", mail.To, "mention should be sent to the mentioned user")
+				assert.Equal(t, testTicket.ID, mail.TicketID)
+			}
+		}
+	})
+
+	t.Run("muted", func(t *testing.T) {
+		defer cleanupMails()
+
+		mutedUser := mentioned
+		mutedUser.Notifications.MuteMention = true
+
+		NotifyEditor(mail_events.Mention, testTicket, mutedUser)
+
+		assert.Empty(t, globals.Mails, "muted notifications should not be sent")
+	})
+
+	t.Run("unassigned", func(t *testing.T) {
+		defer cleanupMails()
+
+		SendMail(mail_events.CustomerReply, testTicket)
+
+		assert.Empty(t, globals.Mails, "no mail should be sent without editor")
+	})
+}
+
+func TestSendDigest(t *testing.T) {
+	testlog.BeginTest()
+	defer testlog.EndTest()
+
+	editor := structs.User{ID: "1", Name: "Editor", Username: "editor", Mail: "editor@example.com"}
+	tickets := []structs.Ticket{mockTicket()}
+
+	t.Run("digest", func(t *testing.T) {
+		defer cleanupMails()
+
+		SendDigest(editor, tickets, nil)
+
+		if assert.Len(t, globals.Mails, 1, "digest should be sent") {
+			for _, mail := range globals.Mails {
+				assert.Equal(t, "editor@example.com", mail.To, "digest should be sent to the editor")
+				assert.Contains(t, mail.Message, tickets[0].ID, "digest should list the tickets")
+				assert.Empty(t, mail.TicketID, "digest is not about a single ticket")
+			}
+		}
+	})
+
+	t.Run("muted", func(t *testing.T) {
+		defer cleanupMails()
+
+		mutedEditor := editor
+		mutedEditor.Notifications.MuteDigest = true
+
+		SendDigest(mutedEditor, tickets, nil)
+
+		assert.Empty(t, globals.Mails, "muted digest should not be sent")
+	})
+}
+
 func TestFetchMails(t *testing.T) {
 	testlog.BeginTest()
 	defer testlog.EndTest()
@@ -319,6 +423,40 @@ func TestFetchMails(t *testing.T) {
 				assert.Equal(t, append(expectedJSON, '\n'), body, "response should contain JSON representation of mail mapped to its id")
 			})
 		})
+
+		t.Run("mimeFormat", func(t *testing.T) {
+			response, err := http.Get(testServer.URL + "?format=mime")
+			defer func() {
+				if err == nil {
+					response.Body.Close()
+				}
+			}()
+
+			assert.NoError(t, err, "GET request should be successful")
+			assert.Equal(t, http.StatusOK, response.StatusCode, "response status should be 200 OK")
+
+			var mails map[string]structs.Mail
+			assert.NoError(t, json.NewDecoder(response.Body).Decode(&mails), "response should be valid JSON")
+
+			assert.Len(t, mails, len(globals.Mails), "response should contain all mails")
+			for id, mail := range mails {
+				assert.Contains(t, mail.MIME, "Content-Type: multipart/alternative", "mail should be multipart")
+				assert.Contains(t, mail.MIME, "Message-ID: "+globals.Mails[id].MessageID, "MIME message should contain the headers")
+				assert.Empty(t, globals.Mails[id].MIME, "MIME message should not be cached")
+			}
+		})
+
+		t.Run("unknownFormat", func(t *testing.T) {
+			response, err := http.Get(testServer.URL + "?format=xml")
+			defer func() {
+				if err == nil {
+					response.Body.Close()
+				}
+			}()
+
+			assert.NoError(t, err, "GET request should be successful")
+			assert.Equal(t, http.StatusBadRequest, response.StatusCode, "unknown format should be rejected")
+		})
 	})
 }
 
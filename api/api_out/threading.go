@@ -0,0 +1,109 @@
+// Trivial Tickets Ticketsystem
+// Copyright (C) 2019 The Contributors
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+// Package api_out implements a web interface for outgoing mails
+// to be fetched and verified to be sent
+package api_out
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/mortenterhart/trivial-tickets/globals"
+	"github.com/mortenterhart/trivial-tickets/log"
+	"github.com/mortenterhart/trivial-tickets/structs"
+	"github.com/mortenterhart/trivial-tickets/util/filehandler"
+)
+
+/*
+ * Ticketsystem Trivial Tickets
+ *
+ * Matriculation numbers: 3040018, 6694964, 3478222
+ * Lecture:               Programmieren II, INF16B
+ * Lecturer:              Herr Prof. Dr. Helmut Neemann
+ * Institute:             Duale Hochschule Baden-Württemberg Mosbach
+ *
+ * ---------------
+ *
+ * Package api_out
+ * Message-IDs of outgoing mails
+ */
+
+// messageIDDomain is the domain of the Message-IDs of
+// outgoing mails.
+const messageIDDomain string = "trivial-tickets.com"
+
+// NewMessageID creates the Message-ID of an outgoing mail
+// which belongs to the given ticket. The ticket id is part
+// of the Message-ID so that replies referencing the mail
+// can be attached to the ticket even after the mail was
+// sent and deleted.
+func NewMessageID(mailID string, ticketID string) string {
+	return fmt.Sprintf("<%s.%s@%s>", mailID, ticketID, messageIDDomain)
+}
+
+// TicketOfMessageID returns the id of the ticket the
+// Message-ID was sent for. The second return value is
+// false for foreign Message-IDs and for Message-IDs which
+// were never sent about the ticket, since the ticket part
+// of a Message-ID can be guessed.
+func TicketOfMessageID(messageID string) (string, bool) {
+	localPart := strings.TrimSuffix(strings.Trim(strings.TrimSpace(messageID), "<>"), "@"+messageIDDomain)
+	if strings.Contains(localPart, "@") {
+		return "", false
+	}
+
+	parts := strings.Split(localPart, ".")
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return "", false
+	}
+
+	sentTicket, ticketExists := globals.Tickets[parts[1]]
+	if !ticketExists {
+		return "", false
+	}
+
+	ownID := "<" + localPart + "@" + messageIDDomain + ">"
+	for _, sentID := range sentTicket.MessageIDs {
+		if sentID == ownID {
+			return sentTicket.ID, true
+		}
+	}
+
+	return "", false
+}
+
+// RecordMessageID remembers the Message-ID of a sent mail
+// on the ticket the mail was about so that replies to the
+// mail can be threaded.
+func RecordMessageID(mail structs.Mail) {
+	if mail.MessageID == "" || mail.TicketID == "" {
+		return
+	}
+
+	sentTicket, ticketExists := globals.Tickets[mail.TicketID]
+	if !ticketExists {
+		return
+	}
+
+	sentTicket.MessageIDs = append(sentTicket.MessageIDs, mail.MessageID)
+	globals.Tickets[sentTicket.ID] = sentTicket
+
+	if writeErr := filehandler.WriteTicketFile(globals.ServerConfig.Tickets, &sentTicket); writeErr != nil {
+		log.Errorf("unable to record the Message-ID of mail '%s' on ticket '%s': %v",
+			mail.ID, sentTicket.ID, writeErr)
+	}
+}
@@ -0,0 +1,133 @@
+// Trivial Tickets Ticketsystem
+// Copyright (C) 2019 The Contributors
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+// Package api_out implements a web interface for outgoing mails
+// to be fetched and verified to be sent
+package api_out
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mortenterhart/trivial-tickets/globals"
+	"github.com/mortenterhart/trivial-tickets/log/testlog"
+	"github.com/mortenterhart/trivial-tickets/mail_events"
+	"github.com/mortenterhart/trivial-tickets/structs"
+	"github.com/mortenterhart/trivial-tickets/util/filehandler"
+)
+
+/*
+ * Ticketsystem Trivial Tickets
+ *
+ * Matriculation numbers: 3040018, 6694964, 3478222
+ * Lecture:               Programmieren II, INF16B
+ * Lecturer:              Herr Prof. Dr. Helmut Neemann
+ * Institute:             Duale Hochschule Baden-Württemberg Mosbach
+ *
+ * ---------------
+ *
+ * Package api_out [tests]
+ * Message-IDs of outgoing mails
+ */
+
+func TestTicketOfMessageID(t *testing.T) {
+	testlog.BeginTest()
+	defer testlog.EndTest()
+
+	prevTickets := globals.Tickets
+	defer func() {
+		globals.Tickets = prevTickets
+	}()
+
+	globals.Tickets = map[string]structs.Ticket{
+		"ticket456": {ID: "ticket456", MessageIDs: []string{NewMessageID("mail123", "ticket456")}},
+	}
+
+	t.Run("own", func(t *testing.T) {
+		ticketID, isOwn := TicketOfMessageID(NewMessageID("mail123", "ticket456"))
+
+		assert.True(t, isOwn)
+		assert.Equal(t, "ticket456", ticketID)
+	})
+
+	t.Run("notSent", func(t *testing.T) {
+		_, isOwn := TicketOfMessageID(NewMessageID("forged", "ticket456"))
+
+		assert.False(t, isOwn, "Message-IDs which were never sent should not match")
+	})
+
+	t.Run("unknownTicket", func(t *testing.T) {
+		_, isOwn := TicketOfMessageID(NewMessageID("mail123", "deleted"))
+
+		assert.False(t, isOwn)
+	})
+
+	t.Run("foreign", func(t *testing.T) {
+		_, isOwn := TicketOfMessageID("<abc.def@mail.example.com>")
+
+		assert.False(t, isOwn)
+	})
+
+	t.Run("legacy", func(t *testing.T) {
+		_, isOwn := TicketOfMessageID("<mail123@trivial-tickets.com>")
+
+		assert.False(t, isOwn, "Message-IDs without ticket id should not match")
+	})
+}
+
+func TestRecordMessageID(t *testing.T) {
+	testlog.BeginTest()
+	defer testlog.EndTest()
+
+	prevTickets := globals.Tickets
+	defer func() {
+		globals.Tickets = prevTickets
+		os.RemoveAll(globals.ServerConfig.Tickets)
+	}()
+
+	testTicket := mockTicket()
+	globals.Tickets = map[string]structs.Ticket{testTicket.ID: testTicket}
+	messageID := NewMessageID("mail123", testTicket.ID)
+
+	RecordMessageID(structs.Mail{ID: "mail123", TicketID: testTicket.ID, MessageID: messageID})
+	RecordMessageID(structs.Mail{ID: "digest", MessageID: ""})
+
+	assert.Equal(t, []string{messageID}, globals.Tickets[testTicket.ID].MessageIDs)
+
+	saved := make(map[string]structs.Ticket)
+	if assert.NoError(t, filehandler.ReadTicketFiles(globals.ServerConfig.Tickets, &saved)) {
+		assert.Equal(t, []string{messageID}, saved[testTicket.ID].MessageIDs, "Message-ID should be persisted")
+	}
+}
+
+func TestSendMailMessageID(t *testing.T) {
+	testlog.BeginTest()
+	defer testlog.EndTest()
+
+	defer cleanupMails()
+
+	testTicket := mockTicket()
+
+	SendMail(mail_events.NewTicket, testTicket)
+
+	for _, mail := range globals.Mails {
+		assert.Equal(t, NewMessageID(mail.ID, testTicket.ID), mail.MessageID, "mail should get a Message-ID")
+		assert.Equal(t, testTicket.ID, mail.TicketID, "mail should remember its ticket")
+	}
+	assert.Len(t, globals.Mails, 1, "sent mail should be stored in the global mail storage")
+}
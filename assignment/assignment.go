@@ -0,0 +1,321 @@
+// Trivial Tickets Ticketsystem
+// Copyright (C) 2019 The Contributors
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+// Package assignment distributes new tickets automatically
+// across the editors according to a configured strategy.
+package assignment
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/mortenterhart/trivial-tickets/globals"
+	"github.com/mortenterhart/trivial-tickets/structs"
+	"github.com/mortenterhart/trivial-tickets/ticket"
+)
+
+/*
+ * Ticketsystem Trivial Tickets
+ *
+ * Matriculation numbers: 3040018, 6694964, 3478222
+ * Lecture:               Programmieren II, INF16B
+ * Lecturer:              Herr Prof. Dr. Helmut Neemann
+ * Institute:             Duale Hochschule Baden-Württemberg Mosbach
+ *
+ * ---------------
+ *
+ * Package assignment
+ * Automatic assignment of tickets to editors
+ */
+
+// PermissionError is returned if a user is not allowed to
+// make an assignment.
+type PermissionError struct {
+	message string
+}
+
+// Error returns the reason why the assignment is denied.
+func (err PermissionError) Error() string {
+	return err.message
+}
+
+// ConflictError is returned if the ticket or the editor
+// cannot be assigned in their current state.
+type ConflictError struct {
+	message string
+}
+
+// Error returns the reason why the assignment is not
+// possible.
+func (err ConflictError) Error() string {
+	return err.message
+}
+
+// CheckAssignment checks whether the actor may assign the
+// ticket to the editor. Agents may only take open tickets
+// themselves, whereas supervisors may assign and reassign
+// tickets to every editor. Closed and merged tickets cannot
+// be assigned, neither can editors on holiday. The returned
+// error is either a PermissionError or a ConflictError.
+func CheckAssignment(actor, editor structs.User, currentTicket structs.Ticket) error {
+	if !actor.IsSupervisor() {
+		if editor.ID != actor.ID {
+			return PermissionError{fmt.Sprintf("user '%s' may only assign tickets to themselves", actor.Username)}
+		}
+
+		if currentTicket.User.ID != "" && currentTicket.User.ID != actor.ID {
+			return PermissionError{fmt.Sprintf("ticket '%s' is already assigned to user '%s'",
+				currentTicket.ID, currentTicket.User.Username)}
+		}
+	}
+
+	switch {
+	case currentTicket.MergeTo != "":
+		return ConflictError{fmt.Sprintf("ticket '%s' has been merged into ticket '%s'", currentTicket.ID, currentTicket.MergeTo)}
+
+	case currentTicket.Status == structs.StatusClosed:
+		return ConflictError{fmt.Sprintf("ticket '%s' is closed", currentTicket.ID)}
+
+	case editor.IsOnHoliday:
+		return ConflictError{fmt.Sprintf("user '%s' is on holiday", editor.Username)}
+	}
+
+	return nil
+}
+
+// lastAssigned is the username of the editor who
+// received the latest ticket using the round-robin
+// strategy.
+var lastAssigned string
+
+// AutoAssign selects an editor for the given ticket using
+// the assignment strategy of the server configuration.
+// Editors who are on holiday are never selected. If an
+// editor is found, the ticket is assigned to them and
+// returned along with true. Otherwise the ticket is
+// returned unchanged along with false.
+func AutoAssign(currentTicket structs.Ticket) (structs.Ticket, bool) {
+	if globals.ServerConfig == nil {
+		return currentTicket, false
+	}
+
+	editor, found := SelectEditor(globals.ServerConfig.AssignStrategy, currentTicket,
+		globals.Users, globals.Tickets)
+	if !found {
+		return currentTicket, false
+	}
+
+	return ticket.AssignTicket(editor, currentTicket), true
+}
+
+// SelectEditor returns the editor the given ticket should be
+// assigned to according to the strategy. Only users who are not
+// on holiday are considered. The second return value is false
+// if the strategy is AssignNone or no editor is available.
+func SelectEditor(strategy structs.AssignStrategy, currentTicket structs.Ticket,
+	users map[string]structs.User, tickets map[string]structs.Ticket) (structs.User, bool) {
+
+	candidates := EligibleEditors(users)
+	if len(candidates) == 0 {
+		return structs.User{}, false
+	}
+
+	switch strategy {
+	case structs.AssignRoundRobin:
+		return selectRoundRobin(candidates), true
+
+	case structs.AssignLeastOpen:
+		return selectLeastOpen(candidates, tickets), true
+
+	case structs.AssignSkills:
+		return selectBySkills(candidates, currentTicket, tickets), true
+	}
+
+	return structs.User{}, false
+}
+
+// EligibleEditors returns all users who are not on holiday
+// sorted by their username so that the selection is
+// deterministic.
+func EligibleEditors(users map[string]structs.User) []structs.User {
+	var candidates []structs.User
+	for _, user := range users {
+		if !user.IsOnHoliday {
+			candidates = append(candidates, user)
+		}
+	}
+
+	sort.Slice(candidates, func(i, j int) bool {
+		return candidates[i].Username < candidates[j].Username
+	})
+
+	return candidates
+}
+
+// selectRoundRobin returns the editor following the one who
+// received the latest ticket. If that editor is no longer a
+// candidate, the first candidate in line is chosen.
+func selectRoundRobin(candidates []structs.User) structs.User {
+	next := candidates[0]
+	for _, candidate := range candidates {
+		if candidate.Username > lastAssigned {
+			next = candidate
+			break
+		}
+	}
+
+	lastAssigned = next.Username
+	return next
+}
+
+// selectLeastOpen returns the editor with the fewest tickets
+// in progress. On a tie the first candidate in line wins.
+func selectLeastOpen(candidates []structs.User, tickets map[string]structs.Ticket) structs.User {
+	openTickets := countOpenTickets(tickets)
+
+	selected := candidates[0]
+	for _, candidate := range candidates[1:] {
+		if openTickets[candidate.ID] < openTickets[selected.ID] {
+			selected = candidate
+		}
+	}
+
+	return selected
+}
+
+// selectBySkills returns the editor with the most skills
+// matching the ticket's tags or words in its subject. If
+// several editors match equally well, the one with the
+// fewest tickets in progress is chosen. Without any match
+// the strategy falls back to the least open tickets.
+func selectBySkills(candidates []structs.User, currentTicket structs.Ticket,
+	tickets map[string]structs.Ticket) structs.User {
+
+	bestScore := 0
+	var bestCandidates []structs.User
+	for _, candidate := range candidates {
+		score := skillScore(candidate, currentTicket)
+		if score > bestScore {
+			bestScore = score
+			bestCandidates = []structs.User{candidate}
+		} else if score == bestScore && score > 0 {
+			bestCandidates = append(bestCandidates, candidate)
+		}
+	}
+
+	if len(bestCandidates) == 0 {
+		return selectLeastOpen(candidates, tickets)
+	}
+
+	return selectLeastOpen(bestCandidates, tickets)
+}
+
+// skillScore counts how many skills of the user occur as
+// tag or as word in the subject of the ticket. The comparison
+// is case-insensitive.
+func skillScore(user structs.User, currentTicket structs.Ticket) int {
+	keywords := make(map[string]bool)
+	for _, tag := range currentTicket.Tags {
+		keywords[strings.ToLower(tag)] = true
+	}
+
+	for _, word := range strings.FieldsFunc(currentTicket.Subject, isSeparator) {
+		keywords[strings.ToLower(word)] = true
+	}
+
+	score := 0
+	for _, skill := range user.Skills {
+		if keywords[strings.ToLower(skill)] {
+			score++
+		}
+	}
+
+	return score
+}
+
+// isSeparator reports whether the rune separates two words
+// inside a subject.
+func isSeparator(r rune) bool {
+	return !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '-' && r != '_'
+}
+
+// countOpenTickets maps the user ids to the number of tickets
+// which are assigned to them and currently in progress.
+func countOpenTickets(tickets map[string]structs.Ticket) map[string]int {
+	openTickets := make(map[string]int)
+	for _, t := range tickets {
+		if t.Status == structs.StatusInProgress && t.User.ID != "" {
+			openTickets[t.User.ID]++
+		}
+	}
+
+	return openTickets
+}
+
+// RedistributeTickets hands over the tickets in progress of
+// the given editor according to the holiday policy. With
+// HolidayRelease the tickets are returned to the queue of
+// open tickets, with HolidayReassign they are assigned to
+// other editors using the configured assignment strategy.
+// If the strategy finds no other editor, the ticket is
+// released instead. The changed tickets are returned and
+// have to be stored by the caller.
+func RedistributeTickets(editor structs.User, policy structs.HolidayPolicy, strategy structs.AssignStrategy,
+	users map[string]structs.User, tickets map[string]structs.Ticket) []structs.Ticket {
+
+	if policy != structs.HolidayRelease && policy != structs.HolidayReassign {
+		return nil
+	}
+
+	// Work on a copy of the tickets so that the number of
+	// open tickets is updated with every reassignment
+	workingTickets := make(map[string]structs.Ticket)
+	var editorTicketIDs []string
+	for id, t := range tickets {
+		workingTickets[id] = t
+		if t.User.ID == editor.ID && t.Status == structs.StatusInProgress {
+			editorTicketIDs = append(editorTicketIDs, id)
+		}
+	}
+	sort.Strings(editorTicketIDs)
+
+	// Never select the editor going on holiday, even if
+	// the users map has not been updated yet
+	otherUsers := make(map[string]structs.User)
+	for username, user := range users {
+		if user.ID != editor.ID {
+			otherUsers[username] = user
+		}
+	}
+
+	var changedTickets []structs.Ticket
+	for _, id := range editorTicketIDs {
+		changedTicket := ticket.UnassignTicket(workingTickets[id])
+
+		if policy == structs.HolidayReassign {
+			if newEditor, found := SelectEditor(strategy, changedTicket, otherUsers, workingTickets); found {
+				changedTicket = ticket.AssignTicket(newEditor, changedTicket)
+			}
+		}
+
+		workingTickets[id] = changedTicket
+		changedTickets = append(changedTickets, changedTicket)
+	}
+
+	return changedTickets
+}
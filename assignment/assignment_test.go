@@ -0,0 +1,276 @@
+// Trivial Tickets Ticketsystem
+// Copyright (C) 2019 The Contributors
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+// Package assignment distributes new tickets automatically
+// across the editors according to a configured strategy.
+package assignment
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mortenterhart/trivial-tickets/globals"
+	"github.com/mortenterhart/trivial-tickets/log/testlog"
+	"github.com/mortenterhart/trivial-tickets/structs"
+)
+
+/*
+ * Ticketsystem Trivial Tickets
+ *
+ * Matriculation numbers: 3040018, 6694964, 3478222
+ * Lecture:               Programmieren II, INF16B
+ * Lecturer:              Herr Prof. Dr. Helmut Neemann
+ * Institute:             Duale Hochschule Baden-Württemberg Mosbach
+ *
+ * ---------------
+ *
+ * Package assignment
+ * Automatic assignment of tickets to editors
+ */
+
+// mockUsers returns three test editors of which
+// the editor "charlie" is on holiday.
+func mockUsers() map[string]structs.User {
+	return map[string]structs.User{
+		"alice": {
+			ID:       "1",
+			Name:     "Alice",
+			Username: "alice",
+			Skills:   []string{"printer", "network"},
+		},
+		"bob": {
+			ID:       "2",
+			Name:     "Bob",
+			Username: "bob",
+			Skills:   []string{"billing"},
+		},
+		"charlie": {
+			ID:          "3",
+			Name:        "Charlie",
+			Username:    "charlie",
+			IsOnHoliday: true,
+			Skills:      []string{"billing", "invoice"},
+		},
+	}
+}
+
+// mockTickets returns tickets in progress of which
+// two are assigned to alice and none to bob.
+func mockTickets(users map[string]structs.User) map[string]structs.Ticket {
+	return map[string]structs.Ticket{
+		"t1": {ID: "t1", Status: structs.StatusInProgress, User: users["alice"]},
+		"t2": {ID: "t2", Status: structs.StatusInProgress, User: users["alice"]},
+		"t3": {ID: "t3", Status: structs.StatusClosed, User: users["bob"]},
+	}
+}
+
+func TestEligibleEditors(t *testing.T) {
+	testlog.BeginTest()
+	defer testlog.EndTest()
+
+	candidates := EligibleEditors(mockUsers())
+
+	assert.Len(t, candidates, 2, "users on holiday should not be eligible")
+	assert.Equal(t, "alice", candidates[0].Username, "candidates should be sorted by username")
+	assert.Equal(t, "bob", candidates[1].Username, "candidates should be sorted by username")
+}
+
+func TestSelectEditor(t *testing.T) {
+	testlog.BeginTest()
+	defer testlog.EndTest()
+
+	users := mockUsers()
+	tickets := mockTickets(users)
+
+	t.Run("none", func(t *testing.T) {
+		_, found := SelectEditor(structs.AssignNone, structs.Ticket{}, users, tickets)
+
+		assert.False(t, found, "no editor should be selected without a strategy")
+	})
+
+	t.Run("roundRobin", func(t *testing.T) {
+		lastAssigned = ""
+
+		first, _ := SelectEditor(structs.AssignRoundRobin, structs.Ticket{}, users, tickets)
+		second, _ := SelectEditor(structs.AssignRoundRobin, structs.Ticket{}, users, tickets)
+		third, _ := SelectEditor(structs.AssignRoundRobin, structs.Ticket{}, users, tickets)
+
+		assert.Equal(t, "alice", first.Username, "first ticket should be assigned to alice")
+		assert.Equal(t, "bob", second.Username, "second ticket should be assigned to bob")
+		assert.Equal(t, "alice", third.Username, "third ticket should be assigned to alice again")
+	})
+
+	t.Run("leastOpen", func(t *testing.T) {
+		editor, found := SelectEditor(structs.AssignLeastOpen, structs.Ticket{}, users, tickets)
+
+		assert.True(t, found, "an editor should be selected")
+		assert.Equal(t, "bob", editor.Username, "bob has the fewest tickets in progress")
+	})
+
+	t.Run("skillsMatchingTag", func(t *testing.T) {
+		newTicket := structs.Ticket{Subject: "Help", Tags: []string{"Printer"}}
+
+		editor, found := SelectEditor(structs.AssignSkills, newTicket, users, tickets)
+
+		assert.True(t, found, "an editor should be selected")
+		assert.Equal(t, "alice", editor.Username, "alice has the matching skill")
+	})
+
+	t.Run("skillsMatchingSubject", func(t *testing.T) {
+		newTicket := structs.Ticket{Subject: "Question about my invoice and billing"}
+
+		editor, found := SelectEditor(structs.AssignSkills, newTicket, users, tickets)
+
+		assert.True(t, found, "an editor should be selected")
+		assert.Equal(t, "bob", editor.Username, "charlie matches better, but is on holiday")
+	})
+
+	t.Run("skillsWithoutMatch", func(t *testing.T) {
+		newTicket := structs.Ticket{Subject: "Something else"}
+
+		editor, found := SelectEditor(structs.AssignSkills, newTicket, users, tickets)
+
+		assert.True(t, found, "an editor should be selected")
+		assert.Equal(t, "bob", editor.Username, "without matching skills the least open tickets decide")
+	})
+
+	t.Run("everybodyOnHoliday", func(t *testing.T) {
+		holidayUsers := map[string]structs.User{
+			"charlie": users["charlie"],
+		}
+
+		_, found := SelectEditor(structs.AssignLeastOpen, structs.Ticket{}, holidayUsers, tickets)
+
+		assert.False(t, found, "no editor should be selected if everybody is on holiday")
+	})
+}
+
+func TestAutoAssign(t *testing.T) {
+	testlog.BeginTest()
+	defer testlog.EndTest()
+
+	previousConfig, previousUsers := globals.ServerConfig, globals.Users
+	defer func() {
+		globals.ServerConfig, globals.Users = previousConfig, previousUsers
+	}()
+
+	globals.Users = mockUsers()
+
+	t.Run("disabled", func(t *testing.T) {
+		globals.ServerConfig = &structs.ServerConfig{AssignStrategy: structs.AssignNone}
+
+		newTicket, assigned := AutoAssign(structs.Ticket{ID: "new"})
+
+		assert.False(t, assigned, "ticket should not be assigned")
+		assert.Equal(t, structs.StatusOpen, newTicket.Status, "ticket should stay open")
+	})
+
+	t.Run("enabled", func(t *testing.T) {
+		globals.ServerConfig = &structs.ServerConfig{AssignStrategy: structs.AssignLeastOpen}
+
+		newTicket, assigned := AutoAssign(structs.Ticket{ID: "new"})
+
+		assert.True(t, assigned, "ticket should be assigned")
+		assert.Equal(t, structs.StatusInProgress, newTicket.Status, "ticket should be in progress")
+		assert.NotEqual(t, "charlie", newTicket.User.Username, "editor on holiday should not be assigned")
+	})
+}
+
+func TestRedistributeTickets(t *testing.T) {
+	testlog.BeginTest()
+	defer testlog.EndTest()
+
+	users := mockUsers()
+	tickets := mockTickets(users)
+
+	t.Run("keep", func(t *testing.T) {
+		changed := RedistributeTickets(users["alice"], structs.HolidayKeep, structs.AssignLeastOpen, users, tickets)
+
+		assert.Empty(t, changed, "no ticket should be changed")
+	})
+
+	t.Run("release", func(t *testing.T) {
+		changed := RedistributeTickets(users["alice"], structs.HolidayRelease, structs.AssignLeastOpen, users, tickets)
+
+		assert.Len(t, changed, 2, "both tickets in progress should be released")
+		for _, changedTicket := range changed {
+			assert.Equal(t, structs.StatusOpen, changedTicket.Status, "released ticket should be open")
+			assert.Empty(t, changedTicket.User.ID, "released ticket should have no editor")
+		}
+	})
+
+	t.Run("reassign", func(t *testing.T) {
+		changed := RedistributeTickets(users["alice"], structs.HolidayReassign, structs.AssignLeastOpen, users, tickets)
+
+		assert.Len(t, changed, 2, "both tickets in progress should be reassigned")
+		for _, changedTicket := range changed {
+			assert.Equal(t, structs.StatusInProgress, changedTicket.Status, "reassigned ticket should be in progress")
+			assert.Equal(t, "bob", changedTicket.User.Username, "bob is the only other editor not on holiday")
+		}
+	})
+
+	t.Run("reassignWithoutStrategy", func(t *testing.T) {
+		changed := RedistributeTickets(users["alice"], structs.HolidayReassign, structs.AssignNone, users, tickets)
+
+		assert.Len(t, changed, 2, "both tickets in progress should be released")
+		for _, changedTicket := range changed {
+			assert.Equal(t, structs.StatusOpen, changedTicket.Status, "ticket should be released without strategy")
+		}
+	})
+}
+
+func TestCheckAssignment(t *testing.T) {
+	testlog.BeginTest()
+	defer testlog.EndTest()
+
+	users := mockUsers()
+	alice, bob, charlie := users["alice"], users["bob"], users["charlie"]
+
+	supervisor := bob
+	supervisor.Role = structs.RoleSupervisor
+
+	openTicket := structs.Ticket{ID: "open", Status: structs.StatusOpen}
+	tickets := mockTickets(users)
+
+	t.Run("selfAssign", func(t *testing.T) {
+		assert.NoError(t, CheckAssignment(alice, alice, openTicket), "agents may take open tickets")
+	})
+
+	t.Run("assignOthers", func(t *testing.T) {
+		assert.IsType(t, PermissionError{}, CheckAssignment(alice, bob, openTicket),
+			"agents may not assign other editors")
+	})
+
+	t.Run("takeOver", func(t *testing.T) {
+		assert.IsType(t, PermissionError{}, CheckAssignment(bob, bob, tickets["t1"]),
+			"agents may not take tickets of other editors")
+	})
+
+	t.Run("supervisor", func(t *testing.T) {
+		assert.NoError(t, CheckAssignment(supervisor, alice, openTicket), "supervisors may assign others")
+		assert.NoError(t, CheckAssignment(supervisor, bob, tickets["t1"]), "supervisors may reassign tickets")
+	})
+
+	t.Run("conflicts", func(t *testing.T) {
+		assert.IsType(t, ConflictError{}, CheckAssignment(supervisor, alice, tickets["t3"]),
+			"closed tickets cannot be assigned")
+		assert.IsType(t, ConflictError{}, CheckAssignment(supervisor, charlie, openTicket),
+			"editors on holiday cannot be assigned")
+		assert.IsType(t, ConflictError{}, CheckAssignment(alice, alice, structs.Ticket{ID: "m", MergeTo: "t1"}),
+			"merged tickets cannot be assigned")
+	})
+}
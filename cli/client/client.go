@@ -71,7 +71,20 @@ var post = makePOSTRequest
 // of an array of structs.Mail in the body of the response.
 // The function returns the structs.Mail it received.
 func FetchEmails() (mails map[string]structs.Mail, err error) {
-	response, err := get("api/fetchMails")
+	return fetchEmails("api/fetchMails")
+}
+
+// FetchMIMEEmails works like FetchEmails, but requests the
+// mails in the MIME format so that each structs.Mail also
+// contains its complete MIME message.
+func FetchMIMEEmails() (mails map[string]structs.Mail, err error) {
+	return fetchEmails("api/fetchMails?format=mime")
+}
+
+// fetchEmails sends a GET request to the given path and
+// unmarshals the received mails.
+func fetchEmails(path string) (mails map[string]structs.Mail, err error) {
+	response, err := get(path)
 	if err != nil {
 		err = fmt.Errorf("error occurred while making the get request: %v", err)
 		return
@@ -90,6 +90,27 @@ func TestFetchEmails(t *testing.T) {
 	assert.NoError(t, resultErr)
 }
 
+// TestFetchMIMEEmails checks that the mails are requested
+// in the MIME format.
+func TestFetchMIMEEmails(t *testing.T) {
+	testlog.BeginTest()
+	defer testlog.EndTest()
+
+	var inputPath string
+
+	get = func(path string) (response string, err error) {
+		inputPath = path
+		response = `{"1234abc":{"id":"1234abc","mime":"MIME-Version: 1.0\r\n"}}`
+		return
+	}
+
+	resultMails, resultErr := FetchMIMEEmails()
+
+	assert.Equal(t, "api/fetchMails?format=mime", inputPath)
+	assert.Equal(t, "MIME-Version: 1.0\r\n", resultMails["1234abc"].MIME)
+	assert.NoError(t, resultErr)
+}
+
 func TestFetchEmailsConnectionError(t *testing.T) {
 	testlog.BeginTest()
 	defer testlog.EndTest()
@@ -24,6 +24,7 @@ import (
 	"io"
 	"os"
 	"strconv"
+	"strings"
 
 	"github.com/mortenterhart/trivial-tickets/structs"
 	"github.com/mortenterhart/trivial-tickets/util/cliutils"
@@ -100,8 +101,14 @@ func OutputMessageToCommandLine(output structs.CliMessage) {
 }
 
 // PrintEmail outputs a received e-mail to
-// the console.
+// the console. Mails fetched in the MIME format
+// are printed as complete MIME message.
 func PrintEmail(mail structs.Mail) {
+	if mail.MIME != "" {
+		fmt.Fprintln(Writer, strings.Replace(mail.MIME, "\r\n", "\n", -1))
+		return
+	}
+
 	fmt.Fprintf(Writer, "From: %s\n"+
 		"To: %s\n\n"+
 		"Subject: %s\n\n"+
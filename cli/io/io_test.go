@@ -449,4 +449,12 @@ func TestPrintEmail(t *testing.T) {
 		string(structs.Subject) + subject + "\n\n" +
 		message + "\n"
 	assert.Equal(t, expectedOutput, output.String())
+
+	output.Reset()
+	mail.MIME = "From: " + fromAddress + "\r\nMIME-Version: 1.0\r\n\r\n" + message
+
+	PrintEmail(mail)
+
+	assert.Equal(t, "From: "+fromAddress+"\nMIME-Version: 1.0\n\n"+message+"\n", output.String(),
+		"MIME message should be printed as is")
 }
@@ -55,7 +55,8 @@ var (
 	cert = flag.String("cert", defaults.CliCertificate, "Location of the ssl certificate")
 
 	// Fetch options
-	fetch = flag.Bool("f", defaults.CliFetch, "fetch (fetch): If set, the application will fetch all messages from the server.")
+	fetch     = flag.Bool("f", defaults.CliFetch, "fetch (fetch): If set, the application will fetch all messages from the server.")
+	fetchMIME = flag.Bool("mime", defaults.CliMIME, "Fetch the messages as complete MIME messages including the HTML part.")
 
 	// Submit options
 	submit   = flag.Bool("s", defaults.CliSubmit, "Use to submit a message to the server. Requires -email, -subject, -message. The use of -tID is optional.")
@@ -88,7 +89,7 @@ func main() {
 		}
 
 	case !submit && fetch:
-		mails, err := client.FetchEmails()
+		mails, err := fetchEmails()
 		if err != nil {
 			fatal(err)
 			return
@@ -168,7 +169,7 @@ func commandLoop() error {
 
 		switch com {
 		case structs.CommandFetch:
-			mails, err := client.FetchEmails()
+			mails, err := fetchEmails()
 			if err != nil {
 				return err
 			}
@@ -196,6 +197,16 @@ func commandLoop() error {
 	return nil
 }
 
+// fetchEmails fetches the mails from the server, in the
+// MIME format if the -mime flag is set.
+func fetchEmails() (map[string]structs.Mail, error) {
+	if *fetchMIME {
+		return client.FetchMIMEEmails()
+	}
+
+	return client.FetchEmails()
+}
+
 // usageMessage prints a complete help text about the usage
 // of the command-line tool to the output writer.
 func usageMessage() {
@@ -238,6 +249,8 @@ func usageMessage() {
 	fmt.Fprintln(w, "  -f             Fetch emails from the server and skip the interactive")
 	fmt.Fprintln(w, "                 menu. Each mail is verified against the server to be")
 	fmt.Fprintln(w, "                 sent.")
+	fmt.Fprintln(w, "  -mime          Fetch the emails as complete MIME messages including")
+	fmt.Fprintln(w, "                 the HTML part instead of the plain text only.")
 	fmt.Fprintln(w)
 
 	fmt.Fprintln(w, "Submit options:")
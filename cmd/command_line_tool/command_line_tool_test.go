@@ -233,6 +233,7 @@ func resetFlags() {
 	*cert = cliConfig.Cert
 
 	*fetch = false
+	*fetchMIME = false
 
 	*submit = false
 	*email = ""
@@ -0,0 +1,236 @@
+// Trivial Tickets Ticketsystem
+// Copyright (C) 2019 The Contributors
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+// Package customers manages the customer directory and
+// links the tickets to the customers who wrote them.
+package customers
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/mortenterhart/trivial-tickets/globals"
+	"github.com/mortenterhart/trivial-tickets/log"
+	"github.com/mortenterhart/trivial-tickets/structs"
+	"github.com/mortenterhart/trivial-tickets/util/filehandler"
+	"github.com/mortenterhart/trivial-tickets/util/random"
+)
+
+/*
+ * Ticketsystem Trivial Tickets
+ *
+ * Matriculation numbers: 3040018, 6694964, 3478222
+ * Lecture:               Programmieren II, INF16B
+ * Lecturer:              Herr Prof. Dr. Helmut Neemann
+ * Institute:             Duale Hochschule Baden-Württemberg Mosbach
+ *
+ * ---------------
+ *
+ * Package customers
+ * Customer directory and organizations
+ */
+
+// Link links the ticket to the customer with the mail address
+// of the ticket. Unknown mail addresses are added to the
+// customer directory as a new customer which can be completed
+// by the editors later on.
+func Link(currentTicket structs.Ticket) structs.Ticket {
+	customer, found := FindByMail(globals.Customers, currentTicket.Customer)
+	if !found {
+		customer = structs.Customer{
+			ID:    random.CreateRandomID(structs.RandomIDLength),
+			Mails: []string{currentTicket.Customer},
+		}
+
+		log.Infof("Adding customer '%s' to the customer directory", currentTicket.Customer)
+
+		globals.Customers[customer.ID] = customer
+		Save()
+	}
+
+	currentTicket.CustomerID = customer.ID
+
+	return currentTicket
+}
+
+// Save persists the customer directory to the configured
+// customers file. Without a configured file the directory
+// is only kept in memory.
+func Save() {
+	if globals.ServerConfig == nil || globals.ServerConfig.Customers == "" {
+		return
+	}
+
+	if writeErr := filehandler.WriteCustomerFile(globals.ServerConfig.Customers, &globals.Customers); writeErr != nil {
+		log.Errorf("unable to persist customer directory: %v", writeErr)
+	}
+}
+
+// FindByMail returns the customer to whom the given mail
+// address belongs.
+func FindByMail(customers map[string]structs.Customer, mail string) (structs.Customer, bool) {
+	for _, customer := range customers {
+		if customer.HasMail(mail) {
+			return customer, true
+		}
+	}
+
+	return structs.Customer{}, false
+}
+
+// ParseMails splits a list of mail addresses separated by
+// commas, semicolons or whitespace. Duplicates are removed.
+func ParseMails(mailList string) []string {
+	var mails []string
+	seen := make(map[string]bool)
+
+	for _, mail := range strings.FieldsFunc(mailList, isMailSeparator) {
+		if key := strings.ToLower(mail); !seen[key] {
+			seen[key] = true
+			mails = append(mails, mail)
+		}
+	}
+
+	return mails
+}
+
+// isMailSeparator reports whether the rune separates two
+// mail addresses in a list.
+func isMailSeparator(r rune) bool {
+	return r == ',' || r == ';' || r == ' ' || r == '\t' || r == '\r' || r == '\n'
+}
+
+// Validate checks that the customer has at least one mail
+// address and none of its addresses belongs to another
+// customer of the directory, because otherwise new tickets
+// could not be linked unambiguously.
+func Validate(customers map[string]structs.Customer, customer structs.Customer) error {
+	if len(customer.Mails) == 0 {
+		return errors.New("a customer needs at least one mail address")
+	}
+
+	for _, mail := range customer.Mails {
+		if !strings.Contains(mail, "@") {
+			return fmt.Errorf("'%s' is not a valid mail address", mail)
+		}
+
+		if other, found := FindByMail(customers, mail); found && other.ID != customer.ID {
+			return fmt.Errorf("mail address '%s' already belongs to customer '%s'", mail, other.DisplayName())
+		}
+	}
+
+	return nil
+}
+
+// Directory returns the customers of the given organization
+// sorted by organization and name. An empty organization
+// returns all customers.
+func Directory(customers map[string]structs.Customer, organization string) []structs.Customer {
+	var directory []structs.Customer
+	for _, customer := range customers {
+		if organization == "" || customer.Organization == organization {
+			directory = append(directory, customer)
+		}
+	}
+
+	sort.Slice(directory, func(i, j int) bool {
+		if directory[i].Organization != directory[j].Organization {
+			return directory[i].Organization < directory[j].Organization
+		}
+
+		return strings.ToLower(directory[i].DisplayName()) < strings.ToLower(directory[j].DisplayName())
+	})
+
+	return directory
+}
+
+// Organizations returns the sorted names of all organizations
+// of the customers in the directory.
+func Organizations(customers map[string]structs.Customer) []string {
+	var organizations []string
+	seen := make(map[string]bool)
+
+	for _, customer := range customers {
+		if customer.Organization != "" && !seen[customer.Organization] {
+			seen[customer.Organization] = true
+			organizations = append(organizations, customer.Organization)
+		}
+	}
+
+	sort.Strings(organizations)
+
+	return organizations
+}
+
+// Tickets returns the tickets of the customer with the most
+// recent ticket first. Tickets created before the customer
+// directory existed are found by the mail addresses of the
+// customer.
+func Tickets(customer structs.Customer, tickets map[string]structs.Ticket) []structs.Ticket {
+	var customerTickets []structs.Ticket
+	for _, currentTicket := range tickets {
+		if currentTicket.CustomerID == customer.ID ||
+			currentTicket.CustomerID == "" && customer.HasMail(currentTicket.Customer) {
+			customerTickets = append(customerTickets, currentTicket)
+		}
+	}
+
+	sort.Slice(customerTickets, func(i, j int) bool {
+		first, second := createdAt(customerTickets[i]), createdAt(customerTickets[j])
+		if !first.Equal(second) {
+			return first.After(second)
+		}
+
+		return customerTickets[i].ID < customerTickets[j].ID
+	})
+
+	return customerTickets
+}
+
+// History returns the entries of all given tickets with the
+// most recent entry first.
+func History(tickets []structs.Ticket) []structs.HistoryEntry {
+	var history []structs.HistoryEntry
+	for _, currentTicket := range tickets {
+		for _, entry := range currentTicket.Entries {
+			history = append(history, structs.HistoryEntry{
+				TicketID: currentTicket.ID,
+				Subject:  currentTicket.Subject,
+				Entry:    entry,
+			})
+		}
+	}
+
+	sort.SliceStable(history, func(i, j int) bool {
+		return history[i].Entry.Date.After(history[j].Entry.Date)
+	})
+
+	return history
+}
+
+// createdAt returns the date of the first entry of the
+// ticket which is the time the ticket was created.
+func createdAt(currentTicket structs.Ticket) time.Time {
+	if len(currentTicket.Entries) == 0 {
+		return time.Time{}
+	}
+
+	return currentTicket.Entries[0].Date
+}
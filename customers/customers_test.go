@@ -0,0 +1,190 @@
+// Trivial Tickets Ticketsystem
+// Copyright (C) 2019 The Contributors
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+// Package customers manages the customer directory and
+// links the tickets to the customers who wrote them.
+package customers
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mortenterhart/trivial-tickets/globals"
+	"github.com/mortenterhart/trivial-tickets/log/testlog"
+	"github.com/mortenterhart/trivial-tickets/structs"
+	"github.com/mortenterhart/trivial-tickets/structs/defaults"
+)
+
+/*
+ * Ticketsystem Trivial Tickets
+ *
+ * Matriculation numbers: 3040018, 6694964, 3478222
+ * Lecture:               Programmieren II, INF16B
+ * Lecturer:              Herr Prof. Dr. Helmut Neemann
+ * Institute:             Duale Hochschule Baden-Württemberg Mosbach
+ *
+ * ---------------
+ *
+ * Package customers
+ * Customer directory and organizations
+ */
+
+//revive:disable:deep-exit
+
+// TestMain is started to run the tests and initializes the
+// logging configuration before running the tests. The tests'
+// exit status is returned as the overall exit status.
+func TestMain(m *testing.M) {
+	globals.LogConfig = &structs.LogConfig{
+		LogLevel:  structs.AsLogLevel(defaults.LogLevelString),
+		Verbose:   defaults.LogVerbose,
+		FullPaths: defaults.LogFullPaths,
+	}
+
+	os.Exit(m.Run())
+}
+
+//revive:enable:deep-exit
+
+// mockCustomers returns a customer directory with two
+// customers of different organizations.
+func mockCustomers() map[string]structs.Customer {
+	return map[string]structs.Customer{
+		"c1": {ID: "c1", Name: "Jane Doe", Organization: "ACME", Mails: []string{"jane@acme.com", "doe@acme.com"}},
+		"c2": {ID: "c2", Name: "Max Mustermann", Organization: "Beispiel GmbH", Mails: []string{"max@example.com"}},
+	}
+}
+
+func TestLink(t *testing.T) {
+	testlog.BeginTest()
+	defer testlog.EndTest()
+
+	globals.Customers = mockCustomers()
+	defer func() {
+		globals.Customers = make(map[string]structs.Customer)
+	}()
+
+	t.Run("knownMail", func(t *testing.T) {
+		linkedTicket := Link(structs.Ticket{ID: "abc123", Customer: "DOE@acme.com"})
+
+		assert.Equal(t, "c1", linkedTicket.CustomerID, "ticket should be linked to the known customer")
+	})
+
+	t.Run("unknownMail", func(t *testing.T) {
+		linkedTicket := Link(structs.Ticket{ID: "def456", Customer: "new@example.com"})
+
+		customer, found := globals.Customers[linkedTicket.CustomerID]
+
+		assert.True(t, found, "unknown customer should be added to the directory")
+		assert.Equal(t, []string{"new@example.com"}, customer.Mails)
+		assert.Len(t, globals.Customers, 3)
+	})
+}
+
+func TestParseMails(t *testing.T) {
+	testlog.BeginTest()
+	defer testlog.EndTest()
+
+	assert.Equal(t, []string{"jane@acme.com", "doe@acme.com"}, ParseMails("jane@acme.com, doe@acme.com;\nJANE@acme.com"))
+	assert.Empty(t, ParseMails(" , "))
+}
+
+func TestValidate(t *testing.T) {
+	testlog.BeginTest()
+	defer testlog.EndTest()
+
+	customers := mockCustomers()
+
+	t.Run("valid", func(t *testing.T) {
+		customer := customers["c1"]
+		customer.Mails = append(customer.Mails, "j.doe@acme.com")
+
+		assert.NoError(t, Validate(customers, customer))
+	})
+
+	t.Run("noMail", func(t *testing.T) {
+		assert.Error(t, Validate(customers, structs.Customer{ID: "c3", Name: "Nobody"}))
+	})
+
+	t.Run("invalidMail", func(t *testing.T) {
+		assert.Error(t, Validate(customers, structs.Customer{ID: "c3", Mails: []string{"nobody"}}))
+	})
+
+	t.Run("foreignMail", func(t *testing.T) {
+		assert.Error(t, Validate(customers, structs.Customer{ID: "c3", Mails: []string{"max@example.com"}}),
+			"mail addresses of other customers should be rejected")
+	})
+}
+
+func TestDirectory(t *testing.T) {
+	testlog.BeginTest()
+	defer testlog.EndTest()
+
+	customers := mockCustomers()
+
+	t.Run("allCustomers", func(t *testing.T) {
+		directory := Directory(customers, "")
+
+		if assert.Len(t, directory, 2) {
+			assert.Equal(t, "c1", directory[0].ID, "customers should be sorted by organization")
+		}
+	})
+
+	t.Run("organization", func(t *testing.T) {
+		directory := Directory(customers, "Beispiel GmbH")
+
+		if assert.Len(t, directory, 1) {
+			assert.Equal(t, "c2", directory[0].ID)
+		}
+	})
+
+	t.Run("organizations", func(t *testing.T) {
+		assert.Equal(t, []string{"ACME", "Beispiel GmbH"}, Organizations(customers))
+	})
+}
+
+func TestTicketsAndHistory(t *testing.T) {
+	testlog.BeginTest()
+	defer testlog.EndTest()
+
+	older := time.Date(2019, time.January, 7, 10, 0, 0, 0, time.UTC)
+	newer := older.AddDate(0, 0, 1)
+
+	tickets := map[string]structs.Ticket{
+		"linked": {ID: "linked", CustomerID: "c1", Customer: "jane@acme.com",
+			Entries: []structs.Entry{{Date: newer, Text: "Second"}}},
+		"old": {ID: "old", Customer: "doe@acme.com",
+			Entries: []structs.Entry{{Date: older, Text: "First"}, {Date: newer.Add(time.Hour), Text: "Answer"}}},
+		"other": {ID: "other", CustomerID: "c2", Customer: "max@example.com"},
+	}
+
+	customerTickets := Tickets(mockCustomers()["c1"], tickets)
+
+	if assert.Len(t, customerTickets, 2, "linked tickets and tickets with a known mail should be found") {
+		assert.Equal(t, "linked", customerTickets[0].ID, "most recent ticket should be first")
+	}
+
+	history := History(customerTickets)
+
+	if assert.Len(t, history, 3) {
+		assert.Equal(t, "Answer", history[0].Entry.Text, "most recent entry should be first")
+		assert.Equal(t, "old", history[0].TicketID)
+		assert.Equal(t, "First", history[2].Entry.Text)
+	}
+}
@@ -0,0 +1,157 @@
+// Trivial Tickets Ticketsystem
+// Copyright (C) 2019 The Contributors
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+// Package duplicates detects new tickets which repeat an
+// open ticket of the same customer, e.g. because the request
+// was sent both by the web form and by mail.
+package duplicates
+
+import (
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/mortenterhart/trivial-tickets/globals"
+	"github.com/mortenterhart/trivial-tickets/log"
+	"github.com/mortenterhart/trivial-tickets/structs"
+	"github.com/mortenterhart/trivial-tickets/ticket"
+)
+
+/*
+ * Ticketsystem Trivial Tickets
+ *
+ * Matriculation numbers: 3040018, 6694964, 3478222
+ * Lecture:               Programmieren II, INF16B
+ * Lecturer:              Herr Prof. Dr. Helmut Neemann
+ * Institute:             Duale Hochschule Baden-Württemberg Mosbach
+ *
+ * ---------------
+ *
+ * Package duplicates
+ * Detection of duplicate tickets
+ */
+
+// similarityThreshold is the share of common words from
+// which two subjects or messages are considered similar.
+const similarityThreshold float64 = 0.7
+
+// Check looks for an original of the new ticket among the
+// tickets kept in memory and applies the configured policy.
+// With the flag policy the new ticket is marked as possible
+// duplicate. With the merge policy the new ticket is merged
+// into the original, which is returned along with true so
+// that the caller can persist it.
+func Check(newTicket structs.Ticket, now time.Time) (checkedTicket, original structs.Ticket, merged bool) {
+	if globals.ServerConfig == nil || globals.ServerConfig.DuplicatePolicy == structs.DuplicateNone {
+		return newTicket, structs.Ticket{}, false
+	}
+
+	window := time.Duration(globals.ServerConfig.DuplicateWindowHours) * time.Hour
+	original, found := FindOriginal(newTicket, globals.Tickets, now.Add(-window))
+	if !found {
+		return newTicket, structs.Ticket{}, false
+	}
+
+	if globals.ServerConfig.DuplicatePolicy == structs.DuplicateMerge {
+		original, newTicket = ticket.MergeTickets(original, newTicket)
+		if newTicket.MergeTo == original.ID {
+			log.Infof("Merged duplicate ticket '%s' into ticket '%s'", newTicket.ID, original.ID)
+			return newTicket, original, true
+		}
+	}
+
+	log.Infof("Ticket '%s' is a possible duplicate of ticket '%s'", newTicket.ID, original.ID)
+	newTicket.DuplicateOf = original.ID
+
+	return newTicket, structs.Ticket{}, false
+}
+
+// FindOriginal returns the most recent ticket which was
+// created since the given time by the same customer as the
+// new ticket, is neither closed nor merged and has a similar
+// subject or message.
+func FindOriginal(newTicket structs.Ticket, tickets map[string]structs.Ticket, since time.Time) (structs.Ticket, bool) {
+	var original structs.Ticket
+	found := false
+
+	for _, candidate := range tickets {
+		if candidate.ID == newTicket.ID || candidate.Status == structs.StatusClosed ||
+			candidate.MergeTo != "" || !ticket.SameCustomer(candidate, newTicket) ||
+			len(candidate.Entries) == 0 || candidate.Entries[0].Date.Before(since) {
+			continue
+		}
+
+		if !IsSimilar(candidate, newTicket) {
+			continue
+		}
+
+		if !found || candidate.Entries[0].Date.After(original.Entries[0].Date) {
+			original = candidate
+			found = true
+		}
+	}
+
+	return original, found
+}
+
+// IsSimilar reports whether the subjects or the first
+// messages of the tickets are similar.
+func IsSimilar(first, second structs.Ticket) bool {
+	if Similarity(first.Subject, second.Subject) >= similarityThreshold {
+		return true
+	}
+
+	return len(first.Entries) > 0 && len(second.Entries) > 0 &&
+		Similarity(first.Entries[0].Text, second.Entries[0].Text) >= similarityThreshold
+}
+
+// Similarity returns the share of words the two texts have
+// in common (Jaccard index) between 0 and 1. Case and
+// punctuation are ignored.
+func Similarity(first, second string) float64 {
+	firstWords, secondWords := words(first), words(second)
+	if len(firstWords) == 0 || len(secondWords) == 0 {
+		return 0
+	}
+
+	common := 0
+	for word := range firstWords {
+		if secondWords[word] {
+			common++
+		}
+	}
+
+	return float64(common) / float64(len(firstWords)+len(secondWords)-common)
+}
+
+// words returns the set of lower case words of the text.
+// Reply and forward prefixes of mail subjects are ignored.
+func words(text string) map[string]bool {
+	wordSet := make(map[string]bool)
+	for _, word := range strings.FieldsFunc(strings.ToLower(text), isWordSeparator) {
+		if word != "re" && word != "fw" && word != "fwd" && word != "aw" {
+			wordSet[word] = true
+		}
+	}
+
+	return wordSet
+}
+
+// isWordSeparator reports whether the rune separates
+// two words.
+func isWordSeparator(r rune) bool {
+	return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+}
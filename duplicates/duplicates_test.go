@@ -0,0 +1,181 @@
+// Trivial Tickets Ticketsystem
+// Copyright (C) 2019 The Contributors
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+// Package duplicates detects new tickets which repeat an
+// open ticket of the same customer, e.g. because the request
+// was sent both by the web form and by mail.
+package duplicates
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mortenterhart/trivial-tickets/globals"
+	"github.com/mortenterhart/trivial-tickets/log/testlog"
+	"github.com/mortenterhart/trivial-tickets/structs"
+	"github.com/mortenterhart/trivial-tickets/structs/defaults"
+)
+
+/*
+ * Ticketsystem Trivial Tickets
+ *
+ * Matriculation numbers: 3040018, 6694964, 3478222
+ * Lecture:               Programmieren II, INF16B
+ * Lecturer:              Herr Prof. Dr. Helmut Neemann
+ * Institute:             Duale Hochschule Baden-Württemberg Mosbach
+ *
+ * ---------------
+ *
+ * Package duplicates
+ * Detection of duplicate tickets
+ */
+
+//revive:disable:deep-exit
+
+// TestMain is started to run the tests and initializes the
+// logging configuration before running the tests. The tests'
+// exit status is returned as the overall exit status.
+func TestMain(m *testing.M) {
+	globals.LogConfig = &structs.LogConfig{
+		LogLevel:  structs.AsLogLevel(defaults.LogLevelString),
+		Verbose:   defaults.LogVerbose,
+		FullPaths: defaults.LogFullPaths,
+	}
+
+	os.Exit(m.Run())
+}
+
+//revive:enable:deep-exit
+
+// mockTicket returns a ticket of the given customer created
+// at the given time with the subject and the message.
+func mockTicket(id, customer, subject, message string, created time.Time) structs.Ticket {
+	return structs.Ticket{
+		ID:       id,
+		Subject:  subject,
+		Customer: customer,
+		Entries:  []structs.Entry{{Date: created, User: customer, Text: message}},
+	}
+}
+
+func TestSimilarity(t *testing.T) {
+	testlog.BeginTest()
+	defer testlog.EndTest()
+
+	assert.Equal(t, 1.0, Similarity("Printer is broken", "RE: printer is broken!"), "prefixes and case should be ignored")
+	assert.InDelta(t, 1.0/3, Similarity("printer broken", "printer works"), 0.001)
+	assert.Equal(t, 0.0, Similarity("", "printer"))
+}
+
+func TestFindOriginal(t *testing.T) {
+	testlog.BeginTest()
+	defer testlog.EndTest()
+
+	now := time.Date(2019, time.January, 7, 10, 0, 0, 0, time.UTC)
+	newTicket := mockTicket("new", "customer@example.com", "Printer is broken", "It does not print", now)
+
+	tickets := map[string]structs.Ticket{
+		"original": mockTicket("original", "Customer@example.com", "The printer is broken", "Help", now.Add(-time.Hour)),
+		"other":    mockTicket("other", "other@example.com", "Printer is broken", "It does not print", now.Add(-time.Hour)),
+		"old":      mockTicket("old", "customer@example.com", "Printer is broken", "It does not print", now.AddDate(0, 0, -3)),
+		"message":  mockTicket("message", "customer@example.com", "Urgent", "it does not print", now.Add(-2*time.Hour)),
+		"new":      newTicket,
+	}
+
+	t.Run("mostRecent", func(t *testing.T) {
+		original, found := FindOriginal(newTicket, tickets, now.Add(-24*time.Hour))
+
+		assert.True(t, found, "a duplicate should be found")
+		assert.Equal(t, "original", original.ID, "the most recent similar ticket should be the original")
+	})
+
+	t.Run("similarMessage", func(t *testing.T) {
+		delete(tickets, "original")
+		defer func() {
+			tickets["original"] = mockTicket("original", "customer@example.com", "The printer is broken", "Help", now.Add(-time.Hour))
+		}()
+
+		original, found := FindOriginal(newTicket, tickets, now.Add(-24*time.Hour))
+
+		assert.True(t, found, "a ticket with a similar message should be found")
+		assert.Equal(t, "message", original.ID)
+	})
+
+	t.Run("closedTicket", func(t *testing.T) {
+		closedTickets := map[string]structs.Ticket{"closed": tickets["original"]}
+		closedTicket := closedTickets["closed"]
+		closedTicket.Status = structs.StatusClosed
+		closedTickets["closed"] = closedTicket
+
+		_, found := FindOriginal(newTicket, closedTickets, now.Add(-24*time.Hour))
+
+		assert.False(t, found, "closed tickets should not be originals")
+	})
+}
+
+func TestCheck(t *testing.T) {
+	testlog.BeginTest()
+	defer testlog.EndTest()
+
+	now := time.Now()
+	original := mockTicket("original", "customer@example.com", "Printer is broken", "Help", now.Add(-time.Hour))
+	newTicket := mockTicket("new", "customer@example.com", "Printer is broken", "It does not print", now)
+
+	globals.Tickets = map[string]structs.Ticket{"original": original}
+	defer func() {
+		globals.Tickets = make(map[string]structs.Ticket)
+		globals.ServerConfig = nil
+	}()
+
+	t.Run("disabled", func(t *testing.T) {
+		globals.ServerConfig = &structs.ServerConfig{DuplicatePolicy: structs.DuplicateNone, DuplicateWindowHours: 24}
+
+		checkedTicket, _, merged := Check(newTicket, now)
+
+		assert.False(t, merged)
+		assert.Empty(t, checkedTicket.DuplicateOf)
+	})
+
+	t.Run("flag", func(t *testing.T) {
+		globals.ServerConfig = &structs.ServerConfig{DuplicatePolicy: structs.DuplicateFlag, DuplicateWindowHours: 24}
+
+		checkedTicket, _, merged := Check(newTicket, now)
+
+		assert.False(t, merged, "flagged ticket should not be merged")
+		assert.Equal(t, "original", checkedTicket.DuplicateOf, "ticket should be flagged as duplicate")
+	})
+
+	t.Run("merge", func(t *testing.T) {
+		globals.ServerConfig = &structs.ServerConfig{DuplicatePolicy: structs.DuplicateMerge, DuplicateWindowHours: 24}
+
+		checkedTicket, mergedOriginal, merged := Check(newTicket, now)
+
+		assert.True(t, merged, "ticket should be merged")
+		assert.Equal(t, "original", checkedTicket.MergeTo)
+		assert.Len(t, mergedOriginal.Entries, 2, "message should be appended to the original")
+	})
+
+	t.Run("outsideWindow", func(t *testing.T) {
+		globals.ServerConfig = &structs.ServerConfig{DuplicatePolicy: structs.DuplicateFlag, DuplicateWindowHours: 0}
+
+		checkedTicket, _, _ := Check(newTicket, now)
+
+		assert.Empty(t, checkedTicket.DuplicateOf, "tickets outside of the window should be ignored")
+	})
+}
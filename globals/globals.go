@@ -19,6 +19,8 @@
 package globals
 
 import (
+	"sync"
+
 	"github.com/mortenterhart/trivial-tickets/structs"
 )
 
@@ -42,6 +44,26 @@ import (
 // Tickets holds all the created tickets.
 var Tickets = make(map[string]structs.Ticket)
 
+// Users holds all registered users.
+var Users = make(map[string]structs.User)
+
+// Responses holds all canned responses.
+var Responses = make(map[string]structs.CannedResponse)
+
+// Macros holds all macros.
+var Macros = make(map[string]structs.Macro)
+
+// Customers holds the customer directory.
+var Customers = make(map[string]structs.Customer)
+
+// Rules holds the automation rules in the
+// order they are evaluated.
+var Rules []structs.Rule
+
+// TicketSequence holds the state of the
+// sequential ticket numbers.
+var TicketSequence structs.TicketSequence
+
 // Mails holds all currently cached mails.
 var Mails = make(map[string]structs.Mail)
 
@@ -55,3 +77,8 @@ var LogConfig *structs.LogConfig
 
 // Sessions holds all the sessions for the users.
 var Sessions = make(map[string]structs.SessionManager)
+
+// StorageLock guards the global tickets, users, mails
+// and sessions against concurrent access of the request
+// handlers and the background jobs of the server.
+var StorageLock sync.Mutex
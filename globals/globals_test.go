@@ -50,6 +50,18 @@ func TestGlobalStructures(t *testing.T) {
 		assert.NotNil(t, Tickets, "Tickets should not be nil")
 	})
 
+	t.Run("usersNotNil", func(t *testing.T) {
+		assert.NotNil(t, Users, "Users should not be nil")
+	})
+
+	t.Run("responsesNotNil", func(t *testing.T) {
+		assert.NotNil(t, Responses, "Responses should not be nil")
+	})
+
+	t.Run("macrosNotNil", func(t *testing.T) {
+		assert.NotNil(t, Macros, "Macros should not be nil")
+	})
+
 	t.Run("mailsNotNil", func(t *testing.T) {
 		assert.NotNil(t, Mails, "Mails should not be nil")
 	})
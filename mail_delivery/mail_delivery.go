@@ -0,0 +1,339 @@
+// Trivial Tickets Ticketsystem
+// Copyright (C) 2019 The Contributors
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+// Package mail_delivery delivers the cached outgoing mails
+// to an SMTP relay and retries failed deliveries with an
+// exponential backoff.
+package mail_delivery
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/smtp"
+	"net/textproto"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/mortenterhart/trivial-tickets/api/api_out"
+	"github.com/mortenterhart/trivial-tickets/globals"
+	"github.com/mortenterhart/trivial-tickets/log"
+	"github.com/mortenterhart/trivial-tickets/mail_mime"
+	"github.com/mortenterhart/trivial-tickets/structs"
+	"github.com/mortenterhart/trivial-tickets/util/filehandler"
+)
+
+/*
+ * Ticketsystem Trivial Tickets
+ *
+ * Matriculation numbers: 3040018, 6694964, 3478222
+ * Lecture:               Programmieren II, INF16B
+ * Lecturer:              Herr Prof. Dr. Helmut Neemann
+ * Institute:             Duale Hochschule Baden-Württemberg Mosbach
+ *
+ * ---------------
+ *
+ * Package mail_delivery
+ * Delivery of outgoing mails over SMTP
+ */
+
+const (
+	// dialTimeout is the maximum duration to wait for
+	// the connection to the relay.
+	dialTimeout time.Duration = 30 * time.Second
+
+	// pollInterval is the duration between two checks
+	// for mails which are due for delivery.
+	pollInterval time.Duration = 10 * time.Second
+
+	// initialBackoff is the delay before the first retry
+	// of a failed delivery. It doubles with every further
+	// failure up to maxBackoff.
+	initialBackoff time.Duration = 30 * time.Second
+
+	// maxBackoff is the longest delay between two retries.
+	maxBackoff time.Duration = time.Hour
+
+	// maxAttempts is the number of failed deliveries after
+	// which the worker gives up on a mail. The mail then
+	// remains available to the mail API.
+	maxAttempts int = 10
+)
+
+// Sender sends single mails to an SMTP relay.
+type Sender struct {
+	Relay           string
+	User            string
+	Password        string
+	RequireStartTLS bool
+
+	// tlsConfig overrides the TLS configuration used
+	// for STARTTLS. It is only set by the tests.
+	tlsConfig *tls.Config
+}
+
+// NewSender creates a sender for the relay and the
+// credentials of the server configuration.
+func NewSender(config *structs.ServerConfig) *Sender {
+	return &Sender{
+		Relay:           config.SMTPRelay,
+		User:            config.SMTPUser,
+		Password:        config.SMTPPassword,
+		RequireStartTLS: config.SMTPStartTLS,
+	}
+}
+
+// Send delivers the mail to the relay. The connection
+// is upgraded with STARTTLS if the relay offers it and
+// authenticated if a user is configured. The mail is
+// delivered as soon as the relay accepted the data, so
+// a failing QUIT is only logged to avoid sending the
+// mail twice.
+func (sender *Sender) Send(mail structs.Mail) error {
+	host, _, splitErr := net.SplitHostPort(sender.Relay)
+	if splitErr != nil {
+		return errors.Wrapf(splitErr, "invalid SMTP relay '%s'", sender.Relay)
+	}
+
+	conn, dialErr := net.DialTimeout("tcp", sender.Relay, dialTimeout)
+	if dialErr != nil {
+		return errors.Wrapf(dialErr, "could not connect to SMTP relay '%s'", sender.Relay)
+	}
+
+	client, clientErr := smtp.NewClient(conn, host)
+	if clientErr != nil {
+		conn.Close()
+		return errors.Wrapf(clientErr, "could not greet SMTP relay '%s'", sender.Relay)
+	}
+	defer client.Close()
+
+	if supported, _ := client.Extension("STARTTLS"); supported {
+		tlsConfig := sender.tlsConfig
+		if tlsConfig == nil {
+			tlsConfig = &tls.Config{ServerName: host}
+		}
+
+		if tlsErr := client.StartTLS(tlsConfig); tlsErr != nil {
+			return errors.Wrap(tlsErr, "STARTTLS failed")
+		}
+	} else if sender.RequireStartTLS {
+		return fmt.Errorf("SMTP relay '%s' does not support STARTTLS", sender.Relay)
+	}
+
+	if sender.User != "" {
+		auth := smtp.PlainAuth("", sender.User, sender.Password, host)
+		if authErr := client.Auth(auth); authErr != nil {
+			return errors.Wrap(authErr, "authentication at SMTP relay failed")
+		}
+	}
+
+	if mailErr := client.Mail(mail.From); mailErr != nil {
+		return errors.Wrapf(mailErr, "relay rejected sender '%s'", mail.From)
+	}
+
+	if rcptErr := client.Rcpt(mail.To); rcptErr != nil {
+		return errors.Wrapf(rcptErr, "relay rejected recipient '%s'", mail.To)
+	}
+
+	writer, dataErr := client.Data()
+	if dataErr != nil {
+		return errors.Wrap(dataErr, "relay rejected mail data")
+	}
+
+	if _, writeErr := writer.Write(mail_mime.Compose(mail, time.Now())); writeErr != nil {
+		writer.Close()
+		return errors.Wrap(writeErr, "could not write mail data")
+	}
+
+	if closeErr := writer.Close(); closeErr != nil {
+		return errors.Wrap(closeErr, "relay did not accept mail")
+	}
+
+	if quitErr := client.Quit(); quitErr != nil {
+		log.Warnf(`unable to close the connection to SMTP relay '%s' after delivering mail "%s": %v`,
+			sender.Relay, mail.ID, quitErr)
+	}
+
+	return nil
+}
+
+// deliveryState records the failed deliveries of a
+// mail and when the next attempt is due.
+type deliveryState struct {
+	attempts int
+	next     time.Time
+}
+
+// Worker delivers the cached mails periodically and
+// keeps track of the retries of failed deliveries.
+type Worker struct {
+	sender *Sender
+	states map[string]*deliveryState
+}
+
+// NewWorker creates a worker delivering with the given
+// sender.
+func NewWorker(sender *Sender) *Worker {
+	return &Worker{
+		sender: sender,
+		states: make(map[string]*deliveryState),
+	}
+}
+
+// Start starts a Go routine which delivers the due mails
+// immediately and then every pollInterval. The returned
+// channel stops the Go routine when it is closed.
+func (worker *Worker) Start() chan<- bool {
+	stop := make(chan bool)
+
+	go func() {
+		ticker := time.NewTicker(pollInterval)
+		defer ticker.Stop()
+
+		worker.DeliverDue(time.Now())
+
+		for {
+			select {
+			case now := <-ticker.C:
+				worker.DeliverDue(now)
+
+			case <-stop:
+				log.Info("Stopping mail delivery")
+				return
+			}
+		}
+	}()
+
+	return stop
+}
+
+// DeliverDue sends all cached mails whose next attempt is
+// due at the given point in time and returns the number of
+// delivered mails. Delivered mails are removed from the
+// cache and the mail directory. The storage lock is only
+// held while the cache is accessed, not during the SMTP
+// conversation.
+func (worker *Worker) DeliverDue(now time.Time) int {
+	due := worker.dueMails(now)
+
+	delivered := 0
+	for _, mail := range due {
+		sendErr := worker.sender.Send(mail)
+
+		globals.StorageLock.Lock()
+		if sendErr != nil {
+			worker.recordFailure(mail, sendErr, now)
+		} else {
+			worker.markDelivered(mail)
+			delivered++
+		}
+		globals.StorageLock.Unlock()
+	}
+
+	return delivered
+}
+
+// dueMails returns the cached mails which are due for
+// delivery and forgets the states of mails which are no
+// longer cached, e.g. because they were verified using
+// the mail API.
+func (worker *Worker) dueMails(now time.Time) []structs.Mail {
+	globals.StorageLock.Lock()
+	defer globals.StorageLock.Unlock()
+
+	for mailID := range worker.states {
+		if _, cached := globals.Mails[mailID]; !cached {
+			delete(worker.states, mailID)
+		}
+	}
+
+	var due []structs.Mail
+	for mailID, mail := range globals.Mails {
+		state, failed := worker.states[mailID]
+		if failed && (state.attempts >= maxAttempts || now.Before(state.next)) {
+			continue
+		}
+
+		due = append(due, mail)
+	}
+
+	return due
+}
+
+// markDelivered records the Message-ID of the delivered
+// mail on its ticket, removes the mail from the cache and
+// deletes its file.
+func (worker *Worker) markDelivered(mail structs.Mail) {
+	log.Infof(`Delivered mail "%s" to '%s' via %s`, mail.ID, mail.To, worker.sender.Relay)
+
+	api_out.RecordMessageID(mail)
+
+	delete(worker.states, mail.ID)
+	delete(globals.Mails, mail.ID)
+
+	if removeErr := filehandler.RemoveMailFile(globals.ServerConfig.Mails, mail.ID); removeErr != nil {
+		log.Errorf(`unable to delete file of delivered mail "%s": %v`, mail.ID, removeErr)
+	}
+}
+
+// recordFailure schedules the next attempt for the mail
+// with an exponential backoff. Permanent errors reported
+// by the relay and too many failures stop the retries.
+func (worker *Worker) recordFailure(mail structs.Mail, sendErr error, now time.Time) {
+	state, exists := worker.states[mail.ID]
+	if !exists {
+		state = &deliveryState{}
+		worker.states[mail.ID] = state
+	}
+
+	state.attempts++
+	if isPermanent(sendErr) {
+		state.attempts = maxAttempts
+	}
+
+	if state.attempts >= maxAttempts {
+		log.Errorf(`giving up delivery of mail "%s" to '%s' after %d attempt(s): %v`,
+			mail.ID, mail.To, state.attempts, sendErr)
+		return
+	}
+
+	state.next = now.Add(backoff(state.attempts))
+	log.Warnf(`delivery of mail "%s" to '%s' failed (attempt %d), retrying at %s: %v`,
+		mail.ID, mail.To, state.attempts, state.next.Format(time.RFC3339), sendErr)
+}
+
+// backoff returns the delay after the given number of
+// failed attempts.
+func backoff(attempts int) time.Duration {
+	delay := initialBackoff
+	for i := 1; i < attempts && delay < maxBackoff; i++ {
+		delay *= 2
+	}
+
+	if delay > maxBackoff {
+		return maxBackoff
+	}
+
+	return delay
+}
+
+// isPermanent reports whether the relay rejected the mail
+// with a permanent (5xx) reply code.
+func isPermanent(sendErr error) bool {
+	protocolErr, isProtocolErr := errors.Cause(sendErr).(*textproto.Error)
+	return isProtocolErr && protocolErr.Code >= 500
+}
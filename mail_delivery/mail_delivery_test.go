@@ -0,0 +1,430 @@
+// Trivial Tickets Ticketsystem
+// Copyright (C) 2019 The Contributors
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+// Package mail_delivery delivers the cached outgoing mails
+// to an SMTP relay and retries failed deliveries with an
+// exponential backoff.
+package mail_delivery
+
+import (
+	"crypto/tls"
+	"encoding/base64"
+	"io/ioutil"
+	"net"
+	"net/textproto"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mortenterhart/trivial-tickets/globals"
+	"github.com/mortenterhart/trivial-tickets/log/testlog"
+	"github.com/mortenterhart/trivial-tickets/structs"
+	"github.com/mortenterhart/trivial-tickets/structs/defaults"
+	"github.com/mortenterhart/trivial-tickets/util/filehandler"
+)
+
+/*
+ * Ticketsystem Trivial Tickets
+ *
+ * Matriculation numbers: 3040018, 6694964, 3478222
+ * Lecture:               Programmieren II, INF16B
+ * Lecturer:              Herr Prof. Dr. Helmut Neemann
+ * Institute:             Duale Hochschule Baden-Württemberg Mosbach
+ *
+ * ---------------
+ *
+ * Package mail_delivery
+ * Delivery of outgoing mails over SMTP
+ */
+
+//revive:disable:deep-exit
+
+// TestMain is started to run the tests and initializes the
+// logging configuration before running the tests. The tests'
+// exit status is returned as the overall exit status.
+func TestMain(m *testing.M) {
+	globals.LogConfig = &structs.LogConfig{
+		LogLevel:  structs.AsLogLevel(defaults.LogLevelString),
+		Verbose:   defaults.LogVerbose,
+		FullPaths: defaults.LogFullPaths,
+	}
+
+	os.Exit(m.Run())
+}
+
+//revive:enable:deep-exit
+
+// receivedMail is a mail accepted by the fake SMTP server.
+type receivedMail struct {
+	from string
+	to   []string
+	data string
+	tls  bool
+	auth string
+}
+
+// fakeSMTPServer is a minimal SMTP server accepting mails
+// on a local port. It optionally offers STARTTLS and can
+// be told to reject all recipients or to hang up on QUIT.
+type fakeSMTPServer struct {
+	listener  net.Listener
+	tlsConfig *tls.Config
+	rejection string
+	dropQuit  bool
+
+	mutex    sync.Mutex
+	received []receivedMail
+}
+
+// newFakeSMTPServer starts a fake SMTP server on a random
+// local port. A non-nil TLS configuration enables STARTTLS.
+func newFakeSMTPServer(t *testing.T, tlsConfig *tls.Config) *fakeSMTPServer {
+	listener, listenErr := net.Listen("tcp", "127.0.0.1:0")
+	if listenErr != nil {
+		t.Fatal(listenErr)
+	}
+
+	server := &fakeSMTPServer{listener: listener, tlsConfig: tlsConfig}
+	go server.serve()
+
+	return server
+}
+
+// serve accepts connections until the listener is closed.
+func (server *fakeSMTPServer) serve() {
+	for {
+		conn, acceptErr := server.listener.Accept()
+		if acceptErr != nil {
+			return
+		}
+
+		go server.handle(conn)
+	}
+}
+
+// handle runs the SMTP conversation on the connection.
+func (server *fakeSMTPServer) handle(conn net.Conn) {
+	defer conn.Close()
+
+	text := textproto.NewConn(conn)
+	text.PrintfLine("220 localhost fake SMTP ready")
+
+	var mail receivedMail
+	for {
+		line, readErr := text.ReadLine()
+		if readErr != nil {
+			return
+		}
+
+		command := strings.ToUpper(strings.SplitN(line, " ", 2)[0])
+		argument := strings.TrimSpace(strings.TrimPrefix(line, strings.SplitN(line, " ", 2)[0]))
+
+		switch command {
+		case "EHLO", "HELO":
+			if server.tlsConfig != nil && !mail.tls {
+				text.PrintfLine("250-localhost")
+				text.PrintfLine("250-STARTTLS")
+				text.PrintfLine("250 AUTH PLAIN")
+			} else {
+				text.PrintfLine("250-localhost")
+				text.PrintfLine("250 AUTH PLAIN")
+			}
+
+		case "STARTTLS":
+			text.PrintfLine("220 ready to start TLS")
+			tlsConn := tls.Server(conn, server.tlsConfig)
+			if handshakeErr := tlsConn.Handshake(); handshakeErr != nil {
+				return
+			}
+			conn = tlsConn
+			text = textproto.NewConn(conn)
+			mail.tls = true
+
+		case "AUTH":
+			credentials, _ := base64.StdEncoding.DecodeString(strings.TrimPrefix(argument, "PLAIN "))
+			mail.auth = string(credentials)
+			text.PrintfLine("235 authentication successful")
+
+		case "MAIL":
+			mail.from = strings.Trim(strings.TrimPrefix(argument, "FROM:"), "<>")
+			text.PrintfLine("250 OK")
+
+		case "RCPT":
+			if server.rejection != "" {
+				text.PrintfLine(server.rejection)
+				continue
+			}
+			mail.to = append(mail.to, strings.Trim(strings.TrimPrefix(argument, "TO:"), "<>"))
+			text.PrintfLine("250 OK")
+
+		case "DATA":
+			text.PrintfLine("354 end data with <CR><LF>.<CR><LF>")
+			data, _ := text.ReadDotBytes()
+			mail.data = string(data)
+			server.mutex.Lock()
+			server.received = append(server.received, mail)
+			server.mutex.Unlock()
+			text.PrintfLine("250 OK queued")
+
+		case "QUIT":
+			if !server.dropQuit {
+				text.PrintfLine("221 bye")
+			}
+			return
+
+		default:
+			text.PrintfLine("250 OK")
+		}
+	}
+}
+
+// mails returns the mails received so far.
+func (server *fakeSMTPServer) mails() []receivedMail {
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+
+	return append([]receivedMail(nil), server.received...)
+}
+
+// close stops the fake SMTP server.
+func (server *fakeSMTPServer) close() {
+	server.listener.Close()
+}
+
+// testMail returns the mail used in the tests.
+func testMail() structs.Mail {
+	return structs.Mail{
+		ID:      "mail123",
+		From:    "no-reply@trivial-tickets.com",
+		To:      "customer@example.com",
+		Subject: "[trivial-tickets] Drucker läuft nicht",
+		Message: "Hello,\n\nyour ticket has been created.",
+	}
+}
+
+// setupMails replaces the cached mails with the test mail
+// and returns a function restoring the previous state.
+func setupMails(t *testing.T) func() {
+	mailDir, dirErr := ioutil.TempDir("", "mails")
+	if dirErr != nil {
+		t.Fatal(dirErr)
+	}
+
+	prevMails, prevConfig := globals.Mails, globals.ServerConfig
+
+	mail := testMail()
+	globals.Mails = map[string]structs.Mail{mail.ID: mail}
+	globals.ServerConfig = &structs.ServerConfig{Mails: mailDir}
+	filehandler.WriteMailFile(mailDir, &mail)
+
+	return func() {
+		globals.Mails, globals.ServerConfig = prevMails, prevConfig
+		os.RemoveAll(mailDir)
+	}
+}
+
+func TestSenderSend(t *testing.T) {
+	testlog.BeginTest()
+	defer testlog.EndTest()
+
+	t.Run("plain", func(t *testing.T) {
+		server := newFakeSMTPServer(t, nil)
+		defer server.close()
+
+		sender := &Sender{Relay: server.listener.Addr().String()}
+
+		assert.NoError(t, sender.Send(testMail()))
+
+		received := server.mails()
+		if assert.Len(t, received, 1) {
+			assert.Equal(t, "no-reply@trivial-tickets.com", received[0].from)
+			assert.Equal(t, []string{"customer@example.com"}, received[0].to)
+			assert.False(t, received[0].tls)
+			assert.Contains(t, received[0].data, "Subject: =?utf-8?q?")
+			assert.Contains(t, received[0].data, "Message-ID: <mail123@trivial-tickets.com>")
+			assert.Contains(t, received[0].data, "your ticket has been created.")
+		}
+	})
+
+	t.Run("startTLSWithAuth", func(t *testing.T) {
+		certificate, certErr := tls.LoadX509KeyPair("../ssl/server.cert", "../ssl/server.key")
+		if certErr != nil {
+			t.Fatal(certErr)
+		}
+
+		server := newFakeSMTPServer(t, &tls.Config{Certificates: []tls.Certificate{certificate}})
+		defer server.close()
+
+		sender := &Sender{
+			Relay:           server.listener.Addr().String(),
+			User:            "tickets",
+			Password:        "secret",
+			RequireStartTLS: true,
+			tlsConfig:       &tls.Config{InsecureSkipVerify: true},
+		}
+
+		assert.NoError(t, sender.Send(testMail()))
+
+		received := server.mails()
+		if assert.Len(t, received, 1) {
+			assert.True(t, received[0].tls, "mail should be sent after STARTTLS")
+			assert.Equal(t, "\x00tickets\x00secret", received[0].auth)
+		}
+	})
+
+	t.Run("startTLSRequired", func(t *testing.T) {
+		server := newFakeSMTPServer(t, nil)
+		defer server.close()
+
+		sender := &Sender{Relay: server.listener.Addr().String(), RequireStartTLS: true}
+
+		assert.Error(t, sender.Send(testMail()))
+		assert.Empty(t, server.mails())
+	})
+
+	t.Run("quitFails", func(t *testing.T) {
+		server := newFakeSMTPServer(t, nil)
+		server.dropQuit = true
+		defer server.close()
+
+		sender := &Sender{Relay: server.listener.Addr().String()}
+
+		assert.NoError(t, sender.Send(testMail()), "accepted mails should count as delivered")
+		assert.Len(t, server.mails(), 1)
+	})
+}
+
+func TestWorkerDeliverDue(t *testing.T) {
+	testlog.BeginTest()
+	defer testlog.EndTest()
+
+	t.Run("delivered", func(t *testing.T) {
+		defer setupMails(t)()
+
+		server := newFakeSMTPServer(t, nil)
+		defer server.close()
+
+		worker := NewWorker(&Sender{Relay: server.listener.Addr().String()})
+
+		assert.Equal(t, 1, worker.DeliverDue(time.Now()))
+		assert.Len(t, server.mails(), 1)
+		assert.Empty(t, globals.Mails, "delivered mail should be removed from the cache")
+		assert.False(t, filehandler.FileExists(globals.ServerConfig.Mails+"/mail123.json"),
+			"delivered mail file should be deleted")
+	})
+
+	t.Run("recordsMessageID", func(t *testing.T) {
+		defer setupMails(t)()
+
+		ticketDir, dirErr := ioutil.TempDir("", "tickets")
+		if dirErr != nil {
+			t.Fatal(dirErr)
+		}
+		defer os.RemoveAll(ticketDir)
+
+		prevTickets := globals.Tickets
+		defer func() {
+			globals.Tickets = prevTickets
+		}()
+
+		globals.ServerConfig.Tickets = ticketDir
+		globals.Tickets = map[string]structs.Ticket{"ticket1": {ID: "ticket1"}}
+
+		mail := globals.Mails["mail123"]
+		mail.TicketID = "ticket1"
+		mail.MessageID = "<mail123.ticket1@trivial-tickets.com>"
+		globals.Mails[mail.ID] = mail
+
+		server := newFakeSMTPServer(t, nil)
+		defer server.close()
+
+		worker := NewWorker(&Sender{Relay: server.listener.Addr().String()})
+
+		assert.Equal(t, 1, worker.DeliverDue(time.Now()))
+		assert.Equal(t, []string{mail.MessageID}, globals.Tickets["ticket1"].MessageIDs,
+			"Message-ID of the delivered mail should be recorded on the ticket")
+	})
+
+	t.Run("retryWithBackoff", func(t *testing.T) {
+		defer setupMails(t)()
+
+		server := newFakeSMTPServer(t, nil)
+		server.rejection = "451 try again later"
+		defer server.close()
+
+		worker := NewWorker(&Sender{Relay: server.listener.Addr().String()})
+		now := time.Now()
+
+		assert.Equal(t, 0, worker.DeliverDue(now))
+		assert.Equal(t, 1, worker.states["mail123"].attempts)
+		assert.Equal(t, now.Add(initialBackoff), worker.states["mail123"].next)
+
+		assert.Equal(t, 0, worker.DeliverDue(now.Add(initialBackoff/2)))
+		assert.Equal(t, 1, worker.states["mail123"].attempts, "mail should not be retried before the backoff")
+
+		now = now.Add(initialBackoff)
+		worker.DeliverDue(now)
+		assert.Equal(t, 2, worker.states["mail123"].attempts)
+		assert.Equal(t, now.Add(2*initialBackoff), worker.states["mail123"].next)
+
+		server.rejection = ""
+		assert.Equal(t, 1, worker.DeliverDue(now.Add(2*initialBackoff)))
+		assert.Empty(t, globals.Mails)
+		assert.Empty(t, worker.states)
+	})
+
+	t.Run("permanentFailure", func(t *testing.T) {
+		defer setupMails(t)()
+
+		server := newFakeSMTPServer(t, nil)
+		server.rejection = "550 no such user"
+		defer server.close()
+
+		worker := NewWorker(&Sender{Relay: server.listener.Addr().String()})
+		now := time.Now()
+
+		worker.DeliverDue(now)
+		server.rejection = ""
+
+		assert.Equal(t, 0, worker.DeliverDue(now.Add(maxBackoff)), "mail should not be retried")
+		assert.Len(t, globals.Mails, 1, "undeliverable mail should remain for the mail API")
+	})
+
+	t.Run("verifiedByAPI", func(t *testing.T) {
+		defer setupMails(t)()
+
+		worker := NewWorker(&Sender{Relay: "127.0.0.1:1"})
+		worker.states["mail123"] = &deliveryState{attempts: 1, next: time.Now().Add(time.Hour)}
+		delete(globals.Mails, "mail123")
+
+		assert.Equal(t, 0, worker.DeliverDue(time.Now()))
+		assert.Empty(t, worker.states, "state of a removed mail should be forgotten")
+	})
+}
+
+func TestBackoff(t *testing.T) {
+	testlog.BeginTest()
+	defer testlog.EndTest()
+
+	assert.Equal(t, initialBackoff, backoff(1))
+	assert.Equal(t, 2*initialBackoff, backoff(2))
+	assert.Equal(t, 4*initialBackoff, backoff(3))
+	assert.Equal(t, maxBackoff, backoff(maxAttempts))
+}
@@ -50,11 +50,12 @@ func ExampleNewMailBody_newTicket() {
 	}
 
 	ticket := structs.Ticket{
-		ID:       "example-ticket",
-		Subject:  "Printer not working",
-		Status:   structs.StatusOpen,
-		User:     editor,
-		Customer: "desparate_user@example.com",
+		ID:          "example-ticket",
+		AccessToken: "0123456789abcdef",
+		Subject:     "Printer not working",
+		Status:      structs.StatusOpen,
+		User:        editor,
+		Customer:    "desparate_user@example.com",
 		Entries: []structs.Entry{
 			{
 				User:      "desparate_user@example.com",
@@ -77,7 +78,7 @@ func ExampleNewMailBody_newTicket() {
 	// -----------------------------
 	// Customer:   desparate_user@example.com
 	// Ticket Key: example-ticket
-	// URL:        https://localhost:8444/ticket?id=example-ticket
+	// URL:        https://localhost:8444/ticket?id=example-ticket&token=0123456789abcdef
 	// Editor:     Example Editor (editor@trivial-tickets.com)
 	// Status:     Open
 	//
@@ -111,11 +112,12 @@ func ExampleNewMailBody_newAnswer() {
 	}
 
 	ticket := structs.Ticket{
-		ID:       "example-ticket",
-		Subject:  "Printer not working",
-		Status:   structs.StatusOpen,
-		User:     editor,
-		Customer: "desparate_user@example.com",
+		ID:          "example-ticket",
+		AccessToken: "0123456789abcdef",
+		Subject:     "Printer not working",
+		Status:      structs.StatusOpen,
+		User:        editor,
+		Customer:    "desparate_user@example.com",
 		Entries: []structs.Entry{
 			{
 				User:      "desparate_user@example.com",
@@ -137,7 +139,7 @@ func ExampleNewMailBody_newAnswer() {
 	// -----------------------------
 	// Customer:   desparate_user@example.com
 	// Ticket Key: example-ticket
-	// URL:        https://localhost:8444/ticket?id=example-ticket
+	// URL:        https://localhost:8444/ticket?id=example-ticket&token=0123456789abcdef
 	// Editor:     Example Editor (editor@trivial-tickets.com)
 	// Status:     Open
 	//
@@ -145,6 +147,11 @@ func ExampleNewMailBody_newAnswer() {
 	//
 	// Of course you can not when the printer is turned off
 	//
+	// Earlier messages:
+	//
+	// desparate_user@example.com wrote:
+	// > I cannot make the printer print my document :(
+	//
 	// -----------------------------
 	//
 	// Kind Regards,
@@ -165,11 +172,12 @@ func ExampleNewMailBody_assignedTicket() {
 	}
 
 	ticket := structs.Ticket{
-		ID:       "example-ticket-2",
-		Subject:  "I need help",
-		Status:   structs.StatusOpen,
-		User:     editor,
-		Customer: "desparate_user@example.com",
+		ID:          "example-ticket-2",
+		AccessToken: "0123456789abcdef",
+		Subject:     "I need help",
+		Status:      structs.StatusOpen,
+		User:        editor,
+		Customer:    "desparate_user@example.com",
 		Entries: []structs.Entry{
 			{
 				User:      "desparate_user@example.com",
@@ -190,7 +198,7 @@ func ExampleNewMailBody_assignedTicket() {
 	// -----------------------------
 	// Customer:   desparate_user@example.com
 	// Ticket Key: example-ticket-2
-	// URL:        https://localhost:8444/ticket?id=example-ticket-2
+	// URL:        https://localhost:8444/ticket?id=example-ticket-2&token=0123456789abcdef
 	// Editor:     Example Editor 2 (editor-2@trivial-tickets.com)
 	// Status:     Open
 	//
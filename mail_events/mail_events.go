@@ -20,11 +20,6 @@
 package mail_events
 
 import (
-	"bytes"
-	"fmt"
-	"html/template"
-	"net/url"
-
 	"github.com/mortenterhart/trivial-tickets/globals"
 	"github.com/mortenterhart/trivial-tickets/log"
 	"github.com/mortenterhart/trivial-tickets/structs"
@@ -63,6 +58,38 @@ const (
 
 	// UnassignedTicket represents the release of a ticket
 	UnassignedTicket
+
+	// ReminderTicket represents a snoozed ticket or a
+	// follow-up becoming due. It is sent to the editor.
+	ReminderTicket
+
+	// StaleReminder represents the reminder of a customer
+	// who has not answered the ticket for a long time
+	StaleReminder
+
+	// StaleClosed represents the closing of a ticket
+	// because the customer did not answer
+	StaleClosed
+
+	// AgentAssigned represents the assignment of a ticket
+	// by another user. It is sent to the assigned editor.
+	AgentAssigned
+
+	// CustomerReply represents a new answer of the customer.
+	// It is sent to the assigned editor.
+	CustomerReply
+
+	// SLAWarning represents the response time of a ticket
+	// being about to pass. It is sent to the assigned editor.
+	SLAWarning
+
+	// Mention represents a user being mentioned in an entry.
+	// It is sent to the mentioned user.
+	Mention
+
+	// DailyDigest represents the daily summary of the open
+	// and overdue tickets of an editor.
+	DailyDigest
 )
 
 // String converts a mail event to a string describing
@@ -83,136 +110,141 @@ func (event Event) String() string {
 
 	case UnassignedTicket:
 		return "unassigned ticket"
-	}
-
-	return "undefined"
-}
 
-// templateMap is the type for the map that fills the mail
-// template with values.
-type templateMap map[string]string
+	case ReminderTicket:
+		return "reminder"
 
-// NewMailBody creates a message to be sent inside a mail body.
-// Depending of the mail event (e.g. ticket or answer creation)
-// different messages are written to the body and populated with
-// information from a given ticket.
-func NewMailBody(event Event, ticket structs.Ticket) string {
-	mailTemplate := template.New("mail_body")
+	case StaleReminder:
+		return "stale reminder"
 
-	// The string was originally built using strings.Builder, however
-	// this type was firstly introduced in Go 1.10 and we want a
-	// backward compatibility with version 1.7
-	var mailBuilder bytes.Buffer
-	mailBuilder.WriteString("Dear Customer,\n\n")
+	case StaleClosed:
+		return "stale closed"
 
-	displayLatestAnswer := false
+	case AgentAssigned:
+		return "agent assignment"
 
-	var eventMessage string
-	switch event {
-	case NewTicket:
-		eventMessage = "Your Ticket '{{.ticketId}}' was created successfully.\n" +
-			fmt.Sprintf("If you want to write a new comment to this ticket,\n"+
-				"please use the following link: mailto:support@trivial-tickets.com?subject=%s\n",
-				url.PathEscape(fmt.Sprintf(`[Ticket "%s"] %s`, ticket.ID, ticket.Subject)))
+	case CustomerReply:
+		return "customer reply"
 
-	case NewAnswer:
-		displayLatestAnswer = true
-		eventMessage = "the user '{{.newAnswerUser}}' wrote a new comment to your ticket:\n"
+	case SLAWarning:
+		return "sla warning"
 
-	case UpdatedTicket:
-		eventMessage = "Your Ticket '{{.ticketId}}' was updated with the following information:\n"
+	case Mention:
+		return "mention"
 
-	case AssignedTicket:
-		eventMessage = "the editor '{{.assignedUserName}}' works on Your Ticket now:\n"
+	case DailyDigest:
+		return "daily digest"
+	}
 
-	case UnassignedTicket:
-		eventMessage = "the editor '{{.assignedUserName}}' has released Your Ticket again:\n"
+	return "undefined"
+}
 
+// IsForEditor reports whether the mail of the event is
+// sent to an editor instead of the customer.
+func (event Event) IsForEditor() bool {
+	switch event {
+	case ReminderTicket, AgentAssigned, CustomerReply, SLAWarning, Mention, DailyDigest:
+		return true
 	}
 
-	mailBuilder.WriteString(eventMessage)
-
-	templateString := `
------------------------------
-Customer:   {{.customer}}
-Ticket Key: {{.ticketId}}
-URL:        {{.url}}
-Editor:     {{.assignedUserMail}}
-Status:     {{.status}}
+	return false
+}
 
-Subject: {{.subject}}
+// IsMutedBy reports whether the user has turned off the
+// notifications of the event. Reminders can not be
+// turned off.
+func (event Event) IsMutedBy(user structs.User) bool {
+	switch event {
+	case AgentAssigned:
+		return user.Notifications.MuteAssignment
 
-{{.message}}
+	case CustomerReply:
+		return user.Notifications.MuteCustomerReply
 
------------------------------
+	case SLAWarning:
+		return user.Notifications.MuteSLAWarning
 
-Kind Regards,
-Your Trivial Tickets Team
+	case Mention:
+		return user.Notifications.MuteMention
 
-This message was automatically generated by trivial-tickets.com.
-Please do not reply to this e-mail.`
+	case DailyDigest:
+		return user.Notifications.MuteDigest
+	}
 
-	mailBuilder.WriteString(templateString)
+	return false
+}
 
-	parsedTemplate, parseErr := mailTemplate.Parse(mailBuilder.String())
-	if parseErr != nil {
-		log.Error("internal error: could not build mail message from template:", parseErr)
-		return ""
-	}
+// Content is the content of a mail created from the
+// templates of an event.
+type Content struct {
+	// Subject is the subject of the mail.
+	Subject string
 
-	mailBuilder.Reset()
+	// Text is the plain text body.
+	Text string
 
-	message, newAnswerUser := getMessage(ticket.Entries, displayLatestAnswer)
+	// HTML is the HTML body which is an alternative
+	// to the plain text body.
+	HTML string
+}
 
-	assignedUserMail, assignedUserName := getAssignedUser(ticket.User)
+// NewMail creates the subject and the plain text and HTML
+// bodies of the mail sent on the event about the ticket out
+// of the loaded templates. The mail is written in the
+// language of the customer if it has templates, otherwise
+// in the default language. Mails for editors are sent to
+// the editor assigned to the ticket.
+func NewMail(event Event, ticket structs.Ticket) (Content, error) {
+	return NewMailTo(event, ticket, ticket.User)
+}
 
-	executeErr := parsedTemplate.Execute(&mailBuilder, templateMap{
-		"customer":         ticket.Customer,
-		"ticketId":         ticket.ID,
-		"url":              fmt.Sprintf("https://localhost:%d/ticket?id=%s", globals.ServerConfig.Port, ticket.ID),
-		"assignedUserName": assignedUserName,
-		"assignedUserMail": assignedUserMail,
-		"status":           ticket.Status.String(),
-		"subject":          ticket.Subject,
-		"message":          message,
-		"newAnswerUser":    newAnswerUser,
-	})
+// NewMailTo creates the mail sent on the event about the
+// ticket like NewMail, but addresses mails for editors to
+// the given recipient. Mails for editors are written in the
+// default language.
+func NewMailTo(event Event, ticket structs.Ticket, recipient structs.User) (Content, error) {
+	language := defaultLanguage()
+	if customer, linked := globals.Customers[ticket.CustomerID]; linked && !event.IsForEditor() && hasLanguage(customer.Language) {
+		language = customer.Language
+	}
 
-	if executeErr != nil {
-		log.Error("internal error: could not fill mail template with ticket information:", executeErr)
-		return ""
+	eventTemplate, templateErr := lookupTemplate(event, language)
+	if templateErr != nil {
+		return Content{}, templateErr
 	}
 
-	return mailBuilder.String()
+	return render(eventTemplate, newMailData(event, ticket, recipient, language))
 }
 
-// getAssignedUser returns a string for the assigned user to be
-// displayed in the mail message. If no user is assigned to the
-// ticket it returns a default non-assigned string. The first
-// return value is the formatted username along with the user's
-// mail address and the second return value is only the name.
-func getAssignedUser(user structs.User) (formattedUsername, userMail string) {
-	if user == (structs.User{}) {
-		return "no editor assigned", "<not assigned>"
+// NewDigest creates the daily digest mail of the recipient
+// summarizing the given open tickets and the overdue ones
+// among them.
+func NewDigest(recipient structs.User, tickets []structs.Ticket, overdue []structs.Ticket) (Content, error) {
+	language := defaultLanguage()
+
+	eventTemplate, templateErr := lookupTemplate(DailyDigest, language)
+	if templateErr != nil {
+		return Content{}, templateErr
 	}
 
-	return fmt.Sprintf("%s (%s)", user.Name, user.Mail), user.Name
-}
+	data := newMailData(DailyDigest, structs.Ticket{}, recipient, language)
+	data.Tickets = tickets
+	data.Overdue = overdue
 
-// getMessage returns either the first or the last message written
-// to a ticket depending on the parameter displayLatestMessage. The
-// username of the user who has written the message is also returned.
-// If the ticket does not contain any entries a default message
-// indicating that no entry was found is returned.
-func getMessage(ticketEntries []structs.Entry, displayLatestMessage bool) (text, username string) {
-	if len(ticketEntries) == 0 {
-		return "no Entry available", "<no user>"
-	}
+	return render(eventTemplate, data)
+}
 
-	if displayLatestMessage {
-		latestEntry := ticketEntries[len(ticketEntries)-1]
-		return latestEntry.Text, latestEntry.User
+// NewMailBody creates a message to be sent inside a mail body.
+// Depending of the mail event (e.g. ticket or answer creation)
+// different messages are written to the body and populated with
+// information from a given ticket. An empty string is returned
+// if the mail cannot be created.
+func NewMailBody(event Event, ticket structs.Ticket) string {
+	content, mailErr := NewMail(event, ticket)
+	if mailErr != nil {
+		log.Error("internal error: could not build mail message from template:", mailErr)
+		return ""
 	}
 
-	return ticketEntries[0].Text, ticketEntries[0].User
+	return content.Text
 }
@@ -21,7 +21,6 @@ package mail_events
 
 import (
 	"fmt"
-	"html/template"
 	"os"
 	"testing"
 
@@ -93,6 +92,9 @@ func testConfig() structs.ServerConfig {
 		Cert:    defaults.TestCertificate,
 		Key:     defaults.TestKey,
 		Web:     defaults.TestWeb,
+
+		MailTemplates: defaults.TestMailTmplTrimmed,
+		MailLanguage:  defaults.ServerMailLang,
 	}
 }
 
@@ -113,6 +115,10 @@ func initializeConfig() {
 
 	logConfig := testLogConfig()
 	globals.LogConfig = &logConfig
+
+	if loadErr := LoadTemplates(config.MailTemplates, config.MailLanguage); loadErr != nil {
+		testlog.Debug("ERROR: cannot load mail templates:", loadErr)
+	}
 }
 
 //revive:disable:deep-exit
@@ -139,11 +145,11 @@ func TestNewMailBodyNewTicket(t *testing.T) {
 
 		t.Run("containsMailEvent", func(t *testing.T) {
 			assert.Contains(t, mailBody, fmt.Sprintf("Your Ticket '%s' was created successfully",
-				template.HTMLEscapeString(testTicket.ID)), "mail body should contain a description of the happened event")
+				testTicket.ID), "mail body should contain a description of the happened event")
 		})
 
 		t.Run("containsEntry", func(t *testing.T) {
-			assert.Contains(t, mailBody, template.HTMLEscapeString(testTicket.Entries[0].Text),
+			assert.Contains(t, mailBody, testTicket.Entries[0].Text,
 				"mail body should contain first written message")
 		})
 	})
@@ -155,12 +161,12 @@ func TestNewMailBodyNewTicket(t *testing.T) {
 
 		t.Run("containsMailEvent", func(t *testing.T) {
 			assert.Contains(t, mailBody, fmt.Sprintf("Your Ticket '%s' was created successfully",
-				template.HTMLEscapeString(testTicket.ID)), "mail body should contain a description of the happened event")
+				testTicket.ID), "mail body should contain a description of the happened event")
 		})
 
 		t.Run("containsAssignedUser", func(t *testing.T) {
-			assert.Contains(t, mailBody, fmt.Sprintf("%s (%s)", template.HTMLEscapeString(testTicket.User.Name),
-				template.HTMLEscapeString(testTicket.User.Mail)), "mail body should contain the name and email of the assigned user")
+			assert.Contains(t, mailBody, fmt.Sprintf("%s (%s)", testTicket.User.Name,
+				testTicket.User.Mail), "mail body should contain the name and email of the assigned user")
 		})
 	})
 }
@@ -176,11 +182,11 @@ func TestNewMailBodyNewAnswer(t *testing.T) {
 
 		t.Run("containsMailEvent", func(t *testing.T) {
 			assert.Contains(t, mailBody, fmt.Sprintf("the user '%s' wrote a new comment to your ticket",
-				template.HTMLEscapeString(testTicket.Entries[0].User)), "mail body should contain a description of the happened event")
+				testTicket.Entries[0].User), "mail body should contain a description of the happened event")
 		})
 
 		t.Run("containsEntry", func(t *testing.T) {
-			assert.Contains(t, mailBody, template.HTMLEscapeString(testTicket.Entries[0].Text),
+			assert.Contains(t, mailBody, testTicket.Entries[0].Text,
 				"mail body should contain first written message")
 		})
 	})
@@ -192,12 +198,12 @@ func TestNewMailBodyNewAnswer(t *testing.T) {
 
 		t.Run("containsMailEvent", func(t *testing.T) {
 			assert.Contains(t, mailBody, fmt.Sprintf("the user '%s' wrote a new comment to your ticket",
-				template.HTMLEscapeString("<no user>")), "mail body should contain a description of the happened event")
+				"<no user>"), "mail body should contain a description of the happened event")
 		})
 
 		t.Run("containsAssignedUser", func(t *testing.T) {
-			assert.Contains(t, mailBody, fmt.Sprintf("%s (%s)", template.HTMLEscapeString(testTicket.User.Name),
-				template.HTMLEscapeString(testTicket.User.Mail)), "mail body should contain the name and email of the assigned user")
+			assert.Contains(t, mailBody, fmt.Sprintf("%s (%s)", testTicket.User.Name,
+				testTicket.User.Mail), "mail body should contain the name and email of the assigned user")
 		})
 	})
 }
@@ -213,11 +219,11 @@ func TestNewMailBodyUpdatedTicket(t *testing.T) {
 
 		t.Run("containsMailEvent", func(t *testing.T) {
 			assert.Contains(t, mailBody, fmt.Sprintf("Your Ticket '%s' was updated with the following information",
-				template.HTMLEscapeString(testTicket.ID)), "mail body should contain a description of the happened event")
+				testTicket.ID), "mail body should contain a description of the happened event")
 		})
 
 		t.Run("containsEntry", func(t *testing.T) {
-			assert.Contains(t, mailBody, template.HTMLEscapeString(testTicket.Entries[0].Text),
+			assert.Contains(t, mailBody, testTicket.Entries[0].Text,
 				"mail body should contain first written message")
 		})
 	})
@@ -229,12 +235,12 @@ func TestNewMailBodyUpdatedTicket(t *testing.T) {
 
 		t.Run("containsMailEvent", func(t *testing.T) {
 			assert.Contains(t, mailBody, fmt.Sprintf("Your Ticket '%s' was updated with the following information",
-				template.HTMLEscapeString(testTicket.ID)), "mail body should contain a description of the happened event")
+				testTicket.ID), "mail body should contain a description of the happened event")
 		})
 
 		t.Run("containsAssignedUser", func(t *testing.T) {
-			assert.Contains(t, mailBody, fmt.Sprintf("%s (%s)", template.HTMLEscapeString(testTicket.User.Name),
-				template.HTMLEscapeString(testTicket.User.Mail)), "mail body should contain the name and email of the assigned user")
+			assert.Contains(t, mailBody, fmt.Sprintf("%s (%s)", testTicket.User.Name,
+				testTicket.User.Mail), "mail body should contain the name and email of the assigned user")
 		})
 	})
 }
@@ -250,11 +256,11 @@ func TestNewMailBodyAssignedTicket(t *testing.T) {
 
 		t.Run("containsMailEvent", func(t *testing.T) {
 			assert.Contains(t, mailBody, fmt.Sprintf("the editor '%s' works on Your Ticket now",
-				template.HTMLEscapeString("<not assigned>")), "mail body should contain a description of the happened event")
+				"<not assigned>"), "mail body should contain a description of the happened event")
 		})
 
 		t.Run("containsEntry", func(t *testing.T) {
-			assert.Contains(t, mailBody, template.HTMLEscapeString(testTicket.Entries[0].Text),
+			assert.Contains(t, mailBody, testTicket.Entries[0].Text,
 				"mail body should contain first written message")
 		})
 	})
@@ -266,12 +272,12 @@ func TestNewMailBodyAssignedTicket(t *testing.T) {
 
 		t.Run("containsMailEvent", func(t *testing.T) {
 			assert.Contains(t, mailBody, fmt.Sprintf("the editor '%s' works on Your Ticket now",
-				template.HTMLEscapeString(testTicket.User.Name)), "mail body should contain a description of the happened event")
+				testTicket.User.Name), "mail body should contain a description of the happened event")
 		})
 
 		t.Run("containsAssignedUser", func(t *testing.T) {
-			assert.Contains(t, mailBody, fmt.Sprintf("%s (%s)", template.HTMLEscapeString(testTicket.User.Name),
-				template.HTMLEscapeString(testTicket.User.Mail)), "mail body should contain the name and email of the assigned user")
+			assert.Contains(t, mailBody, fmt.Sprintf("%s (%s)", testTicket.User.Name,
+				testTicket.User.Mail), "mail body should contain the name and email of the assigned user")
 		})
 	})
 }
@@ -287,11 +293,11 @@ func TestNewMailBodyUnassignedTicket(t *testing.T) {
 
 		t.Run("containsMailEvent", func(t *testing.T) {
 			assert.Contains(t, mailBody, fmt.Sprintf("the editor '%s' has released Your Ticket again",
-				template.HTMLEscapeString("<not assigned>")), "mail body should contain a description of the happened event")
+				"<not assigned>"), "mail body should contain a description of the happened event")
 		})
 
 		t.Run("containsEntry", func(t *testing.T) {
-			assert.Contains(t, mailBody, template.HTMLEscapeString(testTicket.Entries[0].Text),
+			assert.Contains(t, mailBody, testTicket.Entries[0].Text,
 				"mail body should contain first written message")
 		})
 	})
@@ -303,16 +309,36 @@ func TestNewMailBodyUnassignedTicket(t *testing.T) {
 
 		t.Run("containsMailEvent", func(t *testing.T) {
 			assert.Contains(t, mailBody, fmt.Sprintf("the editor '%s' has released Your Ticket again",
-				template.HTMLEscapeString(testTicket.User.Name)), "mail body should contain a description of the happened event")
+				testTicket.User.Name), "mail body should contain a description of the happened event")
 		})
 
 		t.Run("containsAssignedUser", func(t *testing.T) {
-			assert.Contains(t, mailBody, fmt.Sprintf("%s (%s)", template.HTMLEscapeString(testTicket.User.Name),
-				template.HTMLEscapeString(testTicket.User.Mail)), "mail body should contain the name and email of the assigned user")
+			assert.Contains(t, mailBody, fmt.Sprintf("%s (%s)", testTicket.User.Name,
+				testTicket.User.Mail), "mail body should contain the name and email of the assigned user")
 		})
 	})
 }
 
+func TestNewMailBodyInternalEntry(t *testing.T) {
+	testlog.BeginTest()
+	defer testlog.EndTest()
+
+	testTicket := ticket.UpdateTicket("1", "admin@example.com", "Internal note for editors",
+		structs.ReplyInternal, mockTicketWithEntry())
+
+	mailBody := NewMailBody(NewAnswer, testTicket)
+
+	t.Run("skipsInternalEntry", func(t *testing.T) {
+		assert.NotContains(t, mailBody, "Internal note for editors",
+			"mail body should not contain internal entries")
+	})
+
+	t.Run("containsExternalEntry", func(t *testing.T) {
+		assert.Contains(t, mailBody, testTicket.Entries[0].Text,
+			"mail body should contain the latest external message")
+	})
+}
+
 func TestEvent_String(t *testing.T) {
 	testlog.BeginTest()
 	defer testlog.EndTest()
@@ -337,7 +363,148 @@ func TestEvent_String(t *testing.T) {
 		assert.Equal(t, "unassigned ticket", UnassignedTicket.String())
 	})
 
+	t.Run("reminder", func(t *testing.T) {
+		assert.Equal(t, "reminder", ReminderTicket.String())
+	})
+
+	t.Run("staleReminder", func(t *testing.T) {
+		assert.Equal(t, "stale reminder", StaleReminder.String())
+	})
+
+	t.Run("staleClosed", func(t *testing.T) {
+		assert.Equal(t, "stale closed", StaleClosed.String())
+	})
+
+	t.Run("agentAssigned", func(t *testing.T) {
+		assert.Equal(t, "agent assignment", AgentAssigned.String())
+	})
+
+	t.Run("customerReply", func(t *testing.T) {
+		assert.Equal(t, "customer reply", CustomerReply.String())
+	})
+
+	t.Run("slaWarning", func(t *testing.T) {
+		assert.Equal(t, "sla warning", SLAWarning.String())
+	})
+
+	t.Run("mention", func(t *testing.T) {
+		assert.Equal(t, "mention", Mention.String())
+	})
+
+	t.Run("dailyDigest", func(t *testing.T) {
+		assert.Equal(t, "daily digest", DailyDigest.String())
+	})
+
 	t.Run("undefinedEvent", func(t *testing.T) {
 		assert.Equal(t, "undefined", Event(100).String())
 	})
 }
+
+func TestEvent_IsForEditor(t *testing.T) {
+	testlog.BeginTest()
+	defer testlog.EndTest()
+
+	assert.True(t, ReminderTicket.IsForEditor(), "reminders should be sent to the editor")
+	assert.True(t, AgentAssigned.IsForEditor(), "assignments by others should be sent to the editor")
+	assert.True(t, CustomerReply.IsForEditor(), "answers of the customer should be sent to the editor")
+	assert.True(t, Mention.IsForEditor(), "mentions should be sent to the editor")
+	assert.False(t, NewAnswer.IsForEditor(), "answers should be sent to the customer")
+}
+
+func TestEvent_IsMutedBy(t *testing.T) {
+	testlog.BeginTest()
+	defer testlog.EndTest()
+
+	user := mockUser()
+
+	t.Run("defaults", func(t *testing.T) {
+		for _, event := range allEvents {
+			assert.False(t, event.IsMutedBy(user), "notifications should be sent by default")
+		}
+	})
+
+	t.Run("muted", func(t *testing.T) {
+		user.Notifications = structs.Notifications{MuteCustomerReply: true, MuteDigest: true}
+
+		assert.True(t, CustomerReply.IsMutedBy(user))
+		assert.True(t, DailyDigest.IsMutedBy(user))
+		assert.False(t, Mention.IsMutedBy(user), "other notifications should still be sent")
+	})
+
+	t.Run("reminder", func(t *testing.T) {
+		user.Notifications = structs.Notifications{MuteCustomerReply: true, MuteAssignment: true,
+			MuteSLAWarning: true, MuteMention: true, MuteDigest: true}
+
+		assert.False(t, ReminderTicket.IsMutedBy(user), "reminders can not be turned off")
+	})
+}
+
+func TestNewMailBodyReminderTicket(t *testing.T) {
+	testlog.BeginTest()
+	defer testlog.EndTest()
+
+	testTicket := mockTicketWithUser()
+
+	mailBody := NewMailBody(ReminderTicket, testTicket)
+
+	t.Run("greetsEditor", func(t *testing.T) {
+		assert.Contains(t, mailBody, fmt.Sprintf("Dear %s,", testTicket.User.Name),
+			"mail body should address the editor")
+	})
+
+	t.Run("containsMailEvent", func(t *testing.T) {
+		assert.Contains(t, mailBody, fmt.Sprintf("the ticket '%s' you have parked is due again",
+			testTicket.ID), "mail body should contain a description of the happened event")
+	})
+}
+
+func TestNewMailBodyAgentAssigned(t *testing.T) {
+	testlog.BeginTest()
+	defer testlog.EndTest()
+
+	testTicket := mockTicketWithUser()
+
+	mailBody := NewMailBody(AgentAssigned, testTicket)
+
+	assert.Contains(t, mailBody, fmt.Sprintf("Dear %s,", testTicket.User.Name),
+		"mail body should address the editor")
+	assert.Contains(t, mailBody, fmt.Sprintf("the ticket '%s' has been assigned to you", testTicket.ID),
+		"mail body should contain the mail event")
+}
+
+func TestNewMailBodySurvey(t *testing.T) {
+	testlog.BeginTest()
+	defer testlog.EndTest()
+
+	testTicket := mockTicketWithUser()
+	testTicket.Rating.Token = "token123"
+
+	t.Run("closedTicket", func(t *testing.T) {
+		mailBody := NewMailBody(UpdatedTicket, testTicket)
+
+		assert.Contains(t, mailBody, "How satisfied are you", "mail body should contain the survey")
+		assert.Contains(t, mailBody, fmt.Sprintf("https://localhost:%d/rate/%s/token123/5",
+			globals.ServerConfig.Port, testTicket.ID), "mail body should contain a rating link")
+	})
+
+	t.Run("alreadyRated", func(t *testing.T) {
+		ratedTicket := testTicket
+		ratedTicket.Rating.Score = 4
+
+		assert.NotContains(t, NewMailBody(UpdatedTicket, ratedTicket), "How satisfied are you",
+			"rated tickets should not be surveyed again")
+	})
+
+	t.Run("openTicket", func(t *testing.T) {
+		openTicket := testTicket
+		openTicket.Status = structs.StatusInProgress
+
+		assert.NotContains(t, NewMailBody(UpdatedTicket, openTicket), "How satisfied are you",
+			"open tickets should not be surveyed")
+	})
+
+	t.Run("editorMail", func(t *testing.T) {
+		assert.NotContains(t, NewMailBody(ReminderTicket, testTicket), "How satisfied are you",
+			"editors should not be surveyed")
+	})
+}
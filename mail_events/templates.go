@@ -0,0 +1,519 @@
+// Trivial Tickets Ticketsystem
+// Copyright (C) 2019 The Contributors
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+// Package mail_events provides facilities to create
+// standard mail messages for different actions using
+// predefined templates.
+package mail_events
+
+import (
+	"bytes"
+	"fmt"
+	htmltemplate "html/template"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/mortenterhart/trivial-tickets/globals"
+	"github.com/mortenterhart/trivial-tickets/structs"
+	"github.com/mortenterhart/trivial-tickets/structs/defaults"
+	"github.com/mortenterhart/trivial-tickets/ticket"
+)
+
+/*
+ * Ticketsystem Trivial Tickets
+ *
+ * Matriculation numbers: 3040018, 6694964, 3478222
+ * Lecture:               Programmieren II, INF16B
+ * Lecturer:              Herr Prof. Dr. Helmut Neemann
+ * Institute:             Duale Hochschule Baden-Württemberg Mosbach
+ *
+ * ---------------
+ *
+ * Package mail_events
+ * Loading and validation of the localized mail templates
+ */
+
+// commonTemplateFile is the file of a language directory
+// holding the templates shared by all events.
+const commonTemplateFile string = "common.tmpl"
+
+// templateExtension is the file extension of the templates.
+const templateExtension string = ".tmpl"
+
+// Names of the templates each event file has to define.
+const (
+	subjectTemplate string = "subject"
+	bodyTemplate    string = "body"
+	htmlTemplate    string = "html"
+)
+
+// conversationLength is the maximum number of earlier
+// entries quoted in a mail.
+const conversationLength int = 3
+
+// allEvents lists the events for which a template is
+// required in every language.
+var allEvents = []Event{NewTicket, NewAnswer, UpdatedTicket, AssignedTicket, UnassignedTicket,
+	ReminderTicket, StaleReminder, StaleClosed, AgentAssigned, CustomerReply, SLAWarning, Mention, DailyDigest}
+
+// eventTemplate holds the templates of an event parsed
+// once as text for the subject and the plain text body
+// and once as HTML for the escaped HTML body.
+type eventTemplate struct {
+	text *template.Template
+	html *htmltemplate.Template
+}
+
+// mailTemplates holds the parsed templates of each event
+// by language.
+type mailTemplates struct {
+	languages       map[string]map[Event]eventTemplate
+	defaultLanguage string
+}
+
+// templateFuncs are the functions available in the
+// mail templates.
+var templateFuncs = map[string]interface{}{
+	"quote":     quote,
+	"ticketURL": ticketURL,
+}
+
+// loadedTemplates are the templates used to create the
+// mails. They are set by LoadTemplates.
+var loadedTemplates *mailTemplates
+
+// MailData is the data passed to the mail templates. It
+// exposes the ticket together with values prepared for
+// the mail.
+type MailData struct {
+	// Event is the name of the event, i.e. the name of
+	// the template file without extension.
+	Event string
+
+	// Language is the language of the mail.
+	Language string
+
+	// Ticket is the ticket the mail is about. Mails to
+	// customers only get the ticket as customers may see
+	// it, mails to editors get the complete ticket.
+	Ticket structs.Ticket
+
+	// IsForEditor is true if the mail is sent to an
+	// editor, usually the one assigned to the ticket.
+	IsForEditor bool
+
+	// Recipient is the editor the mail is sent to if
+	// IsForEditor is true.
+	Recipient structs.User
+
+	// CustomerName is the name of the customer in the
+	// customer directory, if known.
+	CustomerName string
+
+	// URL is the link to the ticket page.
+	URL string
+
+	// ReplyURL is a mailto link for replies to the ticket.
+	ReplyURL string
+
+	// Entry is the entry the mail is about: the latest
+	// entry for answers and reminders, otherwise the first
+	// entry. Internal entries are never used.
+	Entry structs.Entry
+
+	// Entries are all entries visible to the recipient.
+	// Editors see the internal entries as well.
+	Entries []structs.Entry
+
+	// Conversation are the latest entries visible to the
+	// recipient besides Entry, the newest first.
+	Conversation []structs.Entry
+
+	// Survey holds one rating link per score if the
+	// customer is asked to rate the ticket.
+	Survey []SurveyLink
+
+	// Tickets are the open tickets and Overdue the
+	// overdue ones among them summarized by the daily
+	// digest.
+	Tickets []structs.Ticket
+	Overdue []structs.Ticket
+}
+
+// SurveyLink is a link rating the ticket with the score.
+type SurveyLink struct {
+	Score int
+	URL   string
+}
+
+// templateName returns the name of the template file of
+// the event without extension.
+func (event Event) templateName() string {
+	return strings.Replace(event.String(), " ", "_", -1)
+}
+
+// LoadTemplates reads the mail templates of all languages
+// from the subdirectories of the given directory and checks
+// them by rendering a sample ticket. Each language directory
+// contains a template file per event defining the templates
+// "subject", "body" and "html" and optionally the file
+// common.tmpl with shared templates. The templates are
+// parsed as text and as HTML, but only "html" is rendered
+// as HTML. The default language is used for
+// recipients without a known language.
+func LoadTemplates(directory string, defaultLanguage string) error {
+	entries, readErr := ioutil.ReadDir(directory)
+	if readErr != nil {
+		return errors.Wrap(readErr, "unable to read mail template directory")
+	}
+
+	templates := &mailTemplates{
+		languages:       make(map[string]map[Event]eventTemplate),
+		defaultLanguage: defaultLanguage,
+	}
+
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+
+		language := entry.Name()
+		events, parseErr := parseLanguage(filepath.Join(directory, language))
+		if parseErr != nil {
+			return errors.Wrapf(parseErr, "invalid mail templates for language '%s'", language)
+		}
+
+		templates.languages[language] = events
+	}
+
+	if _, exists := templates.languages[defaultLanguage]; !exists {
+		return errors.Errorf("no mail templates for the default language '%s' in '%s'", defaultLanguage, directory)
+	}
+
+	for language, events := range templates.languages {
+		for _, event := range allEvents {
+			if _, renderErr := render(events[event], sampleData(event, language)); renderErr != nil {
+				return errors.Wrapf(renderErr, "invalid mail template '%s' for language '%s'", event.templateName(), language)
+			}
+		}
+	}
+
+	loadedTemplates = templates
+	return nil
+}
+
+// defaultLanguage returns the default language of the
+// loaded mail templates.
+func defaultLanguage() string {
+	if loadedTemplates == nil {
+		return ""
+	}
+
+	return loadedTemplates.defaultLanguage
+}
+
+// hasLanguage reports whether mail templates have been
+// loaded for the language.
+func hasLanguage(language string) bool {
+	if loadedTemplates == nil {
+		return false
+	}
+
+	_, exists := loadedTemplates.languages[language]
+	return exists
+}
+
+// lookupTemplate returns the loaded templates of the event
+// in the language.
+func lookupTemplate(event Event, language string) (eventTemplate, error) {
+	if loadedTemplates == nil {
+		return eventTemplate{}, errors.New("mail templates have not been loaded")
+	}
+
+	events, exists := loadedTemplates.languages[language][event]
+	if !exists {
+		return eventTemplate{}, errors.Errorf("no mail template for event '%s'", event.String())
+	}
+
+	return events, nil
+}
+
+// Languages returns the sorted languages of the loaded
+// mail templates.
+func Languages() []string {
+	if loadedTemplates == nil {
+		return nil
+	}
+
+	var languages []string
+	for language := range loadedTemplates.languages {
+		languages = append(languages, language)
+	}
+	sort.Strings(languages)
+
+	return languages
+}
+
+// parseLanguage parses the templates of all events in the
+// language directory.
+func parseLanguage(directory string) (map[Event]eventTemplate, error) {
+	commonData, readErr := ioutil.ReadFile(filepath.Join(directory, commonTemplateFile))
+	if readErr != nil && !os.IsNotExist(readErr) {
+		return nil, readErr
+	}
+
+	commonText, parseErr := template.New(commonTemplateFile).Funcs(templateFuncs).Parse(string(commonData))
+	if parseErr != nil {
+		return nil, parseErr
+	}
+
+	commonHTML, parseErr := htmltemplate.New(commonTemplateFile).Funcs(templateFuncs).Parse(string(commonData))
+	if parseErr != nil {
+		return nil, parseErr
+	}
+
+	events := make(map[Event]eventTemplate)
+	for _, event := range allEvents {
+		data, readErr := ioutil.ReadFile(filepath.Join(directory, event.templateName()+templateExtension))
+		if readErr != nil {
+			return nil, errors.Wrapf(readErr, "missing template for event '%s'", event.String())
+		}
+
+		textEvent, cloneErr := commonText.Clone()
+		if cloneErr != nil {
+			return nil, cloneErr
+		}
+
+		if _, parseErr := textEvent.New(event.templateName()).Parse(string(data)); parseErr != nil {
+			return nil, parseErr
+		}
+
+		htmlEvent, cloneErr := commonHTML.Clone()
+		if cloneErr != nil {
+			return nil, cloneErr
+		}
+
+		if _, parseErr := htmlEvent.New(event.templateName()).Parse(string(data)); parseErr != nil {
+			return nil, parseErr
+		}
+
+		for _, name := range []string{subjectTemplate, bodyTemplate, htmlTemplate} {
+			if textEvent.Lookup(name) == nil {
+				return nil, errors.Errorf("template '%s' does not define '%s'", event.templateName(), name)
+			}
+		}
+
+		events[event] = eventTemplate{text: textEvent, html: htmlEvent}
+	}
+
+	return events, nil
+}
+
+// render executes the subject, body and HTML templates with
+// the data. White space in the subject is collapsed.
+func render(eventTemplate eventTemplate, data MailData) (Content, error) {
+	var subject, body, html bytes.Buffer
+
+	if executeErr := eventTemplate.text.ExecuteTemplate(&subject, subjectTemplate, data); executeErr != nil {
+		return Content{}, executeErr
+	}
+
+	if executeErr := eventTemplate.text.ExecuteTemplate(&body, bodyTemplate, data); executeErr != nil {
+		return Content{}, executeErr
+	}
+
+	if executeErr := eventTemplate.html.ExecuteTemplate(&html, htmlTemplate, data); executeErr != nil {
+		return Content{}, executeErr
+	}
+
+	return Content{
+		Subject: strings.Join(strings.Fields(subject.String()), " "),
+		Text:    body.String(),
+		HTML:    html.String(),
+	}, nil
+}
+
+// newMailData collects the data for the mail of the event
+// about the ticket sent to the recipient if the event is
+// meant for editors. Mails to customers only get the ticket
+// as customers may see it.
+func newMailData(event Event, currentTicket structs.Ticket, recipient structs.User, language string) MailData {
+	var customerName string
+	if customer, linked := globals.Customers[currentTicket.CustomerID]; linked {
+		customerName = customer.Name
+	}
+
+	// Customers need the access token to open the ticket
+	link := ticketURL(currentTicket.ID)
+	if !event.IsForEditor() {
+		currentTicket = ticket.CustomerView(currentTicket)
+		recipient = structs.User{}
+		link = customerTicketURL(currentTicket)
+	}
+
+	entries := currentTicket.Entries
+
+	var entry structs.Entry
+	entryIndex := -1
+	if len(entries) > 0 {
+		entryIndex = 0
+		if event.isAboutLatestEntry() {
+			entryIndex = len(entries) - 1
+		}
+		entry = entries[entryIndex]
+	}
+
+	return MailData{
+		Event:        event.templateName(),
+		Language:     language,
+		Ticket:       currentTicket,
+		IsForEditor:  event.IsForEditor(),
+		Recipient:    recipient,
+		CustomerName: customerName,
+		URL:          link,
+		ReplyURL: fmt.Sprintf("mailto:%s?subject=%s", supportAddress(),
+			url.PathEscape(fmt.Sprintf(`[Ticket "%s"] %s`, currentTicket.ID, currentTicket.Subject))),
+		Entry:        entry,
+		Entries:      entries,
+		Conversation: conversation(entries, entryIndex),
+		Survey:       surveyLinks(event, currentTicket),
+	}
+}
+
+// isAboutLatestEntry reports whether the mail of the event
+// is about the latest entry instead of the first entry.
+func (event Event) isAboutLatestEntry() bool {
+	switch event {
+	case NewAnswer, StaleReminder, StaleClosed, CustomerReply, SLAWarning, Mention:
+		return true
+	}
+
+	return false
+}
+
+// ticketURL returns the link to the page of the ticket.
+func ticketURL(ticketID string) string {
+	return fmt.Sprintf("https://localhost:%d/ticket?id=%s", globals.ServerConfig.Port, ticketID)
+}
+
+// customerTicketURL returns the link to the page of the
+// ticket including the access token for the customer.
+// Tickets without access token are linked by their id.
+func customerTicketURL(ticket structs.Ticket) string {
+	if ticket.AccessToken == "" {
+		return ticketURL(ticket.ID)
+	}
+
+	return ticketURL(ticket.ID) + "&token=" + url.QueryEscape(ticket.AccessToken)
+}
+
+// sampleData returns the data of a sample ticket which is
+// used to check the templates.
+func sampleData(event Event, language string) MailData {
+	now := time.Now()
+	editor := structs.User{ID: "sample", Name: "Sample Editor", Username: "sample", Mail: "editor@example.com"}
+	sample := structs.Ticket{
+		ID:       "TT-2019-000001",
+		Subject:  "Sample",
+		Status:   structs.StatusClosed,
+		User:     editor,
+		Customer: "customer@example.com",
+		Entries:  []structs.Entry{{Date: now, User: "customer@example.com", Text: "Sample", ReplyType: structs.ReplyExternal}},
+	}
+
+	return MailData{
+		Event:        event.templateName(),
+		Language:     language,
+		IsForEditor:  event.IsForEditor(),
+		Recipient:    editor,
+		CustomerName: "Sample Customer",
+		URL:          "https://localhost/ticket?id=TT-2019-000001",
+		ReplyURL:     "mailto:support@example.com",
+		Ticket:       sample,
+		Entry:        structs.Entry{Date: now, User: "customer@example.com", Text: "Sample", ReplyType: structs.ReplyExternal},
+		Entries:      []structs.Entry{{Date: now, User: "customer@example.com", Text: "Sample", ReplyType: structs.ReplyExternal}},
+		Conversation: []structs.Entry{{Date: now, User: "editor@example.com", Text: "Sample\nAnswer", ReplyType: structs.ReplyExternal}},
+		Survey:       []SurveyLink{{Score: structs.MaxRatingScore, URL: "https://localhost/rate"}},
+		Tickets:      []structs.Ticket{sample},
+		Overdue:      []structs.Ticket{sample},
+	}
+}
+
+// supportAddress returns the address customers write to.
+func supportAddress() string {
+	if len(globals.ServerConfig.SupportAddresses) > 0 {
+		return globals.ServerConfig.SupportAddresses[0]
+	}
+
+	return defaults.ServerSupport
+}
+
+// conversation returns the latest entries besides the entry
+// at the given index, the newest first. At most
+// conversationLength entries are returned.
+func conversation(entries []structs.Entry, entryIndex int) []structs.Entry {
+	var latest []structs.Entry
+	for index := len(entries) - 1; index >= 0 && len(latest) < conversationLength; index-- {
+		if index != entryIndex {
+			latest = append(latest, entries[index])
+		}
+	}
+
+	return latest
+}
+
+// quote prefixes each line of the text with "> " as it
+// is usual for quoted messages in plain text mails.
+func quote(text string) string {
+	lines := strings.Split(strings.TrimRight(text, "\n"), "\n")
+	for index, line := range lines {
+		lines[index] = strings.TrimRight("> "+line, " ")
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+// surveyLinks returns the links of the satisfaction survey
+// appended to mails sent to the customer of a closed ticket.
+// There is one link for each score which rates the ticket
+// with a single click. No links are returned if the ticket
+// is not closed, was already rated or the mail is sent to
+// the editor.
+func surveyLinks(event Event, ticket structs.Ticket) []SurveyLink {
+	if event.IsForEditor() || ticket.Status != structs.StatusClosed ||
+		ticket.Rating.Token == "" || ticket.Rating.IsRated() {
+		return nil
+	}
+
+	var links []SurveyLink
+	for score := structs.MaxRatingScore; score >= structs.MinRatingScore; score-- {
+		links = append(links, SurveyLink{
+			Score: score,
+			URL: fmt.Sprintf("https://localhost:%d/rate/%s/%s/%d", globals.ServerConfig.Port,
+				url.PathEscape(ticket.ID), ticket.Rating.Token, score),
+		})
+	}
+
+	return links
+}
@@ -0,0 +1,397 @@
+// Trivial Tickets Ticketsystem
+// Copyright (C) 2019 The Contributors
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+// Package mail_events provides facilities to create
+// standard mail messages for different actions using
+// predefined templates.
+package mail_events
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mortenterhart/trivial-tickets/globals"
+	"github.com/mortenterhart/trivial-tickets/log/testlog"
+	"github.com/mortenterhart/trivial-tickets/structs"
+	"github.com/mortenterhart/trivial-tickets/structs/defaults"
+)
+
+/*
+ * Ticketsystem Trivial Tickets
+ *
+ * Matriculation numbers: 3040018, 6694964, 3478222
+ * Lecture:               Programmieren II, INF16B
+ * Lecturer:              Herr Prof. Dr. Helmut Neemann
+ * Institute:             Duale Hochschule Baden-Württemberg Mosbach
+ *
+ * ---------------
+ *
+ * Package mail_events [tests]
+ * Loading and validation of the localized mail templates
+ */
+
+// copyTemplates copies the English mail templates into
+// the language directory "en" of a temporary directory
+// and returns the path to the temporary directory.
+func copyTemplates(t *testing.T) string {
+	directory, dirErr := ioutil.TempDir("", "mail_templates")
+	if !assert.NoError(t, dirErr, "creating temporary directory should not fail") {
+		t.FailNow()
+	}
+
+	languageDirectory := filepath.Join(directory, "en")
+	assert.NoError(t, os.Mkdir(languageDirectory, 0755))
+
+	files, readErr := ioutil.ReadDir(filepath.Join(defaults.TestMailTmplTrimmed, "en"))
+	assert.NoError(t, readErr)
+
+	for _, file := range files {
+		data, _ := ioutil.ReadFile(filepath.Join(defaults.TestMailTmplTrimmed, "en", file.Name()))
+		assert.NoError(t, ioutil.WriteFile(filepath.Join(languageDirectory, file.Name()), data, defaults.FileModeRegular))
+	}
+
+	return directory
+}
+
+// reloadTemplates loads the mail templates of the
+// test configuration again.
+func reloadTemplates() {
+	if loadErr := LoadTemplates(defaults.TestMailTmplTrimmed, defaults.ServerMailLang); loadErr != nil {
+		testlog.Debug("ERROR: cannot load mail templates:", loadErr)
+	}
+}
+
+func TestLoadTemplates(t *testing.T) {
+	testlog.BeginTest()
+	defer testlog.EndTest()
+
+	defer reloadTemplates()
+
+	t.Run("shippedTemplates", func(t *testing.T) {
+		assert.NoError(t, LoadTemplates(defaults.TestMailTmplTrimmed, "de"), "shipped templates should be valid")
+		assert.Equal(t, []string{"de", "en"}, Languages(), "English and German templates should be loaded")
+	})
+
+	t.Run("missingDirectory", func(t *testing.T) {
+		assert.Error(t, LoadTemplates("non-existing-directory", "en"))
+	})
+
+	t.Run("missingDefaultLanguage", func(t *testing.T) {
+		assert.Error(t, LoadTemplates(defaults.TestMailTmplTrimmed, "fr"),
+			"default language without templates should produce an error")
+	})
+
+	t.Run("missingEventTemplate", func(t *testing.T) {
+		directory := copyTemplates(t)
+		defer os.RemoveAll(directory)
+
+		assert.NoError(t, os.Remove(filepath.Join(directory, "en", "reminder.tmpl")))
+
+		assert.Error(t, LoadTemplates(directory, "en"), "missing event template should produce an error")
+	})
+
+	t.Run("missingBody", func(t *testing.T) {
+		directory := copyTemplates(t)
+		defer os.RemoveAll(directory)
+
+		assert.NoError(t, ioutil.WriteFile(filepath.Join(directory, "en", "new_ticket.tmpl"),
+			[]byte(`{{define "subject"}}New ticket{{end}}`), defaults.FileModeRegular))
+
+		assert.Error(t, LoadTemplates(directory, "en"), "template without body should produce an error")
+	})
+
+	t.Run("missingHTML", func(t *testing.T) {
+		directory := copyTemplates(t)
+		defer os.RemoveAll(directory)
+
+		assert.NoError(t, ioutil.WriteFile(filepath.Join(directory, "en", "new_ticket.tmpl"),
+			[]byte(`{{define "subject"}}New ticket{{end}}{{define "body"}}Body{{end}}`), defaults.FileModeRegular))
+
+		assert.Error(t, LoadTemplates(directory, "en"), "template without HTML body should produce an error")
+	})
+
+	t.Run("syntaxError", func(t *testing.T) {
+		directory := copyTemplates(t)
+		defer os.RemoveAll(directory)
+
+		assert.NoError(t, ioutil.WriteFile(filepath.Join(directory, "en", "new_ticket.tmpl"),
+			[]byte(`{{define "subject"}}{{.Ticket.ID}{{end}}{{define "body"}}{{end}}{{define "html"}}{{end}}`), defaults.FileModeRegular))
+
+		assert.Error(t, LoadTemplates(directory, "en"), "template with syntax error should produce an error")
+	})
+
+	t.Run("unknownField", func(t *testing.T) {
+		directory := copyTemplates(t)
+		defer os.RemoveAll(directory)
+
+		assert.NoError(t, ioutil.WriteFile(filepath.Join(directory, "en", "new_ticket.tmpl"),
+			[]byte(`{{define "subject"}}{{.Ticket.Unknown}}{{end}}{{define "body"}}{{end}}{{define "html"}}{{end}}`), defaults.FileModeRegular))
+
+		assert.Error(t, LoadTemplates(directory, "en"), "template with unknown field should produce an error")
+	})
+}
+
+func TestNewMail(t *testing.T) {
+	testlog.BeginTest()
+	defer testlog.EndTest()
+
+	defer func() {
+		globals.Customers = make(map[string]structs.Customer)
+	}()
+
+	testTicket := mockTicketWithEntry()
+	testTicket.CustomerID = "customer-id"
+
+	t.Run("subject", func(t *testing.T) {
+		content, mailErr := NewMail(NewTicket, testTicket)
+
+		assert.NoError(t, mailErr)
+		assert.Equal(t, `[Ticket "`+testTicket.ID+`"] `+testTicket.Subject, content.Subject,
+			"subject should contain the ticket id and subject")
+	})
+
+	t.Run("customerName", func(t *testing.T) {
+		globals.Customers["customer-id"] = structs.Customer{ID: "customer-id", Name: "Jane Doe"}
+
+		content, mailErr := NewMail(NewTicket, testTicket)
+
+		assert.NoError(t, mailErr)
+		assert.Contains(t, content.Text, "Dear Jane Doe,", "mail should greet the customer by name")
+	})
+
+	t.Run("customerLanguage", func(t *testing.T) {
+		globals.Customers["customer-id"] = structs.Customer{ID: "customer-id", Name: "Jane Doe", Language: "de"}
+
+		content, mailErr := NewMail(NewTicket, testTicket)
+
+		assert.NoError(t, mailErr)
+		assert.Contains(t, content.Text, "Guten Tag Jane Doe,", "mail should be written in German")
+		assert.Contains(t, content.Text, "wurde erfolgreich erstellt", "mail should be written in German")
+		assert.Contains(t, content.Text, "Status:     Offen", "status should be translated")
+	})
+
+	t.Run("unknownLanguage", func(t *testing.T) {
+		globals.Customers["customer-id"] = structs.Customer{ID: "customer-id", Language: "fr"}
+
+		content, mailErr := NewMail(NewTicket, testTicket)
+
+		assert.NoError(t, mailErr)
+		assert.Contains(t, content.Text, "was created successfully", "mail should fall back to the default language")
+	})
+
+	t.Run("editorLanguage", func(t *testing.T) {
+		globals.Customers["customer-id"] = structs.Customer{ID: "customer-id", Language: "de"}
+
+		editorTicket := testTicket
+		editorTicket.User = mockUser()
+
+		content, mailErr := NewMail(AgentAssigned, editorTicket)
+
+		assert.NoError(t, mailErr)
+		assert.Contains(t, content.Text, "has been assigned to you", "mails to editors should use the default language")
+	})
+}
+
+func TestNewMailData(t *testing.T) {
+	testlog.BeginTest()
+	defer testlog.EndTest()
+
+	testTicket := mockTicketWithEntry()
+	testTicket.User = mockUser()
+	testTicket.User.Hash = "$2a$12$secret"
+	testTicket.Entries = append(testTicket.Entries,
+		structs.Entry{User: "admin@example.com", Text: "Internal note", ReplyType: structs.ReplyInternal})
+	testTicket.WorkLogs = []structs.WorkLog{{User: testTicket.User.Username, Minutes: 15}}
+	testTicket.FiredRules = []structs.FiredRule{{Rule: "vip"}}
+
+	t.Run("customer", func(t *testing.T) {
+		data := newMailData(NewAnswer, testTicket, structs.User{}, defaultLanguage())
+
+		assert.Len(t, data.Ticket.Entries, len(testTicket.Entries)-1, "internal entries should be removed")
+		assert.Empty(t, data.Ticket.WorkLogs, "logged time should be removed")
+		assert.Empty(t, data.Ticket.FiredRules, "fired rules should be removed")
+		assert.Empty(t, data.Ticket.User.Hash, "credentials of the editor should be removed")
+		assert.Equal(t, testTicket.User.Name, data.Ticket.User.Name, "name of the editor should be kept")
+	})
+
+	t.Run("editor", func(t *testing.T) {
+		data := newMailData(Mention, testTicket, mockUser(), defaultLanguage())
+
+		assert.Equal(t, testTicket, data.Ticket, "editors should get the complete ticket")
+	})
+}
+
+func TestNewMailTo(t *testing.T) {
+	testlog.BeginTest()
+	defer testlog.EndTest()
+
+	testTicket := mockTicketWithEntry()
+	testTicket.User = mockUser()
+	testTicket.AccessToken = "0123456789abcdef"
+	testTicket.Entries = append(testTicket.Entries,
+		structs.Entry{User: "admin@example.com", Text: "@max4711 can you take a look?", ReplyType: structs.ReplyInternal})
+
+	mentioned := structs.User{ID: "max-id", Name: "Max Mustermann", Username: "max4711", Mail: "max@example.com"}
+
+	t.Run("mention", func(t *testing.T) {
+		content, mailErr := NewMailTo(Mention, testTicket, mentioned)
+
+		assert.NoError(t, mailErr)
+		assert.Contains(t, content.Text, "Dear Max Mustermann,", "mail should greet the mentioned user")
+		assert.Contains(t, content.Text, "admin@example.com has mentioned you", "mail should name the author")
+		assert.Contains(t, content.Text, "@max4711 can you take a look?", "editors should see internal entries")
+		assert.NotContains(t, content.Text, testTicket.AccessToken, "editors do not need the access token")
+	})
+
+	t.Run("customerMail", func(t *testing.T) {
+		content, mailErr := NewMailTo(NewAnswer, testTicket, mentioned)
+
+		assert.NoError(t, mailErr)
+		assert.NotContains(t, content.Text, "can you take a look", "customers should not see internal entries")
+		assert.NotContains(t, content.Text, "Max Mustermann", "customer mails should not be addressed to editors")
+		assert.Contains(t, content.Text, "&token="+testTicket.AccessToken, "customer link should contain the access token")
+	})
+
+	t.Run("oldTicket", func(t *testing.T) {
+		oldTicket := testTicket
+		oldTicket.AccessToken = ""
+
+		content, mailErr := NewMailTo(NewAnswer, oldTicket, mentioned)
+
+		assert.NoError(t, mailErr)
+		assert.Contains(t, content.Text, ticketURL(oldTicket.ID)+"\n", "tickets without a token should be linked by id")
+		assert.NotContains(t, content.Text, "token=", "tickets without a token should be linked by id")
+	})
+}
+
+func TestNewDigest(t *testing.T) {
+	testlog.BeginTest()
+	defer testlog.EndTest()
+
+	openTicket := structs.Ticket{ID: "open123", Subject: "Printer", Status: structs.StatusInProgress}
+	overdueTicket := structs.Ticket{ID: "overdue123", Subject: "<b>Scanner</b>", Status: structs.StatusOpen}
+
+	content, mailErr := NewDigest(mockUser(), []structs.Ticket{openTicket, overdueTicket}, []structs.Ticket{overdueTicket})
+
+	assert.NoError(t, mailErr)
+
+	t.Run("subject", func(t *testing.T) {
+		assert.Equal(t, "Daily digest: 2 open, 1 overdue ticket(s)", content.Subject)
+	})
+
+	t.Run("text", func(t *testing.T) {
+		assert.Contains(t, content.Text, "Dear Admin,", "digest should greet the editor")
+		assert.Contains(t, content.Text, "Overdue tickets:\n  - [overdue123] <b>Scanner</b>", "digest should list the overdue tickets")
+		assert.Contains(t, content.Text, "  - [open123] Printer (In Progress)", "digest should list the open tickets")
+		assert.Contains(t, content.Text, fmt.Sprintf("https://localhost:%d/ticket?id=open123", globals.ServerConfig.Port),
+			"digest should link the tickets")
+	})
+
+	t.Run("html", func(t *testing.T) {
+		assert.Contains(t, content.HTML, "&lt;b&gt;Scanner&lt;/b&gt;", "ticket data should be escaped")
+		assert.Contains(t, content.HTML, "/ticket?id=overdue123", "digest should link the tickets")
+	})
+
+	t.Run("noOverdueTickets", func(t *testing.T) {
+		content, _ := NewDigest(mockUser(), []structs.Ticket{openTicket}, nil)
+
+		assert.NotContains(t, content.Text, "Overdue tickets", "empty overdue list should be omitted")
+	})
+}
+
+func TestNewMailHTML(t *testing.T) {
+	testlog.BeginTest()
+	defer testlog.EndTest()
+
+	testTicket := mockTicketWithEntry()
+	testTicket.Subject = "<b>Printer</b> & scanner"
+	testTicket.Entries = append(testTicket.Entries,
+		structs.Entry{User: "editor@example.com", Text: "Is it switched on?", ReplyType: structs.ReplyExternal},
+		structs.Entry{User: "editor@example.com", Text: "Internal note", ReplyType: structs.ReplyInternal},
+		structs.Entry{User: testTicket.Customer, Text: "Yes, it is.\nStill not working.", ReplyType: structs.ReplyExternal})
+
+	content, mailErr := NewMail(NewAnswer, testTicket)
+
+	assert.NoError(t, mailErr)
+
+	t.Run("escaped", func(t *testing.T) {
+		assert.Contains(t, content.HTML, "&lt;b&gt;Printer&lt;/b&gt; &amp; scanner", "ticket data should be escaped")
+		assert.NotContains(t, content.HTML, "<b>Printer</b>", "ticket data should be escaped")
+		assert.Contains(t, content.Text, testTicket.Subject, "plain text should not be escaped")
+	})
+
+	t.Run("links", func(t *testing.T) {
+		newTicket, _ := NewMail(NewTicket, testTicket)
+
+		assert.Contains(t, newTicket.HTML, `href="mailto:`, "HTML should contain the reply link")
+		assert.NotContains(t, newTicket.HTML, "ZgotmplZ", "links should not be filtered as unsafe")
+	})
+
+	t.Run("latestEntry", func(t *testing.T) {
+		assert.Contains(t, content.HTML, "Yes, it is.\nStill not working.", "HTML should contain the latest entry")
+	})
+
+	t.Run("conversation", func(t *testing.T) {
+		assert.Contains(t, content.Text, "Earlier messages:\n\neditor@example.com wrote:\n> Is it switched on?\n\n"+
+			testTicket.Customer+" wrote", "plain text should quote the earlier entries, the newest first")
+		assert.Contains(t, content.HTML, "Is it switched on?", "HTML should contain the earlier entries")
+		assert.NotContains(t, content.Text, "Internal note", "internal entries should not be quoted")
+		assert.NotContains(t, content.HTML, "Internal note", "internal entries should not be quoted")
+	})
+}
+
+func TestConversation(t *testing.T) {
+	testlog.BeginTest()
+	defer testlog.EndTest()
+
+	var entries []structs.Entry
+	for _, text := range []string{"1", "2", "3", "4", "5"} {
+		entries = append(entries, structs.Entry{Text: text})
+	}
+
+	t.Run("latestEntry", func(t *testing.T) {
+		latest := conversation(entries, len(entries)-1)
+
+		if assert.Len(t, latest, conversationLength) {
+			assert.Equal(t, "4", latest[0].Text, "newest entry should be first")
+			assert.Equal(t, "2", latest[2].Text)
+		}
+	})
+
+	t.Run("firstEntry", func(t *testing.T) {
+		latest := conversation(entries, 0)
+
+		if assert.Len(t, latest, conversationLength) {
+			assert.Equal(t, "5", latest[0].Text, "newest entry should be first")
+		}
+	})
+
+	t.Run("noEntries", func(t *testing.T) {
+		assert.Empty(t, conversation(nil, -1))
+	})
+}
+
+func TestQuote(t *testing.T) {
+	testlog.BeginTest()
+	defer testlog.EndTest()
+
+	assert.Equal(t, "> first line\n>\n> second line", quote("first line\n\nsecond line\n"))
+}
@@ -0,0 +1,138 @@
+// Trivial Tickets Ticketsystem
+// Copyright (C) 2019 The Contributors
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+// Package mail_guard protects the ticket system against mail
+// loops by limiting the number of mails accepted per sender
+// and suppressing notifications to looping addresses.
+package mail_guard
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mortenterhart/trivial-tickets/globals"
+)
+
+/*
+ * Ticketsystem Trivial Tickets
+ *
+ * Matriculation numbers: 3040018, 6694964, 3478222
+ * Lecture:               Programmieren II, INF16B
+ * Lecturer:              Herr Prof. Dr. Helmut Neemann
+ * Institute:             Duale Hochschule Baden-Württemberg Mosbach
+ *
+ * ---------------
+ *
+ * Package mail_guard
+ * Protection against mail loops
+ */
+
+// rateWindow is the duration in which the mails of a
+// sender are counted.
+const rateWindow time.Duration = time.Hour
+
+// received holds the times of the mails received from
+// each sender within the rate window.
+var received = make(map[string][]time.Time)
+
+// receivedLock guards the received mails because they
+// are recorded by the web server, the SMTP server and
+// the mailbox poller concurrently.
+var receivedLock sync.Mutex
+
+// Allow records a mail of the sender received at the given
+// time and reports whether it is within the rate limit of
+// the server configuration. Mails above the limit are still
+// counted so that a looping sender stays blocked until it
+// calms down.
+func Allow(sender string, now time.Time) bool {
+	limit := globals.ServerConfig.MailRateLimit
+	if limit == 0 {
+		return true
+	}
+
+	receivedLock.Lock()
+	defer receivedLock.Unlock()
+
+	address := strings.ToLower(sender)
+	times := append(recent(received[address], now), now)
+	received[address] = times
+
+	return uint(len(times)) <= limit
+}
+
+// IsLooping reports whether the address exceeded the rate
+// limit within the rate window. No notifications should be
+// sent to a looping address.
+func IsLooping(address string, now time.Time) bool {
+	limit := globals.ServerConfig.MailRateLimit
+	if limit == 0 {
+		return false
+	}
+
+	receivedLock.Lock()
+	defer receivedLock.Unlock()
+
+	return uint(len(update(strings.ToLower(address), now))) > limit
+}
+
+// Prune forgets the senders without mails within the rate
+// window before now, so that addresses which only sent a
+// few mails do not stay in memory.
+func Prune(now time.Time) {
+	receivedLock.Lock()
+	defer receivedLock.Unlock()
+
+	for address := range received {
+		update(address, now)
+	}
+}
+
+// Reset forgets all received mails.
+func Reset() {
+	receivedLock.Lock()
+	defer receivedLock.Unlock()
+
+	received = make(map[string][]time.Time)
+}
+
+// update removes the times of the address which lie outside
+// of the rate window before now and returns the remaining
+// times. Addresses without remaining times are forgotten.
+// The caller has to hold the receivedLock.
+func update(address string, now time.Time) []time.Time {
+	times := recent(received[address], now)
+	if len(times) == 0 {
+		delete(received, address)
+		return nil
+	}
+
+	received[address] = times
+
+	return times
+}
+
+// recent returns the times which lie within the rate
+// window before now.
+func recent(times []time.Time, now time.Time) []time.Time {
+	start := 0
+	for start < len(times) && !times[start].After(now.Add(-rateWindow)) {
+		start++
+	}
+
+	return times[start:]
+}
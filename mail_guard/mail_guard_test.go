@@ -0,0 +1,106 @@
+// Trivial Tickets Ticketsystem
+// Copyright (C) 2019 The Contributors
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+// Package mail_guard protects the ticket system against mail
+// loops by limiting the number of mails accepted per sender
+// and suppressing notifications to looping addresses.
+package mail_guard
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mortenterhart/trivial-tickets/globals"
+	"github.com/mortenterhart/trivial-tickets/log/testlog"
+	"github.com/mortenterhart/trivial-tickets/structs"
+)
+
+/*
+ * Ticketsystem Trivial Tickets
+ *
+ * Matriculation numbers: 3040018, 6694964, 3478222
+ * Lecture:               Programmieren II, INF16B
+ * Lecturer:              Herr Prof. Dr. Helmut Neemann
+ * Institute:             Duale Hochschule Baden-Württemberg Mosbach
+ *
+ * ---------------
+ *
+ * Package mail_guard [tests]
+ * Protection against mail loops
+ */
+
+func TestAllow(t *testing.T) {
+	testlog.BeginTest()
+	defer testlog.EndTest()
+
+	globals.ServerConfig = &structs.ServerConfig{MailRateLimit: 2}
+	defer Reset()
+
+	now := time.Date(2019, time.January, 7, 10, 0, 0, 0, time.UTC)
+
+	t.Run("withinLimit", func(t *testing.T) {
+		assert.True(t, Allow("Loop@mail.com", now))
+		assert.True(t, Allow("loop@mail.com", now.Add(time.Minute)))
+		assert.False(t, IsLooping("loop@mail.com", now.Add(time.Minute)))
+	})
+
+	t.Run("exceeded", func(t *testing.T) {
+		assert.False(t, Allow("loop@mail.com", now.Add(2*time.Minute)), "third mail should exceed the limit")
+		assert.True(t, IsLooping("LOOP@mail.com", now.Add(2*time.Minute)), "address should be looping")
+		assert.False(t, IsLooping("other@mail.com", now.Add(2*time.Minute)), "other addresses should not be affected")
+	})
+
+	t.Run("windowPassed", func(t *testing.T) {
+		later := now.Add(rateWindow + 3*time.Minute)
+
+		assert.False(t, IsLooping("loop@mail.com", later), "address should calm down after the window")
+		assert.True(t, Allow("loop@mail.com", later))
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		globals.ServerConfig.MailRateLimit = 0
+
+		for count := 0; count < 10; count++ {
+			assert.True(t, Allow("many@mail.com", now))
+		}
+		assert.False(t, IsLooping("many@mail.com", now))
+	})
+}
+
+func TestPrune(t *testing.T) {
+	testlog.BeginTest()
+	defer testlog.EndTest()
+
+	globals.ServerConfig = &structs.ServerConfig{MailRateLimit: 2}
+	defer Reset()
+
+	now := time.Date(2019, time.January, 7, 10, 0, 0, 0, time.UTC)
+
+	Allow("old@mail.com", now)
+	Allow("recent@mail.com", now.Add(rateWindow))
+
+	Prune(now.Add(rateWindow + time.Minute))
+
+	assert.NotContains(t, received, "old@mail.com", "senders without recent mails should be forgotten")
+	assert.Contains(t, received, "recent@mail.com", "senders with recent mails should be kept")
+
+	t.Run("isLooping", func(t *testing.T) {
+		assert.False(t, IsLooping("recent@mail.com", now.Add(3*rateWindow)))
+		assert.NotContains(t, received, "recent@mail.com", "calm senders should be forgotten")
+	})
+}
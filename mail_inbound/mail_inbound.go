@@ -0,0 +1,398 @@
+// Trivial Tickets Ticketsystem
+// Copyright (C) 2019 The Contributors
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+// Package mail_inbound implements an SMTP server receiving
+// mails for the support addresses and turning them into new
+// tickets or answers.
+package mail_inbound
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/mortenterhart/trivial-tickets/api/api_in"
+	"github.com/mortenterhart/trivial-tickets/globals"
+	"github.com/mortenterhart/trivial-tickets/log"
+	"github.com/mortenterhart/trivial-tickets/structs"
+)
+
+/*
+ * Ticketsystem Trivial Tickets
+ *
+ * Matriculation numbers: 3040018, 6694964, 3478222
+ * Lecture:               Programmieren II, INF16B
+ * Lecturer:              Herr Prof. Dr. Helmut Neemann
+ * Institute:             Duale Hochschule Baden-Württemberg Mosbach
+ *
+ * ---------------
+ *
+ * Package mail_inbound
+ * SMTP server for incoming mails
+ */
+
+// commandTimeout is the maximum duration the server waits
+// for the next command of a client.
+const commandTimeout time.Duration = 5 * time.Minute
+
+// hostname is the name the server greets the clients with.
+const hostname string = "trivial-tickets"
+
+// maxLineLength is the maximum length of a command line
+// including the line break as defined by RFC 5321.
+const maxLineLength int = 1000
+
+// maxRecipients is the maximum number of recipients of
+// a single mail transaction.
+const maxRecipients int = 100
+
+// errLineTooLong is returned by readCommand for command
+// lines longer than maxLineLength.
+var errLineTooLong = errors.New("line too long")
+
+// Server accepts mails over SMTP. Only mails to one of the
+// support addresses and not larger than the maximum size
+// are accepted.
+type Server struct {
+	listener  net.Listener
+	addresses map[string]bool
+	maxSize   int64
+}
+
+// Listen creates a server listening on the SMTP address of
+// the server configuration. The connections are accepted
+// after calling Serve.
+func Listen(config *structs.ServerConfig) (*Server, error) {
+	listener, listenErr := net.Listen("tcp", config.SMTPListen)
+	if listenErr != nil {
+		return nil, errors.Wrapf(listenErr, "unable to listen for SMTP connections on '%s'", config.SMTPListen)
+	}
+
+	addresses := make(map[string]bool)
+	for _, address := range config.SupportAddresses {
+		addresses[strings.ToLower(address)] = true
+	}
+
+	return &Server{
+		listener:  listener,
+		addresses: addresses,
+		maxSize:   config.MaxMailSize,
+	}, nil
+}
+
+// Addr returns the address the server listens on.
+func (server *Server) Addr() net.Addr {
+	return server.listener.Addr()
+}
+
+// Serve accepts connections and handles each of them in
+// its own Go routine until the server is closed.
+func (server *Server) Serve() {
+	for {
+		conn, acceptErr := server.listener.Accept()
+		if acceptErr != nil {
+			return
+		}
+
+		go server.handle(conn)
+	}
+}
+
+// Close stops accepting new connections.
+func (server *Server) Close() error {
+	log.Info("Stopping SMTP server on", server.Addr())
+	return server.listener.Close()
+}
+
+// session holds the state of the mail transaction of a
+// single connection.
+type session struct {
+	greeted    bool
+	started    bool
+	from       string
+	recipients []string
+}
+
+// reset discards the current mail transaction.
+func (s *session) reset() {
+	s.started = false
+	s.from = ""
+	s.recipients = nil
+}
+
+// handle runs the SMTP conversation with a client.
+func (server *Server) handle(conn net.Conn) {
+	defer conn.Close()
+
+	text := textproto.NewConn(conn)
+	reply(text, 220, hostname+" ESMTP ready")
+
+	var state session
+	for {
+		conn.SetDeadline(time.Now().Add(commandTimeout))
+
+		line, readErr := readCommand(text.R)
+		if readErr == errLineTooLong {
+			reply(text, 500, "5.5.2 Line too long")
+			continue
+		}
+		if readErr != nil {
+			return
+		}
+
+		verb, argument := splitCommand(line)
+		switch verb {
+		case "HELO":
+			state.greeted = true
+			state.reset()
+			reply(text, 250, hostname)
+
+		case "EHLO":
+			state.greeted = true
+			state.reset()
+			text.PrintfLine("250-%s", hostname)
+			text.PrintfLine("250-8BITMIME")
+			text.PrintfLine("250 SIZE %d", server.maxSize)
+
+		case "MAIL":
+			server.handleMail(text, &state, argument)
+
+		case "RCPT":
+			server.handleRcpt(text, &state, argument)
+
+		case "DATA":
+			server.handleData(text, &state)
+
+		case "RSET":
+			state.reset()
+			reply(text, 250, "2.0.0 OK")
+
+		case "NOOP":
+			reply(text, 250, "2.0.0 OK")
+
+		case "QUIT":
+			reply(text, 221, "2.0.0 Bye")
+			return
+
+		default:
+			reply(text, 502, "5.5.1 Command not implemented")
+		}
+	}
+}
+
+// handleMail starts a new mail transaction for a sender with
+// a valid address or the null sender "<>" used by bounces
+// and delivery status notifications. A declared size larger
+// than the maximum size is rejected.
+func (server *Server) handleMail(text *textproto.Conn, state *session, argument string) {
+	if !state.greeted {
+		reply(text, 503, "5.5.1 Send HELO or EHLO first")
+		return
+	}
+
+	address, params, pathErr := parsePath(argument, "FROM:")
+	if pathErr != nil {
+		reply(text, 501, "5.5.4 Syntax: MAIL FROM:<address>")
+		return
+	}
+
+	if address != "" && !api_in.ValidEmailAddress(address) {
+		reply(text, 553, "5.1.7 Invalid sender address")
+		return
+	}
+
+	for _, param := range params {
+		if strings.HasPrefix(strings.ToUpper(param), "SIZE=") {
+			size, sizeErr := strconv.ParseInt(param[len("SIZE="):], 10, 64)
+			if sizeErr == nil && size > server.maxSize {
+				reply(text, 552, "5.3.4 Message size exceeds fixed maximum message size")
+				return
+			}
+		}
+	}
+
+	state.reset()
+	state.started = true
+	state.from = address
+	reply(text, 250, "2.1.0 OK")
+}
+
+// handleRcpt adds a recipient to the transaction if it is
+// one of the support addresses.
+func (server *Server) handleRcpt(text *textproto.Conn, state *session, argument string) {
+	if !state.started {
+		reply(text, 503, "5.5.1 Send MAIL first")
+		return
+	}
+
+	if len(state.recipients) >= maxRecipients {
+		reply(text, 452, "4.5.3 Too many recipients")
+		return
+	}
+
+	address, _, pathErr := parsePath(argument, "TO:")
+	if pathErr != nil {
+		reply(text, 501, "5.5.4 Syntax: RCPT TO:<address>")
+		return
+	}
+
+	if !server.addresses[strings.ToLower(address)] {
+		log.Warnf("Rejecting mail from '%s' to unknown recipient '%s'", state.from, address)
+		reply(text, 550, "5.1.1 Mailbox unavailable")
+		return
+	}
+
+	state.recipients = append(state.recipients, address)
+	reply(text, 250, "2.1.5 OK")
+}
+
+// handleData reads the message and creates a new ticket or
+// answer out of it. Mails of the null sender are accepted
+// without creating a ticket so that bounces do not start
+// a conversation.
+func (server *Server) handleData(text *textproto.Conn, state *session) {
+	if len(state.recipients) == 0 {
+		reply(text, 503, "5.5.1 Send RCPT first")
+		return
+	}
+
+	reply(text, 354, "End data with <CR><LF>.<CR><LF>")
+
+	dotReader := text.DotReader()
+	data, readErr := ioutil.ReadAll(io.LimitReader(dotReader, server.maxSize+1))
+	if readErr != nil {
+		return
+	}
+
+	from := state.from
+	state.reset()
+
+	if int64(len(data)) > server.maxSize {
+		io.Copy(ioutil.Discard, dotReader)
+		log.Warnf("Rejecting mail from '%s' exceeding the maximum size of %d bytes", from, server.maxSize)
+		reply(text, 552, "5.3.4 Message size exceeds fixed maximum message size")
+		return
+	}
+
+	if from == "" {
+		log.Info("Ignoring mail of the null sender received over SMTP")
+		reply(text, 250, "2.0.0 OK: mail ignored")
+		return
+	}
+
+	message, parseErr := api_in.ParseMessage(bytes.NewReader(data))
+	if parseErr != nil {
+		log.Warnf("Rejecting unreadable mail from '%s': %v", from, parseErr)
+		reply(text, 554, "5.6.0 "+parseErr.Error())
+		return
+	}
+
+	if !api_in.ValidEmailAddress(message.Mail.From) {
+		message.Mail.From = from
+	}
+
+	log.Infof(`Received mail "%s" from '%s' over SMTP`, message.Mail.Subject, message.Mail.From)
+
+	globals.StorageLock.Lock()
+	createdTicket, processErr := api_in.ProcessMessage(message)
+	globals.StorageLock.Unlock()
+
+	if api_in.IsIgnored(processErr) {
+		reply(text, 250, "2.0.0 OK: mail ignored")
+		return
+	}
+	if processErr != nil {
+		log.Error("unable to process mail received over SMTP:", processErr)
+		reply(text, 451, "4.3.0 Mail could not be processed")
+		return
+	}
+
+	reply(text, 250, "2.0.0 OK: ticket "+createdTicket.ID)
+}
+
+// readCommand reads the next command line without the line
+// break. The rest of a line longer than maxLineLength is
+// discarded instead of being kept in memory and
+// errLineTooLong is returned.
+func readCommand(reader *bufio.Reader) (string, error) {
+	var line []byte
+	tooLong := false
+
+	for {
+		chunk, readErr := reader.ReadSlice('\n')
+		if !tooLong {
+			line = append(line, chunk...)
+			if len(line) > maxLineLength {
+				tooLong = true
+				line = nil
+			}
+		}
+
+		if readErr == bufio.ErrBufferFull {
+			continue
+		}
+		if readErr != nil {
+			return "", readErr
+		}
+
+		break
+	}
+
+	if tooLong {
+		return "", errLineTooLong
+	}
+
+	return strings.TrimRight(string(line), "\r\n"), nil
+}
+
+// reply writes a single line reply with the given code.
+func reply(text *textproto.Conn, code int, message string) {
+	text.PrintfLine("%d %s", code, message)
+}
+
+// splitCommand splits a command line into the upper case
+// verb and its argument.
+func splitCommand(line string) (string, string) {
+	fields := strings.SplitN(strings.TrimSpace(line), " ", 2)
+	if len(fields) == 1 {
+		return strings.ToUpper(fields[0]), ""
+	}
+
+	return strings.ToUpper(fields[0]), strings.TrimSpace(fields[1])
+}
+
+// parsePath extracts the address of the path "FROM:<address>"
+// or "TO:<address>" and the following parameters.
+func parsePath(argument string, prefix string) (string, []string, error) {
+	if !strings.HasPrefix(strings.ToUpper(argument), prefix) {
+		return "", nil, errors.New("missing " + prefix)
+	}
+
+	fields := strings.Fields(strings.TrimSpace(argument[len(prefix):]))
+	if len(fields) == 0 || !strings.HasPrefix(fields[0], "<") || !strings.HasSuffix(fields[0], ">") {
+		return "", nil, errors.New("invalid path")
+	}
+
+	return strings.Trim(fields[0], "<>"), fields[1:], nil
+}
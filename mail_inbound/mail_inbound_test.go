@@ -0,0 +1,331 @@
+// Trivial Tickets Ticketsystem
+// Copyright (C) 2019 The Contributors
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+// Package mail_inbound implements an SMTP server receiving
+// mails for the support addresses and turning them into new
+// tickets or answers.
+package mail_inbound
+
+import (
+	"bufio"
+	"io/ioutil"
+	"net/smtp"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mortenterhart/trivial-tickets/globals"
+	"github.com/mortenterhart/trivial-tickets/log/testlog"
+	"github.com/mortenterhart/trivial-tickets/structs"
+	"github.com/mortenterhart/trivial-tickets/structs/defaults"
+)
+
+/*
+ * Ticketsystem Trivial Tickets
+ *
+ * Matriculation numbers: 3040018, 6694964, 3478222
+ * Lecture:               Programmieren II, INF16B
+ * Lecturer:              Herr Prof. Dr. Helmut Neemann
+ * Institute:             Duale Hochschule Baden-Württemberg Mosbach
+ *
+ * ---------------
+ *
+ * Package mail_inbound [tests]
+ * SMTP server for incoming mails
+ */
+
+//revive:disable:deep-exit
+
+// TestMain is started to run the tests and initializes the
+// logging configuration before running the tests. The tests'
+// exit status is returned as the overall exit status.
+func TestMain(m *testing.M) {
+	globals.LogConfig = &structs.LogConfig{
+		LogLevel:  structs.AsLogLevel(defaults.LogLevelString),
+		Verbose:   defaults.LogVerbose,
+		FullPaths: defaults.LogFullPaths,
+	}
+
+	os.Exit(m.Run())
+}
+
+//revive:enable:deep-exit
+
+// startTestServer starts an SMTP server on a random local
+// port with empty ticket and mail storages. The returned
+// function stops the server and removes the test files.
+func startTestServer(t *testing.T) (*Server, func()) {
+	directory, dirErr := ioutil.TempDir("", "inbound")
+	if dirErr != nil {
+		t.Fatal(dirErr)
+	}
+
+	config := &structs.ServerConfig{
+		Tickets:          filepath.Join(directory, "tickets"),
+		Mails:            filepath.Join(directory, "mails"),
+		SMTPListen:       "127.0.0.1:0",
+		SupportAddresses: []string{"Support@Example.com"},
+		MaxMailSize:      1024,
+	}
+
+	prevConfig, prevTickets, prevMails := globals.ServerConfig, globals.Tickets, globals.Mails
+	globals.ServerConfig = config
+	globals.Tickets = make(map[string]structs.Ticket)
+	globals.Mails = make(map[string]structs.Mail)
+
+	server, listenErr := Listen(config)
+	if listenErr != nil {
+		t.Fatal(listenErr)
+	}
+	go server.Serve()
+
+	return server, func() {
+		server.Close()
+		globals.ServerConfig, globals.Tickets, globals.Mails = prevConfig, prevTickets, prevMails
+		os.RemoveAll(directory)
+	}
+}
+
+// sendMail sends the message over SMTP to the server.
+func sendMail(server *Server, to string, message string) error {
+	return smtp.SendMail(server.Addr().String(), nil, "customer@example.com", []string{to},
+		[]byte(strings.Replace(message, "\n", "\r\n", -1)))
+}
+
+func TestServer(t *testing.T) {
+	testlog.BeginTest()
+	defer testlog.EndTest()
+
+	t.Run("createTicket", func(t *testing.T) {
+		server, stop := startTestServer(t)
+		defer stop()
+
+		err := sendMail(server, "support@example.com", "From: Customer <customer@example.com>\n"+
+			"To: support@example.com\n"+
+			"Subject: Printer is broken\n"+
+			"\n"+
+			"The printer does not print.\n")
+
+		assert.NoError(t, err)
+		if assert.Len(t, globals.Tickets, 1) {
+			for _, created := range globals.Tickets {
+				assert.Equal(t, "customer@example.com", created.Customer)
+				assert.Equal(t, "Printer is broken", created.Subject)
+				assert.Equal(t, "The printer does not print.", created.Entries[0].Text)
+			}
+		}
+	})
+
+	t.Run("answer", func(t *testing.T) {
+		server, stop := startTestServer(t)
+		defer stop()
+
+		globals.Tickets["TT-2019-000001"] = structs.Ticket{
+			ID:       "TT-2019-000001",
+			Subject:  "Printer is broken",
+			Customer: "customer@example.com",
+			Status:   structs.StatusInProgress,
+			Entries:  []structs.Entry{{User: "customer@example.com", Text: "The printer does not print."}},
+		}
+
+		err := sendMail(server, "support@example.com", "From: customer@example.com\n"+
+			"Subject: Re: [Ticket \"TT-2019-000001\"] Printer is broken\n"+
+			"\n"+
+			"It works again.\n")
+
+		assert.NoError(t, err)
+		assert.Len(t, globals.Tickets, 1, "answer should not create a new ticket")
+		assert.Len(t, globals.Tickets["TT-2019-000001"].Entries, 2)
+	})
+
+	t.Run("unknownRecipient", func(t *testing.T) {
+		server, stop := startTestServer(t)
+		defer stop()
+
+		err := sendMail(server, "sales@example.com", "From: customer@example.com\n"+
+			"Subject: Offer\n"+
+			"\n"+
+			"Text\n")
+
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "550")
+		assert.Empty(t, globals.Tickets)
+	})
+
+	t.Run("tooLarge", func(t *testing.T) {
+		server, stop := startTestServer(t)
+		defer stop()
+
+		err := sendMail(server, "support@example.com", "From: customer@example.com\n"+
+			"Subject: Large\n"+
+			"\n"+
+			strings.Repeat("Large message.\n", 100))
+
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "552")
+		assert.Empty(t, globals.Tickets)
+	})
+
+	t.Run("unreadable", func(t *testing.T) {
+		server, stop := startTestServer(t)
+		defer stop()
+
+		err := sendMail(server, "support@example.com", "Subject: No sender\n\nText\n")
+
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "554")
+		assert.Empty(t, globals.Tickets)
+	})
+
+	t.Run("autoReply", func(t *testing.T) {
+		server, stop := startTestServer(t)
+		defer stop()
+
+		err := sendMail(server, "support@example.com", "From: customer@example.com\n"+
+			"Subject: Out of office\n"+
+			"Auto-Submitted: auto-replied\n"+
+			"\n"+
+			"I am on holiday.\n")
+
+		assert.NoError(t, err, "auto-replies should be accepted")
+		assert.Empty(t, globals.Tickets, "auto-replies should be ignored")
+	})
+
+	t.Run("nullSender", func(t *testing.T) {
+		server, stop := startTestServer(t)
+		defer stop()
+
+		err := smtp.SendMail(server.Addr().String(), nil, "", []string{"support@example.com"},
+			[]byte("From: MAILER-DAEMON@example.com\r\n"+
+				"Subject: Undelivered Mail Returned to Sender\r\n"+
+				"\r\n"+
+				"The mail could not be delivered.\r\n"))
+
+		assert.NoError(t, err, "bounces with the null sender should be accepted")
+		assert.Empty(t, globals.Tickets, "bounces should not create tickets")
+	})
+
+	t.Run("invalidSender", func(t *testing.T) {
+		server, stop := startTestServer(t)
+		defer stop()
+
+		err := smtp.SendMail(server.Addr().String(), nil, "customer", []string{"support@example.com"},
+			[]byte("Subject: Invalid\r\n\r\nText\r\n"))
+
+		if assert.Error(t, err, "invalid sender addresses should be rejected") {
+			assert.Contains(t, err.Error(), "553")
+		}
+	})
+
+	t.Run("recipientWithoutMail", func(t *testing.T) {
+		server, stop := startTestServer(t)
+		defer stop()
+
+		client, dialErr := smtp.Dial(server.Addr().String())
+		if !assert.NoError(t, dialErr) {
+			return
+		}
+		defer client.Close()
+
+		err := client.Rcpt("support@example.com")
+		if assert.Error(t, err, "RCPT before MAIL should be rejected") {
+			assert.Contains(t, err.Error(), "503")
+		}
+	})
+
+	t.Run("lineTooLong", func(t *testing.T) {
+		server, stop := startTestServer(t)
+		defer stop()
+
+		conn, dialErr := textproto.Dial("tcp", server.Addr().String())
+		if !assert.NoError(t, dialErr) {
+			return
+		}
+		defer conn.Close()
+
+		_, _, err := conn.ReadResponse(220)
+		assert.NoError(t, err)
+
+		assert.NoError(t, conn.PrintfLine("NOOP %s", strings.Repeat("x", 2*maxLineLength)))
+		code, _, _ := conn.ReadResponse(500)
+		assert.Equal(t, 500, code, "too long lines should be rejected")
+
+		assert.NoError(t, conn.PrintfLine("NOOP"))
+		_, _, err = conn.ReadResponse(250)
+		assert.NoError(t, err, "the session should continue after a too long line")
+	})
+
+	t.Run("tooManyRecipients", func(t *testing.T) {
+		server, stop := startTestServer(t)
+		defer stop()
+
+		client, dialErr := smtp.Dial(server.Addr().String())
+		if !assert.NoError(t, dialErr) {
+			return
+		}
+		defer client.Close()
+
+		assert.NoError(t, client.Mail("customer@example.com"))
+		for i := 0; i < maxRecipients; i++ {
+			assert.NoError(t, client.Rcpt("support@example.com"))
+		}
+
+		err := client.Rcpt("support@example.com")
+		if assert.Error(t, err, "recipients above the limit should be rejected") {
+			assert.Contains(t, err.Error(), "452")
+		}
+	})
+}
+
+func TestReadCommand(t *testing.T) {
+	testlog.BeginTest()
+	defer testlog.EndTest()
+
+	reader := bufio.NewReaderSize(strings.NewReader("NOOP\r\n"+
+		strings.Repeat("x", 5000)+"\r\n"+
+		"QUIT\r\n"), 16)
+
+	line, err := readCommand(reader)
+	assert.NoError(t, err)
+	assert.Equal(t, "NOOP", line)
+
+	_, err = readCommand(reader)
+	assert.Equal(t, errLineTooLong, err)
+
+	line, err = readCommand(reader)
+	assert.NoError(t, err)
+	assert.Equal(t, "QUIT", line, "the rest of a too long line should be discarded")
+}
+
+func TestParsePath(t *testing.T) {
+	testlog.BeginTest()
+	defer testlog.EndTest()
+
+	address, params, err := parsePath("FROM:<customer@example.com> SIZE=100", "FROM:")
+	assert.NoError(t, err)
+	assert.Equal(t, "customer@example.com", address)
+	assert.Equal(t, []string{"SIZE=100"}, params)
+
+	_, _, err = parsePath("TO:customer@example.com", "TO:")
+	assert.Error(t, err, "path without angle brackets should be rejected")
+
+	_, _, err = parsePath("<customer@example.com>", "FROM:")
+	assert.Error(t, err, "path without prefix should be rejected")
+}
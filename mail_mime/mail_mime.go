@@ -0,0 +1,118 @@
+// Trivial Tickets Ticketsystem
+// Copyright (C) 2019 The Contributors
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+// Package mail_mime formats the outgoing mails in the
+// Internet Message Format so that they can be delivered
+// over SMTP or fetched over the mail API.
+package mail_mime
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/textproto"
+	"time"
+
+	"github.com/mortenterhart/trivial-tickets/structs"
+)
+
+/*
+ * Ticketsystem Trivial Tickets
+ *
+ * Matriculation numbers: 3040018, 6694964, 3478222
+ * Lecture:               Programmieren II, INF16B
+ * Lecturer:              Herr Prof. Dr. Helmut Neemann
+ * Institute:             Duale Hochschule Baden-Württemberg Mosbach
+ *
+ * ---------------
+ *
+ * Package mail_mime
+ * Formatting of outgoing mails as MIME messages
+ */
+
+// Content types of the bodies.
+const (
+	textContentType string = "text/plain; charset=utf-8"
+	htmlContentType string = "text/html; charset=utf-8"
+)
+
+// Compose formats the mail as RFC 5322 message sent at the
+// given date. Mails with an HTML message are composed as
+// multipart/alternative with the plain text part first,
+// other mails have a single plain text body. All bodies are
+// quoted-printable UTF-8. Mails without their own Message-ID
+// get one derived from the mail id.
+func Compose(mail structs.Mail, date time.Time) []byte {
+	var message bytes.Buffer
+
+	messageID := mail.MessageID
+	if messageID == "" {
+		messageID = fmt.Sprintf("<%s@trivial-tickets.com>", mail.ID)
+	}
+
+	fmt.Fprintf(&message, "From: %s\r\n", mail.From)
+	fmt.Fprintf(&message, "To: %s\r\n", mail.To)
+	fmt.Fprintf(&message, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", mail.Subject))
+	fmt.Fprintf(&message, "Date: %s\r\n", date.Format(time.RFC1123Z))
+	fmt.Fprintf(&message, "Message-ID: %s\r\n", messageID)
+	fmt.Fprint(&message, "MIME-Version: 1.0\r\n")
+
+	if mail.HTMLMessage == "" {
+		fmt.Fprintf(&message, "Content-Type: %s\r\n", textContentType)
+		fmt.Fprint(&message, "Content-Transfer-Encoding: quoted-printable\r\n")
+		fmt.Fprint(&message, "\r\n")
+
+		writeQuotedPrintable(&message, mail.Message)
+		return message.Bytes()
+	}
+
+	parts := multipart.NewWriter(&message)
+	fmt.Fprintf(&message, "Content-Type: %s\r\n", mime.FormatMediaType("multipart/alternative",
+		map[string]string{"boundary": parts.Boundary()}))
+	fmt.Fprint(&message, "\r\n")
+
+	writePart(parts, textContentType, mail.Message)
+	writePart(parts, htmlContentType, mail.HTMLMessage)
+	parts.Close()
+
+	return message.Bytes()
+}
+
+// writePart adds a quoted-printable part with the content
+// type and body to the multipart message.
+func writePart(parts *multipart.Writer, contentType string, body string) {
+	header := make(textproto.MIMEHeader)
+	header.Set("Content-Type", contentType)
+	header.Set("Content-Transfer-Encoding", "quoted-printable")
+
+	part, createErr := parts.CreatePart(header)
+	if createErr != nil {
+		return
+	}
+
+	writeQuotedPrintable(part, body)
+}
+
+// writeQuotedPrintable writes the body quoted-printable
+// encoded to the writer.
+func writeQuotedPrintable(writer io.Writer, body string) {
+	encoder := quotedprintable.NewWriter(writer)
+	encoder.Write([]byte(body))
+	encoder.Close()
+}
@@ -0,0 +1,130 @@
+// Trivial Tickets Ticketsystem
+// Copyright (C) 2019 The Contributors
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+// Package mail_mime formats the outgoing mails in the
+// Internet Message Format so that they can be delivered
+// over SMTP or fetched over the mail API.
+package mail_mime
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mortenterhart/trivial-tickets/log/testlog"
+	"github.com/mortenterhart/trivial-tickets/structs"
+)
+
+/*
+ * Ticketsystem Trivial Tickets
+ *
+ * Matriculation numbers: 3040018, 6694964, 3478222
+ * Lecture:               Programmieren II, INF16B
+ * Lecturer:              Herr Prof. Dr. Helmut Neemann
+ * Institute:             Duale Hochschule Baden-Württemberg Mosbach
+ *
+ * ---------------
+ *
+ * Package mail_mime [tests]
+ * Formatting of outgoing mails as MIME messages
+ */
+
+// testMail returns an outgoing mail without HTML message.
+func testMail() structs.Mail {
+	return structs.Mail{
+		ID:      "mail123",
+		From:    "no-reply@trivial-tickets.com",
+		To:      "customer@example.com",
+		Subject: "[Ticket \"TT-2019-000001\"] Drucker läuft nicht",
+		Message: "Dear Customer,\n\nyour ticket has been created.",
+	}
+}
+
+// readBody reads the decoded body and converts the line
+// breaks of the message back to newlines.
+func readBody(t *testing.T, body io.Reader) string {
+	data, readErr := ioutil.ReadAll(body)
+	assert.NoError(t, readErr, "body should be valid quoted-printable")
+
+	return strings.Replace(string(data), "\r\n", "\n", -1)
+}
+
+func TestCompose(t *testing.T) {
+	testlog.BeginTest()
+	defer testlog.EndTest()
+
+	date := time.Date(2019, time.January, 7, 10, 0, 0, 0, time.UTC)
+
+	t.Run("plainText", func(t *testing.T) {
+		message, parseErr := mail.ReadMessage(bytes.NewReader(Compose(testMail(), date)))
+		if !assert.NoError(t, parseErr, "composed message should be parsable") {
+			return
+		}
+
+		subject, _ := new(mime.WordDecoder).DecodeHeader(message.Header.Get("Subject"))
+
+		assert.Equal(t, testMail().Subject, subject)
+		assert.Equal(t, "<mail123@trivial-tickets.com>", message.Header.Get("Message-ID"))
+		assert.Equal(t, "Mon, 07 Jan 2019 10:00:00 +0000", message.Header.Get("Date"))
+		assert.Equal(t, "text/plain; charset=utf-8", message.Header.Get("Content-Type"))
+
+		assert.Equal(t, "quoted-printable", message.Header.Get("Content-Transfer-Encoding"))
+		assert.Equal(t, testMail().Message, readBody(t, quotedprintable.NewReader(message.Body)))
+	})
+
+	t.Run("multipartAlternative", func(t *testing.T) {
+		htmlMail := testMail()
+		htmlMail.MessageID = "<mail123.TT-2019-000001@trivial-tickets.com>"
+		htmlMail.HTMLMessage = "<p>Dear Customer,</p>\n<p>your ticket has been created.</p>"
+
+		message, parseErr := mail.ReadMessage(bytes.NewReader(Compose(htmlMail, date)))
+		if !assert.NoError(t, parseErr, "composed message should be parsable") {
+			return
+		}
+
+		assert.Equal(t, htmlMail.MessageID, message.Header.Get("Message-ID"))
+
+		mediaType, params, mediaErr := mime.ParseMediaType(message.Header.Get("Content-Type"))
+		assert.NoError(t, mediaErr)
+		assert.Equal(t, "multipart/alternative", mediaType)
+
+		parts := multipart.NewReader(message.Body, params["boundary"])
+
+		textPart, partErr := parts.NextPart()
+		if assert.NoError(t, partErr, "message should contain a plain text part") {
+			assert.Equal(t, "text/plain; charset=utf-8", textPart.Header.Get("Content-Type"))
+			assert.Equal(t, htmlMail.Message, readBody(t, textPart), "multipart reader should decode the part")
+		}
+
+		htmlPart, partErr := parts.NextPart()
+		if assert.NoError(t, partErr, "message should contain an HTML part") {
+			assert.Equal(t, "text/html; charset=utf-8", htmlPart.Header.Get("Content-Type"))
+			assert.Equal(t, htmlMail.HTMLMessage, readBody(t, htmlPart), "multipart reader should decode the part")
+		}
+
+		_, partErr = parts.NextPart()
+		assert.Error(t, partErr, "message should only contain two parts")
+	})
+}
@@ -0,0 +1,226 @@
+// Trivial Tickets Ticketsystem
+// Copyright (C) 2019 The Contributors
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+// Package mail_poller fetches new messages from an IMAP or
+// POP3 mailbox periodically and turns them into new tickets
+// or answers.
+package mail_poller
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+/*
+ * Ticketsystem Trivial Tickets
+ *
+ * Matriculation numbers: 3040018, 6694964, 3478222
+ * Lecture:               Programmieren II, INF16B
+ * Lecturer:              Herr Prof. Dr. Helmut Neemann
+ * Institute:             Duale Hochschule Baden-Württemberg Mosbach
+ *
+ * ---------------
+ *
+ * Package mail_poller
+ * Minimal IMAP4rev1 client
+ */
+
+// literalRegex matches a line announcing a literal of
+// the given number of bytes, e.g. "BODY[] {342}".
+var literalRegex = regexp.MustCompile(`\{(\d+)\}$`)
+
+// imapMailbox is a session with an IMAP server. Only the
+// commands needed to fetch unseen messages and to mark or
+// move them are implemented.
+type imapMailbox struct {
+	conn   net.Conn
+	reader *bufio.Reader
+	tag    int
+
+	// moveTo is the folder to which processed messages
+	// are moved. If it is empty, processed messages are
+	// only marked as seen.
+	moveTo string
+}
+
+// imapResponse is an untagged response line. The contents
+// of literals are collected in literals.
+type imapResponse struct {
+	line     string
+	literals [][]byte
+}
+
+// dialIMAP logs in on the IMAP connection and selects the
+// folder.
+func dialIMAP(conn net.Conn, user string, password string, folder string, moveTo string) (*imapMailbox, error) {
+	box := &imapMailbox{conn: conn, reader: bufio.NewReader(conn), moveTo: moveTo}
+
+	greeting, readErr := box.readLine()
+	if readErr != nil || !strings.HasPrefix(greeting, "* OK") {
+		conn.Close()
+		return nil, errors.Errorf("unexpected IMAP greeting '%s'", greeting)
+	}
+
+	if _, loginErr := box.command("LOGIN %s %s", quote(user), quote(password)); loginErr != nil {
+		conn.Close()
+		return nil, errors.Wrap(loginErr, "IMAP login failed")
+	}
+
+	if _, selectErr := box.command("SELECT %s", quote(folder)); selectErr != nil {
+		conn.Close()
+		return nil, errors.Wrapf(selectErr, "unable to select IMAP folder '%s'", folder)
+	}
+
+	return box, nil
+}
+
+// fetch returns the unseen messages of the selected folder.
+// The messages are fetched with BODY.PEEK so that they stay
+// unseen until they are processed.
+func (box *imapMailbox) fetch() ([]message, error) {
+	responses, searchErr := box.command("UID SEARCH UNSEEN")
+	if searchErr != nil {
+		return nil, searchErr
+	}
+
+	var uids []string
+	for _, response := range responses {
+		if strings.HasPrefix(response.line, "* SEARCH") {
+			uids = append(uids, strings.Fields(strings.TrimPrefix(response.line, "* SEARCH"))...)
+		}
+	}
+
+	var messages []message
+	for _, uid := range uids {
+		responses, fetchErr := box.command("UID FETCH %s BODY.PEEK[]", uid)
+		if fetchErr != nil {
+			return nil, fetchErr
+		}
+
+		for _, response := range responses {
+			if strings.Contains(response.line, "FETCH") && len(response.literals) > 0 {
+				messages = append(messages, message{id: uid, data: response.literals[0]})
+			}
+		}
+	}
+
+	return messages, nil
+}
+
+// done marks the message as seen or moves it to the
+// configured folder.
+func (box *imapMailbox) done(msg message) error {
+	if box.moveTo == "" {
+		_, storeErr := box.command(`UID STORE %s +FLAGS.SILENT (\Seen)`, msg.id)
+		return storeErr
+	}
+
+	if _, copyErr := box.command("UID COPY %s %s", msg.id, quote(box.moveTo)); copyErr != nil {
+		return copyErr
+	}
+
+	_, storeErr := box.command(`UID STORE %s +FLAGS.SILENT (\Seen \Deleted)`, msg.id)
+	return storeErr
+}
+
+// close removes the moved messages and logs out.
+func (box *imapMailbox) close() error {
+	defer box.conn.Close()
+
+	if box.moveTo != "" {
+		if _, expungeErr := box.command("EXPUNGE"); expungeErr != nil {
+			return expungeErr
+		}
+	}
+
+	_, logoutErr := box.command("LOGOUT")
+	return logoutErr
+}
+
+// command sends a tagged command and reads the untagged
+// responses until the tagged completion. It returns an
+// error if the completion is not OK.
+func (box *imapMailbox) command(format string, args ...interface{}) ([]imapResponse, error) {
+	box.tag++
+	tag := fmt.Sprintf("a%03d", box.tag)
+
+	if _, writeErr := fmt.Fprintf(box.conn, "%s %s\r\n", tag, fmt.Sprintf(format, args...)); writeErr != nil {
+		return nil, writeErr
+	}
+
+	var responses []imapResponse
+	for {
+		line, readErr := box.readLine()
+		if readErr != nil {
+			return nil, readErr
+		}
+
+		if strings.HasPrefix(line, tag+" ") {
+			status := strings.TrimPrefix(line, tag+" ")
+			if !strings.HasPrefix(status, "OK") {
+				return responses, errors.Errorf("IMAP server replied '%s'", status)
+			}
+
+			return responses, nil
+		}
+
+		response := imapResponse{line: line}
+		for {
+			match := literalRegex.FindStringSubmatch(line)
+			if match == nil {
+				break
+			}
+
+			size, _ := strconv.Atoi(match[1])
+			literal := make([]byte, size)
+			if _, literalErr := io.ReadFull(box.reader, literal); literalErr != nil {
+				return nil, literalErr
+			}
+			response.literals = append(response.literals, literal)
+
+			// The response continues after the literal
+			if line, readErr = box.readLine(); readErr != nil {
+				return nil, readErr
+			}
+			response.line += line
+		}
+
+		responses = append(responses, response)
+	}
+}
+
+// readLine reads a line without the trailing CRLF.
+func (box *imapMailbox) readLine() (string, error) {
+	line, readErr := box.reader.ReadString('\n')
+	if readErr != nil {
+		return "", readErr
+	}
+
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+// quote encloses the string in double quotes and escapes
+// quotes and backslashes inside it.
+func quote(value string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(value) + `"`
+}
@@ -0,0 +1,150 @@
+// Trivial Tickets Ticketsystem
+// Copyright (C) 2019 The Contributors
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+// Package mail_poller fetches new messages from an IMAP or
+// POP3 mailbox periodically and turns them into new tickets
+// or answers.
+package mail_poller
+
+import (
+	"net"
+	"net/textproto"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+/*
+ * Ticketsystem Trivial Tickets
+ *
+ * Matriculation numbers: 3040018, 6694964, 3478222
+ * Lecture:               Programmieren II, INF16B
+ * Lecturer:              Herr Prof. Dr. Helmut Neemann
+ * Institute:             Duale Hochschule Baden-Württemberg Mosbach
+ *
+ * ---------------
+ *
+ * Package mail_poller
+ * Minimal POP3 client
+ */
+
+// pop3Mailbox is a session with a POP3 server. POP3 knows
+// no seen flag, so processed messages are deleted.
+type pop3Mailbox struct {
+	text *textproto.Conn
+
+	// numbers maps the unique ids of the messages to
+	// their message numbers in this session.
+	numbers map[string]string
+}
+
+// dialPOP3 logs in on the POP3 connection.
+func dialPOP3(conn net.Conn, user string, password string) (*pop3Mailbox, error) {
+	box := &pop3Mailbox{text: textproto.NewConn(conn), numbers: make(map[string]string)}
+
+	if _, greetingErr := box.readStatus(); greetingErr != nil {
+		box.text.Close()
+		return nil, errors.Wrap(greetingErr, "unexpected POP3 greeting")
+	}
+
+	if _, userErr := box.command("USER %s", user); userErr != nil {
+		box.text.Close()
+		return nil, errors.Wrap(userErr, "POP3 login failed")
+	}
+
+	if _, passErr := box.command("PASS %s", password); passErr != nil {
+		box.text.Close()
+		return nil, errors.Wrap(passErr, "POP3 login failed")
+	}
+
+	return box, nil
+}
+
+// fetch returns all messages of the mailbox.
+func (box *pop3Mailbox) fetch() ([]message, error) {
+	if _, uidlErr := box.command("UIDL"); uidlErr != nil {
+		return nil, uidlErr
+	}
+
+	lines, listErr := box.text.ReadDotLines()
+	if listErr != nil {
+		return nil, listErr
+	}
+
+	var messages []message
+	for _, line := range lines {
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			continue
+		}
+
+		number, uid := fields[0], fields[1]
+		box.numbers[uid] = number
+
+		if _, retrErr := box.command("RETR %s", number); retrErr != nil {
+			return nil, retrErr
+		}
+
+		data, readErr := box.text.ReadDotBytes()
+		if readErr != nil {
+			return nil, readErr
+		}
+
+		messages = append(messages, message{id: uid, data: data})
+	}
+
+	return messages, nil
+}
+
+// done marks the message for deletion. The message is
+// deleted when the session is closed.
+func (box *pop3Mailbox) done(msg message) error {
+	_, deleteErr := box.command("DELE %s", box.numbers[msg.id])
+	return deleteErr
+}
+
+// close ends the session which deletes the processed
+// messages.
+func (box *pop3Mailbox) close() error {
+	defer box.text.Close()
+
+	_, quitErr := box.command("QUIT")
+	return quitErr
+}
+
+// command sends a command and reads the status line.
+func (box *pop3Mailbox) command(format string, args ...interface{}) (string, error) {
+	if writeErr := box.text.PrintfLine(format, args...); writeErr != nil {
+		return "", writeErr
+	}
+
+	return box.readStatus()
+}
+
+// readStatus reads a status line and returns an error if
+// it is not positive.
+func (box *pop3Mailbox) readStatus() (string, error) {
+	line, readErr := box.text.ReadLine()
+	if readErr != nil {
+		return "", readErr
+	}
+
+	if !strings.HasPrefix(line, "+OK") {
+		return line, errors.Errorf("POP3 server replied '%s'", line)
+	}
+
+	return line, nil
+}
@@ -0,0 +1,238 @@
+// Trivial Tickets Ticketsystem
+// Copyright (C) 2019 The Contributors
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+// Package responses provides canned responses and macros
+// which help the editors to answer tickets quickly.
+package responses
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+
+	"github.com/pkg/errors"
+
+	"github.com/mortenterhart/trivial-tickets/assignment"
+	"github.com/mortenterhart/trivial-tickets/log"
+	"github.com/mortenterhart/trivial-tickets/structs"
+	"github.com/mortenterhart/trivial-tickets/ticket"
+)
+
+/*
+ * Ticketsystem Trivial Tickets
+ *
+ * Matriculation numbers: 3040018, 6694964, 3478222
+ * Lecture:               Programmieren II, INF16B
+ * Lecturer:              Herr Prof. Dr. Helmut Neemann
+ * Institute:             Duale Hochschule Baden-Württemberg Mosbach
+ *
+ * ---------------
+ *
+ * Package responses
+ * Canned responses and macros for the editors
+ */
+
+// placeholders are the data of a ticket which canned
+// responses and macro replies may refer to. The ticket
+// itself is not passed to the templates, so that they
+// cannot reveal internal entries or user credentials.
+type placeholders struct {
+	ID       string
+	Subject  string
+	Customer string
+	User     editorPlaceholders
+}
+
+// editorPlaceholders are the data of the editor assigned
+// to the ticket which the templates may refer to.
+type editorPlaceholders struct {
+	Name string
+}
+
+// Render fills the given template text with the data of
+// the ticket. The placeholders refer to the id, subject,
+// customer and editor name of the ticket, i.e. {{.ID}},
+// {{.Subject}}, {{.Customer}} and {{.User.Name}}. The
+// result is plain text, so the ticket data, which is
+// stored escaped, is unescaped and the text is escaped
+// only once where it is shown or stored.
+func Render(text string, currentTicket structs.Ticket) (string, error) {
+	responseTemplate, parseErr := template.New("response").Parse(text)
+	if parseErr != nil {
+		return "", errors.Wrap(parseErr, "could not parse response template")
+	}
+
+	data := placeholders{
+		ID:       html.UnescapeString(currentTicket.ID),
+		Subject:  html.UnescapeString(currentTicket.Subject),
+		Customer: html.UnescapeString(currentTicket.Customer),
+		User:     editorPlaceholders{Name: html.UnescapeString(currentTicket.User.Name)},
+	}
+
+	var responseBuilder bytes.Buffer
+	if executeErr := responseTemplate.Execute(&responseBuilder, data); executeErr != nil {
+		return "", errors.Wrap(executeErr, "could not fill response template with ticket information")
+	}
+
+	return responseBuilder.String(), nil
+}
+
+// Available returns the canned responses which are shared or
+// owned by the user with the given username sorted by title.
+func Available(username string, responses map[string]structs.CannedResponse) []structs.CannedResponse {
+	var available []structs.CannedResponse
+	for _, response := range responses {
+		if response.IsShared() || response.Owner == username {
+			available = append(available, response)
+		}
+	}
+
+	sort.Slice(available, func(i, j int) bool {
+		return available[i].Title < available[j].Title
+	})
+
+	return available
+}
+
+// RenderAll returns a copy of the given canned responses with
+// their texts filled with the data of the ticket. Responses
+// which cannot be rendered are left out.
+func RenderAll(responses []structs.CannedResponse, currentTicket structs.Ticket) []structs.CannedResponse {
+	var rendered []structs.CannedResponse
+	for _, response := range responses {
+		text, renderErr := Render(response.Text, currentTicket)
+		if renderErr != nil {
+			log.Errorf("unable to render canned response '%s': %v", response.Title, renderErr)
+			continue
+		}
+
+		response.Text = text
+		rendered = append(rendered, response)
+	}
+
+	return rendered
+}
+
+// AvailableMacros returns the macros which are shared or
+// owned by the user with the given username sorted by title.
+func AvailableMacros(username string, macros map[string]structs.Macro) []structs.Macro {
+	var available []structs.Macro
+	for _, macro := range macros {
+		if macro.IsShared() || macro.Owner == username {
+			available = append(available, macro)
+		}
+	}
+
+	sort.Slice(available, func(i, j int) bool {
+		return available[i].Title < available[j].Title
+	})
+
+	return available
+}
+
+// ApplyMacro applies all actions of the macro to the ticket
+// on behalf of the given editor. The reply is added first,
+// then the tags are added and finally the ticket is assigned
+// and its status is changed. An error is returned if the
+// reply cannot be rendered, the user to assign does not
+// exist or the editor may not assign the ticket to them.
+// The ticket is only returned changed without error.
+func ApplyMacro(macro structs.Macro, editor structs.User, users map[string]structs.User,
+	currentTicket structs.Ticket) (structs.Ticket, error) {
+
+	// Check the assignment before any action is applied
+	assignee := currentTicket.User
+	switch macro.AssignTo {
+	case "":
+		// Keep the current editor
+
+	case structs.MacroAssignSelf:
+		assignee = editor
+
+	default:
+		user, userExists := users[macro.AssignTo]
+		if !userExists {
+			return currentTicket, fmt.Errorf("user '%s' to assign does not exist", macro.AssignTo)
+		}
+
+		assignee = user
+	}
+
+	if assignee.ID != currentTicket.User.ID {
+		if checkErr := assignment.CheckAssignment(editor, assignee, currentTicket); checkErr != nil {
+			return currentTicket, checkErr
+		}
+	}
+
+	if macro.Reply != "" {
+		reply, renderErr := Render(macro.Reply, currentTicket)
+		if renderErr != nil {
+			return currentTicket, renderErr
+		}
+
+		// Entries are stored escaped like the replies of the form
+		currentTicket = ticket.UpdateTicket(strconv.Itoa(int(currentTicket.Status)), editor.Mail,
+			template.HTMLEscapeString(reply), macro.ReplyType, currentTicket)
+	}
+
+	currentTicket.Tags = AddTags(currentTicket.Tags, macro.Tags)
+
+	if macro.AssignTo != "" {
+		currentTicket = ticket.AssignTicket(assignee, currentTicket)
+	}
+
+	if macro.ChangeStatus {
+		currentTicket.Status = macro.Status
+	}
+
+	return ticket.EnsureSurveyToken(currentTicket), nil
+}
+
+// AddTags appends the new tags to the existing ones. Tags
+// which are already present are not added again, regardless
+// of their case.
+func AddTags(tags []string, newTags []string) []string {
+	present := make(map[string]bool)
+	for _, tag := range tags {
+		present[strings.ToLower(tag)] = true
+	}
+
+	for _, tag := range newTags {
+		if !present[strings.ToLower(tag)] {
+			present[strings.ToLower(tag)] = true
+			tags = append(tags, tag)
+		}
+	}
+
+	return tags
+}
+
+// ParseTags splits a comma separated list of tags and
+// removes surrounding whitespace and empty tags.
+func ParseTags(tagList string) []string {
+	var tags []string
+	for _, tag := range strings.Split(tagList, ",") {
+		if tag = strings.TrimSpace(tag); tag != "" {
+			tags = append(tags, tag)
+		}
+	}
+
+	return tags
+}
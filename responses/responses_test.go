@@ -0,0 +1,302 @@
+// Trivial Tickets Ticketsystem
+// Copyright (C) 2019 The Contributors
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+// Package responses provides canned responses and macros
+// which help the editors to answer tickets quickly.
+package responses
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mortenterhart/trivial-tickets/assignment"
+	"github.com/mortenterhart/trivial-tickets/globals"
+	"github.com/mortenterhart/trivial-tickets/log/testlog"
+	"github.com/mortenterhart/trivial-tickets/structs"
+	"github.com/mortenterhart/trivial-tickets/structs/defaults"
+)
+
+/*
+ * Ticketsystem Trivial Tickets
+ *
+ * Matriculation numbers: 3040018, 6694964, 3478222
+ * Lecture:               Programmieren II, INF16B
+ * Lecturer:              Herr Prof. Dr. Helmut Neemann
+ * Institute:             Duale Hochschule Baden-Württemberg Mosbach
+ *
+ * ---------------
+ *
+ * Package responses
+ * Canned responses and macros for the editors
+ */
+
+//revive:disable:deep-exit
+
+// TestMain is started to run the tests and initializes the
+// logging configuration before running the tests because
+// invalid responses are logged.
+func TestMain(m *testing.M) {
+	globals.LogConfig = &structs.LogConfig{
+		LogLevel:  structs.AsLogLevel(defaults.LogLevelString),
+		Verbose:   defaults.LogVerbose,
+		FullPaths: defaults.LogFullPaths,
+	}
+
+	os.Exit(m.Run())
+}
+
+//revive:enable:deep-exit
+
+// mockTicket returns an open test ticket.
+func mockTicket() structs.Ticket {
+	return structs.Ticket{
+		ID:       "abc123",
+		Subject:  "Printer broken",
+		Status:   structs.StatusOpen,
+		Customer: "customer@example.com",
+		Tags:     []string{"printer"},
+	}
+}
+
+// mockEditors returns two editors.
+func mockEditors() map[string]structs.User {
+	return map[string]structs.User{
+		"alice": {ID: "1", Name: "Alice", Username: "alice", Mail: "alice@example.com"},
+		"bob":   {ID: "2", Name: "Bob", Username: "bob", Mail: "bob@example.com"},
+	}
+}
+
+func TestRender(t *testing.T) {
+	testlog.BeginTest()
+	defer testlog.EndTest()
+
+	t.Run("placeholders", func(t *testing.T) {
+		text, err := Render("Dear {{.Customer}}, about ticket {{.ID}}", mockTicket())
+
+		assert.NoError(t, err)
+		assert.Equal(t, "Dear customer@example.com, about ticket abc123", text)
+	})
+
+	t.Run("invalidTemplate", func(t *testing.T) {
+		_, err := Render("Dear {{.Customer", mockTicket())
+
+		assert.Error(t, err, "unclosed action should not be parsed")
+	})
+
+	t.Run("unknownField", func(t *testing.T) {
+		_, err := Render("Dear {{.Unknown}}", mockTicket())
+
+		assert.Error(t, err, "unknown field should not be rendered")
+	})
+
+	t.Run("escapedTicketData", func(t *testing.T) {
+		escapedTicket := mockTicket()
+		escapedTicket.Subject = "Tom &amp; Jerry&#39;s printer"
+		escapedTicket.Customer = "o&#39;brien@example.com"
+
+		text, err := Render("{{.Customer}}: {{.Subject}}", escapedTicket)
+
+		assert.NoError(t, err)
+		assert.Equal(t, "o'brien@example.com: Tom & Jerry's printer", text, "ticket data should not be escaped twice")
+	})
+
+	t.Run("editorName", func(t *testing.T) {
+		assignedTicket := mockTicket()
+		assignedTicket.User = structs.User{Name: "Alice", Hash: "$2a$12$secret"}
+
+		text, err := Render("Regards, {{.User.Name}}", assignedTicket)
+
+		assert.NoError(t, err)
+		assert.Equal(t, "Regards, Alice", text)
+	})
+
+	t.Run("internalData", func(t *testing.T) {
+		for _, text := range []string{"{{.User.Hash}}", "{{range .Entries}}{{.Text}}{{end}}", "{{.WorkLogs}}"} {
+			_, err := Render(text, mockTicket())
+
+			assert.Error(t, err, "internal data of the ticket should not be rendered: %s", text)
+		}
+	})
+}
+
+func TestAvailable(t *testing.T) {
+	testlog.BeginTest()
+	defer testlog.EndTest()
+
+	responses := map[string]structs.CannedResponse{
+		"1": {ID: "1", Title: "Thanks", Text: "Thank you"},
+		"2": {ID: "2", Title: "Greeting", Text: "Hello", Owner: "alice"},
+		"3": {ID: "3", Title: "Bye", Text: "Bye", Owner: "bob"},
+	}
+
+	available := Available("alice", responses)
+
+	assert.Len(t, available, 2, "shared and own responses should be available")
+	assert.Equal(t, "Greeting", available[0].Title, "responses should be sorted by title")
+	assert.Equal(t, "Thanks", available[1].Title, "responses should be sorted by title")
+}
+
+func TestRenderAll(t *testing.T) {
+	testlog.BeginTest()
+	defer testlog.EndTest()
+
+	responses := []structs.CannedResponse{
+		{ID: "1", Title: "Valid", Text: "Ticket {{.ID}}"},
+		{ID: "2", Title: "Invalid", Text: "Ticket {{.ID"},
+	}
+
+	rendered := RenderAll(responses, mockTicket())
+
+	assert.Len(t, rendered, 1, "invalid responses should be left out")
+	assert.Equal(t, "Ticket abc123", rendered[0].Text)
+	assert.Equal(t, "Ticket {{.ID}}", responses[0].Text, "original response should not be changed")
+}
+
+func TestAvailableMacros(t *testing.T) {
+	testlog.BeginTest()
+	defer testlog.EndTest()
+
+	macros := map[string]structs.Macro{
+		"1": {ID: "1", Title: "Shared"},
+		"2": {ID: "2", Title: "Foreign", Owner: "bob"},
+	}
+
+	available := AvailableMacros("alice", macros)
+
+	assert.Len(t, available, 1, "only the shared macro should be available")
+	assert.Equal(t, "Shared", available[0].Title)
+}
+
+func TestApplyMacro(t *testing.T) {
+	testlog.BeginTest()
+	defer testlog.EndTest()
+
+	users := mockEditors()
+
+	t.Run("allActions", func(t *testing.T) {
+		macro := structs.Macro{
+			Reply:        "Dear {{.Customer}}, we are on it.",
+			ReplyType:    "external",
+			ChangeStatus: true,
+			Status:       structs.StatusInProgress,
+			Tags:         []string{"Printer", "hardware"},
+			AssignTo:     structs.MacroAssignSelf,
+		}
+
+		updatedTicket, err := ApplyMacro(macro, users["alice"], users, mockTicket())
+
+		assert.NoError(t, err)
+		assert.Len(t, updatedTicket.Entries, 1, "reply should be added")
+		assert.Equal(t, "Dear customer@example.com, we are on it.", updatedTicket.Entries[0].Text)
+		assert.Equal(t, "alice@example.com", updatedTicket.Entries[0].User)
+		assert.Equal(t, "external", updatedTicket.Entries[0].ReplyType)
+		assert.Equal(t, []string{"printer", "hardware"}, updatedTicket.Tags, "tags should be added once")
+		assert.Equal(t, "alice", updatedTicket.User.Username, "ticket should be assigned to the editor")
+		assert.Equal(t, structs.StatusInProgress, updatedTicket.Status)
+	})
+
+	t.Run("assignOther", func(t *testing.T) {
+		macro := structs.Macro{AssignTo: "bob"}
+		supervisor := users["alice"]
+		supervisor.Role = structs.RoleSupervisor
+
+		updatedTicket, err := ApplyMacro(macro, supervisor, users, mockTicket())
+
+		assert.NoError(t, err)
+		assert.Empty(t, updatedTicket.Entries, "no reply should be added")
+		assert.Equal(t, "bob", updatedTicket.User.Username, "ticket should be assigned to bob")
+	})
+
+	t.Run("agentAssignsOther", func(t *testing.T) {
+		macro := structs.Macro{Reply: "Bob will help you.", ReplyType: "external", AssignTo: "bob"}
+
+		_, err := ApplyMacro(macro, users["alice"], users, mockTicket())
+
+		assert.IsType(t, assignment.PermissionError{}, err, "agents may only assign tickets to themselves")
+	})
+
+	t.Run("closedTicket", func(t *testing.T) {
+		macro := structs.Macro{AssignTo: structs.MacroAssignSelf}
+		closedTicket := mockTicket()
+		closedTicket.Status = structs.StatusClosed
+
+		_, err := ApplyMacro(macro, users["alice"], users, closedTicket)
+
+		assert.IsType(t, assignment.ConflictError{}, err, "closed tickets should not be assigned")
+	})
+
+	t.Run("keepAssignee", func(t *testing.T) {
+		macro := structs.Macro{AssignTo: "bob"}
+		bobsTicket := mockTicket()
+		bobsTicket.User = users["bob"]
+
+		updatedTicket, err := ApplyMacro(macro, users["alice"], users, bobsTicket)
+
+		assert.NoError(t, err, "keeping the assignee needs no permission")
+		assert.Equal(t, "bob", updatedTicket.User.Username)
+	})
+
+	t.Run("closeWithoutAssignment", func(t *testing.T) {
+		macro := structs.Macro{ChangeStatus: true, Status: structs.StatusClosed}
+
+		updatedTicket, err := ApplyMacro(macro, users["alice"], users, mockTicket())
+
+		assert.NoError(t, err)
+		assert.Equal(t, structs.StatusClosed, updatedTicket.Status)
+		assert.Empty(t, updatedTicket.User.ID, "editor should not change")
+	})
+
+	t.Run("unknownUser", func(t *testing.T) {
+		macro := structs.Macro{AssignTo: "unknown"}
+
+		_, err := ApplyMacro(macro, users["alice"], users, mockTicket())
+
+		assert.Error(t, err, "unknown user should not be assigned")
+	})
+
+	t.Run("invalidReply", func(t *testing.T) {
+		macro := structs.Macro{Reply: "{{.Customer"}
+
+		_, err := ApplyMacro(macro, users["alice"], users, mockTicket())
+
+		assert.Error(t, err, "invalid reply should not be added")
+	})
+
+	t.Run("escapedOnce", func(t *testing.T) {
+		escapedTicket := mockTicket()
+		escapedTicket.Customer = "o&#39;brien@example.com"
+
+		macro := structs.Macro{Reply: "Dear {{.Customer}}, it's done.", ReplyType: "external"}
+
+		updatedTicket, err := ApplyMacro(macro, users["alice"], users, escapedTicket)
+
+		assert.NoError(t, err)
+		if assert.NotEmpty(t, updatedTicket.Entries) {
+			assert.Equal(t, "Dear o&#39;brien@example.com, it&#39;s done.",
+				updatedTicket.Entries[len(updatedTicket.Entries)-1].Text, "reply should be stored escaped once")
+		}
+	})
+}
+
+func TestParseTags(t *testing.T) {
+	testlog.BeginTest()
+	defer testlog.EndTest()
+
+	assert.Equal(t, []string{"billing", "vip"}, ParseTags(" billing, ,vip,"))
+	assert.Empty(t, ParseTags(""))
+}
@@ -0,0 +1,421 @@
+// Trivial Tickets Ticketsystem
+// Copyright (C) 2019 The Contributors
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+// Package rules evaluates the automation rules of the
+// form "when an event occurs, if all conditions match, then
+// apply the actions" on ticket events.
+package rules
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/mortenterhart/trivial-tickets/globals"
+	"github.com/mortenterhart/trivial-tickets/log"
+	"github.com/mortenterhart/trivial-tickets/responses"
+	"github.com/mortenterhart/trivial-tickets/structs"
+	"github.com/mortenterhart/trivial-tickets/ticket"
+)
+
+/*
+ * Ticketsystem Trivial Tickets
+ *
+ * Matriculation numbers: 3040018, 6694964, 3478222
+ * Lecture:               Programmieren II, INF16B
+ * Lecturer:              Herr Prof. Dr. Helmut Neemann
+ * Institute:             Duale Hochschule Baden-Württemberg Mosbach
+ *
+ * ---------------
+ *
+ * Package rules
+ * Automation rules for ticket events
+ */
+
+// The ticket events on which the rules are evaluated.
+const (
+	// EventCreated occurs when a new ticket is created
+	// on the website or out of a mail.
+	EventCreated string = "created"
+
+	// EventReply occurs when the customer answers a
+	// ticket.
+	EventReply string = "reply"
+
+	// EventUpdated occurs when an editor updates a
+	// ticket.
+	EventUpdated string = "updated"
+)
+
+// The fields of a ticket which can be compared in
+// conditions. The message is the latest entry of the
+// ticket and the domain the part of the customer's mail
+// address after the "@".
+const (
+	fieldSubject  string = "subject"
+	fieldMessage  string = "message"
+	fieldCustomer string = "customer"
+	fieldDomain   string = "domain"
+	fieldStatus   string = "status"
+	fieldPriority string = "priority"
+	fieldTag      string = "tag"
+)
+
+// The operators of conditions. All operators except
+// operatorMatches ignore the case.
+const (
+	operatorEquals     string = "equals"
+	operatorContains   string = "contains"
+	operatorStartsWith string = "startsWith"
+	operatorEndsWith   string = "endsWith"
+	operatorMatches    string = "matches"
+)
+
+// The types of actions. The value of an action is a comma
+// separated list of tags, the username of an editor, a
+// priority, a status or the text of an internal note.
+const (
+	actionTag      string = "tag"
+	actionAssign   string = "assign"
+	actionPriority string = "priority"
+	actionStatus   string = "status"
+	actionNote     string = "note"
+)
+
+// Apply evaluates the configured rules on the event of the
+// given ticket, appends the fired rules to the log of the
+// ticket and returns the changed ticket.
+func Apply(event string, currentTicket structs.Ticket) structs.Ticket {
+	changedTicket, fired := Evaluate(globals.Rules, event, currentTicket, globals.Users, time.Now())
+
+	for _, firedRule := range fired {
+		log.Infof(`Rule '%s' ("%s") fired on %s event of ticket '%s'`,
+			firedRule.Rule, firedRule.Title, event, changedTicket.ID)
+	}
+
+	if len(fired) > 0 {
+		firedRules := make([]structs.FiredRule, 0, len(changedTicket.FiredRules)+len(fired))
+		changedTicket.FiredRules = append(append(firedRules, changedTicket.FiredRules...), fired...)
+	}
+
+	return changedTicket
+}
+
+// Evaluate applies all enabled rules which match the ticket
+// on the given event in their order and returns the changed
+// ticket along with the rules which fired. Later rules see
+// the changes of earlier ones. The users are needed for the
+// assign actions. Evaluate does not change any stored data
+// and can therefore be used for dry runs.
+func Evaluate(rules []structs.Rule, event string, currentTicket structs.Ticket,
+	users map[string]structs.User, now time.Time) (structs.Ticket, []structs.FiredRule) {
+
+	var fired []structs.FiredRule
+	for _, rule := range rules {
+		if rule.Disabled || !handlesEvent(rule, event) || !Matches(rule, currentTicket) {
+			continue
+		}
+
+		for _, action := range rule.Actions {
+			currentTicket = applyAction(action, currentTicket, users, now)
+		}
+
+		fired = append(fired, structs.FiredRule{
+			Rule:  rule.ID,
+			Title: rule.Title,
+			Event: event,
+			Date:  now,
+		})
+	}
+
+	return currentTicket, fired
+}
+
+// handlesEvent reports whether the rule is evaluated on the
+// event. Rules without events are evaluated on every event.
+func handlesEvent(rule structs.Rule, event string) bool {
+	if len(rule.Events) == 0 {
+		return true
+	}
+
+	for _, ruleEvent := range rule.Events {
+		if ruleEvent == event {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Matches reports whether all conditions of the rule match
+// the ticket. A rule without conditions matches every ticket.
+func Matches(rule structs.Rule, currentTicket structs.Ticket) bool {
+	for _, condition := range rule.Conditions {
+		if !conditionMatches(condition, currentTicket) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// conditionMatches reports whether the condition matches the
+// ticket. Fields with several values, such as the tags, match
+// if one of the values matches.
+func conditionMatches(condition structs.RuleCondition, currentTicket structs.Ticket) bool {
+	for _, value := range fieldValues(condition.Field, currentTicket) {
+		if compare(condition.Operator, value, condition.Value) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// fieldValues returns the values of the field of the ticket.
+func fieldValues(field string, currentTicket structs.Ticket) []string {
+	switch field {
+	case fieldSubject:
+		return []string{currentTicket.Subject}
+
+	case fieldMessage:
+		if len(currentTicket.Entries) == 0 {
+			return nil
+		}
+		return []string{currentTicket.Entries[len(currentTicket.Entries)-1].Text}
+
+	case fieldCustomer:
+		return []string{currentTicket.Customer}
+
+	case fieldDomain:
+		return []string{currentTicket.Customer[strings.LastIndex(currentTicket.Customer, "@")+1:]}
+
+	case fieldStatus:
+		return []string{currentTicket.Status.String()}
+
+	case fieldPriority:
+		return []string{currentTicket.Priority.String()}
+
+	case fieldTag:
+		return currentTicket.Tags
+	}
+
+	return nil
+}
+
+// compare compares the actual value of a field with the
+// expected value of a condition using the operator.
+func compare(operator, actual, expected string) bool {
+	if operator == operatorMatches {
+		pattern, compileErr := regexp.Compile(expected)
+		return compileErr == nil && pattern.MatchString(actual)
+	}
+
+	actual = strings.ToLower(actual)
+	expected = strings.ToLower(expected)
+
+	switch operator {
+	case operatorEquals:
+		return actual == expected
+
+	case operatorContains:
+		return strings.Contains(actual, expected)
+
+	case operatorStartsWith:
+		return strings.HasPrefix(actual, expected)
+
+	case operatorEndsWith:
+		return strings.HasSuffix(actual, expected)
+	}
+
+	return false
+}
+
+// applyAction applies a single action to the ticket. Actions
+// which cannot be applied, e.g. because the editor is on
+// holiday, leave the ticket unchanged.
+func applyAction(action structs.RuleAction, currentTicket structs.Ticket,
+	users map[string]structs.User, now time.Time) structs.Ticket {
+
+	switch action.Type {
+	case actionTag:
+		currentTicket.Tags = responses.AddTags(currentTicket.Tags, responses.ParseTags(action.Value))
+
+	case actionAssign:
+		editor, userExists := users[action.Value]
+		if !userExists || editor.IsOnHoliday || currentTicket.Status == structs.StatusClosed {
+			log.Warnf("Ticket '%s' cannot be assigned to user '%s' by a rule", currentTicket.ID, action.Value)
+			break
+		}
+
+		currentTicket = ticket.AssignTicket(editor, currentTicket)
+
+	case actionPriority:
+		currentTicket.Priority = structs.AsPriority(action.Value)
+
+	case actionStatus:
+		status, _ := parseStatus(action.Value)
+		switch {
+		case status == structs.StatusOpen:
+			currentTicket = ticket.UnassignTicket(currentTicket)
+
+		case status == structs.StatusInProgress && currentTicket.User.ID == "":
+			log.Warnf("Ticket '%s' has no editor and cannot be in progress", currentTicket.ID)
+
+		default:
+			currentTicket.Status = status
+		}
+
+	case actionNote:
+		currentTicket = ticket.AddSystemNote(currentTicket, now, action.Value)
+	}
+
+	return currentTicket
+}
+
+// parseStatus converts the description of a status, such
+// as "in progress", to the status ignoring the case.
+func parseStatus(value string) (structs.Status, bool) {
+	for _, status := range []structs.Status{structs.StatusOpen, structs.StatusInProgress, structs.StatusClosed} {
+		if strings.EqualFold(status.String(), value) {
+			return status, true
+		}
+	}
+
+	return structs.StatusOpen, false
+}
+
+// Validate checks that the rules are well-formed, i.e. they
+// have a unique id and only use known events, fields,
+// operators and actions with valid values. The first
+// problem found is returned as error.
+func Validate(rules []structs.Rule) error {
+	ids := make(map[string]bool)
+
+	for index, rule := range rules {
+		if rule.ID == "" {
+			return fmt.Errorf("rule %d has no id", index+1)
+		}
+
+		if ids[rule.ID] {
+			return fmt.Errorf("rule id '%s' is used more than once", rule.ID)
+		}
+		ids[rule.ID] = true
+
+		if validateErr := validateRule(rule); validateErr != nil {
+			return errors.Wrapf(validateErr, "invalid rule '%s'", rule.ID)
+		}
+	}
+
+	return nil
+}
+
+// validateRule checks the events, conditions and actions of
+// a single rule.
+func validateRule(rule structs.Rule) error {
+	for _, event := range rule.Events {
+		if event != EventCreated && event != EventReply && event != EventUpdated {
+			return fmt.Errorf("event '%s' not defined", event)
+		}
+	}
+
+	for _, condition := range rule.Conditions {
+		if !isField(condition.Field) {
+			return fmt.Errorf("field '%s' not defined", condition.Field)
+		}
+
+		if !isOperator(condition.Operator) {
+			return fmt.Errorf("operator '%s' not defined", condition.Operator)
+		}
+
+		if condition.Operator == operatorMatches {
+			if _, compileErr := regexp.Compile(condition.Value); compileErr != nil {
+				return errors.Wrapf(compileErr, "invalid pattern '%s'", condition.Value)
+			}
+		}
+	}
+
+	if len(rule.Actions) == 0 {
+		return errors.New("rule has no actions")
+	}
+
+	for _, action := range rule.Actions {
+		if validateErr := validateAction(action); validateErr != nil {
+			return validateErr
+		}
+	}
+
+	return nil
+}
+
+// isField reports whether the field can be used in
+// conditions.
+func isField(field string) bool {
+	switch field {
+	case fieldSubject, fieldMessage, fieldCustomer, fieldDomain, fieldStatus, fieldPriority, fieldTag:
+		return true
+	}
+
+	return false
+}
+
+// isOperator reports whether the operator is defined.
+func isOperator(operator string) bool {
+	switch operator {
+	case operatorEquals, operatorContains, operatorStartsWith, operatorEndsWith, operatorMatches:
+		return true
+	}
+
+	return false
+}
+
+// validateAction checks the type and the value of an action.
+func validateAction(action structs.RuleAction) error {
+	switch action.Type {
+	case actionTag:
+		if len(responses.ParseTags(action.Value)) == 0 {
+			return errors.New("tag action without tags")
+		}
+
+	case actionAssign:
+		if action.Value == "" {
+			return errors.New("assign action without username")
+		}
+
+	case actionPriority:
+		if structs.AsPriority(action.Value) < 0 {
+			return fmt.Errorf("priority '%s' not defined", action.Value)
+		}
+
+	case actionStatus:
+		if _, valid := parseStatus(action.Value); !valid {
+			return fmt.Errorf("status '%s' not defined", action.Value)
+		}
+
+	case actionNote:
+		if action.Value == "" {
+			return errors.New("note action without text")
+		}
+
+	default:
+		return fmt.Errorf("action '%s' not defined", action.Type)
+	}
+
+	return nil
+}
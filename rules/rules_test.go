@@ -0,0 +1,248 @@
+// Trivial Tickets Ticketsystem
+// Copyright (C) 2019 The Contributors
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+// Package rules evaluates the automation rules of the
+// form "when an event occurs, if all conditions match, then
+// apply the actions" on ticket events.
+package rules
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mortenterhart/trivial-tickets/globals"
+	"github.com/mortenterhart/trivial-tickets/log/testlog"
+	"github.com/mortenterhart/trivial-tickets/structs"
+	"github.com/mortenterhart/trivial-tickets/structs/defaults"
+)
+
+/*
+ * Ticketsystem Trivial Tickets
+ *
+ * Matriculation numbers: 3040018, 6694964, 3478222
+ * Lecture:               Programmieren II, INF16B
+ * Lecturer:              Herr Prof. Dr. Helmut Neemann
+ * Institute:             Duale Hochschule Baden-Württemberg Mosbach
+ *
+ * ---------------
+ *
+ * Package rules
+ * Automation rules for ticket events
+ */
+
+//revive:disable:deep-exit
+
+// TestMain is started to run the tests and initializes the
+// logging configuration before running the tests. The tests'
+// exit status is returned as the overall exit status.
+func TestMain(m *testing.M) {
+	globals.LogConfig = &structs.LogConfig{
+		LogLevel:  structs.AsLogLevel(defaults.LogLevelString),
+		Verbose:   defaults.LogVerbose,
+		FullPaths: defaults.LogFullPaths,
+	}
+
+	os.Exit(m.Run())
+}
+
+//revive:enable:deep-exit
+
+// testRules returns the rules used in the tests: invoices
+// are tagged and assigned to the billing editor and tickets
+// of VIP customers get a high priority.
+func testRules() []structs.Rule {
+	return []structs.Rule{
+		{
+			ID:         "billing",
+			Title:      "Billing",
+			Events:     []string{EventCreated},
+			Conditions: []structs.RuleCondition{{Field: "subject", Operator: "contains", Value: "Invoice"}},
+			Actions: []structs.RuleAction{
+				{Type: "tag", Value: "billing"},
+				{Type: "assign", Value: "billing"},
+			},
+		},
+		{
+			ID:         "vip",
+			Title:      "VIP customers",
+			Conditions: []structs.RuleCondition{{Field: "domain", Operator: "equals", Value: "vip.com"}},
+			Actions:    []structs.RuleAction{{Type: "priority", Value: "high"}},
+		},
+		{
+			ID:         "disabled",
+			Title:      "Disabled",
+			Disabled:   true,
+			Conditions: []structs.RuleCondition{{Field: "subject", Operator: "contains", Value: "invoice"}},
+			Actions:    []structs.RuleAction{{Type: "status", Value: "closed"}},
+		},
+	}
+}
+
+// testUsers returns the editor of the billing queue.
+func testUsers() map[string]structs.User {
+	return map[string]structs.User{
+		"billing": {ID: "u1", Name: "Billing", Username: "billing", Mail: "billing@example.com"},
+	}
+}
+
+// newTestTicket returns a new ticket of the customer with
+// the subject and the message.
+func newTestTicket(customer, subject, message string) structs.Ticket {
+	return structs.Ticket{
+		ID:       "t1",
+		Subject:  subject,
+		Customer: customer,
+		Entries:  []structs.Entry{{User: customer, Text: message}},
+	}
+}
+
+func TestEvaluate(t *testing.T) {
+	testlog.BeginTest()
+	defer testlog.EndTest()
+
+	now := time.Date(2019, time.January, 7, 10, 0, 0, 0, time.UTC)
+
+	t.Run("created", func(t *testing.T) {
+		newTicket := newTestTicket("jane@vip.com", "Your invoice 123", "It is wrong")
+
+		changedTicket, fired := Evaluate(testRules(), EventCreated, newTicket, testUsers(), now)
+
+		assert.Equal(t, []structs.FiredRule{
+			{Rule: "billing", Title: "Billing", Event: EventCreated, Date: now},
+			{Rule: "vip", Title: "VIP customers", Event: EventCreated, Date: now},
+		}, fired, "enabled matching rules should fire in order")
+		assert.Equal(t, []string{"billing"}, changedTicket.Tags)
+		assert.Equal(t, "billing", changedTicket.User.Username, "ticket should be assigned")
+		assert.Equal(t, structs.StatusInProgress, changedTicket.Status)
+		assert.Equal(t, structs.PriorityHigh, changedTicket.Priority)
+		assert.Empty(t, newTicket.Tags, "original ticket should not be changed")
+	})
+
+	t.Run("otherEvent", func(t *testing.T) {
+		newTicket := newTestTicket("jane@example.com", "Your invoice 123", "It is wrong")
+
+		changedTicket, fired := Evaluate(testRules(), EventReply, newTicket, testUsers(), now)
+
+		assert.Empty(t, fired, "rules of other events should not fire")
+		assert.Equal(t, newTicket, changedTicket)
+	})
+
+	t.Run("editorOnHoliday", func(t *testing.T) {
+		users := testUsers()
+		editor := users["billing"]
+		editor.IsOnHoliday = true
+		users["billing"] = editor
+
+		changedTicket, fired := Evaluate(testRules(), EventCreated,
+			newTestTicket("jane@example.com", "Invoice", ""), users, now)
+
+		assert.Len(t, fired, 1, "rule should fire")
+		assert.Equal(t, structs.StatusOpen, changedTicket.Status, "editor on holiday should not be assigned")
+	})
+
+	t.Run("noteAndStatus", func(t *testing.T) {
+		rules := []structs.Rule{{
+			ID:         "spam",
+			Conditions: []structs.RuleCondition{{Field: "message", Operator: "matches", Value: `(?i)\bviagra\b`}},
+			Actions: []structs.RuleAction{
+				{Type: "note", Value: "Closed as spam"},
+				{Type: "status", Value: "Closed"},
+			},
+		}}
+
+		changedTicket, fired := Evaluate(rules, EventUpdated,
+			newTestTicket("spam@example.com", "Offer", "Cheap VIAGRA"), nil, now)
+
+		assert.Len(t, fired, 1, "rule should fire")
+		assert.Equal(t, structs.StatusClosed, changedTicket.Status)
+		assert.Equal(t, "Closed as spam", changedTicket.Entries[1].Text, "note should be added")
+		assert.True(t, changedTicket.Entries[1].IsInternal(), "note should be internal")
+	})
+}
+
+func TestMatches(t *testing.T) {
+	testlog.BeginTest()
+	defer testlog.EndTest()
+
+	currentTicket := newTestTicket("jane@example.com", "Printer broken", "Please help")
+	currentTicket.Tags = []string{"hardware", "urgent"}
+
+	matches := func(field, operator, value string) bool {
+		return Matches(structs.Rule{
+			Conditions: []structs.RuleCondition{{Field: field, Operator: operator, Value: value}},
+		}, currentTicket)
+	}
+
+	assert.True(t, matches("subject", "startsWith", "printer"), "comparison should ignore the case")
+	assert.True(t, matches("message", "endsWith", "HELP"))
+	assert.True(t, matches("customer", "equals", "jane@example.com"))
+	assert.True(t, matches("tag", "equals", "urgent"), "one of the tags should match")
+	assert.True(t, matches("status", "equals", "open"))
+	assert.True(t, matches("priority", "equals", "normal"))
+	assert.False(t, matches("domain", "equals", "vip.com"))
+	assert.False(t, matches("subject", "matches", "^printer"), "patterns should respect the case")
+	assert.True(t, Matches(structs.Rule{}, currentTicket), "rules without conditions should match")
+}
+
+func TestValidate(t *testing.T) {
+	testlog.BeginTest()
+	defer testlog.EndTest()
+
+	assert.NoError(t, Validate(testRules()), "test rules should be valid")
+
+	invalid := map[string]structs.Rule{
+		"noID":       {Actions: []structs.RuleAction{{Type: "tag", Value: "a"}}},
+		"event":      {ID: "r", Events: []string{"deleted"}, Actions: []structs.RuleAction{{Type: "tag", Value: "a"}}},
+		"field":      {ID: "r", Conditions: []structs.RuleCondition{{Field: "size", Operator: "equals"}}},
+		"operator":   {ID: "r", Conditions: []structs.RuleCondition{{Field: "subject", Operator: "like"}}},
+		"pattern":    {ID: "r", Conditions: []structs.RuleCondition{{Field: "subject", Operator: "matches", Value: "("}}},
+		"noActions":  {ID: "r"},
+		"actionType": {ID: "r", Actions: []structs.RuleAction{{Type: "delete"}}},
+		"priority":   {ID: "r", Actions: []structs.RuleAction{{Type: "priority", Value: "urgent"}}},
+		"status":     {ID: "r", Actions: []structs.RuleAction{{Type: "status", Value: "done"}}},
+		"tags":       {ID: "r", Actions: []structs.RuleAction{{Type: "tag", Value: " , "}}},
+	}
+
+	for name, rule := range invalid {
+		assert.Error(t, Validate([]structs.Rule{rule}), "rule should be invalid: %s", name)
+	}
+
+	duplicateIDs := []structs.Rule{testRules()[0], testRules()[0]}
+	assert.Error(t, Validate(duplicateIDs), "rule ids should be unique")
+}
+
+func TestApply(t *testing.T) {
+	testlog.BeginTest()
+	defer testlog.EndTest()
+
+	globals.Rules = testRules()
+	defer func() {
+		globals.Rules = nil
+	}()
+
+	currentTicket := newTestTicket("jane@vip.com", "Question", "Hello")
+	currentTicket.FiredRules = []structs.FiredRule{{Rule: "earlier"}}
+
+	changedTicket := Apply(EventReply, currentTicket)
+
+	assert.Equal(t, structs.PriorityHigh, changedTicket.Priority)
+	assert.Len(t, changedTicket.FiredRules, 2, "fired rule should be appended to the log")
+	assert.Equal(t, "vip", changedTicket.FiredRules[1].Rule)
+	assert.Len(t, currentTicket.FiredRules, 1, "log of the original ticket should not be changed")
+}
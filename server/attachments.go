@@ -0,0 +1,125 @@
+// Trivial Tickets Ticketsystem
+// Copyright (C) 2019 The Contributors
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+// Package server implements the web server including
+// shutdown routines and the associated handlers for
+// web requests.
+package server
+
+import (
+	"mime"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/mortenterhart/trivial-tickets/globals"
+	"github.com/mortenterhart/trivial-tickets/log"
+	"github.com/mortenterhart/trivial-tickets/session"
+	"github.com/mortenterhart/trivial-tickets/structs"
+	"github.com/mortenterhart/trivial-tickets/ticket"
+	"github.com/mortenterhart/trivial-tickets/util/filehandler"
+)
+
+/*
+ * Ticketsystem Trivial Tickets
+ *
+ * Matriculation numbers: 3040018, 6694964, 3478222
+ * Lecture:               Programmieren II, INF16B
+ * Lecturer:              Herr Prof. Dr. Helmut Neemann
+ * Institute:             Duale Hochschule Baden-Württemberg Mosbach
+ *
+ * ---------------
+ *
+ * Package server
+ * Download of the attachments of entries
+ */
+
+// handleAttachment sends the attachment given in the form
+// value "id" of the ticket given in the form value "ticket"
+// as download. Like the ticket page, customers need the
+// access token of the ticket given in the form value "token".
+// The attachments of internal comments require a logged in
+// user.
+func handleAttachment(w http.ResponseWriter, r *http.Request) {
+
+	// Only support GET requests
+	if r.Method != getMethod {
+		http.Redirect(w, r, indexURL, http.StatusMovedPermanently)
+		return
+	}
+
+	sessionID := session.GetSessionID(r)
+	isLoggedIn := globals.Sessions[sessionID].Session.IsLoggedIn
+
+	ticketID := r.FormValue("ticket")
+	currentTicket := globals.Tickets[ticketID]
+	if !isLoggedIn && !ticket.HasAccess(currentTicket, r.FormValue(tokenParameter)) {
+		log.Errorf("%s %s: invalid access token for ticket '%s'", r.Method, r.URL.Path, ticketID)
+		http.NotFound(w, r)
+		return
+	}
+
+	attachment, found := findAttachment(currentTicket, r.FormValue(idParameter), isLoggedIn)
+	if !found {
+		log.Errorf("%s %s: attachment not found in ticket '%s'", r.Method, r.RequestURI, ticketID)
+		http.NotFound(w, r)
+		return
+	}
+
+	file, openErr := os.Open(filehandler.AttachmentPath(globals.ServerConfig.Attachments, attachment.ID))
+	if openErr != nil {
+		log.Errorf("unable to open attachment '%s' of ticket '%s': %v", attachment.ID, ticketID, openErr)
+		http.NotFound(w, r)
+		return
+	}
+	defer file.Close()
+
+	contentType := attachment.ContentType
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment",
+		map[string]string{"filename": attachment.Name}))
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+
+	var modTime time.Time
+	if info, statErr := file.Stat(); statErr == nil {
+		modTime = info.ModTime()
+	}
+
+	http.ServeContent(w, r, "", modTime, file)
+}
+
+// findAttachment looks up the attachment with the given id in
+// the entries of the ticket. Attachments of internal comments
+// are only found for logged in users.
+func findAttachment(currentTicket structs.Ticket, attachmentID string, isLoggedIn bool) (structs.Attachment, bool) {
+	for _, entry := range currentTicket.Entries {
+		if entry.IsInternal() && !isLoggedIn {
+			continue
+		}
+
+		for _, attachment := range entry.Attachments {
+			if attachment.ID == attachmentID {
+				return attachment, true
+			}
+		}
+	}
+
+	return structs.Attachment{}, false
+}
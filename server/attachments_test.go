@@ -0,0 +1,161 @@
+// Trivial Tickets Ticketsystem
+// Copyright (C) 2019 The Contributors
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+// Package server implements the web server including
+// shutdown routines and the associated handlers for
+// web requests.
+package server
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mortenterhart/trivial-tickets/globals"
+	"github.com/mortenterhart/trivial-tickets/log/testlog"
+	"github.com/mortenterhart/trivial-tickets/structs"
+	"github.com/mortenterhart/trivial-tickets/util/filehandler"
+)
+
+/*
+ * Ticketsystem Trivial Tickets
+ *
+ * Matriculation numbers: 3040018, 6694964, 3478222
+ * Lecture:               Programmieren II, INF16B
+ * Lecturer:              Herr Prof. Dr. Helmut Neemann
+ * Institute:             Duale Hochschule Baden-Württemberg Mosbach
+ *
+ * ---------------
+ *
+ * Package server [tests]
+ * Download of the attachments of entries
+ */
+
+func TestHandleAttachment(t *testing.T) {
+	testlog.BeginTest()
+	defer testlog.EndTest()
+
+	defer resetConfig()
+
+	directory, tempErr := ioutil.TempDir("", "attachments")
+	if !assert.NoError(t, tempErr) {
+		return
+	}
+	defer os.RemoveAll(directory)
+
+	globals.ServerConfig.Attachments = directory
+
+	assert.NoError(t, filehandler.WriteAttachmentFile(directory, "att1", []byte("log output")))
+	assert.NoError(t, filehandler.WriteAttachmentFile(directory, "att2", []byte("internal notes")))
+
+	user, logout := loginResponseUser()
+	defer logout()
+
+	defer mockEntryTicket(user, true)()
+
+	entryTicket := globals.Tickets["entry123"]
+	entryTicket.Entries[0].Attachments = []structs.Attachment{
+		{ID: "att1", Name: "log.txt", ContentType: "text/plain", Size: 10},
+	}
+	entryTicket.Entries[1].Attachments = []structs.Attachment{
+		{ID: "att2", Name: "notes.txt", ContentType: "text/plain", Size: 14},
+	}
+	globals.Tickets[entryTicket.ID] = entryTicket
+
+	server := httptest.NewServer(&sessionHandler{handleAttachment})
+	defer server.Close()
+
+	client := newNonRedirectClient()
+
+	get := func(ticketID string, attachmentID string) (*http.Response, string) {
+		resp, err := client.Get(server.URL + "?ticket=" + ticketID + "&id=" + attachmentID + "&token=entrytoken")
+		if !assert.NoError(t, err, "An unexpected error occurred") {
+			return &http.Response{}, ""
+		}
+		defer resp.Body.Close()
+
+		body, _ := ioutil.ReadAll(resp.Body)
+		return resp, string(body)
+	}
+
+	t.Run("download", func(t *testing.T) {
+		resp, body := get("entry123", "att1")
+
+		assert.Equal(t, http.StatusOK, resp.StatusCode, "attachment should be sent")
+		assert.Equal(t, "log output", body)
+		assert.Equal(t, "text/plain", resp.Header.Get("Content-Type"))
+		assert.Equal(t, `attachment; filename=log.txt`, resp.Header.Get("Content-Disposition"))
+		assert.Equal(t, "nosniff", resp.Header.Get("X-Content-Type-Options"))
+	})
+
+	t.Run("unknownAttachment", func(t *testing.T) {
+		resp, _ := get("entry123", "att3")
+
+		assert.Equal(t, http.StatusNotFound, resp.StatusCode, "unknown attachment should not be found")
+	})
+
+	t.Run("unknownTicket", func(t *testing.T) {
+		resp, _ := get("unknown", "att1")
+
+		assert.Equal(t, http.StatusNotFound, resp.StatusCode, "unknown ticket should not be found")
+	})
+
+	t.Run("internalLoggedIn", func(t *testing.T) {
+		resp, body := get("entry123", "att2")
+
+		assert.Equal(t, http.StatusOK, resp.StatusCode, "internal attachment should be sent to users")
+		assert.Equal(t, "internal notes", body)
+	})
+
+	t.Run("internalNotLoggedIn", func(t *testing.T) {
+		logout()
+
+		resp, _ := get("entry123", "att2")
+
+		assert.Equal(t, http.StatusNotFound, resp.StatusCode, "internal attachment should be hidden from customers")
+	})
+
+	t.Run("externalNotLoggedIn", func(t *testing.T) {
+		resp, body := get("entry123", "att1")
+
+		assert.Equal(t, http.StatusOK, resp.StatusCode, "attachment should be sent to customers with the token")
+		assert.Equal(t, "log output", body)
+	})
+
+	t.Run("invalidToken", func(t *testing.T) {
+		resp, err := client.Get(server.URL + "?ticket=entry123&id=att1&token=wrong")
+		if err == nil {
+			resp.Body.Close()
+		}
+
+		assert.NoError(t, err, "An unexpected error occurred")
+		assert.Equal(t, http.StatusNotFound, resp.StatusCode, "attachment should be hidden without the token")
+	})
+
+	t.Run("wrongMethod", func(t *testing.T) {
+		resp, err := client.Post(server.URL, "text/plain", nil)
+		if err == nil {
+			resp.Body.Close()
+		}
+
+		assert.NoError(t, err, "An unexpected error occurred")
+		assert.Equal(t, http.StatusMovedPermanently, resp.StatusCode, "Status code did not match 301")
+	})
+}
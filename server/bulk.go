@@ -0,0 +1,362 @@
+// Trivial Tickets Ticketsystem
+// Copyright (C) 2019 The Contributors
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+// Package server implements the web server including
+// shutdown routines and the associated handlers for
+// web requests.
+package server
+
+import (
+	"fmt"
+	"html/template"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/mortenterhart/trivial-tickets/api/api_out"
+	"github.com/mortenterhart/trivial-tickets/assignment"
+	"github.com/mortenterhart/trivial-tickets/globals"
+	"github.com/mortenterhart/trivial-tickets/log"
+	"github.com/mortenterhart/trivial-tickets/mail_events"
+	"github.com/mortenterhart/trivial-tickets/responses"
+	"github.com/mortenterhart/trivial-tickets/session"
+	"github.com/mortenterhart/trivial-tickets/structs"
+	"github.com/mortenterhart/trivial-tickets/ticket"
+	"github.com/mortenterhart/trivial-tickets/util/filehandler"
+	"github.com/mortenterhart/trivial-tickets/util/httptools"
+)
+
+/*
+ * Ticketsystem Trivial Tickets
+ *
+ * Matriculation numbers: 3040018, 6694964, 3478222
+ * Lecture:               Programmieren II, INF16B
+ * Lecturer:              Herr Prof. Dr. Helmut Neemann
+ * Institute:             Duale Hochschule Baden-Württemberg Mosbach
+ *
+ * ---------------
+ *
+ * Package server
+ * Bulk actions on several tickets
+ */
+
+// The bulk actions which can be applied to the
+// tickets selected in the all tickets view.
+const (
+	bulkAssign string = "assign"
+	bulkClose  string = "close"
+	bulkStatus string = "status"
+	bulkTag    string = "tag"
+	bulkMerge  string = "merge"
+)
+
+// bulkChanges collects the changed tickets of a bulk action
+// before they are written back to the stored tickets.
+type bulkChanges map[string]structs.Ticket
+
+// ticket returns the changed version of the ticket with
+// the given id or the stored ticket if it is unchanged.
+func (changes bulkChanges) ticket(id string) (structs.Ticket, bool) {
+	if changedTicket, changed := changes[id]; changed {
+		return changedTicket, true
+	}
+
+	storedTicket, exists := globals.Tickets[id]
+	return storedTicket, exists
+}
+
+// bulkAction applies a bulk action to a single ticket and
+// records the changed tickets. It returns an error if the
+// action cannot be applied to the ticket.
+type bulkAction func(changes bulkChanges, currentTicket structs.Ticket) error
+
+// handleBulkAction applies the action given in the form value
+// "action" to all tickets given in the form values "tickets".
+// The actions are applied transactionally: if the action fails
+// for one of the tickets, none of the tickets is changed. The
+// result for every ticket is returned as JSON.
+func handleBulkAction(w http.ResponseWriter, r *http.Request) {
+
+	// Only support POST requests
+	if r.Method != postMethod {
+		httptools.StatusCodeError(w, fmt.Sprintf("method %s not allowed, expecting POST", r.Method),
+			http.StatusMethodNotAllowed)
+		return
+	}
+
+	// Get the session
+	sessionID := session.GetSessionID(r)
+	currentSession := globals.Sessions[sessionID].Session
+
+	if !currentSession.IsLoggedIn {
+		log.Errorf("%s %s: login required to apply bulk actions", r.Method, r.RequestURI)
+		httptools.JSONError(w, structs.JSONMap{
+			"applied": false,
+			"message": "login required to apply bulk actions",
+		}, http.StatusUnauthorized)
+		return
+	}
+
+	user := currentSession.User
+
+	if parseErr := r.ParseForm(); parseErr != nil {
+		httptools.StatusCodeError(w, parseErr.Error(), http.StatusBadRequest)
+		return
+	}
+
+	action := template.HTMLEscapeString(r.FormValue("action"))
+	ticketIDs := uniqueTicketIDs(r.Form["tickets"])
+	if len(ticketIDs) == 0 {
+		httptools.StatusCodeError(w, "no tickets selected", http.StatusBadRequest)
+		return
+	}
+
+	// Check the permissions with the current role of the user
+	if storedUser, userExists := globals.Users[user.Username]; userExists {
+		user = storedUser
+	}
+
+	apply, actionErr := newBulkAction(action, r.Form, user)
+	if actionErr != nil {
+		httptools.StatusCodeError(w, actionErr.Error(), http.StatusBadRequest)
+		return
+	}
+
+	changes := make(bulkChanges)
+	results, applied := applyBulkAction(apply, changes, ticketIDs)
+
+	if !applied {
+		log.Errorf("%s %s: bulk action '%s' of user '%s' failed, no ticket was changed",
+			r.Method, r.RequestURI, action, user.Username)
+		httptools.JSONError(w, structs.JSONMap{
+			"applied": false,
+			"results": results,
+		}, http.StatusConflict)
+		return
+	}
+
+	log.Infof("User '%s' applied bulk action '%s' to %d ticket(s)", user.Username, action, len(ticketIDs))
+
+	// Commit the changes and inform the customers afterwards
+	previous := make(map[string]structs.Ticket)
+	for id, changedTicket := range changes {
+		previous[id] = globals.Tickets[id]
+		globals.Tickets[id] = changedTicket
+		filehandler.WriteTicketFile(globals.ServerConfig.Tickets, &changedTicket)
+	}
+
+	for _, id := range ticketIDs {
+		sendBulkMails(previous[id], changes[id], user)
+	}
+
+	httptools.JSONResponse(w, structs.JSONMap{
+		"applied": true,
+		"results": results,
+	})
+}
+
+// uniqueTicketIDs returns the escaped ticket ids without
+// duplicates in the order they were selected.
+func uniqueTicketIDs(ticketIDs []string) []string {
+	var unique []string
+	seen := make(map[string]bool)
+	for _, id := range ticketIDs {
+		id = template.HTMLEscapeString(id)
+		if id != "" && !seen[id] {
+			seen[id] = true
+			unique = append(unique, id)
+		}
+	}
+
+	return unique
+}
+
+// applyBulkAction applies the action to all given tickets and
+// records the changes. It reports whether the action succeeded
+// for all tickets. Otherwise, the results of the tickets which
+// did not fail state that the changes were discarded.
+func applyBulkAction(apply bulkAction, changes bulkChanges, ticketIDs []string) ([]structs.BulkResult, bool) {
+	results := make([]structs.BulkResult, 0, len(ticketIDs))
+	applied := true
+
+	for _, id := range ticketIDs {
+		result := structs.BulkResult{Ticket: id, Success: true}
+
+		currentTicket, exists := changes.ticket(id)
+		applyErr := errors.New("ticket does not exist")
+		if exists {
+			applyErr = applyToTicket(apply, changes, currentTicket)
+		}
+
+		if applyErr != nil {
+			result.Success = false
+			result.Message = applyErr.Error()
+			applied = false
+		}
+
+		results = append(results, result)
+	}
+
+	if !applied {
+		for index := range results {
+			if results[index].Success {
+				results[index].Success = false
+				results[index].Message = "not applied because the action failed for other tickets"
+			}
+		}
+	}
+
+	return results, applied
+}
+
+// applyToTicket applies the action to a ticket which has
+// not been merged into another ticket.
+func applyToTicket(apply bulkAction, changes bulkChanges, currentTicket structs.Ticket) error {
+	if currentTicket.MergeTo != "" {
+		return fmt.Errorf("ticket has been merged into ticket '%s'", currentTicket.MergeTo)
+	}
+
+	return apply(changes, currentTicket)
+}
+
+// newBulkAction returns the bulk action with the given name.
+// The parameters of the action are taken from the form values
+// "user", "status", "tag" and "merge" respectively. Tickets
+// are assigned with the permissions of the actor.
+func newBulkAction(action string, form url.Values, actor structs.User) (bulkAction, error) {
+	switch action {
+	case bulkAssign:
+		username := form.Get("user")
+		editor, userExists := globals.Users[username]
+		if !userExists {
+			return nil, fmt.Errorf("user '%s' does not exist", username)
+		}
+
+		return func(changes bulkChanges, currentTicket structs.Ticket) error {
+			if checkErr := assignment.CheckAssignment(actor, editor, currentTicket); checkErr != nil {
+				return checkErr
+			}
+
+			changes[currentTicket.ID] = ticket.AssignTicket(editor, currentTicket)
+			return nil
+		}, nil
+
+	case bulkClose:
+		return setStatus(structs.StatusClosed), nil
+
+	case bulkStatus:
+		status, convErr := strconv.Atoi(form.Get("status"))
+		if convErr != nil || status < int(structs.StatusOpen) || status > int(structs.StatusClosed) {
+			return nil, fmt.Errorf("status '%s' is not defined", form.Get("status"))
+		}
+
+		return setStatus(structs.Status(status)), nil
+
+	case bulkTag:
+		tags := responses.ParseTags(form.Get("tag"))
+		if len(tags) == 0 {
+			return nil, errors.New("no tag given")
+		}
+
+		return func(changes bulkChanges, currentTicket structs.Ticket) error {
+			currentTicket.Tags = responses.AddTags(currentTicket.Tags, tags)
+			changes[currentTicket.ID] = currentTicket
+			return nil
+		}, nil
+
+	case bulkMerge:
+		targetID := template.HTMLEscapeString(form.Get("merge"))
+		if _, targetExists := globals.Tickets[targetID]; !targetExists {
+			return nil, fmt.Errorf("ticket '%s' to merge into does not exist", targetID)
+		}
+
+		return func(changes bulkChanges, currentTicket structs.Ticket) error {
+			target, _ := changes.ticket(targetID)
+
+			switch {
+			case currentTicket.ID == target.ID:
+				return errors.New("ticket cannot be merged into itself")
+			case target.MergeTo != "":
+				return fmt.Errorf("ticket '%s' has been merged into ticket '%s'", target.ID, target.MergeTo)
+			case currentTicket.Customer != target.Customer:
+				return fmt.Errorf("ticket '%s' belongs to another customer", target.ID)
+			}
+
+			mergedTo, mergedFrom := ticket.MergeTickets(target, currentTicket)
+			changes[mergedTo.ID] = mergedTo
+			changes[mergedFrom.ID] = mergedFrom
+			return nil
+		}, nil
+	}
+
+	return nil, fmt.Errorf("bulk action '%s' not defined", action)
+}
+
+// setStatus returns a bulk action changing the status of the
+// tickets. Tickets which are set to open are released and
+// tickets can only be in progress if they have an editor.
+// Otherwise the status is changed like in single updates,
+// so that closed tickets get their survey token.
+func setStatus(status structs.Status) bulkAction {
+	return func(changes bulkChanges, currentTicket structs.Ticket) error {
+		if currentTicket.Status == status {
+			return fmt.Errorf("ticket is already %s", strings.ToLower(status.String()))
+		}
+
+		switch status {
+		case structs.StatusOpen:
+			currentTicket = ticket.UnassignTicket(currentTicket)
+
+		case structs.StatusInProgress:
+			if currentTicket.User.Username == "" {
+				return errors.New("ticket has no editor")
+			}
+			fallthrough
+
+		default:
+			currentTicket = ticket.UpdateTicket(strconv.Itoa(int(status)), "", "", "", currentTicket)
+		}
+
+		changes[currentTicket.ID] = currentTicket
+		return nil
+	}
+}
+
+// sendBulkMails informs the customer about the changes of a
+// ticket made by a bulk action and the editor about tickets
+// assigned to them by the actor. Merged tickets are closed
+// silently because the customer is informed by the merged
+// ticket.
+func sendBulkMails(previousTicket, changedTicket structs.Ticket, actor structs.User) {
+	if changedTicket.MergeTo != "" {
+		return
+	}
+
+	if changedTicket.User.ID != "" && changedTicket.User.ID != previousTicket.User.ID {
+		api_out.SendMail(mail_events.AssignedTicket, changedTicket)
+
+		if changedTicket.User.ID != actor.ID {
+			api_out.SendMail(mail_events.AgentAssigned, changedTicket)
+		}
+	}
+
+	if changedTicket.Status == structs.StatusClosed && previousTicket.Status != structs.StatusClosed {
+		api_out.SendMail(mail_events.UpdatedTicket, changedTicket)
+	}
+}
@@ -0,0 +1,237 @@
+// Trivial Tickets Ticketsystem
+// Copyright (C) 2019 The Contributors
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+// Package server implements the web server including
+// shutdown routines and the associated handlers for
+// web requests.
+package server
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mortenterhart/trivial-tickets/globals"
+	"github.com/mortenterhart/trivial-tickets/log/testlog"
+	"github.com/mortenterhart/trivial-tickets/structs"
+)
+
+/*
+ * Ticketsystem Trivial Tickets
+ *
+ * Matriculation numbers: 3040018, 6694964, 3478222
+ * Lecture:               Programmieren II, INF16B
+ * Lecturer:              Herr Prof. Dr. Helmut Neemann
+ * Institute:             Duale Hochschule Baden-Württemberg Mosbach
+ *
+ * ---------------
+ *
+ * Package server
+ * Bulk actions on several tickets
+ */
+
+// bulkResponse is the JSON response of a bulk action.
+type bulkResponse struct {
+	Applied bool                 `json:"applied"`
+	Results []structs.BulkResult `json:"results"`
+}
+
+// mockBulkTickets creates the open ticket "bulk1" and the
+// closed ticket "bulk2" of the mocked customer and returns a
+// function removing them again.
+func mockBulkTickets() func() {
+	globals.Tickets["bulk1"] = structs.Ticket{
+		ID:       "bulk1",
+		Customer: "customer@mail.com",
+		Status:   structs.StatusOpen,
+		Entries:  []structs.Entry{{User: "customer@mail.com", Text: "First", ReplyType: "external"}},
+	}
+	globals.Tickets["bulk2"] = structs.Ticket{
+		ID:       "bulk2",
+		Customer: "customer@mail.com",
+		Status:   structs.StatusClosed,
+		Entries:  []structs.Entry{{User: "customer@mail.com", Text: "Second", ReplyType: "external"}},
+	}
+
+	return func() {
+		delete(globals.Tickets, "bulk1")
+		delete(globals.Tickets, "bulk2")
+	}
+}
+
+// postBulkAction posts the form values to the server and
+// decodes the JSON response.
+func postBulkAction(t *testing.T, client *http.Client, serverURL string, form url.Values) (int, bulkResponse) {
+	var response bulkResponse
+
+	resp, err := client.PostForm(serverURL, form)
+	if !assert.NoError(t, err, "An unexpected error occurred") {
+		return 0, response
+	}
+	defer resp.Body.Close()
+
+	body, _ := ioutil.ReadAll(resp.Body)
+	json.Unmarshal(body, &response)
+
+	return resp.StatusCode, response
+}
+
+func TestHandleBulkAction(t *testing.T) {
+	testlog.BeginTest()
+	defer testlog.EndTest()
+
+	defer resetConfig()
+
+	config := testServerConfig()
+	defer cleanupTestFiles(config)
+
+	user, logout := loginResponseUser()
+	defer logout()
+
+	server := httptest.NewServer(&sessionHandler{handleBulkAction})
+	defer server.Close()
+
+	client := newNonRedirectClient()
+
+	t.Run("assign", func(t *testing.T) {
+		defer mockEntryTicket(user, false)()
+		defer mockBulkTickets()()
+
+		status, response := postBulkAction(t, client, server.URL, url.Values{
+			"action":  {"assign"},
+			"user":    {user.Username},
+			"tickets": {"entry123", "bulk1"},
+		})
+
+		assert.Equal(t, http.StatusOK, status, "Status code did not match 200")
+		assert.True(t, response.Applied, "action should be applied")
+		assert.Len(t, response.Results, 2, "every ticket should have a result")
+		assert.Equal(t, user.ID, globals.Tickets["entry123"].User.ID, "ticket should be assigned")
+		assert.Equal(t, structs.StatusInProgress, globals.Tickets["bulk1"].Status, "ticket should be in progress")
+	})
+
+	t.Run("assignOthers", func(t *testing.T) {
+		defer mockBulkTickets()()
+
+		globals.Users["other"] = structs.User{ID: "other1", Username: "other", Mail: "other@mail.com"}
+		defer delete(globals.Users, "other")
+
+		status, response := postBulkAction(t, client, server.URL, url.Values{
+			"action":  {"assign"},
+			"user":    {"other"},
+			"tickets": {"bulk1"},
+		})
+
+		assert.Equal(t, http.StatusConflict, status, "Status code did not match 409")
+		assert.False(t, response.Applied, "agents should not assign other editors")
+		assert.Equal(t, structs.StatusOpen, globals.Tickets["bulk1"].Status, "ticket should not be assigned")
+	})
+
+	t.Run("tag", func(t *testing.T) {
+		defer mockBulkTickets()()
+
+		status, response := postBulkAction(t, client, server.URL, url.Values{
+			"action":  {"tag"},
+			"tag":     {"printer, urgent"},
+			"tickets": {"bulk1", "bulk2"},
+		})
+
+		assert.Equal(t, http.StatusOK, status, "Status code did not match 200")
+		assert.True(t, response.Applied, "action should be applied")
+		assert.Equal(t, []string{"printer", "urgent"}, globals.Tickets["bulk2"].Tags, "tags should be added")
+	})
+
+	t.Run("merge", func(t *testing.T) {
+		defer mockEntryTicket(user, true)()
+		defer mockBulkTickets()()
+
+		status, response := postBulkAction(t, client, server.URL, url.Values{
+			"action":  {"merge"},
+			"merge":   {"entry123"},
+			"tickets": {"bulk1", "bulk2"},
+		})
+
+		assert.Equal(t, http.StatusOK, status, "Status code did not match 200")
+		assert.True(t, response.Applied, "action should be applied")
+		assert.Equal(t, "entry123", globals.Tickets["bulk1"].MergeTo, "ticket should be merged")
+		assert.Equal(t, "entry123", globals.Tickets["bulk2"].MergeTo, "ticket should be merged")
+		assert.Len(t, globals.Tickets["entry123"].Entries, 4, "all entries should be merged")
+	})
+
+	t.Run("rollback", func(t *testing.T) {
+		defer mockBulkTickets()()
+
+		status, response := postBulkAction(t, client, server.URL, url.Values{
+			"action":  {"close"},
+			"tickets": {"bulk1", "bulk2", "unknown"},
+		})
+
+		assert.Equal(t, http.StatusConflict, status, "Status code did not match 409")
+		assert.False(t, response.Applied, "action should not be applied")
+		assert.Equal(t, []structs.BulkResult{
+			{Ticket: "bulk1", Message: "not applied because the action failed for other tickets"},
+			{Ticket: "bulk2", Message: "ticket is already closed"},
+			{Ticket: "unknown", Message: "ticket does not exist"},
+		}, response.Results, "results should explain the failures")
+		assert.Equal(t, structs.StatusOpen, globals.Tickets["bulk1"].Status, "no ticket should be changed")
+	})
+
+	t.Run("close", func(t *testing.T) {
+		defer mockBulkTickets()()
+
+		status, response := postBulkAction(t, client, server.URL, url.Values{
+			"action":  {"close"},
+			"tickets": {"bulk1"},
+		})
+
+		assert.Equal(t, http.StatusOK, status, "Status code did not match 200")
+		assert.True(t, response.Applied, "action should be applied")
+		assert.Equal(t, structs.StatusClosed, globals.Tickets["bulk1"].Status, "ticket should be closed")
+		assert.NotEmpty(t, globals.Tickets["bulk1"].Rating.Token, "closed ticket should get a survey token")
+	})
+
+	t.Run("invalidAction", func(t *testing.T) {
+		defer mockBulkTickets()()
+
+		status, _ := postBulkAction(t, client, server.URL, url.Values{
+			"action":  {"status"},
+			"status":  {"7"},
+			"tickets": {"bulk1"},
+		})
+
+		assert.Equal(t, http.StatusBadRequest, status, "Status code did not match 400")
+	})
+
+	t.Run("notLoggedIn", func(t *testing.T) {
+		defer mockBulkTickets()()
+
+		logout()
+
+		status, response := postBulkAction(t, client, server.URL, url.Values{
+			"action":  {"close"},
+			"tickets": {"bulk1"},
+		})
+
+		assert.Equal(t, http.StatusUnauthorized, status, "Status code did not match 401")
+		assert.False(t, response.Applied, "action should not be applied")
+		assert.Equal(t, structs.StatusOpen, globals.Tickets["bulk1"].Status, "ticket should not be closed")
+	})
+}
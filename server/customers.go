@@ -0,0 +1,175 @@
+// Trivial Tickets Ticketsystem
+// Copyright (C) 2019 The Contributors
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+// Package server implements the web server including
+// shutdown routines and the associated handlers for
+// web requests.
+package server
+
+import (
+	"html/template"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/mortenterhart/trivial-tickets/customers"
+	"github.com/mortenterhart/trivial-tickets/globals"
+	"github.com/mortenterhart/trivial-tickets/log"
+	"github.com/mortenterhart/trivial-tickets/mail_events"
+	"github.com/mortenterhart/trivial-tickets/session"
+	"github.com/mortenterhart/trivial-tickets/structs"
+	"github.com/mortenterhart/trivial-tickets/util/random"
+)
+
+/*
+ * Ticketsystem Trivial Tickets
+ *
+ * Matriculation numbers: 3040018, 6694964, 3478222
+ * Lecture:               Programmieren II, INF16B
+ * Lecturer:              Herr Prof. Dr. Helmut Neemann
+ * Institute:             Duale Hochschule Baden-Württemberg Mosbach
+ *
+ * ---------------
+ *
+ * Package server
+ * Customer directory and customer pages
+ */
+
+// customersURL is the URL of the customer directory.
+const customersURL string = "/customers"
+
+// handleCustomers serves the customer directory. The GET
+// parameter "organization" restricts the directory to the
+// customers of one organization.
+func handleCustomers(w http.ResponseWriter, r *http.Request) {
+
+	// Get session id
+	sessionID := session.GetSessionID(r)
+
+	// Only react on GET requests of logged in users
+	if r.Method != getMethod || !globals.Sessions[sessionID].Session.IsLoggedIn {
+		http.Redirect(w, r, indexURL, http.StatusMovedPermanently)
+		return
+	}
+
+	currentSession, _ := session.GetSession(sessionID)
+	organization := r.URL.Query().Get("organization")
+
+	executeErr := tmpl.Lookup("customers.html").ExecuteTemplate(w, "customers", structs.DataCustomers{
+		Session:       currentSession,
+		Customers:     customers.Directory(globals.Customers, organization),
+		Organizations: customers.Organizations(globals.Customers),
+		Organization:  organization,
+		Languages:     mail_events.Languages(),
+	})
+	if executeErr != nil {
+		log.Errorf("unable to render customer directory: %v", executeErr)
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+}
+
+// handleCustomer serves the page of the customer given by the
+// GET parameter "id" or "mail" with all tickets of the customer
+// and their history.
+func handleCustomer(w http.ResponseWriter, r *http.Request) {
+
+	// Get session id
+	sessionID := session.GetSessionID(r)
+
+	// Only react on GET requests of logged in users
+	if r.Method != getMethod || !globals.Sessions[sessionID].Session.IsLoggedIn {
+		http.Redirect(w, r, indexURL, http.StatusMovedPermanently)
+		return
+	}
+
+	currentSession, _ := session.GetSession(sessionID)
+
+	customer, customerExists := globals.Customers[r.URL.Query().Get(idParameter)]
+	if mail := r.URL.Query().Get("mail"); !customerExists && mail != "" {
+		customer, customerExists = customers.FindByMail(globals.Customers, mail)
+	}
+
+	if !customerExists {
+		log.Errorf("%s %s: customer not found", r.Method, r.RequestURI)
+		http.Redirect(w, r, customersURL, http.StatusMovedPermanently)
+		return
+	}
+
+	customerTickets := customers.Tickets(customer, globals.Tickets)
+
+	executeErr := tmpl.Lookup("customer.html").ExecuteTemplate(w, "customer", structs.DataCustomer{
+		Session:   currentSession,
+		Customer:  customer,
+		Tickets:   customerTickets,
+		History:   customers.History(customerTickets),
+		Languages: mail_events.Languages(),
+	})
+	if executeErr != nil {
+		log.Errorf("unable to render customer '%s': %v", customer.ID, executeErr)
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+}
+
+// handleSaveCustomer saves the customer given in the form value
+// "customer" with the form values "name", "organization",
+// "mails", "phone", "language" and "notes". The mail addresses
+// are separated by commas. Without a customer a new customer is
+// added to the directory.
+func handleSaveCustomer(w http.ResponseWriter, r *http.Request) {
+
+	// Get session id
+	sessionID := session.GetSessionID(r)
+
+	// Only react on POST requests of logged in users
+	if r.Method != postMethod || !globals.Sessions[sessionID].Session.IsLoggedIn {
+		http.Redirect(w, r, indexURL, http.StatusMovedPermanently)
+		return
+	}
+
+	currentSession, _ := session.GetSession(sessionID)
+
+	customerID := template.HTMLEscapeString(r.FormValue("customer"))
+	if customerID == "" {
+		customerID = random.CreateRandomID(structs.RandomIDLength)
+	} else if _, customerExists := globals.Customers[customerID]; !customerExists {
+		log.Errorf("%s %s: customer '%s' not found", r.Method, r.RequestURI, customerID)
+		http.Redirect(w, r, customersURL, http.StatusMovedPermanently)
+		return
+	}
+
+	customer := structs.Customer{
+		ID:           customerID,
+		Name:         template.HTMLEscapeString(r.FormValue("name")),
+		Organization: template.HTMLEscapeString(r.FormValue("organization")),
+		Mails:        customers.ParseMails(template.HTMLEscapeString(r.FormValue("mails"))),
+		Phone:        template.HTMLEscapeString(r.FormValue("phone")),
+		Notes:        template.HTMLEscapeString(r.FormValue("notes")),
+		Language:     strings.ToLower(strings.TrimSpace(template.HTMLEscapeString(r.FormValue("language")))),
+	}
+
+	if validateErr := customers.Validate(globals.Customers, customer); validateErr != nil {
+		log.Errorf("%s %s: invalid customer: %v", r.Method, r.RequestURI, validateErr)
+		http.Redirect(w, r, customersURL, http.StatusMovedPermanently)
+		return
+	}
+
+	log.Infof("User '%s' saved customer '%s'", currentSession.User.Username, customer.DisplayName())
+
+	globals.Customers[customer.ID] = customer
+	customers.Save()
+
+	http.Redirect(w, r, "/customer?"+idParameter+"="+url.QueryEscape(customer.ID), http.StatusMovedPermanently)
+}
@@ -0,0 +1,231 @@
+// Trivial Tickets Ticketsystem
+// Copyright (C) 2019 The Contributors
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+// Package server implements the web server including
+// shutdown routines and the associated handlers for
+// web requests.
+package server
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mortenterhart/trivial-tickets/globals"
+	"github.com/mortenterhart/trivial-tickets/log/testlog"
+	"github.com/mortenterhart/trivial-tickets/structs"
+	"github.com/mortenterhart/trivial-tickets/structs/defaults"
+)
+
+/*
+ * Ticketsystem Trivial Tickets
+ *
+ * Matriculation numbers: 3040018, 6694964, 3478222
+ * Lecture:               Programmieren II, INF16B
+ * Lecturer:              Herr Prof. Dr. Helmut Neemann
+ * Institute:             Duale Hochschule Baden-Württemberg Mosbach
+ *
+ * ---------------
+ *
+ * Package server
+ * Customer directory and customer pages
+ */
+
+// mockCustomer stores the customer of the mock entry
+// ticket in the customer directory and returns a function
+// clearing the directory again.
+func mockCustomer() func() {
+	globals.Customers["cust123"] = structs.Customer{
+		ID:           "cust123",
+		Name:         "Jane Doe",
+		Organization: "ACME",
+		Mails:        []string{"customer@mail.com"},
+	}
+
+	return func() {
+		globals.Customers = make(map[string]structs.Customer)
+	}
+}
+
+func TestHandleCustomers(t *testing.T) {
+	testlog.BeginTest()
+	defer testlog.EndTest()
+
+	defer resetConfig()
+
+	config := testServerConfig()
+	defer cleanupTestFiles(config)
+
+	tmpl = getTemplates(defaults.TestWebTrimmed)
+
+	_, logout := loginResponseUser()
+	defer logout()
+
+	defer mockCustomer()()
+
+	server := httptest.NewServer(&sessionHandler{handleCustomers})
+	defer server.Close()
+
+	client := newNonRedirectClient()
+
+	t.Run("directory", func(t *testing.T) {
+		resp, err := client.Get(server.URL + "/customers?organization=ACME")
+		if !assert.NoError(t, err, "An unexpected error occurred") {
+			return
+		}
+		defer resp.Body.Close()
+
+		body, _ := ioutil.ReadAll(resp.Body)
+
+		assert.Equal(t, http.StatusOK, resp.StatusCode, "The http status is not 200")
+		assert.Contains(t, string(body), "Jane Doe", "directory should contain the customer")
+	})
+
+	t.Run("otherOrganization", func(t *testing.T) {
+		resp, err := client.Get(server.URL + "/customers?organization=Other")
+		if !assert.NoError(t, err, "An unexpected error occurred") {
+			return
+		}
+		defer resp.Body.Close()
+
+		body, _ := ioutil.ReadAll(resp.Body)
+
+		assert.NotContains(t, string(body), "Jane Doe", "customers of other organizations should be hidden")
+	})
+
+	t.Run("notLoggedIn", func(t *testing.T) {
+		anonymousServer := httptest.NewServer(http.HandlerFunc(handleCustomers))
+		defer anonymousServer.Close()
+
+		resp, err := client.Get(anonymousServer.URL + "/customers")
+		if err == nil {
+			resp.Body.Close()
+		}
+
+		assert.NoError(t, err, "An unexpected error occurred")
+		assert.Equal(t, http.StatusMovedPermanently, resp.StatusCode, "Status code did not match 301")
+	})
+}
+
+func TestHandleCustomer(t *testing.T) {
+	testlog.BeginTest()
+	defer testlog.EndTest()
+
+	defer resetConfig()
+
+	config := testServerConfig()
+	defer cleanupTestFiles(config)
+
+	tmpl = getTemplates(defaults.TestWebTrimmed)
+
+	user, logout := loginResponseUser()
+	defer logout()
+
+	defer mockCustomer()()
+	defer mockEntryTicket(user, true)()
+
+	server := httptest.NewServer(&sessionHandler{handleCustomer})
+	defer server.Close()
+
+	client := newNonRedirectClient()
+
+	t.Run("byMail", func(t *testing.T) {
+		resp, err := client.Get(server.URL + "/customer?mail=customer@mail.com")
+		if !assert.NoError(t, err, "An unexpected error occurred") {
+			return
+		}
+		defer resp.Body.Close()
+
+		body, _ := ioutil.ReadAll(resp.Body)
+
+		assert.Equal(t, http.StatusOK, resp.StatusCode, "The http status is not 200")
+		assert.Contains(t, string(body), "Jane Doe", "page should show the customer")
+		assert.Contains(t, string(body), "/ticket?id=entry123", "page should list the tickets of the customer")
+		assert.Contains(t, string(body), "My password is secret", "page should show the history")
+	})
+
+	t.Run("unknownCustomer", func(t *testing.T) {
+		resp, err := client.Get(server.URL + "/customer?id=unknown")
+		if err == nil {
+			resp.Body.Close()
+		}
+
+		assert.NoError(t, err, "An unexpected error occurred")
+		assert.Equal(t, "/customers", resp.Header.Get("Location"), "should redirect to the directory")
+	})
+}
+
+func TestHandleSaveCustomer(t *testing.T) {
+	testlog.BeginTest()
+	defer testlog.EndTest()
+
+	defer resetConfig()
+
+	config := testServerConfig()
+	defer cleanupTestFiles(config)
+
+	_, logout := loginResponseUser()
+	defer logout()
+
+	defer mockCustomer()()
+
+	server := httptest.NewServer(&sessionHandler{handleSaveCustomer})
+	defer server.Close()
+
+	client := newNonRedirectClient()
+
+	t.Run("update", func(t *testing.T) {
+		resp, err := client.PostForm(server.URL, url.Values{"customer": {"cust123"}, "name": {"Jane Doe"},
+			"organization": {"ACME Corp"}, "mails": {"customer@mail.com, jane@acme.com"}, "phone": {"+49 123"}, "language": {" DE "}})
+		if err == nil {
+			resp.Body.Close()
+		}
+
+		customer := globals.Customers["cust123"]
+
+		assert.NoError(t, err, "An unexpected error occurred")
+		assert.Equal(t, "/customer?id=cust123", resp.Header.Get("Location"), "should redirect to the customer")
+		assert.Equal(t, "ACME Corp", customer.Organization)
+		assert.Equal(t, []string{"customer@mail.com", "jane@acme.com"}, customer.Mails)
+		assert.Equal(t, "+49 123", customer.Phone)
+		assert.Equal(t, "de", customer.Language, "language should be normalized")
+	})
+
+	t.Run("duplicateMail", func(t *testing.T) {
+		resp, err := client.PostForm(server.URL, url.Values{"name": {"John Doe"}, "mails": {"jane@acme.com"}})
+		if err == nil {
+			resp.Body.Close()
+		}
+
+		assert.NoError(t, err, "An unexpected error occurred")
+		assert.Equal(t, "/customers", resp.Header.Get("Location"), "should redirect to the directory")
+		assert.Len(t, globals.Customers, 1, "customer with a foreign mail address should not be added")
+	})
+
+	t.Run("create", func(t *testing.T) {
+		resp, err := client.PostForm(server.URL, url.Values{"name": {"John Doe"}, "mails": {"john@acme.com"}})
+		if err == nil {
+			resp.Body.Close()
+		}
+
+		assert.NoError(t, err, "An unexpected error occurred")
+		assert.Len(t, globals.Customers, 2, "new customer should be added")
+	})
+}
@@ -0,0 +1,107 @@
+// Trivial Tickets Ticketsystem
+// Copyright (C) 2019 The Contributors
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+// Package server implements the web server including
+// shutdown routines and the associated handlers for
+// web requests.
+package server
+
+import (
+	"html/template"
+	"net/http"
+	"net/url"
+
+	"github.com/mortenterhart/trivial-tickets/globals"
+	"github.com/mortenterhart/trivial-tickets/log"
+	"github.com/mortenterhart/trivial-tickets/session"
+	"github.com/mortenterhart/trivial-tickets/ticket"
+	"github.com/mortenterhart/trivial-tickets/util/filehandler"
+	"github.com/mortenterhart/trivial-tickets/util/httptools"
+)
+
+/*
+ * Ticketsystem Trivial Tickets
+ *
+ * Matriculation numbers: 3040018, 6694964, 3478222
+ * Lecture:               Programmieren II, INF16B
+ * Lecturer:              Herr Prof. Dr. Helmut Neemann
+ * Institute:             Duale Hochschule Baden-Württemberg Mosbach
+ *
+ * ---------------
+ *
+ * Package server
+ * Confirmation of possible duplicate tickets
+ */
+
+// handleResolveDuplicate resolves the duplicate flag of the
+// ticket given in the form value "ticket". If the form value
+// "action" is "merge", the ticket is merged into the ticket
+// it duplicates, otherwise the flag is dismissed.
+func handleResolveDuplicate(w http.ResponseWriter, r *http.Request) {
+
+	// Get session id
+	sessionID := session.GetSessionID(r)
+
+	// Only react on POST requests of logged in users
+	if r.Method != postMethod || !globals.Sessions[sessionID].Session.IsLoggedIn {
+		http.Redirect(w, r, indexURL, http.StatusMovedPermanently)
+		return
+	}
+
+	currentSession, _ := session.GetSession(sessionID)
+	user := currentSession.User
+
+	ticketID := template.HTMLEscapeString(r.FormValue("ticket"))
+	duplicateTicket, ticketExists := globals.Tickets[ticketID]
+	if !ticketExists || duplicateTicket.DuplicateOf == "" {
+		log.Errorf("%s %s: ticket '%s' is not flagged as duplicate", r.Method, r.RequestURI, ticketID)
+		http.Redirect(w, r, indexURL, http.StatusMovedPermanently)
+		return
+	}
+
+	ticketURL := "/ticket?" + idParameter + "=" + url.QueryEscape(ticketID)
+	original, originalExists := globals.Tickets[duplicateTicket.DuplicateOf]
+	duplicateTicket.DuplicateOf = ""
+
+	if r.FormValue("action") == "merge" {
+		if !originalExists || original.MergeTo != "" {
+			log.Errorf("%s %s: original of ticket '%s' cannot be merged", r.Method, r.RequestURI, ticketID)
+			http.Redirect(w, r, ticketURL, http.StatusMovedPermanently)
+			return
+		}
+
+		original, duplicateTicket = ticket.MergeTickets(original, duplicateTicket)
+		if duplicateTicket.MergeTo != original.ID {
+			log.Errorf("%s %s: ticket '%s' has another customer than ticket '%s' and cannot be merged",
+				r.Method, r.RequestURI, ticketID, original.ID)
+			httptools.StatusCodeError(w, "ticket '"+ticketID+"' has another customer than ticket '"+
+				original.ID+"' and cannot be merged", http.StatusConflict)
+			return
+		}
+
+		log.Infof("User '%s' merged duplicate ticket '%s' into ticket '%s'", user.Username, ticketID, original.ID)
+
+		globals.Tickets[original.ID] = original
+		filehandler.WriteTicketFile(globals.ServerConfig.Tickets, &original)
+	} else {
+		log.Infof("User '%s' dismissed the duplicate flag of ticket '%s'", user.Username, ticketID)
+	}
+
+	globals.Tickets[ticketID] = duplicateTicket
+	filehandler.WriteTicketFile(globals.ServerConfig.Tickets, &duplicateTicket)
+
+	http.Redirect(w, r, ticketURL, http.StatusMovedPermanently)
+}
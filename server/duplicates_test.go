@@ -0,0 +1,202 @@
+// Trivial Tickets Ticketsystem
+// Copyright (C) 2019 The Contributors
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+// Package server implements the web server including
+// shutdown routines and the associated handlers for
+// web requests.
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mortenterhart/trivial-tickets/globals"
+	"github.com/mortenterhart/trivial-tickets/log/testlog"
+	"github.com/mortenterhart/trivial-tickets/structs"
+)
+
+/*
+ * Ticketsystem Trivial Tickets
+ *
+ * Matriculation numbers: 3040018, 6694964, 3478222
+ * Lecture:               Programmieren II, INF16B
+ * Lecturer:              Herr Prof. Dr. Helmut Neemann
+ * Institute:             Duale Hochschule Baden-Württemberg Mosbach
+ *
+ * ---------------
+ *
+ * Package server
+ * Confirmation of possible duplicate tickets
+ */
+
+// mockDuplicateTicket creates a ticket flagged as
+// duplicate of the mocked entry ticket and returns a
+// function removing it again.
+func mockDuplicateTicket() func() {
+	duplicateTicket := structs.Ticket{
+		ID:          "dup123",
+		Customer:    "customer@mail.com",
+		Status:      structs.StatusOpen,
+		DuplicateOf: "entry123",
+		Entries: []structs.Entry{
+			{User: "customer@mail.com", Text: "My password is still secret", ReplyType: "external"},
+		},
+	}
+
+	globals.Tickets[duplicateTicket.ID] = duplicateTicket
+
+	return func() {
+		delete(globals.Tickets, duplicateTicket.ID)
+	}
+}
+
+func TestHandleResolveDuplicate(t *testing.T) {
+	testlog.BeginTest()
+	defer testlog.EndTest()
+
+	defer resetConfig()
+
+	config := testServerConfig()
+	defer cleanupTestFiles(config)
+
+	user, logout := loginResponseUser()
+	defer logout()
+
+	defer mockEntryTicket(user, true)()
+
+	server := httptest.NewServer(&sessionHandler{handleResolveDuplicate})
+	defer server.Close()
+
+	client := newNonRedirectClient()
+
+	t.Run("dismiss", func(t *testing.T) {
+		defer mockDuplicateTicket()()
+
+		resp, err := client.PostForm(server.URL, url.Values{
+			"ticket": {"dup123"},
+			"action": {"dismiss"},
+		})
+		if err == nil {
+			resp.Body.Close()
+		}
+
+		assert.NoError(t, err, "An unexpected error occurred")
+		assert.Equal(t, "/ticket?id=dup123", resp.Header.Get("Location"), "should redirect to the ticket")
+		assert.Empty(t, globals.Tickets["dup123"].DuplicateOf, "duplicate flag should be dismissed")
+		assert.Empty(t, globals.Tickets["dup123"].MergeTo, "ticket should not be merged")
+	})
+
+	t.Run("merge", func(t *testing.T) {
+		defer mockDuplicateTicket()()
+
+		resp, err := client.PostForm(server.URL, url.Values{
+			"ticket": {"dup123"},
+			"action": {"merge"},
+		})
+		if err == nil {
+			resp.Body.Close()
+		}
+
+		assert.NoError(t, err, "An unexpected error occurred")
+		assert.Equal(t, http.StatusMovedPermanently, resp.StatusCode, "Status code did not match 301")
+		assert.Equal(t, "entry123", globals.Tickets["dup123"].MergeTo, "ticket should be merged into the original")
+		assert.Len(t, globals.Tickets["entry123"].Entries, 3, "entries should be merged")
+	})
+
+	t.Run("linkedCustomer", func(t *testing.T) {
+		mockEntryTicket(user, true)
+		defer mockDuplicateTicket()()
+
+		original := globals.Tickets["entry123"]
+		original.CustomerID = "cust1"
+		globals.Tickets["entry123"] = original
+
+		duplicateTicket := globals.Tickets["dup123"]
+		duplicateTicket.Customer = "other@mail.com"
+		duplicateTicket.CustomerID = "cust1"
+		globals.Tickets["dup123"] = duplicateTicket
+
+		resp, err := client.PostForm(server.URL, url.Values{
+			"ticket": {"dup123"},
+			"action": {"merge"},
+		})
+		if err == nil {
+			resp.Body.Close()
+		}
+
+		assert.NoError(t, err, "An unexpected error occurred")
+		assert.Equal(t, http.StatusMovedPermanently, resp.StatusCode, "Status code did not match 301")
+		assert.Equal(t, "entry123", globals.Tickets["dup123"].MergeTo,
+			"tickets of the same linked customer should be merged")
+	})
+
+	t.Run("otherCustomer", func(t *testing.T) {
+		mockEntryTicket(user, true)
+		defer mockDuplicateTicket()()
+
+		duplicateTicket := globals.Tickets["dup123"]
+		duplicateTicket.Customer = "other@mail.com"
+		globals.Tickets["dup123"] = duplicateTicket
+
+		resp, err := client.PostForm(server.URL, url.Values{
+			"ticket": {"dup123"},
+			"action": {"merge"},
+		})
+		if err == nil {
+			resp.Body.Close()
+		}
+
+		assert.NoError(t, err, "An unexpected error occurred")
+		assert.Equal(t, http.StatusConflict, resp.StatusCode, "Status code did not match 409")
+		assert.Empty(t, globals.Tickets["dup123"].MergeTo, "ticket should not be merged")
+		assert.Equal(t, "entry123", globals.Tickets["dup123"].DuplicateOf, "duplicate flag should remain")
+		assert.Len(t, globals.Tickets["entry123"].Entries, 2, "original should not change")
+	})
+
+	t.Run("notFlagged", func(t *testing.T) {
+		resp, err := client.PostForm(server.URL, url.Values{
+			"ticket": {"entry123"},
+			"action": {"merge"},
+		})
+		if err == nil {
+			resp.Body.Close()
+		}
+
+		assert.NoError(t, err, "An unexpected error occurred")
+		assert.Equal(t, "/", resp.Header.Get("Location"), "should redirect to the index page")
+	})
+
+	t.Run("notLoggedIn", func(t *testing.T) {
+		defer mockDuplicateTicket()()
+
+		logout()
+
+		resp, err := client.PostForm(server.URL, url.Values{
+			"ticket": {"dup123"},
+			"action": {"dismiss"},
+		})
+		if err == nil {
+			resp.Body.Close()
+		}
+
+		assert.NoError(t, err, "An unexpected error occurred")
+		assert.Equal(t, "entry123", globals.Tickets["dup123"].DuplicateOf, "flag should remain without login")
+	})
+}
@@ -0,0 +1,136 @@
+// Trivial Tickets Ticketsystem
+// Copyright (C) 2019 The Contributors
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+// Package server implements the web server including
+// shutdown routines and the associated handlers for
+// web requests.
+package server
+
+import (
+	"html/template"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/mortenterhart/trivial-tickets/globals"
+	"github.com/mortenterhart/trivial-tickets/log"
+	"github.com/mortenterhart/trivial-tickets/session"
+	"github.com/mortenterhart/trivial-tickets/structs"
+	"github.com/mortenterhart/trivial-tickets/ticket"
+	"github.com/mortenterhart/trivial-tickets/util/filehandler"
+)
+
+/*
+ * Ticketsystem Trivial Tickets
+ *
+ * Matriculation numbers: 3040018, 6694964, 3478222
+ * Lecture:               Programmieren II, INF16B
+ * Lecturer:              Herr Prof. Dr. Helmut Neemann
+ * Institute:             Duale Hochschule Baden-Württemberg Mosbach
+ *
+ * ---------------
+ *
+ * Package server
+ * Handlers to edit and redact ticket entries
+ */
+
+// handleEditEntry replaces the text of the entry with the index
+// given in the form value "entry" of the ticket given in the form
+// value "ticket" with the form value "text". Only the author of
+// the entry is allowed to edit it.
+func handleEditEntry(w http.ResponseWriter, r *http.Request) {
+	handleEntryChange(w, r, "edit",
+		func(user structs.User, currentTicket structs.Ticket, entry structs.Entry) bool {
+			return ticket.CanEditEntry(user, entry)
+		},
+		func(currentTicket structs.Ticket, index int, editor structs.User) (structs.Ticket, error) {
+			text := template.HTMLEscapeString(r.FormValue("text"))
+			return ticket.EditEntry(currentTicket, index, text, editor.Username)
+		})
+}
+
+// handleRedactEntry removes the text of the entry with the
+// index given in the form value "entry" of the ticket given in
+// the form value "ticket". The author of the entry and the
+// editor assigned to the ticket are allowed to redact it.
+func handleRedactEntry(w http.ResponseWriter, r *http.Request) {
+	handleEntryChange(w, r, "redact", ticket.CanRedactEntry,
+		func(currentTicket structs.Ticket, index int, editor structs.User) (structs.Ticket, error) {
+			return ticket.RedactEntry(currentTicket, index, editor.Username)
+		})
+}
+
+// handleEntryChange looks up the ticket and the entry of an edit
+// or redact request, checks the permission of the logged in user
+// and applies the change. Afterwards the user is redirected to
+// the ticket.
+func handleEntryChange(w http.ResponseWriter, r *http.Request, action string,
+	permitted func(structs.User, structs.Ticket, structs.Entry) bool,
+	change func(structs.Ticket, int, structs.User) (structs.Ticket, error)) {
+
+	// Get session id
+	sessionID := session.GetSessionID(r)
+
+	// Only react on POST requests of logged in users
+	if r.Method != postMethod || !globals.Sessions[sessionID].Session.IsLoggedIn {
+		http.Redirect(w, r, indexURL, http.StatusMovedPermanently)
+		return
+	}
+
+	currentSession, _ := session.GetSession(sessionID)
+	user := currentSession.User
+
+	ticketID := template.HTMLEscapeString(r.FormValue("ticket"))
+	currentTicket, ticketExists := globals.Tickets[ticketID]
+	if !ticketExists {
+		log.Errorf("%s %s: ticket '%s' not found", r.Method, r.RequestURI, ticketID)
+		http.Redirect(w, r, indexURL, http.StatusMovedPermanently)
+		return
+	}
+
+	ticketURL := "/ticket?" + idParameter + "=" + url.QueryEscape(ticketID)
+
+	index, convertErr := strconv.Atoi(r.FormValue("entry"))
+	if convertErr != nil || index < 0 || index >= len(currentTicket.Entries) {
+		log.Errorf("%s %s: invalid entry '%s' of ticket '%s'", r.Method, r.RequestURI,
+			r.FormValue("entry"), ticketID)
+		http.Redirect(w, r, ticketURL, http.StatusMovedPermanently)
+		return
+	}
+
+	entry := currentTicket.Entries[index]
+	if !permitted(user, currentTicket, entry) {
+		log.Errorf("%s %s: user '%s' is not allowed to %s entry %d of ticket '%s'", r.Method, r.RequestURI,
+			user.Username, action, index, ticketID)
+		http.Redirect(w, r, ticketURL, http.StatusMovedPermanently)
+		return
+	}
+
+	updatedTicket, changeErr := change(currentTicket, index, user)
+	if changeErr != nil {
+		log.Errorf("%s %s: unable to %s entry %d of ticket '%s': %v", r.Method, r.RequestURI,
+			action, index, ticketID, changeErr)
+		http.Redirect(w, r, ticketURL, http.StatusMovedPermanently)
+		return
+	}
+
+	log.Infof("User '%s' performed %s on entry %d of ticket '%s'", user.Username, action, index, ticketID)
+
+	globals.Tickets[ticketID] = updatedTicket
+	filehandler.WriteTicketFile(globals.ServerConfig.Tickets, &updatedTicket)
+
+	http.Redirect(w, r, ticketURL, http.StatusMovedPermanently)
+}
@@ -0,0 +1,217 @@
+// Trivial Tickets Ticketsystem
+// Copyright (C) 2019 The Contributors
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+// Package server implements the web server including
+// shutdown routines and the associated handlers for
+// web requests.
+package server
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mortenterhart/trivial-tickets/globals"
+	"github.com/mortenterhart/trivial-tickets/log/testlog"
+	"github.com/mortenterhart/trivial-tickets/structs"
+	"github.com/mortenterhart/trivial-tickets/structs/defaults"
+)
+
+/*
+ * Ticketsystem Trivial Tickets
+ *
+ * Matriculation numbers: 3040018, 6694964, 3478222
+ * Lecture:               Programmieren II, INF16B
+ * Lecturer:              Herr Prof. Dr. Helmut Neemann
+ * Institute:             Duale Hochschule Baden-Württemberg Mosbach
+ *
+ * ---------------
+ *
+ * Package server
+ * Handlers to edit and redact ticket entries
+ */
+
+// mockEntryTicket stores a ticket with one entry of the
+// customer and one entry of the given user and returns
+// a function removing the ticket again.
+func mockEntryTicket(user structs.User, assigned bool) func() {
+	entryTicket := structs.Ticket{
+		ID:          "entry123",
+		Customer:    "customer@mail.com",
+		AccessToken: "entrytoken",
+		Entries: []structs.Entry{
+			{User: "customer@mail.com", Text: "My password is secret", ReplyType: "external"},
+			{User: user.Mail, Text: "Thank you", ReplyType: "internal"},
+		},
+	}
+
+	if assigned {
+		entryTicket.User = user
+		entryTicket.Status = structs.StatusInProgress
+	}
+
+	globals.Tickets[entryTicket.ID] = entryTicket
+
+	return func() {
+		delete(globals.Tickets, entryTicket.ID)
+	}
+}
+
+func TestHandleEditEntry(t *testing.T) {
+	testlog.BeginTest()
+	defer testlog.EndTest()
+
+	defer resetConfig()
+
+	config := testServerConfig()
+	defer cleanupTestFiles(config)
+
+	user, logout := loginResponseUser()
+	defer logout()
+
+	defer mockEntryTicket(user, false)()
+
+	server := httptest.NewServer(&sessionHandler{handleEditEntry})
+	defer server.Close()
+
+	client := newNonRedirectClient()
+
+	t.Run("foreignEntry", func(t *testing.T) {
+		resp, err := client.PostForm(server.URL, url.Values{"ticket": {"entry123"}, "entry": {"0"}, "text": {"changed"}})
+		if err == nil {
+			resp.Body.Close()
+		}
+
+		assert.NoError(t, err, "An unexpected error occurred")
+		assert.Equal(t, "My password is secret", globals.Tickets["entry123"].Entries[0].Text,
+			"entry of another author should not be edited")
+	})
+
+	t.Run("ownEntry", func(t *testing.T) {
+		resp, err := client.PostForm(server.URL, url.Values{"ticket": {"entry123"}, "entry": {"1"}, "text": {"Thank you!"}})
+		if err == nil {
+			resp.Body.Close()
+		}
+
+		entry := globals.Tickets["entry123"].Entries[1]
+
+		assert.NoError(t, err, "An unexpected error occurred")
+		assert.Equal(t, http.StatusMovedPermanently, resp.StatusCode, "Status code did not match 301")
+		assert.Equal(t, "/ticket?id=entry123", resp.Header.Get("Location"), "should redirect to the ticket")
+		assert.Equal(t, "Thank you!", entry.Text, "entry should be edited")
+		if assert.Len(t, entry.Revisions, 1, "previous text should be kept") {
+			assert.Equal(t, "Thank you", entry.Revisions[0].Text)
+		}
+	})
+
+	t.Run("invalidEntry", func(t *testing.T) {
+		resp, err := client.PostForm(server.URL, url.Values{"ticket": {"entry123"}, "entry": {"x"}, "text": {"text"}})
+		if err == nil {
+			resp.Body.Close()
+		}
+
+		assert.NoError(t, err, "An unexpected error occurred")
+		assert.Equal(t, "/ticket?id=entry123", resp.Header.Get("Location"), "should redirect to the ticket")
+	})
+}
+
+func TestHandleRedactEntry(t *testing.T) {
+	testlog.BeginTest()
+	defer testlog.EndTest()
+
+	defer resetConfig()
+
+	config := testServerConfig()
+	defer cleanupTestFiles(config)
+
+	user, logout := loginResponseUser()
+	defer logout()
+
+	server := httptest.NewServer(&sessionHandler{handleRedactEntry})
+	defer server.Close()
+
+	client := newNonRedirectClient()
+
+	t.Run("notAssigned", func(t *testing.T) {
+		defer mockEntryTicket(user, false)()
+
+		resp, err := client.PostForm(server.URL, url.Values{"ticket": {"entry123"}, "entry": {"0"}})
+		if err == nil {
+			resp.Body.Close()
+		}
+
+		assert.NoError(t, err, "An unexpected error occurred")
+		assert.False(t, globals.Tickets["entry123"].Entries[0].Redacted,
+			"customer entry should only be redacted by the assigned editor")
+	})
+
+	t.Run("assigned", func(t *testing.T) {
+		defer mockEntryTicket(user, true)()
+
+		resp, err := client.PostForm(server.URL, url.Values{"ticket": {"entry123"}, "entry": {"0"}})
+		if err == nil {
+			resp.Body.Close()
+		}
+
+		entry := globals.Tickets["entry123"].Entries[0]
+
+		assert.NoError(t, err, "An unexpected error occurred")
+		assert.True(t, entry.Redacted, "entry should be redacted")
+		assert.Equal(t, structs.RedactedText, entry.Text, "text should be removed")
+	})
+}
+
+func TestHandleTicketWithEditedEntries(t *testing.T) {
+	testlog.BeginTest()
+	defer testlog.EndTest()
+
+	defer resetConfig()
+
+	config := testServerConfig()
+	defer cleanupTestFiles(config)
+
+	tmpl = getTemplates(defaults.TestWebTrimmed)
+
+	user, logout := loginResponseUser()
+	defer logout()
+
+	defer mockEntryTicket(user, true)()
+
+	editedTicket := globals.Tickets["entry123"]
+	editedTicket.Entries[0].Revisions = []structs.Revision{{User: "responseuser", Text: "old text"}}
+	globals.Tickets["entry123"] = editedTicket
+
+	server := httptest.NewServer(&sessionHandler{handleTicket})
+	defer server.Close()
+
+	client := newNonRedirectClient()
+	resp, err := client.Get(server.URL + "/ticket?id=entry123")
+	if !assert.NoError(t, err, "An unexpected error occurred") {
+		return
+	}
+	defer resp.Body.Close()
+
+	body, _ := ioutil.ReadAll(resp.Body)
+
+	assert.Equal(t, http.StatusOK, resp.StatusCode, "The http status is not 200")
+	assert.Contains(t, string(body), "(edited)", "edited entry should be marked")
+	assert.Contains(t, string(body), "old text", "revision history should be shown")
+	assert.Contains(t, string(body), "redact_entry_0", "redaction should be offered")
+}
@@ -20,19 +20,28 @@
 package server
 
 import (
+	"fmt"
 	"html/template"
 	"net/http"
+	"net/url"
+	"strconv"
 	"time"
 
 	"github.com/mortenterhart/trivial-tickets/api/api_out"
+	"github.com/mortenterhart/trivial-tickets/assignment"
+	"github.com/mortenterhart/trivial-tickets/customers"
+	"github.com/mortenterhart/trivial-tickets/duplicates"
 	"github.com/mortenterhart/trivial-tickets/globals"
 	"github.com/mortenterhart/trivial-tickets/log"
 	"github.com/mortenterhart/trivial-tickets/mail_events"
+	"github.com/mortenterhart/trivial-tickets/responses"
+	"github.com/mortenterhart/trivial-tickets/rules"
 	"github.com/mortenterhart/trivial-tickets/session"
 	"github.com/mortenterhart/trivial-tickets/structs"
 	"github.com/mortenterhart/trivial-tickets/ticket"
 	"github.com/mortenterhart/trivial-tickets/util/filehandler"
 	"github.com/mortenterhart/trivial-tickets/util/hashing"
+	"github.com/mortenterhart/trivial-tickets/util/httptools"
 )
 
 /*
@@ -63,6 +72,14 @@ const indexURL string = "/"
 // to get the ticket id required for its action.
 const idParameter string = "id"
 
+// tokenParameter is the parameter holding the access
+// token of a ticket for customers.
+const tokenParameter string = "token"
+
+// dateFormat is the format of dates submitted by
+// date input fields.
+const dateFormat string = "2006-01-02"
+
 // handleIndex handles the traffic for the index.html
 func handleIndex(w http.ResponseWriter, r *http.Request) {
 
@@ -72,12 +89,20 @@ func handleIndex(w http.ResponseWriter, r *http.Request) {
 		log.Error("Unable to create session:", errCheckForSession)
 	}
 
-	executeErr := tmpl.Lookup("index.html").ExecuteTemplate(w, "index",
-		structs.Data{
-			Session: userSession,
-			Tickets: globals.Tickets,
-			Users:   users,
-		})
+	data := structs.Data{
+		Session: userSession,
+	}
+
+	// The tickets are only handed to logged in users
+	// because they contain the internal entries
+	if userSession.IsLoggedIn {
+		data.Tickets = globals.Tickets
+		data.Users = globals.Users
+		data.Responses = responses.Available(userSession.User.Username, globals.Responses)
+		data.Macros = responses.AvailableMacros(userSession.User.Username, globals.Macros)
+	}
+
+	executeErr := tmpl.Lookup("index.html").ExecuteTemplate(w, "index", data)
 	if executeErr != nil {
 		log.Error(executeErr)
 		w.WriteHeader(http.StatusInternalServerError)
@@ -100,7 +125,7 @@ func handleLogin(w http.ResponseWriter, r *http.Request) {
 
 		// Get the user with the given username from the hash map
 		// Check if the given username and password are correct
-		if user, errUser := users[username]; errUser {
+		if user, errUser := globals.Users[username]; errUser {
 			if username == user.Username && hashing.CheckPassword(user.Hash, password) {
 
 				log.Infof("User '%s' (username '%s') logged in successfully", user.Name, username)
@@ -156,21 +181,55 @@ func handleCreateTicket(w http.ResponseWriter, r *http.Request) {
 		text := template.HTMLEscapeString(r.FormValue("text"))
 
 		// Create the ticket
-		newTicket := ticket.CreateTicket(mail, subject, text)
+		newTicket := customers.Link(ticket.CreateTicket(mail, subject, text))
 		log.Infof(`Creating new ticket '%s' for customer '%s' with subject "%s"`,
 			newTicket.ID, newTicket.Customer, newTicket.Subject)
 
+		// Look for an open ticket which the new ticket duplicates
+		newTicket, original, merged := duplicates.Check(newTicket, time.Now())
+
+		// Apply the automation rules and assign the ticket to an
+		// editor if no rule did and automatic assignment is enabled
+		assigned := false
+		if !merged {
+			newTicket = rules.Apply(rules.EventCreated, newTicket)
+
+			assigned = newTicket.User.ID != ""
+			if !assigned {
+				newTicket, assigned = assignment.AutoAssign(newTicket)
+			}
+		}
+
 		// Assign the ticket to the tickets kept in memory
 		globals.Tickets[newTicket.ID] = newTicket
 
-		// Persist the ticket to the file system
+		// Persist the ticket and the sequence of the ticket
+		// numbers to the file system
 		filehandler.WriteTicketFile(globals.ServerConfig.Tickets, &newTicket)
+		if saveErr := ticket.SaveSequence(); saveErr != nil {
+			log.Error("Unable to save the ticket sequence:", saveErr)
+		}
 
-		// Send notification mail on create ticket event
-		api_out.SendMail(mail_events.NewTicket, newTicket)
+		// Send notification mail on create ticket event. A merged
+		// ticket is an answer to the original ticket instead.
+		if merged {
+			globals.Tickets[original.ID] = original
+			filehandler.WriteTicketFile(globals.ServerConfig.Tickets, &original)
+			api_out.SendMail(mail_events.NewAnswer, original)
+			api_out.SendMail(mail_events.CustomerReply, original)
+		} else {
+			api_out.SendMail(mail_events.NewTicket, newTicket)
+		}
+
+		if assigned {
+			log.Infof("Automatically assigned user '%s' (username '%s') to ticket '%s'",
+				newTicket.User.Name, newTicket.User.Username, newTicket.ID)
+			api_out.SendMail(mail_events.AssignedTicket, newTicket)
+			api_out.SendMail(mail_events.AgentAssigned, newTicket)
+		}
 
 		// Redirect the user to the ticket page
-		http.Redirect(w, r, "/ticket?id="+newTicket.ID, http.StatusMovedPermanently)
+		http.Redirect(w, r, customerTicketURL(newTicket), http.StatusMovedPermanently)
 
 		return
 	}
@@ -188,30 +247,102 @@ func handleHoliday(w http.ResponseWriter, r *http.Request) {
 	// Make sure user is logged in
 	if globals.Sessions[sessionID].Session.IsLoggedIn {
 
-		// Create a session to update the current one
+		// Get the current user
 		currentSession, _ := session.GetSession(sessionID)
+		user := globals.Users[currentSession.User.Username]
 
-		// Get the current user
-		user := users[currentSession.User.Username]
+		// Toggle the holiday mode, a manual change overrides
+		// a scheduled holiday. Switching it off ends the active
+		// holidays so that the schedule does not enable it again.
+		if user.IsOnHoliday {
+			user.Holidays = withoutActiveHolidays(user.Holidays, time.Now())
+		}
+		setHolidayMode(user, !user.IsOnHoliday, false)
+	}
 
-		// Toggle IsOnHoliday
-		if currentSession.User.IsOnHoliday {
-			currentSession.User.IsOnHoliday, user.IsOnHoliday = false, false
-		} else {
-			currentSession.User.IsOnHoliday, user.IsOnHoliday = true, true
+	// Redirect the user to the index
+	http.Redirect(w, r, indexURL, http.StatusMovedPermanently)
+}
+
+// handleScheduleHoliday adds a holiday between the dates given
+// in the form values "start" and "end" to the logged in user.
+// Both dates are inclusive and the vacation mode is switched
+// on and off automatically.
+func handleScheduleHoliday(w http.ResponseWriter, r *http.Request) {
+
+	// Get session id
+	sessionID := session.GetSessionID(r)
+
+	// Only react on POST requests of logged in users
+	if r.Method == postMethod && globals.Sessions[sessionID].Session.IsLoggedIn {
+
+		currentSession, _ := session.GetSession(sessionID)
+		user := globals.Users[currentSession.User.Username]
+
+		// Parse the given dates in local time
+		start, startErr := time.ParseInLocation(dateFormat, r.FormValue("start"), time.Local)
+		end, endErr := time.ParseInLocation(dateFormat, r.FormValue("end"), time.Local)
+
+		if startErr != nil || endErr != nil || end.Before(start) {
+			log.Errorf("%s %s: invalid holiday period from '%s' to '%s'", r.Method, r.RequestURI,
+				r.FormValue("start"), r.FormValue("end"))
+			http.Redirect(w, r, indexURL, http.StatusMovedPermanently)
+			return
 		}
 
-		log.Infof("Updating the holiday setting for user '%s' (username '%s') to %t",
-			user.Name, user.Username, user.IsOnHoliday)
+		// The end date is inclusive, so the holiday ends
+		// with the beginning of the next day
+		holiday := structs.Holiday{
+			Start: start,
+			End:   end.AddDate(0, 0, 1),
+		}
 
-		// Update the session with the one just created
-		session.UpdateSession(sessionID, currentSession)
+		log.Infof("Scheduling holiday for user '%s' (username '%s') from %s until %s",
+			user.Name, user.Username, holiday.Start.Format(time.ANSIC), holiday.End.Format(time.ANSIC))
 
-		// Update the users hash map
-		users[currentSession.User.Username] = user
+		user.Holidays = append(user.Holidays, holiday)
+		saveUser(user)
 
-		// Persist the changes to the file system
-		filehandler.WriteUserFile(globals.ServerConfig.Users, &users)
+		// Enable the vacation mode directly if the holiday
+		// has already begun
+		applyHolidaySchedule(user, time.Now())
+	}
+
+	// Redirect the user to the index
+	http.Redirect(w, r, indexURL, http.StatusMovedPermanently)
+}
+
+// handleCancelHoliday removes the scheduled holiday with the
+// index given in the form value "holiday" from the logged in
+// user.
+func handleCancelHoliday(w http.ResponseWriter, r *http.Request) {
+
+	// Get session id
+	sessionID := session.GetSessionID(r)
+
+	// Only react on POST requests of logged in users
+	if r.Method == postMethod && globals.Sessions[sessionID].Session.IsLoggedIn {
+
+		currentSession, _ := session.GetSession(sessionID)
+		user := globals.Users[currentSession.User.Username]
+
+		index, convertErr := strconv.Atoi(r.FormValue("holiday"))
+		if convertErr != nil || index < 0 || index >= len(user.Holidays) {
+			log.Errorf("%s %s: invalid holiday index '%s'", r.Method, r.RequestURI, r.FormValue("holiday"))
+			http.Redirect(w, r, indexURL, http.StatusMovedPermanently)
+			return
+		}
+
+		log.Infof("Cancelling scheduled holiday of user '%s' (username '%s')", user.Name, user.Username)
+
+		holidays := make([]structs.Holiday, 0, len(user.Holidays)-1)
+		holidays = append(holidays, user.Holidays[:index]...)
+		user.Holidays = append(holidays, user.Holidays[index+1:]...)
+		saveUser(user)
+
+		// Disable the vacation mode if it was enabled by
+		// the cancelled holiday
+		applyHolidaySchedule(user, time.Now())
 	}
 
 	// Redirect the user to the index
@@ -236,12 +367,7 @@ func handleTicket(w http.ResponseWriter, r *http.Request) {
 
 		// Get the ticket based on the given id
 		ticketID := idParam[0]
-		ticket := globals.Tickets[ticketID]
-
-		// If it is a merged ticket, redirect to the merged one
-		if ticket.MergeTo != "" {
-			ticket = globals.Tickets[ticket.MergeTo]
-		}
+		currentTicket, ticketExists := globals.Tickets[ticketID]
 
 		// Create or get the users session
 		currentSession, errCheckForSession := session.CheckForSession(w, r)
@@ -250,9 +376,23 @@ func handleTicket(w http.ResponseWriter, r *http.Request) {
 			log.Error("Unable to get session")
 		}
 
+		// Customers need the access token of the ticket. Unknown
+		// tickets and invalid tokens are not distinguished.
+		if !currentSession.IsLoggedIn &&
+			(!ticketExists || !ticket.HasAccess(currentTicket, r.URL.Query().Get(tokenParameter))) {
+			log.Errorf("%s %s: invalid access token for ticket '%s'", r.Method, r.URL.Path, ticketID)
+			http.NotFound(w, r)
+			return
+		}
+
+		// If it is a merged ticket, redirect to the merged one
+		if currentTicket.MergeTo != "" {
+			currentTicket = globals.Tickets[currentTicket.MergeTo]
+		}
+
 		// Serve the template to show a single ticket
 		executeErr := tmpl.Lookup("ticket.html").ExecuteTemplate(w, "ticket",
-			structs.DataSingleTicket{Session: currentSession, Ticket: ticket, Tickets: globals.Tickets, Users: users})
+			newSingleTicketData(currentSession, currentTicket))
 		if executeErr != nil {
 			log.Error(executeErr)
 			w.WriteHeader(http.StatusInternalServerError)
@@ -287,18 +427,45 @@ func handleUpdateTicket(w http.ResponseWriter, r *http.Request) {
 		replyType := template.HTMLEscapeString(r.FormValue("reply_type"))
 		merge := template.HTMLEscapeString(r.FormValue("merge"))
 
+		// Customers may only write external replies
+		if !currentSession.IsLoggedIn {
+			replyType = structs.ReplyExternal
+		}
+		replyType = structs.NormalizeReplyType(replyType)
+
 		// Get the ticket which was edited
-		currentTicket := globals.Tickets[ticketID]
+		currentTicket, ticketExists := globals.Tickets[ticketID]
+
+		// Customers need the access token of the ticket
+		if !currentSession.IsLoggedIn &&
+			(!ticketExists || !ticket.HasAccess(currentTicket, r.FormValue(tokenParameter))) {
+			log.Errorf("%s %s: invalid access token for ticket '%s'", r.Method, r.URL.Path, ticketID)
+			http.NotFound(w, r)
+			return
+		}
 
 		// Update the current ticket
 		updatedTicket := ticket.UpdateTicket(status, mail, reply, replyType, currentTicket)
 
+		// The reminder is done as soon as the editor works on the ticket
+		if currentSession.IsLoggedIn && updatedTicket.User.ID == currentSession.User.ID {
+			updatedTicket.Reminder = false
+		}
+
+		// Answers of customers are replies, everything else updates
+		ruleEvent := rules.EventUpdated
+		if !currentSession.IsLoggedIn {
+			ruleEvent = rules.EventReply
+		}
+		updatedTicket = rules.Apply(ruleEvent, updatedTicket)
+
 		if merge != "" {
 			// Get the ticket to merge from the tickets map
 			ticketFrom := globals.Tickets[merge]
 
 			// Only if they have the same assigned user
-			if ticketFrom.User == currentSession.User && updatedTicket.User == currentSession.User {
+			if currentSession.IsLoggedIn && ticketFrom.User.ID == currentSession.User.ID &&
+				updatedTicket.User.ID == currentSession.User.ID {
 
 				// Merge structs.Ticket
 				ticketMergedTo, ticketMergedFrom := ticket.MergeTickets(updatedTicket, ticketFrom)
@@ -328,23 +495,31 @@ func handleUpdateTicket(w http.ResponseWriter, r *http.Request) {
 			filehandler.WriteTicketFile(globals.ServerConfig.Tickets, &updatedTicket)
 		}
 
-		if !currentSession.IsLoggedIn {
-			replyType = "external"
-		}
-
-		// Send mail if the reply was selected for external
-		if replyType == "external" {
+		// Send mail if the reply was selected for external or the
+		// ticket was closed, so that the customer gets the survey
+		closed := updatedTicket.Status == structs.StatusClosed && currentTicket.Status != structs.StatusClosed
+		if replyType == structs.ReplyExternal || closed {
 			mailEvent := mail_events.UpdatedTicket
-			if reply != "" {
+			if reply != "" && replyType == structs.ReplyExternal {
 				mailEvent = mail_events.NewAnswer
 			}
 
 			api_out.SendMail(mailEvent, updatedTicket)
 		}
 
+		// Inform the editor about answers of the customer and
+		// the users mentioned in replies of editors
+		if reply != "" {
+			if currentSession.IsLoggedIn {
+				notifyMentions(updatedTicket, currentSession.User, reply)
+			} else {
+				api_out.SendMail(mail_events.CustomerReply, updatedTicket)
+			}
+		}
+
 		// Redirect to the ticket again, now with updated Values
 		executeErr := tmpl.Lookup("ticket.html").ExecuteTemplate(w, "ticket",
-			structs.DataSingleTicket{Session: currentSession, Ticket: updatedTicket, Tickets: globals.Tickets})
+			newSingleTicketData(currentSession, updatedTicket))
 		if executeErr != nil {
 			log.Error(executeErr)
 			w.WriteHeader(http.StatusInternalServerError)
@@ -356,50 +531,129 @@ func handleUpdateTicket(w http.ResponseWriter, r *http.Request) {
 	http.Redirect(w, r, indexURL, http.StatusMovedPermanently)
 }
 
-// handleAssignTicket assigns a given user to a given ticket and
-// returns the user name of the newly assigned user to the browser.
-func handleAssignTicket(w http.ResponseWriter, r *http.Request) {
-
-	if r.Method == getMethod {
+// customerTicketURL returns the link to the page of the
+// ticket including the access token for the customer.
+// Tickets without access token are linked by their id.
+func customerTicketURL(currentTicket structs.Ticket) string {
+	query := url.Values{idParameter: {currentTicket.ID}}
+	if currentTicket.AccessToken != "" {
+		query.Set(tokenParameter, currentTicket.AccessToken)
+	}
 
-		// Get the session
-		currentSession, errCheckForSession := session.CheckForSession(w, r)
+	return "/ticket?" + query.Encode()
+}
 
-		if errCheckForSession != nil {
-			log.Error("Unable to get session: ", errCheckForSession)
-			return
+// newSingleTicketData collects the data for the template of
+// a single ticket. The canned responses and macros as well as
+// the other tickets and users are only provided to logged in
+// users. Customers never receive the internal entries and the
+// logged time of the ticket.
+func newSingleTicketData(currentSession structs.Session, currentTicket structs.Ticket) structs.DataSingleTicket {
+	if !currentSession.IsLoggedIn {
+		return structs.DataSingleTicket{
+			Session: currentSession,
+			Ticket:  ticket.CustomerView(currentTicket),
 		}
+	}
 
-		if currentSession.IsLoggedIn {
+	data := structs.DataSingleTicket{
+		Session: currentSession,
+		Ticket:  currentTicket,
+		Tickets: globals.Tickets,
+		Users:   globals.Users,
+	}
 
-			// Extract the GET request parameters
-			params := r.URL.Query()
+	data.Responses = responses.Available(currentSession.User.Username, globals.Responses)
+	data.RenderedResponses = responses.RenderAll(data.Responses, currentTicket)
+	data.Macros = responses.AvailableMacros(currentSession.User.Username, globals.Macros)
 
-			ticketID := params["id"][0]
-			user := params["user"][0]
+	return data
+}
 
-			// Get the ticket based on the given id
-			currentTicket := globals.Tickets[ticketID]
+// handleAssignTicket assigns the ticket given in the form value
+// "id" to the user given in the form value "user" and returns the
+// username of the newly assigned user to the browser. Agents may
+// only take open tickets themselves, supervisors may assign the
+// tickets to every editor. The assigned editor is notified by mail
+// unless they took the ticket themselves.
+func handleAssignTicket(w http.ResponseWriter, r *http.Request) {
 
-			// Update the ticket itself
-			updatedTicket := ticket.AssignTicket(users[user], currentTicket)
+	// Only support POST requests
+	if r.Method != postMethod {
+		httptools.StatusCodeError(w, fmt.Sprintf("method %s not allowed, expecting POST", r.Method),
+			http.StatusMethodNotAllowed)
+		return
+	}
 
-			log.Infof("Assigning user '%s' (username '%s') to ticket '%s'",
-				updatedTicket.User.Name, updatedTicket.User.Username, updatedTicket.ID)
+	// Get the session
+	sessionID := session.GetSessionID(r)
+	currentSession := globals.Sessions[sessionID].Session
 
-			// Update the ticket in memory
-			globals.Tickets[ticketID] = updatedTicket
+	if !currentSession.IsLoggedIn {
+		httptools.StatusCodeError(w, "login required to assign tickets", http.StatusUnauthorized)
+		return
+	}
 
-			// Persist the change in the file system
-			filehandler.WriteTicketFile(globals.ServerConfig.Tickets, &updatedTicket)
+	// Get the form values
+	ticketID := r.FormValue(idParameter)
+	username := r.FormValue("user")
 
-			// Return the assigned user
-			response := updatedTicket.User.Username
-			w.Header().Set("Content-Type", "text/html")
-			w.Write([]byte(response))
+	if ticketID == "" || username == "" {
+		httptools.StatusCodeError(w, fmt.Sprintf("missing parameter '%s' or 'user'", idParameter),
+			http.StatusBadRequest)
+		return
+	}
+
+	currentTicket, ticketExists := globals.Tickets[ticketID]
+	if !ticketExists {
+		httptools.StatusCodeError(w, fmt.Sprintf("ticket '%s' does not exist", ticketID),
+			http.StatusNotFound)
+		return
+	}
+
+	editor, userExists := globals.Users[username]
+	if !userExists {
+		httptools.StatusCodeError(w, fmt.Sprintf("user '%s' does not exist", username),
+			http.StatusNotFound)
+		return
+	}
 
-			api_out.SendMail(mail_events.AssignedTicket, updatedTicket)
+	// Check the permissions with the current role of the user
+	actor, actorExists := globals.Users[currentSession.User.Username]
+	if !actorExists {
+		actor = currentSession.User
+	}
+
+	if checkErr := assignment.CheckAssignment(actor, editor, currentTicket); checkErr != nil {
+		statusCode := http.StatusConflict
+		if _, denied := checkErr.(assignment.PermissionError); denied {
+			statusCode = http.StatusForbidden
 		}
+
+		httptools.StatusCodeError(w, checkErr.Error(), statusCode)
+		return
+	}
+
+	// Update the ticket itself
+	updatedTicket := ticket.AssignTicket(editor, currentTicket)
+
+	log.Infof("User '%s' assigned user '%s' (username '%s') to ticket '%s'", actor.Username,
+		updatedTicket.User.Name, updatedTicket.User.Username, updatedTicket.ID)
+
+	// Update the ticket in memory
+	globals.Tickets[ticketID] = updatedTicket
+
+	// Persist the change in the file system
+	filehandler.WriteTicketFile(globals.ServerConfig.Tickets, &updatedTicket)
+
+	// Return the assigned user
+	response := updatedTicket.User.Username
+	w.Header().Set("Content-Type", "text/html")
+	w.Write([]byte(response))
+
+	api_out.SendMail(mail_events.AssignedTicket, updatedTicket)
+	if editor.ID != actor.ID {
+		api_out.SendMail(mail_events.AgentAssigned, updatedTicket)
 	}
 }
 
@@ -22,8 +22,10 @@ package server
 import (
 	"fmt"
 	"html/template"
+	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
 	"os"
 	"path/filepath"
 	"strings"
@@ -34,6 +36,7 @@ import (
 
 	"github.com/mortenterhart/trivial-tickets/globals"
 	"github.com/mortenterhart/trivial-tickets/log/testlog"
+	"github.com/mortenterhart/trivial-tickets/mail_events"
 	"github.com/mortenterhart/trivial-tickets/session"
 	"github.com/mortenterhart/trivial-tickets/structs"
 	"github.com/mortenterhart/trivial-tickets/structs/defaults"
@@ -88,10 +91,15 @@ func testServerConfig() structs.ServerConfig {
 		Cert:    defaults.TestCertificateTrimmed,
 		Key:     defaults.TestKeyTrimmed,
 		Web:     defaults.TestWebTrimmed,
+
+		Responses: defaults.TestResponsesTrimmed,
+
+		MailTemplates: defaults.TestMailTmplTrimmed,
+		MailLanguage:  defaults.ServerMailLang,
 	}
 }
 
-// cleanupTestFiles removes all test tickets, mails and users
+// cleanupTestFiles removes all test tickets, mails, responses and users
 // from the paths in the given config, if they exist. It reports
 // an error if a directory could not be removed.
 func cleanupTestFiles(config structs.ServerConfig) {
@@ -109,6 +117,13 @@ func cleanupTestFiles(config structs.ServerConfig) {
 		}
 	}
 
+	if filehandler.DirectoryExists(filepath.Dir(config.Responses)) {
+		testlog.Debug("Deferred: Removing test responses directory")
+		if removeErr := os.RemoveAll(filepath.Dir(config.Responses)); removeErr != nil {
+			testlog.Debug("ERROR: cannot remove test responses directory:", removeErr)
+		}
+	}
+
 	if filehandler.DirectoryExists(config.Mails) {
 		testlog.Debug("Deferred: Removing test mail directory")
 		if removeErr := os.RemoveAll(config.Mails); removeErr != nil {
@@ -131,6 +146,10 @@ func initializeConfig() {
 
 	logConfig := mockLogConfig()
 	globals.LogConfig = &logConfig
+
+	if loadErr := mail_events.LoadTemplates(serverConfig.MailTemplates, serverConfig.MailLanguage); loadErr != nil {
+		testlog.Debug("ERROR: cannot load mail templates:", loadErr)
+	}
 }
 
 //revive:disable:deep-exit
@@ -179,7 +198,7 @@ func TestHandleIndex(t *testing.T) {
 	handler := &indexHandler{}
 
 	globals.Tickets["abc123"] = structs.Ticket{}
-	users["abc123"] = structs.User{}
+	globals.Users["abc123"] = structs.User{}
 
 	server := httptest.NewServer(handler)
 	defer server.Close()
@@ -247,7 +266,7 @@ func TestHandleLogin(t *testing.T) {
 	server := httptest.NewServer(handler)
 	defer server.Close()
 
-	users["testuser"] = structs.User{
+	globals.Users["testuser"] = structs.User{
 		ID:          "1",
 		Name:        "Test",
 		Username:    "testuser",
@@ -394,7 +413,7 @@ func TestHandleHoliday(t *testing.T) {
 		IsOnHoliday: false,
 	}
 
-	users["testuser"] = testUser
+	globals.Users["testuser"] = testUser
 
 	globals.Sessions["def123"] = structs.SessionManager{
 		Name: "def123",
@@ -432,6 +451,201 @@ func TestHandleHoliday(t *testing.T) {
 	assert.Equal(t, http.StatusMovedPermanently, resp.StatusCode, "Status code did not match 301")
 }
 
+// schedule holiday
+// --------------------------
+
+// scheduleHolidayHandler is the handler wrapper that
+// calls the schedule holiday handler.
+type scheduleHolidayHandler struct{}
+
+// ServeHTTP handles the test web requests
+// and adds a session cookie to each request.
+func (h *scheduleHolidayHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+
+	cookie := http.Cookie{
+		Name:  session.CookieName,
+		Value: "def123",
+	}
+	r.AddCookie(&cookie)
+	handleScheduleHoliday(w, r)
+}
+
+func TestHandleScheduleHoliday(t *testing.T) {
+	testlog.BeginTest()
+	defer testlog.EndTest()
+
+	defer resetConfig()
+
+	config := testServerConfig()
+	defer cleanupTestFiles(config)
+
+	handler := &scheduleHolidayHandler{}
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	testUser := structs.User{
+		ID:       "1",
+		Name:     "Test",
+		Username: "testuser",
+		Mail:     "Testuser@mail.com",
+		Hash:     "$2a$12$rW6Ska0DaVjTX/8sQGCp/.y7kl2RvF.9936Hmm27HyI0cJ78q1UOG",
+	}
+
+	globals.Users["testuser"] = testUser
+	defer delete(globals.Users, "testuser")
+
+	globals.Sessions["def123"] = structs.SessionManager{
+		Name: "def123",
+		Session: structs.Session{
+			User:         testUser,
+			CreationTime: time.Now(),
+			IsLoggedIn:   true,
+			ID:           "def123",
+		},
+		TTL: session.CookieTTL,
+	}
+
+	userDirectory := filepath.Dir(config.Users)
+	filehandler.CreateFolders(userDirectory)
+
+	client := newNonRedirectClient()
+
+	t.Run("futureHoliday", func(t *testing.T) {
+		start := time.Now().AddDate(0, 0, 7)
+		resp, err := client.PostForm(server.URL, url.Values{
+			"start": {start.Format(dateFormat)},
+			"end":   {start.AddDate(0, 0, 3).Format(dateFormat)},
+		})
+		if err == nil {
+			resp.Body.Close()
+		}
+
+		assert.NoError(t, err, "An unexpected error occurred")
+		assert.Equal(t, http.StatusMovedPermanently, resp.StatusCode, "Status code did not match 301")
+		assert.Len(t, globals.Users["testuser"].Holidays, 1, "holiday should be scheduled")
+		assert.False(t, globals.Users["testuser"].IsOnHoliday, "vacation mode should not be enabled yet")
+		assert.Len(t, globals.Sessions["def123"].Session.User.Holidays, 1, "session user should be updated")
+	})
+
+	t.Run("currentHoliday", func(t *testing.T) {
+		today := time.Now()
+		resp, err := client.PostForm(server.URL, url.Values{
+			"start": {today.Format(dateFormat)},
+			"end":   {today.Format(dateFormat)},
+		})
+		if err == nil {
+			resp.Body.Close()
+		}
+
+		assert.NoError(t, err, "An unexpected error occurred")
+		assert.Len(t, globals.Users["testuser"].Holidays, 2, "holiday should be scheduled")
+		assert.True(t, globals.Users["testuser"].IsOnHoliday, "vacation mode should be enabled")
+		assert.True(t, globals.Users["testuser"].ScheduledHoliday, "vacation mode should be marked as scheduled")
+	})
+
+	t.Run("invalidPeriod", func(t *testing.T) {
+		resp, err := client.PostForm(server.URL, url.Values{
+			"start": {"2019-01-10"},
+			"end":   {"2019-01-07"},
+		})
+		if err == nil {
+			resp.Body.Close()
+		}
+
+		assert.NoError(t, err, "An unexpected error occurred")
+		assert.Equal(t, http.StatusMovedPermanently, resp.StatusCode, "Status code did not match 301")
+		assert.Len(t, globals.Users["testuser"].Holidays, 2, "invalid holiday should not be scheduled")
+	})
+}
+
+// cancel holiday
+// --------------------------
+
+// cancelHolidayHandler is the handler wrapper that
+// calls the cancel holiday handler.
+type cancelHolidayHandler struct{}
+
+// ServeHTTP handles the test web requests
+// and adds a session cookie to each request.
+func (h *cancelHolidayHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+
+	cookie := http.Cookie{
+		Name:  session.CookieName,
+		Value: "def123",
+	}
+	r.AddCookie(&cookie)
+	handleCancelHoliday(w, r)
+}
+
+func TestHandleCancelHoliday(t *testing.T) {
+	testlog.BeginTest()
+	defer testlog.EndTest()
+
+	defer resetConfig()
+
+	config := testServerConfig()
+	defer cleanupTestFiles(config)
+
+	handler := &cancelHolidayHandler{}
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	today := time.Now()
+	testUser := structs.User{
+		ID:          "1",
+		Name:        "Test",
+		Username:    "testuser",
+		Mail:        "Testuser@mail.com",
+		Hash:        "$2a$12$rW6Ska0DaVjTX/8sQGCp/.y7kl2RvF.9936Hmm27HyI0cJ78q1UOG",
+		IsOnHoliday: true,
+		Holidays: []structs.Holiday{
+			{Start: today.AddDate(0, 0, -1), End: today.AddDate(0, 0, 1)},
+		},
+		ScheduledHoliday: true,
+	}
+
+	globals.Users["testuser"] = testUser
+	defer delete(globals.Users, "testuser")
+
+	globals.Sessions["def123"] = structs.SessionManager{
+		Name: "def123",
+		Session: structs.Session{
+			User:         testUser,
+			CreationTime: time.Now(),
+			IsLoggedIn:   true,
+			ID:           "def123",
+		},
+		TTL: session.CookieTTL,
+	}
+
+	userDirectory := filepath.Dir(config.Users)
+	filehandler.CreateFolders(userDirectory)
+
+	client := newNonRedirectClient()
+
+	t.Run("invalidIndex", func(t *testing.T) {
+		resp, err := client.PostForm(server.URL, url.Values{"holiday": {"5"}})
+		if err == nil {
+			resp.Body.Close()
+		}
+
+		assert.NoError(t, err, "An unexpected error occurred")
+		assert.Equal(t, http.StatusMovedPermanently, resp.StatusCode, "Status code did not match 301")
+		assert.Len(t, globals.Users["testuser"].Holidays, 1, "holiday should not be cancelled")
+	})
+
+	t.Run("validIndex", func(t *testing.T) {
+		resp, err := client.PostForm(server.URL, url.Values{"holiday": {"0"}})
+		if err == nil {
+			resp.Body.Close()
+		}
+
+		assert.NoError(t, err, "An unexpected error occurred")
+		assert.Empty(t, globals.Users["testuser"].Holidays, "holiday should be cancelled")
+		assert.False(t, globals.Users["testuser"].IsOnHoliday, "scheduled vacation mode should be disabled")
+	})
+}
+
 // ticket
 // --------------------------
 
@@ -460,13 +674,14 @@ func TestHandleTicket(t *testing.T) {
 	defer server.Close()
 
 	ticket := structs.Ticket{
-		ID: "abc123",
+		ID:          "abc123",
+		AccessToken: "token123",
 	}
 
 	globals.Tickets["abc123"] = ticket
 
 	client := newNonRedirectClient()
-	resp, err := client.Get(server.URL + "/ticket?id=abc123")
+	resp, err := client.Get(server.URL + "/ticket?id=abc123&token=token123")
 	defer func() {
 		if err == nil {
 			resp.Body.Close()
@@ -477,6 +692,70 @@ func TestHandleTicket(t *testing.T) {
 	assert.Equal(t, http.StatusOK, resp.StatusCode, "The http response is wrong")
 }
 
+func TestHandleTicketAccessToken(t *testing.T) {
+	testlog.BeginTest()
+	defer testlog.EndTest()
+
+	defer resetConfig()
+
+	config := testServerConfig()
+	defer cleanupTestFiles(config)
+
+	tmpl = getTemplates(defaults.TestWebTrimmed)
+
+	globals.Tickets["abc123"] = structs.Ticket{
+		ID:          "abc123",
+		AccessToken: "token123",
+	}
+	globals.Tickets["old123"] = structs.Ticket{
+		ID: "old123",
+	}
+	defer delete(globals.Tickets, "old123")
+
+	client := newNonRedirectClient()
+
+	getStatus := func(t *testing.T, handler http.Handler, query string) int {
+		server := httptest.NewServer(handler)
+		defer server.Close()
+
+		resp, err := client.Get(server.URL + "/ticket?" + query)
+		if !assert.NoError(t, err, "An unexpected error occurred") {
+			return 0
+		}
+		resp.Body.Close()
+
+		return resp.StatusCode
+	}
+
+	t.Run("missingToken", func(t *testing.T) {
+		assert.Equal(t, http.StatusNotFound, getStatus(t, &ticketHandler{}, "id=abc123"),
+			"ticket should not be shown without the token")
+	})
+
+	t.Run("invalidToken", func(t *testing.T) {
+		assert.Equal(t, http.StatusNotFound, getStatus(t, &ticketHandler{}, "id=abc123&token=wrong"),
+			"ticket should not be shown with an invalid token")
+	})
+
+	t.Run("oldLink", func(t *testing.T) {
+		assert.Equal(t, http.StatusOK, getStatus(t, &ticketHandler{}, "id=old123"),
+			"tickets created before the access tokens should open from old links")
+	})
+
+	t.Run("unknownTicket", func(t *testing.T) {
+		assert.Equal(t, http.StatusNotFound, getStatus(t, &ticketHandler{}, "id=unknown&token=token123"),
+			"unknown ticket should not be found")
+	})
+
+	t.Run("editor", func(t *testing.T) {
+		_, logout := loginResponseUser()
+		defer logout()
+
+		assert.Equal(t, http.StatusOK, getStatus(t, &sessionHandler{handleTicket}, "id=abc123"),
+			"editors should not need the token")
+	})
+}
+
 func TestHandleTicketWithMergeTo(t *testing.T) {
 	testlog.BeginTest()
 	defer testlog.EndTest()
@@ -493,8 +772,9 @@ func TestHandleTicketWithMergeTo(t *testing.T) {
 	defer server.Close()
 
 	ticket := structs.Ticket{
-		ID:      "abc123",
-		MergeTo: "def123",
+		ID:          "abc123",
+		MergeTo:     "def123",
+		AccessToken: "token123",
 	}
 
 	ticket2 := structs.Ticket{
@@ -505,7 +785,7 @@ func TestHandleTicketWithMergeTo(t *testing.T) {
 	globals.Tickets["abc123"] = ticket
 
 	client := newNonRedirectClient()
-	resp, err := client.Get(server.URL + "/ticket?id=abc123")
+	resp, err := client.Get(server.URL + "/ticket?id=abc123&token=token123")
 	defer func() {
 		if err == nil {
 			resp.Body.Close()
@@ -600,8 +880,13 @@ func TestHandleTicketExecuteTemplateError(t *testing.T) {
 	// a template execution error.
 	tmpl, _ = template.New("ticket.html").Parse("{{range $replies := .Ticket.Entries}} <p> {{$replies.Text}} </p> {{end}}")
 
+	globals.Tickets["abc123"] = structs.Ticket{
+		ID:          "abc123",
+		AccessToken: "token123",
+	}
+
 	client := newNonRedirectClient()
-	resp, err := client.Get(server.URL + "/ticket?id=abc123")
+	resp, err := client.Get(server.URL + "/ticket?id=abc123&token=token123")
 	defer func() {
 		if err == nil {
 			resp.Body.Close()
@@ -624,6 +909,79 @@ func (h *updateTicketHandler) ServeHTTP(w http.ResponseWriter, r *http.Request)
 	handleUpdateTicket(w, r)
 }
 
+// mockCustomerTicket adds the ticket "1" with the access
+// token "token1" and returns a function removing it again.
+func mockCustomerTicket() func() {
+	globals.Tickets["1"] = structs.Ticket{
+		ID:          "1",
+		Customer:    "bla@example.com",
+		AccessToken: "token1",
+	}
+
+	return func() {
+		delete(globals.Tickets, "1")
+	}
+}
+
+func TestHandleTicketInternalEntries(t *testing.T) {
+	testlog.BeginTest()
+	defer testlog.EndTest()
+
+	defer resetConfig()
+
+	config := testServerConfig()
+	defer cleanupTestFiles(config)
+
+	tmpl = getTemplates(defaults.TestWebTrimmed)
+
+	globals.Tickets["internal123"] = structs.Ticket{
+		ID:          "internal123",
+		Customer:    "customer@mail.com",
+		AccessToken: "token123",
+		Entries: []structs.Entry{
+			{User: "customer@mail.com", Text: "Public question", ReplyType: structs.ReplyExternal},
+			{User: "response@mail.com", Text: "Confidential note", ReplyType: structs.ReplyInternal},
+		},
+	}
+	defer delete(globals.Tickets, "internal123")
+
+	client := newNonRedirectClient()
+
+	getTicket := func(t *testing.T, handler http.Handler) string {
+		server := httptest.NewServer(handler)
+		defer server.Close()
+
+		resp, err := client.Get(server.URL + "/ticket?id=internal123&token=token123")
+		if !assert.NoError(t, err, "An unexpected error occurred") {
+			return ""
+		}
+		defer resp.Body.Close()
+
+		assert.Equal(t, http.StatusOK, resp.StatusCode, "The http status is not 200")
+
+		body, _ := ioutil.ReadAll(resp.Body)
+		return string(body)
+	}
+
+	t.Run("customer", func(t *testing.T) {
+		body := getTicket(t, &ticketHandler{})
+
+		assert.Contains(t, body, "Public question", "external entries should be shown to customers")
+		assert.NotContains(t, body, "Confidential note", "internal entries must not be sent to customers")
+	})
+
+	t.Run("editor", func(t *testing.T) {
+		_, logout := loginResponseUser()
+		defer logout()
+
+		body := getTicket(t, &sessionHandler{handleTicket})
+
+		assert.Contains(t, body, "Public question", "external entries should be shown to editors")
+		assert.Contains(t, body, "Confidential note", "internal entries should be shown to editors")
+		assert.Contains(t, body, "(internal comment)", "internal entries should be marked")
+	})
+}
+
 func TestHandleUpdateTicketWrongMethod(t *testing.T) {
 	testlog.BeginTest()
 	defer testlog.EndTest()
@@ -664,7 +1022,9 @@ func TestHandleUpdateTicketMerge(t *testing.T) {
 	server := httptest.NewServer(handler)
 	defer server.Close()
 
-	reader := strings.NewReader("ticketId=1&status=0&mail=bla@example.com&reply=hallo&reply_type=intern&merge=2")
+	defer mockCustomerTicket()()
+
+	reader := strings.NewReader("ticket=1&token=token1&status=0&mail=bla@example.com&reply=hallo&reply_type=intern&merge=2")
 
 	client := newNonRedirectClient()
 	resp, err := client.Post(server.URL, "application/x-www-form-urlencoded", reader)
@@ -693,7 +1053,9 @@ func TestHandleUpdateTicketExtern(t *testing.T) {
 	server := httptest.NewServer(handler)
 	defer server.Close()
 
-	reader := strings.NewReader("ticketId=1&status=0&mail=bla@example.com&reply=hallo&reply_type=extern")
+	defer mockCustomerTicket()()
+
+	reader := strings.NewReader("ticket=1&token=token1&status=0&mail=bla@example.com&reply=hallo&reply_type=extern")
 
 	client := newNonRedirectClient()
 	resp, err := client.Post(server.URL, "application/x-www-form-urlencoded", reader)
@@ -707,6 +1069,82 @@ func TestHandleUpdateTicketExtern(t *testing.T) {
 	assert.Equal(t, http.StatusOK, resp.StatusCode, "Wrong http status code")
 }
 
+func TestHandleUpdateTicketCustomerInternal(t *testing.T) {
+	testlog.BeginTest()
+	defer testlog.EndTest()
+
+	defer resetConfig()
+
+	config := testServerConfig()
+	defer cleanupTestFiles(config)
+
+	tmpl = getTemplates(defaults.TestWebTrimmed)
+
+	globals.Tickets["customer123"] = structs.Ticket{
+		ID:          "customer123",
+		Customer:    "customer@mail.com",
+		AccessToken: "token123",
+	}
+	defer delete(globals.Tickets, "customer123")
+
+	server := httptest.NewServer(&updateTicketHandler{})
+	defer server.Close()
+
+	client := newNonRedirectClient()
+	resp, err := client.PostForm(server.URL, url.Values{
+		"ticket":     {"customer123"},
+		"token":      {"token123"},
+		"mail":       {"customer@mail.com"},
+		"reply":      {"Hidden from the editor?"},
+		"reply_type": {structs.ReplyInternal},
+	})
+	if err == nil {
+		resp.Body.Close()
+	}
+
+	assert.NoError(t, err, "An unexpected error occurred")
+	assert.Equal(t, http.StatusOK, resp.StatusCode, "Wrong http status code")
+
+	entries := globals.Tickets["customer123"].Entries
+	if assert.Len(t, entries, 1, "the reply should be stored") {
+		assert.Equal(t, structs.ReplyExternal, entries[0].ReplyType, "customer replies have to be external")
+	}
+}
+
+func TestHandleUpdateTicketInvalidToken(t *testing.T) {
+	testlog.BeginTest()
+	defer testlog.EndTest()
+
+	defer resetConfig()
+
+	config := testServerConfig()
+	defer cleanupTestFiles(config)
+
+	tmpl = getTemplates(defaults.TestWebTrimmed)
+
+	defer mockCustomerTicket()()
+
+	server := httptest.NewServer(&updateTicketHandler{})
+	defer server.Close()
+
+	client := newNonRedirectClient()
+	resp, err := client.PostForm(server.URL, url.Values{
+		"ticket": {"1"},
+		"token":  {"wrong"},
+		"status": {"2"},
+		"mail":   {"attacker@example.com"},
+		"reply":  {"Guessed the ticket id"},
+	})
+	if err == nil {
+		resp.Body.Close()
+	}
+
+	assert.NoError(t, err, "An unexpected error occurred")
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode, "ticket should not be found without the token")
+	assert.Empty(t, globals.Tickets["1"].Entries, "the reply should not be stored")
+	assert.Equal(t, structs.StatusOpen, globals.Tickets["1"].Status, "the status should not be changed")
+}
+
 func TestHandleUpdateTicketExecuteTemplateError(t *testing.T) {
 	testlog.BeginTest()
 	defer testlog.EndTest()
@@ -725,7 +1163,9 @@ func TestHandleUpdateTicketExecuteTemplateError(t *testing.T) {
 	// a template execution error.
 	tmpl, _ = template.New("ticket.html").Parse("{{range $replies := .Ticket.Entries}} <p> {{$replies.Text}} </p> {{end}}")
 
-	reader := strings.NewReader("ticketId=1&status=0&mail=bla@example.com&reply=hallo&reply_type=extern")
+	defer mockCustomerTicket()()
+
+	reader := strings.NewReader("ticket=1&token=token1&status=0&mail=bla@example.com&reply=hallo&reply_type=extern")
 
 	client := newNonRedirectClient()
 	resp, err := client.Post(server.URL, "application/x-www-form-urlencoded", reader)
@@ -842,7 +1282,7 @@ func TestHandleAssignTicket(t *testing.T) {
 	config := testServerConfig()
 	defer cleanupTestFiles(config)
 
-	users["testuser"] = structs.User{
+	globals.Users["testuser"] = structs.User{
 		ID:          "1",
 		Name:        "Test",
 		Username:    "testuser",
@@ -854,7 +1294,7 @@ func TestHandleAssignTicket(t *testing.T) {
 	globals.Sessions["def123"] = structs.SessionManager{
 		Name: "def123",
 		Session: structs.Session{
-			User:         users["testuser"],
+			User:         globals.Users["testuser"],
 			CreationTime: time.Now(),
 			IsLoggedIn:   true,
 			ID:           "def123",
@@ -862,18 +1302,103 @@ func TestHandleAssignTicket(t *testing.T) {
 		TTL: session.CookieTTL,
 	}
 
+	globals.Users["otheruser"] = structs.User{
+		ID:       "2",
+		Name:     "Other",
+		Username: "otheruser",
+		Mail:     "other@mail.com",
+	}
+	defer delete(globals.Users, "otheruser")
+
+	globals.Tickets["assign123"] = structs.Ticket{
+		ID:       "assign123",
+		Customer: "customer@mail.com",
+		Status:   structs.StatusOpen,
+	}
+	defer delete(globals.Tickets, "assign123")
+
 	handler := &assignTicketHandler{}
 	server := httptest.NewServer(handler)
 	defer server.Close()
 
 	client := newNonRedirectClient()
-	resp, err := client.Get(server.URL + "/assignTicket?id=abc123&user=testuser")
-	defer func() {
+
+	postAssign := func(form url.Values) (int, string) {
+		resp, err := client.PostForm(server.URL+"/assignTicket", form)
+		if !assert.NoError(t, err, "An unexpected error occurred") {
+			return 0, ""
+		}
+		defer resp.Body.Close()
+
+		body, _ := ioutil.ReadAll(resp.Body)
+		return resp.StatusCode, string(body)
+	}
+
+	t.Run("getMethod", func(t *testing.T) {
+		resp, err := client.Get(server.URL + "/assignTicket?id=assign123&user=testuser")
 		if err == nil {
 			resp.Body.Close()
 		}
-	}()
 
-	assert.Nil(t, err, "An unexpected error occurred")
-	assert.Equal(t, http.StatusOK, resp.StatusCode, "The http status is not 200")
+		assert.NoError(t, err, "An unexpected error occurred")
+		assert.Equal(t, http.StatusMethodNotAllowed, resp.StatusCode, "The http status is not 405")
+	})
+
+	t.Run("missingParameter", func(t *testing.T) {
+		status, _ := postAssign(url.Values{"id": {"assign123"}})
+
+		assert.Equal(t, http.StatusBadRequest, status, "The http status is not 400")
+	})
+
+	t.Run("unknownTicket", func(t *testing.T) {
+		status, _ := postAssign(url.Values{"id": {"unknown"}, "user": {"testuser"}})
+
+		assert.Equal(t, http.StatusNotFound, status, "The http status is not 404")
+	})
+
+	t.Run("unknownUser", func(t *testing.T) {
+		status, _ := postAssign(url.Values{"id": {"assign123"}, "user": {"unknown"}})
+
+		assert.Equal(t, http.StatusNotFound, status, "The http status is not 404")
+		assert.Empty(t, globals.Tickets["assign123"].User.ID, "no zero user should be assigned")
+	})
+
+	t.Run("assignOthers", func(t *testing.T) {
+		status, _ := postAssign(url.Values{"id": {"assign123"}, "user": {"otheruser"}})
+
+		assert.Equal(t, http.StatusForbidden, status, "The http status is not 403")
+	})
+
+	t.Run("selfAssign", func(t *testing.T) {
+		mailsBefore := countMailsTo("Testuser@mail.com")
+
+		status, body := postAssign(url.Values{"id": {"assign123"}, "user": {"testuser"}})
+
+		assert.Equal(t, http.StatusOK, status, "The http status is not 200")
+		assert.Equal(t, "testuser", body, "the assigned username should be returned")
+		assert.Equal(t, "1", globals.Tickets["assign123"].User.ID, "ticket should be assigned")
+		assert.Equal(t, mailsBefore, countMailsTo("Testuser@mail.com"), "self assignments should not be notified")
+	})
+
+	t.Run("supervisor", func(t *testing.T) {
+		supervisor := globals.Users["testuser"]
+		supervisor.Role = structs.RoleSupervisor
+		globals.Users["testuser"] = supervisor
+
+		mailsBefore := countMailsTo("other@mail.com")
+
+		status, _ := postAssign(url.Values{"id": {"assign123"}, "user": {"otheruser"}})
+
+		assert.Equal(t, http.StatusOK, status, "The http status is not 200")
+		assert.Equal(t, "2", globals.Tickets["assign123"].User.ID, "supervisors may reassign tickets")
+		assert.Equal(t, mailsBefore+1, countMailsTo("other@mail.com"), "assigned editor should be notified")
+	})
+
+	t.Run("notLoggedIn", func(t *testing.T) {
+		delete(globals.Sessions, "def123")
+
+		status, _ := postAssign(url.Values{"id": {"assign123"}, "user": {"testuser"}})
+
+		assert.Equal(t, http.StatusUnauthorized, status, "The http status is not 401")
+	})
 }
@@ -0,0 +1,166 @@
+// Trivial Tickets Ticketsystem
+// Copyright (C) 2019 The Contributors
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+// Package server implements the web server including
+// shutdown routines and the associated handlers for
+// web requests.
+package server
+
+import (
+	"time"
+
+	"github.com/mortenterhart/trivial-tickets/api/api_out"
+	"github.com/mortenterhart/trivial-tickets/assignment"
+	"github.com/mortenterhart/trivial-tickets/globals"
+	"github.com/mortenterhart/trivial-tickets/log"
+	"github.com/mortenterhart/trivial-tickets/mail_events"
+	"github.com/mortenterhart/trivial-tickets/structs"
+	"github.com/mortenterhart/trivial-tickets/util/filehandler"
+)
+
+/*
+ * Ticketsystem Trivial Tickets
+ *
+ * Matriculation numbers: 3040018, 6694964, 3478222
+ * Lecture:               Programmieren II, INF16B
+ * Lecturer:              Herr Prof. Dr. Helmut Neemann
+ * Institute:             Duale Hochschule Baden-Württemberg Mosbach
+ *
+ * ---------------
+ *
+ * Package server
+ * Vacation mode and scheduled holidays of the users
+ */
+
+// setHolidayMode enables or disables the vacation mode of the
+// given user and persists the change. The scheduled flag marks
+// whether the change was caused by a scheduled holiday. When
+// the vacation mode is enabled, the tickets of the user are
+// redistributed according to the configured holiday policy.
+func setHolidayMode(user structs.User, enabled bool, scheduled bool) {
+	user.IsOnHoliday = enabled
+	user.ScheduledHoliday = enabled && scheduled
+
+	log.Infof("Updating the holiday setting for user '%s' (username '%s') to %t",
+		user.Name, user.Username, user.IsOnHoliday)
+
+	saveUser(user)
+
+	if enabled {
+		redistributeTickets(user)
+	}
+}
+
+// saveUser updates the given user in the users hash map and
+// in all sessions of the user and persists the users file.
+func saveUser(user structs.User) {
+	globals.Users[user.Username] = user
+
+	for sessionID, sessionManager := range globals.Sessions {
+		if sessionManager.Session.IsLoggedIn && sessionManager.Session.User.ID == user.ID {
+			sessionManager.Session.User = user
+			globals.Sessions[sessionID] = sessionManager
+		}
+	}
+
+	if writeErr := filehandler.WriteUserFile(globals.ServerConfig.Users, &globals.Users); writeErr != nil {
+		log.Errorf("unable to persist user '%s': %v", user.Username, writeErr)
+	}
+}
+
+// redistributeTickets hands over the tickets in progress of the
+// given user according to the configured holiday policy and
+// notifies the affected customers and editors.
+func redistributeTickets(user structs.User) {
+	changedTickets := assignment.RedistributeTickets(user, globals.ServerConfig.HolidayPolicy,
+		globals.ServerConfig.AssignStrategy, globals.Users, globals.Tickets)
+
+	for _, changedTicket := range changedTickets {
+		previousTicket := globals.Tickets[changedTicket.ID]
+
+		globals.Tickets[changedTicket.ID] = changedTicket
+		filehandler.WriteTicketFile(globals.ServerConfig.Tickets, &changedTicket)
+
+		if changedTicket.Status == structs.StatusOpen {
+			log.Infof("Released ticket '%s' of user '%s' (username '%s') due to holiday",
+				changedTicket.ID, user.Name, user.Username)
+			api_out.SendMail(mail_events.UnassignedTicket, previousTicket)
+		} else {
+			log.Infof("Reassigned ticket '%s' of user '%s' to user '%s' due to holiday",
+				changedTicket.ID, user.Username, changedTicket.User.Username)
+			api_out.SendMail(mail_events.AssignedTicket, changedTicket)
+			api_out.SendMail(mail_events.AgentAssigned, changedTicket)
+		}
+	}
+}
+
+// withoutActiveHolidays returns the scheduled holidays except
+// those which are active at the given time.
+func withoutActiveHolidays(holidays []structs.Holiday, now time.Time) []structs.Holiday {
+	var remainingHolidays []structs.Holiday
+	for _, holiday := range holidays {
+		if !holiday.IsActive(now) {
+			remainingHolidays = append(remainingHolidays, holiday)
+		}
+	}
+
+	return remainingHolidays
+}
+
+// applyHolidaySchedules switches the vacation mode of all users
+// on or off according to their scheduled holidays.
+func applyHolidaySchedules(now time.Time) {
+	for _, user := range globals.Users {
+		applyHolidaySchedule(user, now)
+	}
+}
+
+// applyHolidaySchedule enables the vacation mode of the given
+// user if one of the scheduled holidays is active and disables
+// it again after the holiday is over. A vacation mode that was
+// enabled manually is not disabled. Holidays that are over are
+// removed from the user. A vacation mode that was disabled
+// manually stays off since the active holidays are removed
+// when it is switched off.
+func applyHolidaySchedule(user structs.User, now time.Time) {
+	active := false
+	var remainingHolidays []structs.Holiday
+	for _, holiday := range user.Holidays {
+		if holiday.IsActive(now) {
+			active = true
+		}
+
+		if now.Before(holiday.End) {
+			remainingHolidays = append(remainingHolidays, holiday)
+		}
+	}
+
+	holidaysExpired := len(remainingHolidays) != len(user.Holidays)
+	user.Holidays = remainingHolidays
+
+	switch {
+	case active && !user.IsOnHoliday:
+		log.Infof("Scheduled holiday of user '%s' (username '%s') has begun", user.Name, user.Username)
+		setHolidayMode(user, true, true)
+
+	case !active && user.IsOnHoliday && user.ScheduledHoliday:
+		log.Infof("Scheduled holiday of user '%s' (username '%s') is over", user.Name, user.Username)
+		setHolidayMode(user, false, false)
+
+	case holidaysExpired:
+		saveUser(user)
+	}
+}
@@ -0,0 +1,193 @@
+// Trivial Tickets Ticketsystem
+// Copyright (C) 2019 The Contributors
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+// Package server implements the web server including
+// shutdown routines and the associated handlers for
+// web requests.
+package server
+
+import (
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mortenterhart/trivial-tickets/globals"
+	"github.com/mortenterhart/trivial-tickets/log/testlog"
+	"github.com/mortenterhart/trivial-tickets/session"
+	"github.com/mortenterhart/trivial-tickets/structs"
+	"github.com/mortenterhart/trivial-tickets/util/filehandler"
+)
+
+/*
+ * Ticketsystem Trivial Tickets
+ *
+ * Matriculation numbers: 3040018, 6694964, 3478222
+ * Lecture:               Programmieren II, INF16B
+ * Lecturer:              Herr Prof. Dr. Helmut Neemann
+ * Institute:             Duale Hochschule Baden-Württemberg Mosbach
+ *
+ * ---------------
+ *
+ * Package server
+ * Vacation mode and scheduled holidays of the users
+ */
+
+func TestApplyHolidaySchedules(t *testing.T) {
+	testlog.BeginTest()
+	defer testlog.EndTest()
+
+	defer resetConfig()
+
+	config := testServerConfig()
+	config.HolidayPolicy = structs.HolidayRelease
+	globals.ServerConfig = &config
+	defer cleanupTestFiles(config)
+
+	filehandler.CreateFolders(filepath.Dir(config.Users))
+
+	start := time.Date(2019, time.January, 7, 0, 0, 0, 0, time.Local)
+	testUser := structs.User{
+		ID:       "holiday1",
+		Name:     "Holiday",
+		Username: "holidayuser",
+		Mail:     "holiday@mail.com",
+		Holidays: []structs.Holiday{
+			{Start: start, End: start.AddDate(0, 0, 5)},
+		},
+	}
+
+	globals.Users["holidayuser"] = testUser
+	defer delete(globals.Users, "holidayuser")
+
+	globals.Tickets["holiday_ticket"] = structs.Ticket{
+		ID:       "holiday_ticket",
+		Subject:  "Holiday ticket",
+		Customer: "customer@mail.com",
+		Status:   structs.StatusInProgress,
+		User:     testUser,
+	}
+	defer delete(globals.Tickets, "holiday_ticket")
+
+	t.Run("beforeHoliday", func(t *testing.T) {
+		applyHolidaySchedules(start.Add(-time.Hour))
+
+		assert.False(t, globals.Users["holidayuser"].IsOnHoliday, "vacation mode should not be enabled yet")
+		assert.Equal(t, structs.StatusInProgress, globals.Tickets["holiday_ticket"].Status,
+			"ticket should still be in progress")
+	})
+
+	t.Run("duringHoliday", func(t *testing.T) {
+		applyHolidaySchedules(start.Add(time.Hour))
+
+		assert.True(t, globals.Users["holidayuser"].IsOnHoliday, "vacation mode should be enabled")
+		assert.True(t, globals.Users["holidayuser"].ScheduledHoliday, "vacation mode should be marked as scheduled")
+		assert.Equal(t, structs.StatusOpen, globals.Tickets["holiday_ticket"].Status,
+			"ticket should be released")
+		assert.Empty(t, globals.Tickets["holiday_ticket"].User.ID, "ticket should have no editor")
+	})
+
+	t.Run("afterHoliday", func(t *testing.T) {
+		applyHolidaySchedules(start.AddDate(0, 0, 6))
+
+		assert.False(t, globals.Users["holidayuser"].IsOnHoliday, "vacation mode should be disabled")
+		assert.Empty(t, globals.Users["holidayuser"].Holidays, "expired holiday should be removed")
+	})
+}
+
+func TestApplyHolidayScheduleManualHoliday(t *testing.T) {
+	testlog.BeginTest()
+	defer testlog.EndTest()
+
+	defer resetConfig()
+
+	config := testServerConfig()
+	defer cleanupTestFiles(config)
+
+	filehandler.CreateFolders(filepath.Dir(config.Users))
+
+	testUser := structs.User{
+		ID:          "holiday2",
+		Name:        "Manual",
+		Username:    "manualuser",
+		IsOnHoliday: true,
+	}
+
+	globals.Users["manualuser"] = testUser
+	defer delete(globals.Users, "manualuser")
+
+	applyHolidaySchedule(testUser, time.Now())
+
+	assert.True(t, globals.Users["manualuser"].IsOnHoliday,
+		"manually enabled vacation mode should not be disabled")
+}
+
+func TestApplyHolidayScheduleManualToggleOff(t *testing.T) {
+	testlog.BeginTest()
+	defer testlog.EndTest()
+
+	defer resetConfig()
+
+	config := testServerConfig()
+	defer cleanupTestFiles(config)
+
+	filehandler.CreateFolders(filepath.Dir(config.Users))
+
+	now := time.Now()
+	testUser := structs.User{
+		ID:       "1",
+		Name:     "Test",
+		Username: "testuser",
+		Mail:     "testuser@mail.com",
+		Holidays: []structs.Holiday{
+			{Start: now.Add(-time.Hour), End: now.AddDate(0, 0, 5)},
+			{Start: now.AddDate(0, 1, 0), End: now.AddDate(0, 1, 5)},
+		},
+	}
+
+	globals.Users["testuser"] = testUser
+	defer delete(globals.Users, "testuser")
+
+	globals.Sessions["def123"] = structs.SessionManager{
+		Name: "def123",
+		Session: structs.Session{
+			User:         testUser,
+			CreationTime: now,
+			IsLoggedIn:   true,
+			ID:           "def123",
+		},
+		TTL: session.CookieTTL,
+	}
+	defer delete(globals.Sessions, "def123")
+
+	applyHolidaySchedules(now)
+	assert.True(t, globals.Users["testuser"].IsOnHoliday, "scheduled holiday should enable the vacation mode")
+
+	server := httptest.NewServer(&holidayHandler{})
+	defer server.Close()
+
+	resp, err := newNonRedirectClient().Post(server.URL, "application/x-www-form-urlencoded", nil)
+	if assert.NoError(t, err, "An unexpected error occurred") {
+		resp.Body.Close()
+	}
+
+	applyHolidaySchedules(now.Add(time.Minute))
+
+	assert.False(t, globals.Users["testuser"].IsOnHoliday, "manually disabled vacation mode should stay off")
+	assert.Len(t, globals.Users["testuser"].Holidays, 1, "only the active holiday should be removed")
+}
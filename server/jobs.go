@@ -0,0 +1,104 @@
+// Trivial Tickets Ticketsystem
+// Copyright (C) 2019 The Contributors
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+// Package server implements the web server including
+// shutdown routines and the associated handlers for
+// web requests.
+package server
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/mortenterhart/trivial-tickets/globals"
+	"github.com/mortenterhart/trivial-tickets/log"
+	"github.com/mortenterhart/trivial-tickets/mail_guard"
+)
+
+/*
+ * Ticketsystem Trivial Tickets
+ *
+ * Matriculation numbers: 3040018, 6694964, 3478222
+ * Lecture:               Programmieren II, INF16B
+ * Lecturer:              Herr Prof. Dr. Helmut Neemann
+ * Institute:             Duale Hochschule Baden-Württemberg Mosbach
+ *
+ * ---------------
+ *
+ * Package server
+ * Background jobs running periodically beside the handlers
+ */
+
+// jobInterval is the duration between two runs of the
+// background jobs.
+const jobInterval time.Duration = time.Minute
+
+// startBackgroundJobs starts a Go routine which runs the
+// background jobs once immediately and then periodically
+// every jobInterval. The returned channel stops the Go
+// routine when it is closed.
+func startBackgroundJobs() chan<- bool {
+	stop := make(chan bool)
+
+	go func() {
+		ticker := time.NewTicker(jobInterval)
+		defer ticker.Stop()
+
+		runBackgroundJobs(time.Now())
+
+		for {
+			select {
+			case now := <-ticker.C:
+				runBackgroundJobs(now)
+
+			case <-stop:
+				log.Info("Stopping background jobs")
+				return
+			}
+		}
+	}()
+
+	return stop
+}
+
+// runBackgroundJobs executes all background jobs for the
+// given point in time. The storage lock is held during the
+// execution so that no handler accesses the tickets and
+// users concurrently.
+func runBackgroundJobs(now time.Time) {
+	globals.StorageLock.Lock()
+	defer globals.StorageLock.Unlock()
+
+	applyHolidaySchedules(now)
+	wakeTickets(now)
+	checkStaleTickets(now)
+	checkResponseTimes(now)
+	sendDailyDigests(now)
+	mail_guard.Prune(now)
+}
+
+// synchronized wraps the given handler so that every request
+// holds the storage lock while it is processed. This prevents
+// the background jobs from modifying the tickets and users
+// while a handler works on them.
+func synchronized(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		globals.StorageLock.Lock()
+		defer globals.StorageLock.Unlock()
+
+		handler.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,193 @@
+// Trivial Tickets Ticketsystem
+// Copyright (C) 2019 The Contributors
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+// Package server implements the web server including
+// shutdown routines and the associated handlers for
+// web requests.
+package server
+
+import (
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/mortenterhart/trivial-tickets/api/api_out"
+	"github.com/mortenterhart/trivial-tickets/globals"
+	"github.com/mortenterhart/trivial-tickets/log"
+	"github.com/mortenterhart/trivial-tickets/mail_events"
+	"github.com/mortenterhart/trivial-tickets/session"
+	"github.com/mortenterhart/trivial-tickets/structs"
+	"github.com/mortenterhart/trivial-tickets/ticket"
+	"github.com/mortenterhart/trivial-tickets/util/filehandler"
+)
+
+/*
+ * Ticketsystem Trivial Tickets
+ *
+ * Matriculation numbers: 3040018, 6694964, 3478222
+ * Lecture:               Programmieren II, INF16B
+ * Lecturer:              Herr Prof. Dr. Helmut Neemann
+ * Institute:             Duale Hochschule Baden-Württemberg Mosbach
+ *
+ * ---------------
+ *
+ * Package server
+ * Notifications of the editors and the daily digest
+ */
+
+// handleSaveNotifications saves the notification preferences
+// of the logged in user. A notification is turned off if its
+// checkbox is not checked in the form.
+func handleSaveNotifications(w http.ResponseWriter, r *http.Request) {
+
+	// Get session id
+	sessionID := session.GetSessionID(r)
+
+	// Only react on POST requests of logged in users
+	if r.Method == postMethod && globals.Sessions[sessionID].Session.IsLoggedIn {
+
+		currentSession, _ := session.GetSession(sessionID)
+		user := globals.Users[currentSession.User.Username]
+
+		user.Notifications = structs.Notifications{
+			MuteCustomerReply: r.FormValue("customerReply") == "",
+			MuteAssignment:    r.FormValue("assignment") == "",
+			MuteSLAWarning:    r.FormValue("slaWarning") == "",
+			MuteMention:       r.FormValue("mention") == "",
+			MuteDigest:        r.FormValue("digest") == "",
+		}
+
+		log.Infof("Updating the notification settings for user '%s' (username '%s')",
+			user.Name, user.Username)
+
+		saveUser(user)
+	}
+
+	// Redirect the user to the index
+	http.Redirect(w, r, indexURL, http.StatusMovedPermanently)
+}
+
+// notifyMentions informs the users mentioned in the text of
+// the entry written by the author. Authors do not get a mail
+// about mentioning themselves.
+func notifyMentions(currentTicket structs.Ticket, author structs.User, text string) {
+	for _, username := range ticket.Mentions(text) {
+		user, userExists := globals.Users[username]
+		if !userExists || user.ID == author.ID {
+			continue
+		}
+
+		log.Infof("User '%s' mentioned user '%s' in ticket '%s'", author.Username, user.Username, currentTicket.ID)
+		api_out.NotifyEditor(mail_events.Mention, currentTicket, user)
+	}
+}
+
+// checkResponseTimes warns the assigned editors of all tickets
+// whose response time is about to pass. Nothing happens if no
+// response time is configured.
+func checkResponseTimes(now time.Time) {
+	slaHours := globals.ServerConfig.SLAHours
+	if slaHours == 0 {
+		return
+	}
+
+	for _, currentTicket := range globals.Tickets {
+		if currentTicket.User.ID == "" {
+			continue
+		}
+
+		warnedTicket, warn := ticket.CheckSLA(currentTicket, now, slaHours)
+		if !warn {
+			continue
+		}
+
+		log.Infof("Warning user '%s' that the response time of ticket '%s' is about to pass",
+			warnedTicket.User.Username, warnedTicket.ID)
+
+		globals.Tickets[warnedTicket.ID] = warnedTicket
+		filehandler.WriteTicketFile(globals.ServerConfig.Tickets, &warnedTicket)
+
+		api_out.SendMail(mail_events.SLAWarning, warnedTicket)
+	}
+}
+
+// sendDailyDigests sends the daily digest to every user who
+// has not received it since the configured time of day. Users
+// on holiday and users without open tickets are skipped.
+func sendDailyDigests(now time.Time) {
+	digestTime, enabled := dailyDigestTime(now)
+	if !enabled || now.Before(digestTime) {
+		return
+	}
+
+	for _, user := range globals.Users {
+		if user.IsOnHoliday || !user.DigestSent.Before(digestTime) {
+			continue
+		}
+
+		user.DigestSent = now
+		saveUser(user)
+
+		tickets, overdue := digestTickets(user, now)
+		if len(tickets) == 0 {
+			continue
+		}
+
+		log.Infof("Sending daily digest with %d ticket(s) to user '%s' (username '%s')",
+			len(tickets), user.Name, user.Username)
+		api_out.SendDigest(user, tickets, overdue)
+	}
+}
+
+// dailyDigestTime returns the point in time on the day of now
+// at which the daily digest is sent. The second return value
+// is false if the daily digest is disabled.
+func dailyDigestTime(now time.Time) (time.Time, bool) {
+	timeOfDay, parseErr := time.Parse(structs.DailyDigestFormat, globals.ServerConfig.DailyDigest)
+	if parseErr != nil {
+		return time.Time{}, false
+	}
+
+	return time.Date(now.Year(), now.Month(), now.Day(), timeOfDay.Hour(), timeOfDay.Minute(),
+		0, 0, now.Location()), true
+}
+
+// digestTickets returns the tickets assigned to the user which
+// are not closed and the overdue ones among them, sorted by id.
+// A ticket is overdue if its response time has passed or if a
+// reminder of it is due.
+func digestTickets(user structs.User, now time.Time) ([]structs.Ticket, []structs.Ticket) {
+	var tickets, overdue []structs.Ticket
+	for _, currentTicket := range globals.Tickets {
+		if currentTicket.User.ID != user.ID || currentTicket.Status == structs.StatusClosed {
+			continue
+		}
+
+		tickets = append(tickets, currentTicket)
+		if currentTicket.Reminder || ticket.IsOverdue(currentTicket, now, globals.ServerConfig.SLAHours) {
+			overdue = append(overdue, currentTicket)
+		}
+	}
+
+	sort.Slice(tickets, func(i, j int) bool {
+		return tickets[i].ID < tickets[j].ID
+	})
+	sort.Slice(overdue, func(i, j int) bool {
+		return overdue[i].ID < overdue[j].ID
+	})
+
+	return tickets, overdue
+}
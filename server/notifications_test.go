@@ -0,0 +1,257 @@
+// Trivial Tickets Ticketsystem
+// Copyright (C) 2019 The Contributors
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+// Package server implements the web server including
+// shutdown routines and the associated handlers for
+// web requests.
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mortenterhart/trivial-tickets/globals"
+	"github.com/mortenterhart/trivial-tickets/log/testlog"
+	"github.com/mortenterhart/trivial-tickets/structs"
+	"github.com/mortenterhart/trivial-tickets/util/filehandler"
+)
+
+/*
+ * Ticketsystem Trivial Tickets
+ *
+ * Matriculation numbers: 3040018, 6694964, 3478222
+ * Lecture:               Programmieren II, INF16B
+ * Lecturer:              Herr Prof. Dr. Helmut Neemann
+ * Institute:             Duale Hochschule Baden-Württemberg Mosbach
+ *
+ * ---------------
+ *
+ * Package server
+ * Notifications of the editors and the daily digest
+ */
+
+func TestHandleSaveNotifications(t *testing.T) {
+	testlog.BeginTest()
+	defer testlog.EndTest()
+
+	defer resetConfig()
+
+	config := testServerConfig()
+	defer cleanupTestFiles(config)
+
+	filehandler.CreateFolders(filepath.Dir(config.Users))
+
+	user, logout := loginResponseUser()
+	defer logout()
+
+	server := httptest.NewServer(&sessionHandler{handleSaveNotifications})
+	defer server.Close()
+
+	client := newNonRedirectClient()
+
+	t.Run("muteNotifications", func(t *testing.T) {
+		resp, err := client.PostForm(server.URL, url.Values{
+			"customerReply": {"on"},
+			"mention":       {"on"},
+		})
+		if err == nil {
+			resp.Body.Close()
+		}
+
+		assert.NoError(t, err, "An unexpected error occurred")
+		assert.Equal(t, http.StatusMovedPermanently, resp.StatusCode, "Status code did not match 301")
+		assert.Equal(t, structs.Notifications{MuteAssignment: true, MuteSLAWarning: true, MuteDigest: true},
+			globals.Users[user.Username].Notifications, "unchecked notifications should be muted")
+		assert.Equal(t, globals.Users[user.Username].Notifications, globals.Sessions["resp123"].Session.User.Notifications,
+			"session user should be updated")
+	})
+
+	t.Run("wrongMethod", func(t *testing.T) {
+		resp, err := client.Get(server.URL)
+		if err == nil {
+			resp.Body.Close()
+		}
+
+		assert.NoError(t, err, "An unexpected error occurred")
+		assert.True(t, globals.Users[user.Username].Notifications.MuteDigest, "settings should not change")
+	})
+}
+
+func TestNotifyMentions(t *testing.T) {
+	testlog.BeginTest()
+	defer testlog.EndTest()
+
+	defer resetConfig()
+
+	config := testServerConfig()
+	defer cleanupTestFiles(config)
+
+	user, logout := loginResponseUser()
+	defer logout()
+
+	mentioned := structs.User{ID: "mention1", Name: "Mentioned", Username: "mentioned", Mail: "mentioned@mail.com"}
+	globals.Users[mentioned.Username] = mentioned
+	defer delete(globals.Users, mentioned.Username)
+
+	defer mockEntryTicket(user, true)()
+
+	t.Run("mention", func(t *testing.T) {
+		mailsBefore := countMailsTo(mentioned.Mail)
+
+		notifyMentions(globals.Tickets["entry123"], user, "@mentioned and @unknown, please have a look")
+
+		assert.Equal(t, mailsBefore+1, countMailsTo(mentioned.Mail), "mentioned user should be notified")
+	})
+
+	t.Run("selfMention", func(t *testing.T) {
+		mailsBefore := countMailsTo(user.Mail)
+
+		notifyMentions(globals.Tickets["entry123"], user, "Note to @responseuser")
+
+		assert.Equal(t, mailsBefore, countMailsTo(user.Mail), "authors should not be notified")
+	})
+
+	t.Run("muted", func(t *testing.T) {
+		mutedUser := mentioned
+		mutedUser.Notifications.MuteMention = true
+		globals.Users[mentioned.Username] = mutedUser
+
+		mailsBefore := countMailsTo(mentioned.Mail)
+
+		notifyMentions(globals.Tickets["entry123"], user, "@mentioned")
+
+		assert.Equal(t, mailsBefore, countMailsTo(mentioned.Mail), "muted mentions should not be sent")
+	})
+}
+
+func TestCheckResponseTimes(t *testing.T) {
+	testlog.BeginTest()
+	defer testlog.EndTest()
+
+	defer resetConfig()
+
+	config := testServerConfig()
+	defer cleanupTestFiles(config)
+
+	user, logout := loginResponseUser()
+	defer logout()
+
+	defer mockEntryTicket(user, true)()
+
+	question := time.Date(2019, time.January, 7, 8, 0, 0, 0, time.Local)
+
+	waitingTicket := globals.Tickets["entry123"]
+	waitingTicket.Entries[0].Date = question
+	globals.Tickets["entry123"] = waitingTicket
+
+	t.Run("disabled", func(t *testing.T) {
+		mailsBefore := countMailsTo(user.Mail)
+
+		checkResponseTimes(question.AddDate(0, 0, 1))
+
+		assert.Equal(t, mailsBefore, countMailsTo(user.Mail), "no warning should be sent without response time")
+	})
+
+	globals.ServerConfig.SLAHours = 8
+
+	t.Run("notDue", func(t *testing.T) {
+		mailsBefore := countMailsTo(user.Mail)
+
+		checkResponseTimes(question.Add(5 * time.Hour))
+
+		assert.Equal(t, mailsBefore, countMailsTo(user.Mail), "no warning should be sent yet")
+	})
+
+	t.Run("warning", func(t *testing.T) {
+		mailsBefore := countMailsTo(user.Mail)
+
+		checkResponseTimes(question.Add(6 * time.Hour))
+		checkResponseTimes(question.Add(7 * time.Hour))
+
+		assert.Equal(t, mailsBefore+1, countMailsTo(user.Mail), "editor should be warned once")
+		assert.False(t, globals.Tickets["entry123"].SLAWarned.IsZero(), "warning should be recorded")
+	})
+}
+
+func TestSendDailyDigests(t *testing.T) {
+	testlog.BeginTest()
+	defer testlog.EndTest()
+
+	defer resetConfig()
+
+	config := testServerConfig()
+	defer cleanupTestFiles(config)
+
+	filehandler.CreateFolders(filepath.Dir(config.Users))
+
+	user, logout := loginResponseUser()
+	defer logout()
+
+	defer mockEntryTicket(user, true)()
+
+	morning := time.Date(2019, time.January, 7, 8, 0, 0, 0, time.Local)
+
+	t.Run("disabled", func(t *testing.T) {
+		mailsBefore := countMailsTo(user.Mail)
+
+		sendDailyDigests(morning)
+
+		assert.Equal(t, mailsBefore, countMailsTo(user.Mail), "no digest should be sent if disabled")
+	})
+
+	globals.ServerConfig.DailyDigest = "08:00"
+
+	t.Run("notDue", func(t *testing.T) {
+		mailsBefore := countMailsTo(user.Mail)
+
+		sendDailyDigests(morning.Add(-time.Minute))
+
+		assert.Equal(t, mailsBefore, countMailsTo(user.Mail), "no digest should be sent before the time of day")
+	})
+
+	t.Run("digest", func(t *testing.T) {
+		mailsBefore := countMailsTo(user.Mail)
+
+		sendDailyDigests(morning)
+		sendDailyDigests(morning.Add(time.Hour))
+
+		assert.Equal(t, mailsBefore+1, countMailsTo(user.Mail), "digest should be sent once a day")
+		assert.Equal(t, morning, globals.Users[user.Username].DigestSent, "digest should be recorded")
+	})
+
+	t.Run("nextDay", func(t *testing.T) {
+		mailsBefore := countMailsTo(user.Mail)
+
+		sendDailyDigests(morning.AddDate(0, 0, 1))
+
+		assert.Equal(t, mailsBefore+1, countMailsTo(user.Mail), "digest should be sent again the next day")
+	})
+
+	t.Run("overdue", func(t *testing.T) {
+		globals.ServerConfig.SLAHours = 8
+
+		tickets, overdue := digestTickets(user, morning)
+
+		assert.Len(t, tickets, 1, "ticket in progress should be listed")
+		assert.Len(t, overdue, 1, "ticket waiting for the editor should be overdue")
+	})
+}
@@ -0,0 +1,123 @@
+// Trivial Tickets Ticketsystem
+// Copyright (C) 2019 The Contributors
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+// Package server implements the web server including
+// shutdown routines and the associated handlers for
+// web requests.
+package server
+
+import (
+	"crypto/subtle"
+	"html/template"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mortenterhart/trivial-tickets/globals"
+	"github.com/mortenterhart/trivial-tickets/log"
+	"github.com/mortenterhart/trivial-tickets/structs"
+	"github.com/mortenterhart/trivial-tickets/ticket"
+	"github.com/mortenterhart/trivial-tickets/util/filehandler"
+)
+
+/*
+ * Ticketsystem Trivial Tickets
+ *
+ * Matriculation numbers: 3040018, 6694964, 3478222
+ * Lecture:               Programmieren II, INF16B
+ * Lecturer:              Herr Prof. Dr. Helmut Neemann
+ * Institute:             Duale Hochschule Baden-Württemberg Mosbach
+ *
+ * ---------------
+ *
+ * Package server
+ * Customer satisfaction surveys of closed tickets
+ */
+
+// rateURL is the prefix of the public rating links
+// sent to the customers.
+const rateURL string = "/rate/"
+
+// handleRate records the rating of a closed ticket. The link
+// has the form /rate/<ticket>/<token>/<score> and is public,
+// so that the customer can rate the ticket from the closing
+// mail. The token authorizes the rating instead of a session.
+// A GET request only shows a form to confirm the score, since
+// mail scanners and link prefetchers follow every link of the
+// mail. The POST request of the form records the score along
+// with the comment given in the form value "comment". Only an
+// explicit submission of the form replaces a previous rating.
+func handleRate(w http.ResponseWriter, r *http.Request) {
+	if r.Method != getMethod && r.Method != postMethod {
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, rateURL), "/")
+	if len(parts) != 3 {
+		http.NotFound(w, r)
+		return
+	}
+
+	ticketID, token := parts[0], parts[1]
+	currentTicket, ticketExists := globals.Tickets[ticketID]
+
+	// Unknown tickets and invalid tokens are not distinguished
+	// to prevent guessing of ticket ids
+	if !ticketExists || currentTicket.Rating.Token == "" ||
+		subtle.ConstantTimeCompare([]byte(token), []byte(currentTicket.Rating.Token)) != 1 {
+		log.Errorf("%s %s: invalid rating link", r.Method, r.URL.Path)
+		http.NotFound(w, r)
+		return
+	}
+
+	score, convertErr := strconv.Atoi(parts[2])
+	if convertErr != nil {
+		http.Error(w, "invalid score '"+template.HTMLEscapeString(parts[2])+"'", http.StatusBadRequest)
+		return
+	}
+
+	comment := template.HTMLEscapeString(r.FormValue("comment"))
+	ratedTicket, rateErr := ticket.Rate(currentTicket, score, comment, time.Now())
+	if rateErr != nil {
+		log.Errorf("%s %s: unable to rate ticket '%s': %v", r.Method, r.URL.Path, ticketID, rateErr)
+		http.Error(w, rateErr.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// The rating is only checked but not recorded on GET requests
+	recorded := r.Method == postMethod
+	if recorded {
+		log.Infof("Customer rated ticket '%s' with score %d", ticketID, score)
+
+		globals.Tickets[ticketID] = ratedTicket
+		filehandler.WriteTicketFile(globals.ServerConfig.Tickets, &ratedTicket)
+	} else {
+		ratedTicket = currentTicket
+	}
+
+	executeErr := tmpl.Lookup("rating.html").ExecuteTemplate(w, "rating", structs.DataRating{
+		Ticket:   ratedTicket,
+		URL:      r.URL.Path,
+		Score:    score,
+		Recorded: recorded,
+	})
+	if executeErr != nil {
+		log.Errorf("unable to render rating page of ticket '%s': %v", ticketID, executeErr)
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,199 @@
+// Trivial Tickets Ticketsystem
+// Copyright (C) 2019 The Contributors
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+// Package server implements the web server including
+// shutdown routines and the associated handlers for
+// web requests.
+package server
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mortenterhart/trivial-tickets/globals"
+	"github.com/mortenterhart/trivial-tickets/log/testlog"
+	"github.com/mortenterhart/trivial-tickets/structs"
+	"github.com/mortenterhart/trivial-tickets/structs/defaults"
+)
+
+/*
+ * Ticketsystem Trivial Tickets
+ *
+ * Matriculation numbers: 3040018, 6694964, 3478222
+ * Lecture:               Programmieren II, INF16B
+ * Lecturer:              Herr Prof. Dr. Helmut Neemann
+ * Institute:             Duale Hochschule Baden-Württemberg Mosbach
+ *
+ * ---------------
+ *
+ * Package server
+ * Customer satisfaction surveys of closed tickets
+ */
+
+// mockClosedTicket stores a closed ticket of the given
+// editor with a survey token and returns a function
+// removing the ticket again.
+func mockClosedTicket(user structs.User) func() {
+	globals.Tickets["rate123"] = structs.Ticket{
+		ID:       "rate123",
+		Subject:  "Printer is broken",
+		Customer: "customer@mail.com",
+		Status:   structs.StatusClosed,
+		User:     user,
+		Rating:   structs.Rating{Token: "token123"},
+	}
+
+	return func() {
+		delete(globals.Tickets, "rate123")
+	}
+}
+
+func TestHandleRate(t *testing.T) {
+	testlog.BeginTest()
+	defer testlog.EndTest()
+
+	defer resetConfig()
+
+	config := testServerConfig()
+	defer cleanupTestFiles(config)
+
+	tmpl = getTemplates(defaults.TestWebTrimmed)
+
+	defer mockClosedTicket(structs.User{ID: "resp1", Username: "responseuser"})()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc(rateURL, handleRate)
+
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	client := newNonRedirectClient()
+
+	t.Run("confirmation", func(t *testing.T) {
+		resp, err := client.Get(server.URL + "/rate/rate123/token123/4")
+		if !assert.NoError(t, err, "An unexpected error occurred") {
+			return
+		}
+		defer resp.Body.Close()
+
+		body, _ := ioutil.ReadAll(resp.Body)
+
+		assert.Equal(t, http.StatusOK, resp.StatusCode, "The http status is not 200")
+		assert.Contains(t, string(body), "with 4 out of 5?", "score should be asked for confirmation")
+		assert.Contains(t, string(body), `method="POST"`, "page should contain the confirmation form")
+		assert.False(t, globals.Tickets["rate123"].Rating.IsRated(), "following the link should not rate the ticket")
+	})
+
+	t.Run("rate", func(t *testing.T) {
+		resp, err := client.PostForm(server.URL+"/rate/rate123/token123/4", url.Values{"comment": {"Fast & friendly"}})
+		if !assert.NoError(t, err, "An unexpected error occurred") {
+			return
+		}
+		defer resp.Body.Close()
+
+		body, _ := ioutil.ReadAll(resp.Body)
+		rating := globals.Tickets["rate123"].Rating
+
+		assert.Equal(t, http.StatusOK, resp.StatusCode, "The http status is not 200")
+		assert.Contains(t, string(body), "with 4 out of 5.", "rating should be confirmed")
+		assert.Equal(t, 4, rating.Score, "score should be recorded")
+		assert.Equal(t, "responseuser", rating.Agent, "assigned editor should be credited")
+		assert.Equal(t, "Fast &amp; friendly", rating.Comment, "comment should be recorded escaped")
+	})
+
+	t.Run("prefetchedLink", func(t *testing.T) {
+		resp, err := client.Get(server.URL + "/rate/rate123/token123/1")
+		if err == nil {
+			resp.Body.Close()
+		}
+
+		assert.NoError(t, err, "An unexpected error occurred")
+		assert.Equal(t, 4, globals.Tickets["rate123"].Rating.Score, "following another link should keep the rating")
+	})
+
+	t.Run("rateAgain", func(t *testing.T) {
+		resp, err := client.PostForm(server.URL+"/rate/rate123/token123/5", url.Values{})
+		if err == nil {
+			resp.Body.Close()
+		}
+
+		assert.NoError(t, err, "An unexpected error occurred")
+		assert.Equal(t, 5, globals.Tickets["rate123"].Rating.Score, "submitting the form again should replace the rating")
+	})
+
+	t.Run("invalidToken", func(t *testing.T) {
+		resp, err := client.Get(server.URL + "/rate/rate123/guessed/1")
+		if err == nil {
+			resp.Body.Close()
+		}
+
+		assert.NoError(t, err, "An unexpected error occurred")
+		assert.Equal(t, http.StatusNotFound, resp.StatusCode, "Status code did not match 404")
+		assert.Equal(t, 5, globals.Tickets["rate123"].Rating.Score, "rating should not be changed")
+	})
+
+	t.Run("invalidScore", func(t *testing.T) {
+		resp, err := client.Get(server.URL + "/rate/rate123/token123/9")
+		if err == nil {
+			resp.Body.Close()
+		}
+
+		assert.NoError(t, err, "An unexpected error occurred")
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode, "Status code did not match 400")
+	})
+}
+
+func TestHandleSatisfactionCSV(t *testing.T) {
+	testlog.BeginTest()
+	defer testlog.EndTest()
+
+	defer resetConfig()
+
+	config := testServerConfig()
+	defer cleanupTestFiles(config)
+
+	user, logout := loginResponseUser()
+	defer logout()
+
+	defer mockClosedTicket(user)()
+
+	ratedTicket := globals.Tickets["rate123"]
+	ratedTicket.Rating = structs.Rating{Score: 5, Agent: user.Username,
+		Date: time.Date(2019, time.January, 7, 10, 0, 0, 0, time.Local)}
+	globals.Tickets["rate123"] = ratedTicket
+
+	server := httptest.NewServer(&sessionHandler{handleSatisfactionCSV})
+	defer server.Close()
+
+	client := newNonRedirectClient()
+	resp, err := client.Get(server.URL + "/csat.csv?from=2019-01-01&to=2019-01-31&period=month")
+	if !assert.NoError(t, err, "An unexpected error occurred") {
+		return
+	}
+	defer resp.Body.Close()
+
+	body, _ := ioutil.ReadAll(resp.Body)
+
+	assert.Equal(t, http.StatusOK, resp.StatusCode, "The http status is not 200")
+	assert.Contains(t, resp.Header.Get("Content-Disposition"), "csat_2019-01-01_2019-01-31.csv")
+	assert.Equal(t, "period,agent,ratings,average,csat\n2019-01,responseuser,1,5.0,100\n", string(body))
+}
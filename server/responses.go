@@ -0,0 +1,337 @@
+// Trivial Tickets Ticketsystem
+// Copyright (C) 2019 The Contributors
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+// Package server implements the web server including
+// shutdown routines and the associated handlers for
+// web requests.
+package server
+
+import (
+	"html/template"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/mortenterhart/trivial-tickets/api/api_out"
+	"github.com/mortenterhart/trivial-tickets/globals"
+	"github.com/mortenterhart/trivial-tickets/log"
+	"github.com/mortenterhart/trivial-tickets/mail_events"
+	"github.com/mortenterhart/trivial-tickets/responses"
+	"github.com/mortenterhart/trivial-tickets/session"
+	"github.com/mortenterhart/trivial-tickets/structs"
+	"github.com/mortenterhart/trivial-tickets/util/filehandler"
+	"github.com/mortenterhart/trivial-tickets/util/random"
+)
+
+/*
+ * Ticketsystem Trivial Tickets
+ *
+ * Matriculation numbers: 3040018, 6694964, 3478222
+ * Lecture:               Programmieren II, INF16B
+ * Lecturer:              Herr Prof. Dr. Helmut Neemann
+ * Institute:             Duale Hochschule Baden-Württemberg Mosbach
+ *
+ * ---------------
+ *
+ * Package server
+ * Handlers for canned responses and macros
+ */
+
+// handleSaveResponse creates a new canned response with the
+// form values "title" and "text". If the form value "shared"
+// is set, the response is available to all users, otherwise
+// only to the logged in user.
+func handleSaveResponse(w http.ResponseWriter, r *http.Request) {
+
+	// Get session id
+	sessionID := session.GetSessionID(r)
+
+	// Only react on POST requests of logged in users
+	if r.Method == postMethod && globals.Sessions[sessionID].Session.IsLoggedIn {
+
+		currentSession, _ := session.GetSession(sessionID)
+
+		// The text is a template whose result is escaped where
+		// it is shown or stored, so it is not escaped here
+		response := structs.CannedResponse{
+			ID:    random.CreateRandomID(structs.RandomIDLength),
+			Title: template.HTMLEscapeString(r.FormValue("title")),
+			Text:  r.FormValue("text"),
+		}
+
+		if response.Title == "" || response.Text == "" {
+			log.Errorf("%s %s: missing title or text of canned response", r.Method, r.RequestURI)
+			http.Redirect(w, r, indexURL, http.StatusMovedPermanently)
+			return
+		}
+
+		if _, renderErr := responses.Render(response.Text, structs.Ticket{}); renderErr != nil {
+			log.Errorf("%s %s: invalid canned response: %v", r.Method, r.RequestURI, renderErr)
+			http.Redirect(w, r, indexURL, http.StatusMovedPermanently)
+			return
+		}
+
+		if r.FormValue("shared") == "" {
+			response.Owner = currentSession.User.Username
+		}
+
+		log.Infof("Saving canned response '%s' of user '%s'", response.Title, currentSession.User.Username)
+
+		globals.Responses[response.ID] = response
+		saveResponses()
+	}
+
+	// Redirect the user to the index
+	http.Redirect(w, r, indexURL, http.StatusMovedPermanently)
+}
+
+// handleDeleteResponse deletes the canned response with the id
+// given in the form value "response". Personal responses can
+// only be deleted by their owner.
+func handleDeleteResponse(w http.ResponseWriter, r *http.Request) {
+
+	// Get session id
+	sessionID := session.GetSessionID(r)
+
+	// Only react on POST requests of logged in users
+	if r.Method == postMethod && globals.Sessions[sessionID].Session.IsLoggedIn {
+
+		currentSession, _ := session.GetSession(sessionID)
+
+		responseID := template.HTMLEscapeString(r.FormValue("response"))
+		response, responseExists := globals.Responses[responseID]
+
+		if !responseExists || !(response.IsShared() || response.Owner == currentSession.User.Username) {
+			log.Errorf("%s %s: canned response '%s' not found", r.Method, r.RequestURI, responseID)
+			http.Redirect(w, r, indexURL, http.StatusMovedPermanently)
+			return
+		}
+
+		log.Infof("Deleting canned response '%s'", response.Title)
+
+		delete(globals.Responses, responseID)
+		saveResponses()
+	}
+
+	// Redirect the user to the index
+	http.Redirect(w, r, indexURL, http.StatusMovedPermanently)
+}
+
+// handleSaveMacro creates a new macro from the form values
+// "title", "reply", "reply_type", "status", "tags" and
+// "assign". An empty status or assignee keeps the current
+// value of the ticket. The tags are separated by commas. If
+// the form value "shared" is set, the macro is available to
+// all users.
+func handleSaveMacro(w http.ResponseWriter, r *http.Request) {
+
+	// Get session id
+	sessionID := session.GetSessionID(r)
+
+	// Only react on POST requests of logged in users
+	if r.Method == postMethod && globals.Sessions[sessionID].Session.IsLoggedIn {
+
+		currentSession, _ := session.GetSession(sessionID)
+
+		macro := structs.Macro{
+			ID:        random.CreateRandomID(structs.RandomIDLength),
+			Title:     template.HTMLEscapeString(r.FormValue("title")),
+			Reply:     r.FormValue("reply"),
+			ReplyType: template.HTMLEscapeString(r.FormValue("reply_type")),
+			Tags:      responses.ParseTags(template.HTMLEscapeString(r.FormValue("tags"))),
+			AssignTo:  template.HTMLEscapeString(r.FormValue("assign")),
+		}
+
+		// Check the assignment with the current role of the user
+		author, authorExists := globals.Users[currentSession.User.Username]
+		if !authorExists {
+			author = currentSession.User
+		}
+
+		if macroErr := validateMacro(&macro, r.FormValue("status"), author); macroErr != "" {
+			log.Errorf("%s %s: invalid macro: %s", r.Method, r.RequestURI, macroErr)
+			http.Redirect(w, r, indexURL, http.StatusMovedPermanently)
+			return
+		}
+
+		if r.FormValue("shared") == "" {
+			macro.Owner = currentSession.User.Username
+		}
+
+		log.Infof("Saving macro '%s' of user '%s'", macro.Title, currentSession.User.Username)
+
+		globals.Macros[macro.ID] = macro
+		saveResponses()
+	}
+
+	// Redirect the user to the index
+	http.Redirect(w, r, indexURL, http.StatusMovedPermanently)
+}
+
+// validateMacro checks the values of a new macro and sets its
+// status from the given status string. Only supervisors may
+// save macros assigning tickets to other users. It returns a
+// description of the first invalid value or an empty string
+// if the macro is valid.
+func validateMacro(macro *structs.Macro, status string, author structs.User) string {
+	if macro.Title == "" {
+		return "missing title"
+	}
+
+	if macro.Reply != "" {
+		if macro.ReplyType != structs.ReplyInternal && macro.ReplyType != structs.ReplyExternal {
+			return "reply type has to be either 'internal' or 'external'"
+		}
+
+		if _, renderErr := responses.Render(macro.Reply, structs.Ticket{}); renderErr != nil {
+			return renderErr.Error()
+		}
+	}
+
+	if status != "" {
+		statusValue, convertErr := strconv.Atoi(status)
+		if convertErr != nil || statusValue < int(structs.StatusOpen) || statusValue > int(structs.StatusClosed) {
+			return "undefined status '" + status + "'"
+		}
+
+		macro.ChangeStatus = true
+		macro.Status = structs.Status(statusValue)
+	}
+
+	if macro.AssignTo != "" && macro.AssignTo != structs.MacroAssignSelf {
+		if _, userExists := globals.Users[macro.AssignTo]; !userExists {
+			return "user '" + macro.AssignTo + "' does not exist"
+		}
+
+		if macro.AssignTo != author.Username && !author.IsSupervisor() {
+			return "user '" + author.Username + "' may only assign tickets to themselves"
+		}
+	}
+
+	return ""
+}
+
+// handleDeleteMacro deletes the macro with the id given in
+// the form value "macro". Personal macros can only be deleted
+// by their owner.
+func handleDeleteMacro(w http.ResponseWriter, r *http.Request) {
+
+	// Get session id
+	sessionID := session.GetSessionID(r)
+
+	// Only react on POST requests of logged in users
+	if r.Method == postMethod && globals.Sessions[sessionID].Session.IsLoggedIn {
+
+		currentSession, _ := session.GetSession(sessionID)
+
+		macroID := template.HTMLEscapeString(r.FormValue("macro"))
+		macro, macroExists := globals.Macros[macroID]
+
+		if !macroExists || !(macro.IsShared() || macro.Owner == currentSession.User.Username) {
+			log.Errorf("%s %s: macro '%s' not found", r.Method, r.RequestURI, macroID)
+			http.Redirect(w, r, indexURL, http.StatusMovedPermanently)
+			return
+		}
+
+		log.Infof("Deleting macro '%s'", macro.Title)
+
+		delete(globals.Macros, macroID)
+		saveResponses()
+	}
+
+	// Redirect the user to the index
+	http.Redirect(w, r, indexURL, http.StatusMovedPermanently)
+}
+
+// handleApplyMacro applies the macro with the id given in the
+// form value "macro" to the ticket given in the form value
+// "ticket" and redirects to the ticket afterwards. The customer
+// is notified about an external reply, a new editor or a new
+// status.
+func handleApplyMacro(w http.ResponseWriter, r *http.Request) {
+
+	// Get session id
+	sessionID := session.GetSessionID(r)
+
+	// Only react on POST requests of logged in users
+	if r.Method != postMethod || !globals.Sessions[sessionID].Session.IsLoggedIn {
+		http.Redirect(w, r, indexURL, http.StatusMovedPermanently)
+		return
+	}
+
+	currentSession, _ := session.GetSession(sessionID)
+
+	ticketID := template.HTMLEscapeString(r.FormValue("ticket"))
+	currentTicket, ticketExists := globals.Tickets[ticketID]
+	if !ticketExists {
+		log.Errorf("%s %s: ticket '%s' not found", r.Method, r.RequestURI, ticketID)
+		http.Redirect(w, r, indexURL, http.StatusMovedPermanently)
+		return
+	}
+
+	ticketURL := "/ticket?" + idParameter + "=" + url.QueryEscape(ticketID)
+
+	macroID := template.HTMLEscapeString(r.FormValue("macro"))
+	macro, macroExists := globals.Macros[macroID]
+	if !macroExists || !(macro.IsShared() || macro.Owner == currentSession.User.Username) {
+		log.Errorf("%s %s: macro '%s' not found", r.Method, r.RequestURI, macroID)
+		http.Redirect(w, r, ticketURL, http.StatusMovedPermanently)
+		return
+	}
+
+	// Check the assignment with the current role of the user
+	editor, editorExists := globals.Users[currentSession.User.Username]
+	if !editorExists {
+		editor = currentSession.User
+	}
+
+	updatedTicket, applyErr := responses.ApplyMacro(macro, editor, globals.Users, currentTicket)
+	if applyErr != nil {
+		log.Errorf("%s %s: unable to apply macro '%s': %v", r.Method, r.RequestURI, macro.Title, applyErr)
+		http.Redirect(w, r, ticketURL, http.StatusMovedPermanently)
+		return
+	}
+
+	log.Infof("Applying macro '%s' to ticket '%s'", macro.Title, updatedTicket.ID)
+
+	globals.Tickets[updatedTicket.ID] = updatedTicket
+	filehandler.WriteTicketFile(globals.ServerConfig.Tickets, &updatedTicket)
+
+	switch {
+	case macro.Reply != "" && macro.ReplyType == structs.ReplyExternal:
+		api_out.SendMail(mail_events.NewAnswer, updatedTicket)
+
+	case updatedTicket.User.ID != currentTicket.User.ID:
+		api_out.SendMail(mail_events.AssignedTicket, updatedTicket)
+
+	case updatedTicket.Status != currentTicket.Status:
+		api_out.SendMail(mail_events.UpdatedTicket, updatedTicket)
+	}
+
+	if updatedTicket.User.ID != currentTicket.User.ID && updatedTicket.User.ID != editor.ID {
+		api_out.SendMail(mail_events.AgentAssigned, updatedTicket)
+	}
+
+	http.Redirect(w, r, ticketURL, http.StatusMovedPermanently)
+}
+
+// saveResponses persists the canned responses and macros.
+func saveResponses() {
+	if writeErr := filehandler.WriteResponseFile(globals.ServerConfig.Responses,
+		&globals.Responses, &globals.Macros); writeErr != nil {
+		log.Errorf("unable to persist canned responses: %v", writeErr)
+	}
+}
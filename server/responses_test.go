@@ -0,0 +1,460 @@
+// Trivial Tickets Ticketsystem
+// Copyright (C) 2019 The Contributors
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+// Package server implements the web server including
+// shutdown routines and the associated handlers for
+// web requests.
+package server
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mortenterhart/trivial-tickets/globals"
+	"github.com/mortenterhart/trivial-tickets/log/testlog"
+	"github.com/mortenterhart/trivial-tickets/session"
+	"github.com/mortenterhart/trivial-tickets/structs"
+	"github.com/mortenterhart/trivial-tickets/structs/defaults"
+)
+
+/*
+ * Ticketsystem Trivial Tickets
+ *
+ * Matriculation numbers: 3040018, 6694964, 3478222
+ * Lecture:               Programmieren II, INF16B
+ * Lecturer:              Herr Prof. Dr. Helmut Neemann
+ * Institute:             Duale Hochschule Baden-Württemberg Mosbach
+ *
+ * ---------------
+ *
+ * Package server
+ * Handlers for canned responses and macros
+ */
+
+// sessionHandler is a handler wrapper that adds
+// the session cookie of the test user to each
+// request before calling the wrapped handler.
+type sessionHandler struct {
+	handle http.HandlerFunc
+}
+
+// ServeHTTP handles the test web requests
+// and adds a session cookie to each request.
+func (h *sessionHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+
+	cookie := http.Cookie{
+		Name:  session.CookieName,
+		Value: "resp123",
+	}
+	r.AddCookie(&cookie)
+	h.handle(w, r)
+}
+
+// loginResponseUser logs in a test user with the
+// session id of the sessionHandler and returns the
+// user. The returned function removes the user and
+// the session again.
+func loginResponseUser() (structs.User, func()) {
+	testUser := structs.User{
+		ID:       "resp1",
+		Name:     "Response",
+		Username: "responseuser",
+		Mail:     "response@mail.com",
+	}
+
+	globals.Users[testUser.Username] = testUser
+	globals.Sessions["resp123"] = structs.SessionManager{
+		Name: "resp123",
+		Session: structs.Session{
+			User:         testUser,
+			CreationTime: time.Now(),
+			IsLoggedIn:   true,
+			ID:           "resp123",
+		},
+		TTL: session.CookieTTL,
+	}
+
+	return testUser, func() {
+		delete(globals.Users, testUser.Username)
+		delete(globals.Sessions, "resp123")
+	}
+}
+
+// resetResponses removes all canned responses
+// and macros.
+func resetResponses() {
+	globals.Responses = make(map[string]structs.CannedResponse)
+	globals.Macros = make(map[string]structs.Macro)
+}
+
+func TestHandleSaveResponse(t *testing.T) {
+	testlog.BeginTest()
+	defer testlog.EndTest()
+
+	defer resetConfig()
+	defer resetResponses()
+
+	config := testServerConfig()
+	defer cleanupTestFiles(config)
+
+	_, logout := loginResponseUser()
+	defer logout()
+
+	server := httptest.NewServer(&sessionHandler{handleSaveResponse})
+	defer server.Close()
+
+	client := newNonRedirectClient()
+
+	t.Run("personalResponse", func(t *testing.T) {
+		resetResponses()
+
+		resp, err := client.PostForm(server.URL, url.Values{
+			"title": {"Greeting"},
+			"text":  {"Dear {{.Customer}}"},
+		})
+		if err == nil {
+			resp.Body.Close()
+		}
+
+		assert.NoError(t, err, "An unexpected error occurred")
+		assert.Equal(t, http.StatusMovedPermanently, resp.StatusCode, "Status code did not match 301")
+		assert.Len(t, globals.Responses, 1, "response should be saved")
+		for _, response := range globals.Responses {
+			assert.Equal(t, "responseuser", response.Owner, "response should be personal")
+		}
+		assert.FileExists(t, config.Responses, "responses file should be written")
+	})
+
+	t.Run("sharedResponse", func(t *testing.T) {
+		resetResponses()
+
+		resp, err := client.PostForm(server.URL, url.Values{
+			"title":  {"Greeting"},
+			"text":   {"Dear {{.Customer}}"},
+			"shared": {"on"},
+		})
+		if err == nil {
+			resp.Body.Close()
+		}
+
+		assert.NoError(t, err, "An unexpected error occurred")
+		for _, response := range globals.Responses {
+			assert.True(t, response.IsShared(), "response should be shared")
+		}
+	})
+
+	t.Run("invalidTemplate", func(t *testing.T) {
+		resetResponses()
+
+		resp, err := client.PostForm(server.URL, url.Values{
+			"title": {"Broken"},
+			"text":  {"Dear {{.Unknown}}"},
+		})
+		if err == nil {
+			resp.Body.Close()
+		}
+
+		assert.NoError(t, err, "An unexpected error occurred")
+		assert.Empty(t, globals.Responses, "invalid response should not be saved")
+	})
+
+	t.Run("internalData", func(t *testing.T) {
+		resetResponses()
+
+		resp, err := client.PostForm(server.URL, url.Values{
+			"title": {"Leak"},
+			"text":  {"{{.User.Hash}} {{range .Entries}}{{.Text}}{{end}}"},
+		})
+		if err == nil {
+			resp.Body.Close()
+		}
+
+		assert.NoError(t, err, "An unexpected error occurred")
+		assert.Empty(t, globals.Responses, "response referring to internal data should not be saved")
+	})
+}
+
+func TestHandleDeleteResponse(t *testing.T) {
+	testlog.BeginTest()
+	defer testlog.EndTest()
+
+	defer resetConfig()
+	defer resetResponses()
+
+	config := testServerConfig()
+	defer cleanupTestFiles(config)
+
+	_, logout := loginResponseUser()
+	defer logout()
+
+	globals.Responses["own"] = structs.CannedResponse{ID: "own", Title: "Own", Owner: "responseuser"}
+	globals.Responses["foreign"] = structs.CannedResponse{ID: "foreign", Title: "Foreign", Owner: "someone"}
+
+	server := httptest.NewServer(&sessionHandler{handleDeleteResponse})
+	defer server.Close()
+
+	client := newNonRedirectClient()
+
+	t.Run("foreignResponse", func(t *testing.T) {
+		resp, err := client.PostForm(server.URL, url.Values{"response": {"foreign"}})
+		if err == nil {
+			resp.Body.Close()
+		}
+
+		assert.NoError(t, err, "An unexpected error occurred")
+		assert.Contains(t, globals.Responses, "foreign", "foreign response should not be deleted")
+	})
+
+	t.Run("ownResponse", func(t *testing.T) {
+		resp, err := client.PostForm(server.URL, url.Values{"response": {"own"}})
+		if err == nil {
+			resp.Body.Close()
+		}
+
+		assert.NoError(t, err, "An unexpected error occurred")
+		assert.NotContains(t, globals.Responses, "own", "own response should be deleted")
+	})
+}
+
+func TestHandleSaveMacro(t *testing.T) {
+	testlog.BeginTest()
+	defer testlog.EndTest()
+
+	defer resetConfig()
+	defer resetResponses()
+
+	config := testServerConfig()
+	defer cleanupTestFiles(config)
+
+	_, logout := loginResponseUser()
+	defer logout()
+
+	server := httptest.NewServer(&sessionHandler{handleSaveMacro})
+	defer server.Close()
+
+	client := newNonRedirectClient()
+
+	t.Run("validMacro", func(t *testing.T) {
+		resetResponses()
+
+		resp, err := client.PostForm(server.URL, url.Values{
+			"title":      {"Close printer ticket"},
+			"reply":      {"Dear {{.Customer}}, the printer works again."},
+			"reply_type": {"external"},
+			"status":     {"2"},
+			"tags":       {"printer, solved"},
+			"assign":     {"@me"},
+		})
+		if err == nil {
+			resp.Body.Close()
+		}
+
+		assert.NoError(t, err, "An unexpected error occurred")
+		assert.Len(t, globals.Macros, 1, "macro should be saved")
+		for _, macro := range globals.Macros {
+			assert.True(t, macro.ChangeStatus, "macro should change the status")
+			assert.Equal(t, structs.StatusClosed, macro.Status)
+			assert.Equal(t, []string{"printer", "solved"}, macro.Tags)
+			assert.Equal(t, structs.MacroAssignSelf, macro.AssignTo)
+		}
+	})
+
+	t.Run("unknownUser", func(t *testing.T) {
+		resetResponses()
+
+		resp, err := client.PostForm(server.URL, url.Values{
+			"title":  {"Assign"},
+			"assign": {"unknown"},
+		})
+		if err == nil {
+			resp.Body.Close()
+		}
+
+		assert.NoError(t, err, "An unexpected error occurred")
+		assert.Empty(t, globals.Macros, "macro with unknown user should not be saved")
+	})
+
+	t.Run("agentAssignsOther", func(t *testing.T) {
+		resetResponses()
+
+		globals.Users["otheruser"] = structs.User{ID: "other1", Username: "otheruser"}
+		defer delete(globals.Users, "otheruser")
+
+		resp, err := client.PostForm(server.URL, url.Values{
+			"title":  {"Hand over"},
+			"assign": {"otheruser"},
+		})
+		if err == nil {
+			resp.Body.Close()
+		}
+
+		assert.NoError(t, err, "An unexpected error occurred")
+		assert.Empty(t, globals.Macros, "agents should not save macros assigning other users")
+	})
+
+	t.Run("invalidStatus", func(t *testing.T) {
+		resetResponses()
+
+		resp, err := client.PostForm(server.URL, url.Values{
+			"title":  {"Status"},
+			"status": {"5"},
+		})
+		if err == nil {
+			resp.Body.Close()
+		}
+
+		assert.NoError(t, err, "An unexpected error occurred")
+		assert.Empty(t, globals.Macros, "macro with invalid status should not be saved")
+	})
+}
+
+func TestHandleApplyMacro(t *testing.T) {
+	testlog.BeginTest()
+	defer testlog.EndTest()
+
+	defer resetConfig()
+	defer resetResponses()
+
+	config := testServerConfig()
+	defer cleanupTestFiles(config)
+
+	_, logout := loginResponseUser()
+	defer logout()
+
+	globals.Tickets["macro123"] = structs.Ticket{
+		ID:       "macro123",
+		Subject:  "Printer broken",
+		Customer: "customer@mail.com",
+		Status:   structs.StatusOpen,
+	}
+	defer delete(globals.Tickets, "macro123")
+
+	globals.Macros["take"] = structs.Macro{
+		ID:        "take",
+		Title:     "Take ticket",
+		Reply:     "Dear {{.Customer}}, we are working on ticket {{.ID}}.",
+		ReplyType: "external",
+		Tags:      []string{"printer"},
+		AssignTo:  structs.MacroAssignSelf,
+	}
+	globals.Macros["foreign"] = structs.Macro{ID: "foreign", Title: "Foreign", Owner: "someone", AssignTo: "@me"}
+
+	server := httptest.NewServer(&sessionHandler{handleApplyMacro})
+	defer server.Close()
+
+	client := newNonRedirectClient()
+
+	t.Run("foreignMacro", func(t *testing.T) {
+		resp, err := client.PostForm(server.URL, url.Values{"ticket": {"macro123"}, "macro": {"foreign"}})
+		if err == nil {
+			resp.Body.Close()
+		}
+
+		assert.NoError(t, err, "An unexpected error occurred")
+		assert.Empty(t, globals.Tickets["macro123"].User.ID, "foreign macro should not be applied")
+	})
+
+	t.Run("validMacro", func(t *testing.T) {
+		resp, err := client.PostForm(server.URL, url.Values{"ticket": {"macro123"}, "macro": {"take"}})
+		if err == nil {
+			resp.Body.Close()
+		}
+
+		updatedTicket := globals.Tickets["macro123"]
+
+		assert.NoError(t, err, "An unexpected error occurred")
+		assert.Equal(t, http.StatusMovedPermanently, resp.StatusCode, "Status code did not match 301")
+		assert.Equal(t, "/ticket?id=macro123", resp.Header.Get("Location"), "should redirect to the ticket")
+		assert.Equal(t, "responseuser", updatedTicket.User.Username, "ticket should be assigned")
+		assert.Equal(t, structs.StatusInProgress, updatedTicket.Status, "ticket should be in progress")
+		assert.Equal(t, []string{"printer"}, updatedTicket.Tags, "tag should be added")
+		if assert.Len(t, updatedTicket.Entries, 1, "reply should be added") {
+			assert.Equal(t, "Dear customer@mail.com, we are working on ticket macro123.", updatedTicket.Entries[0].Text)
+		}
+	})
+
+	t.Run("agentAssignsOther", func(t *testing.T) {
+		globals.Users["otheruser"] = structs.User{ID: "other1", Username: "otheruser"}
+		defer delete(globals.Users, "otheruser")
+
+		globals.Tickets["other123"] = structs.Ticket{ID: "other123", Customer: "customer@mail.com"}
+		defer delete(globals.Tickets, "other123")
+
+		globals.Macros["handover"] = structs.Macro{ID: "handover", Title: "Hand over", AssignTo: "otheruser"}
+
+		resp, err := client.PostForm(server.URL, url.Values{"ticket": {"other123"}, "macro": {"handover"}})
+		if err == nil {
+			resp.Body.Close()
+		}
+
+		assert.NoError(t, err, "An unexpected error occurred")
+		assert.Empty(t, globals.Tickets["other123"].User.ID, "agents should not assign tickets to other users")
+	})
+
+	t.Run("unknownTicket", func(t *testing.T) {
+		resp, err := client.PostForm(server.URL, url.Values{"ticket": {"unknown"}, "macro": {"take"}})
+		if err == nil {
+			resp.Body.Close()
+		}
+
+		assert.NoError(t, err, "An unexpected error occurred")
+		assert.Equal(t, indexURL, resp.Header.Get("Location"), "should redirect to the index")
+	})
+}
+
+func TestHandleTicketWithResponses(t *testing.T) {
+	testlog.BeginTest()
+	defer testlog.EndTest()
+
+	defer resetConfig()
+	defer resetResponses()
+
+	config := testServerConfig()
+	defer cleanupTestFiles(config)
+
+	tmpl = getTemplates(defaults.TestWebTrimmed)
+
+	_, logout := loginResponseUser()
+	defer logout()
+
+	globals.Tickets["resp123"] = structs.Ticket{ID: "resp123", Customer: "customer@mail.com"}
+	defer delete(globals.Tickets, "resp123")
+
+	globals.Responses["greeting"] = structs.CannedResponse{ID: "greeting", Title: "Greeting", Text: "Dear {{.Customer}}"}
+	globals.Macros["close"] = structs.Macro{ID: "close", Title: "Close", ChangeStatus: true, Status: structs.StatusClosed}
+
+	server := httptest.NewServer(&sessionHandler{handleTicket})
+	defer server.Close()
+
+	client := newNonRedirectClient()
+	resp, err := client.Get(server.URL + "/ticket?id=resp123")
+	if !assert.NoError(t, err, "An unexpected error occurred") {
+		return
+	}
+	defer resp.Body.Close()
+
+	body, _ := ioutil.ReadAll(resp.Body)
+
+	assert.Equal(t, http.StatusOK, resp.StatusCode, "The http status is not 200")
+	assert.Contains(t, string(body), "Dear customer@mail.com", "canned response should be rendered for the ticket")
+	assert.Contains(t, string(body), "Apply Macro", "macros should be offered")
+}
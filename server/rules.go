@@ -0,0 +1,208 @@
+// Trivial Tickets Ticketsystem
+// Copyright (C) 2019 The Contributors
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+// Package server implements the web server including
+// shutdown routines and the associated handlers for
+// web requests.
+package server
+
+import (
+	"encoding/json"
+	"html/template"
+	"net/http"
+	"time"
+
+	"github.com/mortenterhart/trivial-tickets/globals"
+	"github.com/mortenterhart/trivial-tickets/rules"
+	"github.com/mortenterhart/trivial-tickets/session"
+	"github.com/mortenterhart/trivial-tickets/structs"
+	"github.com/mortenterhart/trivial-tickets/util/httptools"
+)
+
+/*
+ * Ticketsystem Trivial Tickets
+ *
+ * Matriculation numbers: 3040018, 6694964, 3478222
+ * Lecture:               Programmieren II, INF16B
+ * Lecturer:              Herr Prof. Dr. Helmut Neemann
+ * Institute:             Duale Hochschule Baden-Württemberg Mosbach
+ *
+ * ---------------
+ *
+ * Package server
+ * Dry runs of the automation rules
+ */
+
+// dryRunResult describes a rule which fired in a dry run
+// and the fields of the ticket the rule would change.
+type dryRunResult struct {
+	Rule    string        `json:"rule"`
+	Changes dryRunChanges `json:"changes"`
+}
+
+// dryRunChanges holds the changes of a single rule. Fields
+// which the rule leaves unchanged are omitted.
+type dryRunChanges struct {
+	Tags       []string `json:"tags,omitempty"`
+	Assignee   string   `json:"assignee,omitempty"`
+	Unassigned bool     `json:"unassigned,omitempty"`
+	Status     string   `json:"status,omitempty"`
+	Priority   string   `json:"priority,omitempty"`
+	Notes      []string `json:"notes,omitempty"`
+}
+
+// handleRulesDryRun evaluates the automation rules on the
+// event given in the form value "event" (default "created")
+// without changing any ticket. The rules are evaluated on
+// the ticket given in the form value "ticket" or on a sample
+// ticket made of the form values "customer", "subject" and
+// "message". Instead of the configured rules, the rules
+// given as JSON in the form value "rules" can be tested
+// before they are put into the rules file. The ids of the
+// fired rules and the fields they would change are returned
+// as JSON. Only supervisors may run the rules.
+func handleRulesDryRun(w http.ResponseWriter, r *http.Request) {
+
+	// Get session id
+	sessionID := session.GetSessionID(r)
+	currentSession := globals.Sessions[sessionID].Session
+
+	// Only react on POST requests of logged in users
+	if r.Method != postMethod || !currentSession.IsLoggedIn {
+		http.Redirect(w, r, indexURL, http.StatusMovedPermanently)
+		return
+	}
+
+	// Check the current role of the user
+	currentUser, userExists := globals.Users[currentSession.User.Username]
+	if !userExists {
+		currentUser = currentSession.User
+	}
+
+	if !currentUser.IsSupervisor() {
+		httptools.StatusCodeError(w, "only supervisors may test the automation rules", http.StatusForbidden)
+		return
+	}
+
+	event := r.FormValue("event")
+	if event == "" {
+		event = rules.EventCreated
+	}
+
+	if event != rules.EventCreated && event != rules.EventReply && event != rules.EventUpdated {
+		httptools.StatusCodeError(w, "event '"+template.HTMLEscapeString(event)+"' not defined", http.StatusBadRequest)
+		return
+	}
+
+	testRules := globals.Rules
+	if ruleJSON := r.FormValue("rules"); ruleJSON != "" {
+		testRules = nil
+		if unmarshalErr := json.Unmarshal([]byte(ruleJSON), &testRules); unmarshalErr != nil {
+			httptools.StatusCodeError(w, "unable to decode rules: "+unmarshalErr.Error(), http.StatusBadRequest)
+			return
+		}
+
+		if validateErr := rules.Validate(testRules); validateErr != nil {
+			httptools.StatusCodeError(w, validateErr.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	testTicket, ticketExists := dryRunTicket(r)
+	if !ticketExists {
+		httptools.StatusCodeError(w, "ticket '"+template.HTMLEscapeString(r.FormValue("ticket"))+"' does not exist",
+			http.StatusBadRequest)
+		return
+	}
+
+	// Evaluate the rules one by one to tell the changes of
+	// each rule apart. Later rules see the changes of earlier
+	// ones like in rules.Evaluate.
+	now := time.Now()
+	results := []dryRunResult{}
+	for _, rule := range testRules {
+		resultTicket, fired := rules.Evaluate([]structs.Rule{rule}, event, testTicket, globals.Users, now)
+		if len(fired) == 0 {
+			continue
+		}
+
+		results = append(results, dryRunResult{
+			Rule:    rule.ID,
+			Changes: ruleChanges(testTicket, resultTicket),
+		})
+		testTicket = resultTicket
+	}
+
+	httptools.JSONResponse(w, structs.JSONMap{
+		"event": event,
+		"fired": results,
+	})
+}
+
+// ruleChanges compares the ticket before and after a rule
+// was applied and collects the changed fields.
+func ruleChanges(before structs.Ticket, after structs.Ticket) dryRunChanges {
+	var changes dryRunChanges
+
+	// Rules only append tags and entries
+	changes.Tags = after.Tags[len(before.Tags):]
+
+	if after.User.ID != before.User.ID {
+		if after.User.ID == "" {
+			changes.Unassigned = true
+		} else {
+			changes.Assignee = after.User.Username
+		}
+	}
+
+	if after.Status != before.Status {
+		changes.Status = after.Status.String()
+	}
+
+	if after.Priority != before.Priority {
+		changes.Priority = after.Priority.String()
+	}
+
+	for _, entry := range after.Entries[len(before.Entries):] {
+		changes.Notes = append(changes.Notes, entry.Text)
+	}
+
+	return changes
+}
+
+// dryRunTicket returns the ticket for a dry run. The second
+// return value is false if the requested ticket does not
+// exist.
+func dryRunTicket(r *http.Request) (structs.Ticket, bool) {
+	if ticketID := r.FormValue("ticket"); ticketID != "" {
+		storedTicket, exists := globals.Tickets[ticketID]
+		return storedTicket, exists
+	}
+
+	customer := template.HTMLEscapeString(r.FormValue("customer"))
+
+	return structs.Ticket{
+		ID:       "dry-run",
+		Subject:  template.HTMLEscapeString(r.FormValue("subject")),
+		Customer: customer,
+		Entries: []structs.Entry{{
+			Date:      time.Now(),
+			User:      customer,
+			Text:      template.HTMLEscapeString(r.FormValue("message")),
+			ReplyType: structs.ReplyExternal,
+		}},
+	}, true
+}
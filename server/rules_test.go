@@ -0,0 +1,232 @@
+// Trivial Tickets Ticketsystem
+// Copyright (C) 2019 The Contributors
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+// Package server implements the web server including
+// shutdown routines and the associated handlers for
+// web requests.
+package server
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mortenterhart/trivial-tickets/globals"
+	"github.com/mortenterhart/trivial-tickets/log/testlog"
+	"github.com/mortenterhart/trivial-tickets/structs"
+)
+
+/*
+ * Ticketsystem Trivial Tickets
+ *
+ * Matriculation numbers: 3040018, 6694964, 3478222
+ * Lecture:               Programmieren II, INF16B
+ * Lecturer:              Herr Prof. Dr. Helmut Neemann
+ * Institute:             Duale Hochschule Baden-Württemberg Mosbach
+ *
+ * ---------------
+ *
+ * Package server
+ * Dry runs of the automation rules
+ */
+
+// dryRunResponse is the JSON response of a dry run.
+type dryRunResponse struct {
+	Event string         `json:"event"`
+	Fired []dryRunResult `json:"fired"`
+	body  string
+}
+
+// mockRules configures a rule which tags tickets about
+// invoices and returns a function removing it again.
+func mockRules() func() {
+	globals.Rules = []structs.Rule{{
+		ID:         "billing",
+		Title:      "Billing",
+		Conditions: []structs.RuleCondition{{Field: "subject", Operator: "contains", Value: "invoice"}},
+		Actions:    []structs.RuleAction{{Type: "tag", Value: "billing"}},
+	}}
+
+	return func() {
+		globals.Rules = nil
+	}
+}
+
+// postDryRun posts the form values to the server and decodes
+// the JSON response.
+func postDryRun(t *testing.T, client *http.Client, serverURL string, form url.Values) (int, dryRunResponse) {
+	var response dryRunResponse
+
+	resp, err := client.PostForm(serverURL, form)
+	if !assert.NoError(t, err, "An unexpected error occurred") {
+		return 0, response
+	}
+	defer resp.Body.Close()
+
+	body, _ := ioutil.ReadAll(resp.Body)
+	json.Unmarshal(body, &response)
+	response.body = string(body)
+
+	return resp.StatusCode, response
+}
+
+func TestHandleRulesDryRun(t *testing.T) {
+	testlog.BeginTest()
+	defer testlog.EndTest()
+
+	defer resetConfig()
+
+	config := testServerConfig()
+	defer cleanupTestFiles(config)
+
+	user, logout := loginResponseUser()
+	defer logout()
+
+	supervisor := user
+	supervisor.Role = structs.RoleSupervisor
+	globals.Users[user.Username] = supervisor
+
+	defer mockEntryTicket(user, true)()
+	defer mockRules()()
+
+	server := httptest.NewServer(&sessionHandler{handleRulesDryRun})
+	defer server.Close()
+
+	client := newNonRedirectClient()
+
+	t.Run("sampleTicket", func(t *testing.T) {
+		status, response := postDryRun(t, client, server.URL, url.Values{
+			"customer": {"jane@example.com"},
+			"subject":  {"Your invoice"},
+			"message":  {"It is wrong"},
+		})
+
+		assert.Equal(t, http.StatusOK, status, "Status code did not match 200")
+		assert.Equal(t, "created", response.Event, "created should be the default event")
+		if assert.Len(t, response.Fired, 1, "billing rule should fire") {
+			assert.Equal(t, "billing", response.Fired[0].Rule)
+			assert.Equal(t, []string{"billing"}, response.Fired[0].Changes.Tags, "resulting ticket should be tagged")
+		}
+	})
+
+	t.Run("storedTicket", func(t *testing.T) {
+		status, response := postDryRun(t, client, server.URL, url.Values{
+			"ticket": {"entry123"},
+			"event":  {"updated"},
+			"rules": {`[{"id": "secret", "title": "Secrets",
+				"conditions": [{"field": "message", "operator": "contains", "value": "thank"}],
+				"actions": [{"type": "priority", "value": "high"}]}]`},
+		})
+
+		assert.Equal(t, http.StatusOK, status, "Status code did not match 200")
+		if assert.Len(t, response.Fired, 1) {
+			assert.Equal(t, "secret", response.Fired[0].Rule, "given rules should be tested")
+			assert.Equal(t, "high", response.Fired[0].Changes.Priority)
+			assert.Empty(t, response.Fired[0].Changes.Tags, "unchanged fields should be omitted")
+		}
+		assert.Equal(t, structs.PriorityNormal, globals.Tickets["entry123"].Priority, "stored ticket should not change")
+	})
+
+	t.Run("onlyChanges", func(t *testing.T) {
+		status, response := postDryRun(t, client, server.URL, url.Values{
+			"ticket": {"entry123"},
+			"rules": {`[{"id": "assign", "title": "Assign",
+				"actions": [{"type": "assign", "value": "responseuser"}, {"type": "note", "value": "Assigned"}]}]`},
+		})
+
+		assert.Equal(t, http.StatusOK, status, "Status code did not match 200")
+		if assert.Len(t, response.Fired, 1) {
+			assert.Equal(t, []string{"Assigned"}, response.Fired[0].Changes.Notes)
+		}
+		assert.NotContains(t, response.body, "entrytoken", "the access token should not be returned")
+		assert.NotContains(t, response.body, "hash", "the password hash should not be returned")
+		assert.NotContains(t, response.body, "entries", "the ticket should not be returned")
+	})
+
+	t.Run("agent", func(t *testing.T) {
+		globals.Users[user.Username] = user
+		defer func() {
+			globals.Users[user.Username] = supervisor
+		}()
+
+		status, _ := postDryRun(t, client, server.URL, url.Values{"ticket": {"entry123"}})
+
+		assert.Equal(t, http.StatusForbidden, status, "only supervisors should run the rules")
+	})
+
+	t.Run("invalidRules", func(t *testing.T) {
+		status, _ := postDryRun(t, client, server.URL, url.Values{
+			"ticket": {"entry123"},
+			"rules":  {`[{"id": "broken", "actions": [{"type": "explode"}]}]`},
+		})
+
+		assert.Equal(t, http.StatusBadRequest, status, "Status code did not match 400")
+	})
+
+	t.Run("unknownTicket", func(t *testing.T) {
+		status, _ := postDryRun(t, client, server.URL, url.Values{"ticket": {"unknown"}})
+
+		assert.Equal(t, http.StatusBadRequest, status, "Status code did not match 400")
+	})
+
+	t.Run("notLoggedIn", func(t *testing.T) {
+		logout()
+
+		status, _ := postDryRun(t, client, server.URL, url.Values{"ticket": {"entry123"}})
+
+		assert.Equal(t, http.StatusMovedPermanently, status, "Status code did not match 301")
+	})
+}
+
+func TestCreateTicketAppliesRules(t *testing.T) {
+	testlog.BeginTest()
+	defer testlog.EndTest()
+
+	defer resetConfig()
+
+	config := testServerConfig()
+	defer cleanupTestFiles(config)
+
+	defer mockRules()()
+
+	server := httptest.NewServer(&createTicketHandler{})
+	defer server.Close()
+
+	client := newNonRedirectClient()
+	resp, err := client.PostForm(server.URL, url.Values{
+		"mail":    {"jane@example.com"},
+		"subject": {"Invoice 2019-001"},
+		"text":    {"The amount is wrong"},
+	})
+	if err == nil {
+		resp.Body.Close()
+	}
+
+	assert.NoError(t, err, "An unexpected error occurred")
+
+	location, _ := url.Parse(resp.Header.Get("Location"))
+	ticketID := location.Query().Get(idParameter)
+	defer delete(globals.Tickets, ticketID)
+
+	createdTicket := globals.Tickets[ticketID]
+	assert.Equal(t, []string{"billing"}, createdTicket.Tags, "rule should tag the new ticket")
+	assert.Len(t, createdTicket.FiredRules, 1, "fired rule should be logged on the ticket")
+}
@@ -35,6 +35,11 @@ import (
 	"github.com/mortenterhart/trivial-tickets/api/api_out"
 	"github.com/mortenterhart/trivial-tickets/globals"
 	"github.com/mortenterhart/trivial-tickets/log"
+	"github.com/mortenterhart/trivial-tickets/mail_delivery"
+	"github.com/mortenterhart/trivial-tickets/mail_events"
+	"github.com/mortenterhart/trivial-tickets/mail_inbound"
+	"github.com/mortenterhart/trivial-tickets/mail_poller"
+	"github.com/mortenterhart/trivial-tickets/rules"
 	"github.com/mortenterhart/trivial-tickets/structs"
 	"github.com/mortenterhart/trivial-tickets/structs/defaults"
 	"github.com/mortenterhart/trivial-tickets/util/filehandler"
@@ -58,9 +63,6 @@ import (
 // the templates once on startup, instead of on every GET - request to index.
 var tmpl *template.Template
 
-// Holds all the users
-var users = make(map[string]structs.User)
-
 // interrupt is the channel which receives potential
 // interrupt or kill signals in order to shutdown
 // the server. This variable is needed to provide
@@ -93,22 +95,56 @@ func StartServer(config *structs.ServerConfig) (defaults.ExitCode, error) {
 
 	// Read the users file
 	log.Info("Reading users file", config.Users)
-	if errReadUserFile := filehandler.ReadUserFile(config.Users, &users); errReadUserFile != nil {
+	if errReadUserFile := filehandler.ReadUserFile(config.Users, &globals.Users); errReadUserFile != nil {
 		return defaults.ExitStartError, errors.Wrap(errReadUserFile, "unable to load user file")
 	}
 
+	// Read the canned responses and macros
+	log.Info("Reading responses file", config.Responses)
+	if errReadResponseFile := filehandler.ReadResponseFile(config.Responses, &globals.Responses, &globals.Macros); errReadResponseFile != nil {
+		return defaults.ExitStartError, errors.Wrap(errReadResponseFile, "unable to load responses file")
+	}
+
 	// Read the tickets
 	log.Info("Reading ticket files in", config.Tickets)
 	if errReadTicketFiles := filehandler.ReadTicketFiles(config.Tickets, &globals.Tickets); errReadTicketFiles != nil {
 		return defaults.ExitStartError, errors.Wrap(errReadTicketFiles, "unable to load ticket files")
 	}
 
+	// Read the customer directory
+	log.Info("Reading customers file", config.Customers)
+	if errReadCustomerFile := filehandler.ReadCustomerFile(config.Customers, &globals.Customers); errReadCustomerFile != nil {
+		return defaults.ExitStartError, errors.Wrap(errReadCustomerFile, "unable to load customers file")
+	}
+
+	// Read the sequence of the ticket numbers
+	log.Info("Reading sequence file", config.Sequence)
+	if errReadSequenceFile := filehandler.ReadSequenceFile(config.Sequence, &globals.TicketSequence); errReadSequenceFile != nil {
+		return defaults.ExitStartError, errors.Wrap(errReadSequenceFile, "unable to load ticket sequence")
+	}
+
+	// Read and check the automation rules
+	log.Info("Reading rules file", config.Rules)
+	if errReadRuleFile := filehandler.ReadRuleFile(config.Rules, &globals.Rules); errReadRuleFile != nil {
+		return defaults.ExitStartError, errors.Wrap(errReadRuleFile, "unable to load rules file")
+	}
+
+	if errValidateRules := rules.Validate(globals.Rules); errValidateRules != nil {
+		return defaults.ExitStartError, errors.Wrap(errValidateRules, "invalid automation rules")
+	}
+
 	// Read the mails
 	log.Info("Reading mail files in", config.Mails)
 	if errReadMailFiles := filehandler.ReadMailFiles(config.Mails, &globals.Mails); errReadMailFiles != nil {
 		return defaults.ExitStartError, errors.Wrap(errReadMailFiles, "unable to load mail files")
 	}
 
+	// Read and check the mail templates
+	log.Info("Loading mail templates in", config.MailTemplates)
+	if errLoadMailTemplates := mail_events.LoadTemplates(config.MailTemplates, config.MailLanguage); errLoadMailTemplates != nil {
+		return defaults.ExitStartError, errors.Wrap(errLoadMailTemplates, "unable to load mail templates")
+	}
+
 	// Read the HTML templates
 	log.Info("Loading HTML templates in", config.Web)
 	if tmpl = getTemplates(config.Web); tmpl == nil {
@@ -134,9 +170,45 @@ func StartServer(config *structs.ServerConfig) (defaults.ExitCode, error) {
 	interrupt = notifyOnInterruptSignal()
 	startError := make(chan error)
 
+	// Start the background jobs such as the holiday schedules
+	log.Info("Starting background jobs")
+	stopJobs := startBackgroundJobs()
+	defer close(stopJobs)
+
+	// Deliver the outgoing mails if an SMTP relay is configured
+	if config.SMTPRelay != "" {
+		log.Info("Starting mail delivery to SMTP relay", config.SMTPRelay)
+		stopDelivery := mail_delivery.NewWorker(mail_delivery.NewSender(config)).Start()
+		defer close(stopDelivery)
+	}
+
+	// Receive incoming mails if the SMTP server is enabled
+	if config.SMTPListen != "" {
+		inbound, listenErr := mail_inbound.Listen(config)
+		if listenErr != nil {
+			return defaults.ExitStartError, errors.Wrap(listenErr, "unable to start SMTP server")
+		}
+
+		log.Info("SMTP server listening on", inbound.Addr())
+		go inbound.Serve()
+		defer inbound.Close()
+	}
+
+	// Poll the mailbox for incoming mails if one is configured
+	if config.Mailbox != "" {
+		poller, pollerErr := mail_poller.NewPoller(config)
+		if pollerErr != nil {
+			return defaults.ExitStartError, errors.Wrap(pollerErr, "unable to poll mailbox")
+		}
+
+		log.Info("Starting to poll mailbox", mail_poller.RedactMailboxURL(config.Mailbox))
+		stopPolling := poller.Start()
+		defer close(stopPolling)
+	}
+
 	server := http.Server{
 		Addr:     fmt.Sprintf("localhost:%d", config.Port),
-		Handler:  handler,
+		Handler:  synchronized(handler),
 		ErrorLog: log.NewErrorLogger(),
 	}
 
@@ -284,8 +356,31 @@ func registerHandlers(rootDirectory string) (*http.ServeMux, error) {
 	mainHandler.HandleFunc("/logout", handleLogout)
 	mainHandler.HandleFunc("/createTicket", handleCreateTicket)
 	mainHandler.HandleFunc("/holiday", handleHoliday)
+	mainHandler.HandleFunc("/scheduleHoliday", handleScheduleHoliday)
+	mainHandler.HandleFunc("/cancelHoliday", handleCancelHoliday)
+	mainHandler.HandleFunc("/saveNotifications", handleSaveNotifications)
+	mainHandler.HandleFunc("/saveResponse", handleSaveResponse)
+	mainHandler.HandleFunc("/deleteResponse", handleDeleteResponse)
+	mainHandler.HandleFunc("/saveMacro", handleSaveMacro)
+	mainHandler.HandleFunc("/deleteMacro", handleDeleteMacro)
+	mainHandler.HandleFunc("/applyMacro", handleApplyMacro)
 	mainHandler.HandleFunc("/ticket", handleTicket)
 	mainHandler.HandleFunc("/updateTicket", handleUpdateTicket)
+	mainHandler.HandleFunc("/editEntry", handleEditEntry)
+	mainHandler.HandleFunc("/redactEntry", handleRedactEntry)
+	mainHandler.HandleFunc("/attachment", handleAttachment)
+	mainHandler.HandleFunc("/logTime", handleLogTime)
+	mainHandler.HandleFunc("/snoozeTicket", handleSnoozeTicket)
+	mainHandler.HandleFunc("/report", handleReport)
+	mainHandler.HandleFunc("/report.csv", handleReportCSV)
+	mainHandler.HandleFunc("/csat.csv", handleSatisfactionCSV)
+	mainHandler.HandleFunc(rateURL, handleRate)
+	mainHandler.HandleFunc("/resolveDuplicate", handleResolveDuplicate)
+	mainHandler.HandleFunc("/bulkAction", handleBulkAction)
+	mainHandler.HandleFunc("/rules/dryRun", handleRulesDryRun)
+	mainHandler.HandleFunc(customersURL, handleCustomers)
+	mainHandler.HandleFunc("/customer", handleCustomer)
+	mainHandler.HandleFunc("/saveCustomer", handleSaveCustomer)
 	mainHandler.HandleFunc("/unassignTicket", handleUnassignTicket)
 	mainHandler.HandleFunc("/assignTicket", handleAssignTicket)
 	mainHandler.HandleFunc("/api/receive", api_in.ReceiveMail)
@@ -331,4 +426,30 @@ func logServerConfig(config *structs.ServerConfig) {
 	log.Info("  Cert:", config.Cert)
 	log.Info("  Key:", config.Key)
 	log.Info("  Web:", config.Web)
+	log.Info("  Responses:", config.Responses)
+	log.Info("  Customers:", config.Customers)
+	log.Info("  Sequence:", config.Sequence)
+	log.Info("  Rules:", config.Rules)
+	log.Info("  Attachments:", config.Attachments)
+	log.Info("  Assign:", config.AssignStrategy)
+	log.Info("  Holiday tickets:", config.HolidayPolicy)
+	log.Info("  Stale reminder days:", config.StaleReminderDays)
+	log.Info("  Stale close days:", config.StaleCloseDays)
+	log.Info("  Duplicates:", config.DuplicatePolicy)
+	log.Info("  Duplicate window hours:", config.DuplicateWindowHours)
+	log.Info("  Ticket prefix:", config.TicketPrefix)
+	log.Info("  Mail templates:", config.MailTemplates)
+	log.Info("  Mail language:", config.MailLanguage)
+	log.Info("  SLA hours:", config.SLAHours)
+	log.Info("  Daily digest:", config.DailyDigest)
+	log.Info("  SMTP relay:", config.SMTPRelay)
+	log.Info("  SMTP user:", config.SMTPUser)
+	log.Info("  SMTP STARTTLS:", config.SMTPStartTLS)
+	log.Info("  SMTP listen:", config.SMTPListen)
+	log.Info("  Support addresses:", config.SupportAddresses)
+	log.Info("  Max mail size:", config.MaxMailSize)
+	log.Info("  Mailbox:", mail_poller.RedactMailboxURL(config.Mailbox))
+	log.Info("  Mailbox folder:", config.MailboxFolder)
+	log.Info("  Mailbox interval:", config.MailboxInterval)
+	log.Info("  Mail rate limit:", config.MailRateLimit)
 }
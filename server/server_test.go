@@ -76,6 +76,9 @@ func mockConfig() structs.ServerConfig {
 		Cert:    defaults.TestCertificateTrimmed,
 		Key:     defaults.TestKeyTrimmed,
 		Web:     defaults.TestWebTrimmed,
+
+		MailTemplates: defaults.TestMailTmplTrimmed,
+		MailLanguage:  defaults.ServerMailLang,
 	}
 }
 
@@ -154,8 +157,31 @@ func TestRegisterHandlers(t *testing.T) {
 	testHandlerRegistered(t, mux, "/logout")
 	testHandlerRegistered(t, mux, "/createTicket")
 	testHandlerRegistered(t, mux, "/holiday")
+	testHandlerRegistered(t, mux, "/scheduleHoliday")
+	testHandlerRegistered(t, mux, "/cancelHoliday")
+	testHandlerRegistered(t, mux, "/saveNotifications")
+	testHandlerRegistered(t, mux, "/saveResponse")
+	testHandlerRegistered(t, mux, "/deleteResponse")
+	testHandlerRegistered(t, mux, "/saveMacro")
+	testHandlerRegistered(t, mux, "/deleteMacro")
+	testHandlerRegistered(t, mux, "/applyMacro")
 	testHandlerRegistered(t, mux, "/ticket")
 	testHandlerRegistered(t, mux, "/updateTicket")
+	testHandlerRegistered(t, mux, "/editEntry")
+	testHandlerRegistered(t, mux, "/redactEntry")
+	testHandlerRegistered(t, mux, "/attachment")
+	testHandlerRegistered(t, mux, "/logTime")
+	testHandlerRegistered(t, mux, "/snoozeTicket")
+	testHandlerRegistered(t, mux, "/report")
+	testHandlerRegistered(t, mux, "/report.csv")
+	testHandlerRegistered(t, mux, "/csat.csv")
+	testHandlerRegistered(t, mux, "/rate/")
+	testHandlerRegistered(t, mux, "/resolveDuplicate")
+	testHandlerRegistered(t, mux, "/bulkAction")
+	testHandlerRegistered(t, mux, "/rules/dryRun")
+	testHandlerRegistered(t, mux, "/customers")
+	testHandlerRegistered(t, mux, "/customer")
+	testHandlerRegistered(t, mux, "/saveCustomer")
 	testHandlerRegistered(t, mux, "/unassignTicket")
 	testHandlerRegistered(t, mux, "/assignTicket")
 	testHandlerRegistered(t, mux, "/api/receive")
@@ -235,6 +261,22 @@ func TestStartServerNoWebPath(t *testing.T) {
 	assert.Equal(t, defaults.ExitStartError, exitCode, "exit code should be 1 due to expected error")
 }
 
+// TestStartServerUnknownMailLanguage produces an error
+// to make sure the server will not start without mail
+// templates for the default mail language.
+func TestStartServerUnknownMailLanguage(t *testing.T) {
+	testlog.BeginTest()
+	defer testlog.EndTest()
+
+	config := mockConfig()
+	config.MailLanguage = "xx"
+
+	exitCode, err := StartServer(&config)
+
+	assert.NotNil(t, err, "No error was returned, although no mail templates exist for the language")
+	assert.Equal(t, defaults.ExitStartError, exitCode, "exit code should be 1 due to expected error")
+}
+
 // TestStartServerNoTicketsPath produces an error to make
 // sure the server will not start without a path to the
 // ticket folder.
@@ -0,0 +1,163 @@
+// Trivial Tickets Ticketsystem
+// Copyright (C) 2019 The Contributors
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+// Package server implements the web server including
+// shutdown routines and the associated handlers for
+// web requests.
+package server
+
+import (
+	"html/template"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/mortenterhart/trivial-tickets/api/api_out"
+	"github.com/mortenterhart/trivial-tickets/globals"
+	"github.com/mortenterhart/trivial-tickets/log"
+	"github.com/mortenterhart/trivial-tickets/mail_events"
+	"github.com/mortenterhart/trivial-tickets/session"
+	"github.com/mortenterhart/trivial-tickets/structs"
+	"github.com/mortenterhart/trivial-tickets/ticket"
+	"github.com/mortenterhart/trivial-tickets/util/filehandler"
+)
+
+/*
+ * Ticketsystem Trivial Tickets
+ *
+ * Matriculation numbers: 3040018, 6694964, 3478222
+ * Lecture:               Programmieren II, INF16B
+ * Lecturer:              Herr Prof. Dr. Helmut Neemann
+ * Institute:             Duale Hochschule Baden-Württemberg Mosbach
+ *
+ * ---------------
+ *
+ * Package server
+ * Snoozed tickets and follow-up reminders
+ */
+
+// dateTimeFormat is the format of points in time submitted
+// by datetime-local inputs of the web forms.
+const dateTimeFormat string = "2006-01-02T15:04"
+
+// handleSnoozeTicket parks the ticket given in the form value
+// "ticket" until the time given in the form value "until".
+// If the form value "type" is "followup", a follow-up is
+// scheduled instead and the ticket stays on the dashboard.
+// Without a time the snooze, the follow-up and the reminder
+// of the ticket are cleared. Only the assigned editor may
+// park a ticket.
+func handleSnoozeTicket(w http.ResponseWriter, r *http.Request) {
+
+	// Get session id
+	sessionID := session.GetSessionID(r)
+
+	// Only react on POST requests of logged in users
+	if r.Method != postMethod || !globals.Sessions[sessionID].Session.IsLoggedIn {
+		http.Redirect(w, r, indexURL, http.StatusMovedPermanently)
+		return
+	}
+
+	currentSession, _ := session.GetSession(sessionID)
+	user := currentSession.User
+
+	ticketID := template.HTMLEscapeString(r.FormValue("ticket"))
+	currentTicket, ticketExists := globals.Tickets[ticketID]
+	if !ticketExists {
+		log.Errorf("%s %s: ticket '%s' not found", r.Method, r.RequestURI, ticketID)
+		http.Redirect(w, r, indexURL, http.StatusMovedPermanently)
+		return
+	}
+
+	ticketURL := "/ticket?" + idParameter + "=" + url.QueryEscape(ticketID)
+
+	if currentTicket.User.ID != user.ID {
+		log.Errorf("%s %s: user '%s' is not assigned to ticket '%s'", r.Method, r.RequestURI,
+			user.Username, ticketID)
+		http.Redirect(w, r, ticketURL, http.StatusMovedPermanently)
+		return
+	}
+
+	var updatedTicket structs.Ticket
+	if untilValue := r.FormValue("until"); untilValue == "" {
+		log.Infof("User '%s' cleared the reminders of ticket '%s'", user.Username, ticketID)
+		updatedTicket = ticket.ClearReminders(currentTicket)
+	} else {
+		until, parseErr := parseReminderTime(untilValue)
+		if parseErr != nil {
+			log.Errorf("%s %s: %v", r.Method, r.RequestURI, parseErr)
+			http.Redirect(w, r, ticketURL, http.StatusMovedPermanently)
+			return
+		}
+
+		var snoozeErr error
+		if r.FormValue("type") == "followup" {
+			updatedTicket, snoozeErr = ticket.ScheduleFollowUp(currentTicket, until, time.Now())
+		} else {
+			updatedTicket, snoozeErr = ticket.Snooze(currentTicket, until, time.Now())
+		}
+
+		if snoozeErr != nil {
+			log.Errorf("%s %s: unable to park ticket '%s': %v", r.Method, r.RequestURI, ticketID, snoozeErr)
+			http.Redirect(w, r, ticketURL, http.StatusMovedPermanently)
+			return
+		}
+
+		log.Infof("User '%s' parked ticket '%s' until %s", user.Username, ticketID, until.Format(time.ANSIC))
+	}
+
+	globals.Tickets[ticketID] = updatedTicket
+	filehandler.WriteTicketFile(globals.ServerConfig.Tickets, &updatedTicket)
+
+	http.Redirect(w, r, indexURL, http.StatusMovedPermanently)
+}
+
+// parseReminderTime parses a point in time in local time
+// given either with date and time or only as date. A date
+// without time refers to the beginning of the day.
+func parseReminderTime(value string) (time.Time, error) {
+	if at, parseErr := time.ParseInLocation(dateTimeFormat, value, time.Local); parseErr == nil {
+		return at, nil
+	}
+
+	at, parseErr := time.ParseInLocation(dateFormat, value, time.Local)
+	if parseErr != nil {
+		return at, errors.Errorf("invalid reminder time '%s'", value)
+	}
+
+	return at, nil
+}
+
+// wakeTickets wakes up all snoozed tickets and follow-ups
+// which are due at the given time and sends a reminder mail
+// to the assigned editors.
+func wakeTickets(now time.Time) {
+	for _, currentTicket := range globals.Tickets {
+		wokenTicket, woken := ticket.Wake(currentTicket, now)
+		if !woken {
+			continue
+		}
+
+		log.Infof("Reminding user '%s' of ticket '%s'", wokenTicket.User.Username, wokenTicket.ID)
+
+		globals.Tickets[wokenTicket.ID] = wokenTicket
+		filehandler.WriteTicketFile(globals.ServerConfig.Tickets, &wokenTicket)
+
+		api_out.SendMail(mail_events.ReminderTicket, wokenTicket)
+	}
+}
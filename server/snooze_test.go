@@ -0,0 +1,212 @@
+// Trivial Tickets Ticketsystem
+// Copyright (C) 2019 The Contributors
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+// Package server implements the web server including
+// shutdown routines and the associated handlers for
+// web requests.
+package server
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mortenterhart/trivial-tickets/globals"
+	"github.com/mortenterhart/trivial-tickets/log/testlog"
+	"github.com/mortenterhart/trivial-tickets/structs/defaults"
+)
+
+/*
+ * Ticketsystem Trivial Tickets
+ *
+ * Matriculation numbers: 3040018, 6694964, 3478222
+ * Lecture:               Programmieren II, INF16B
+ * Lecturer:              Herr Prof. Dr. Helmut Neemann
+ * Institute:             Duale Hochschule Baden-Württemberg Mosbach
+ *
+ * ---------------
+ *
+ * Package server
+ * Snoozed tickets and follow-up reminders
+ */
+
+// countMailsTo returns the number of cached mails
+// sent to the given address.
+func countMailsTo(address string) int {
+	count := 0
+	for _, mail := range globals.Mails {
+		if mail.To == address {
+			count++
+		}
+	}
+
+	return count
+}
+
+func TestHandleSnoozeTicket(t *testing.T) {
+	testlog.BeginTest()
+	defer testlog.EndTest()
+
+	defer resetConfig()
+
+	config := testServerConfig()
+	defer cleanupTestFiles(config)
+
+	user, logout := loginResponseUser()
+	defer logout()
+
+	defer mockEntryTicket(user, true)()
+
+	server := httptest.NewServer(&sessionHandler{handleSnoozeTicket})
+	defer server.Close()
+
+	client := newNonRedirectClient()
+	tomorrow := time.Now().AddDate(0, 0, 1)
+
+	t.Run("snooze", func(t *testing.T) {
+		resp, err := client.PostForm(server.URL, url.Values{
+			"ticket": {"entry123"},
+			"until":  {tomorrow.Format(dateTimeFormat)},
+		})
+		if err == nil {
+			resp.Body.Close()
+		}
+
+		assert.NoError(t, err, "An unexpected error occurred")
+		assert.Equal(t, http.StatusMovedPermanently, resp.StatusCode, "Status code did not match 301")
+		assert.Equal(t, tomorrow.Format(dateTimeFormat), globals.Tickets["entry123"].SnoozedUntil.Format(dateTimeFormat),
+			"ticket should be snoozed")
+	})
+
+	t.Run("followUp", func(t *testing.T) {
+		resp, err := client.PostForm(server.URL, url.Values{
+			"ticket": {"entry123"},
+			"until":  {tomorrow.Format(dateFormat)},
+			"type":   {"followup"},
+		})
+		if err == nil {
+			resp.Body.Close()
+		}
+
+		assert.NoError(t, err, "An unexpected error occurred")
+		assert.True(t, globals.Tickets["entry123"].HasFollowUp(), "follow-up should be scheduled")
+	})
+
+	t.Run("pastTime", func(t *testing.T) {
+		resp, err := client.PostForm(server.URL, url.Values{
+			"ticket": {"entry123"},
+			"until":  {"2019-01-07"},
+			"type":   {"followup"},
+		})
+		if err == nil {
+			resp.Body.Close()
+		}
+
+		assert.NoError(t, err, "An unexpected error occurred")
+		assert.Equal(t, "/ticket?id=entry123", resp.Header.Get("Location"), "should redirect to the ticket")
+		assert.Equal(t, tomorrow.Format(dateFormat), globals.Tickets["entry123"].FollowUp.Format(dateFormat),
+			"follow-up in the past should be rejected")
+	})
+
+	t.Run("clear", func(t *testing.T) {
+		resp, err := client.PostForm(server.URL, url.Values{"ticket": {"entry123"}})
+		if err == nil {
+			resp.Body.Close()
+		}
+
+		assert.NoError(t, err, "An unexpected error occurred")
+		assert.False(t, globals.Tickets["entry123"].IsSnoozed(), "snooze should be cleared")
+		assert.False(t, globals.Tickets["entry123"].HasFollowUp(), "follow-up should be cleared")
+	})
+
+	t.Run("notAssigned", func(t *testing.T) {
+		otherTicket := globals.Tickets["entry123"]
+		otherTicket.User.ID = "other"
+		globals.Tickets["entry123"] = otherTicket
+
+		resp, err := client.PostForm(server.URL, url.Values{
+			"ticket": {"entry123"},
+			"until":  {tomorrow.Format(dateTimeFormat)},
+		})
+		if err == nil {
+			resp.Body.Close()
+		}
+
+		assert.NoError(t, err, "An unexpected error occurred")
+		assert.False(t, globals.Tickets["entry123"].IsSnoozed(), "only the editor may snooze the ticket")
+	})
+}
+
+func TestWakeTickets(t *testing.T) {
+	testlog.BeginTest()
+	defer testlog.EndTest()
+
+	defer resetConfig()
+
+	config := testServerConfig()
+	defer cleanupTestFiles(config)
+
+	tmpl = getTemplates(defaults.TestWebTrimmed)
+
+	user, logout := loginResponseUser()
+	defer logout()
+
+	defer mockEntryTicket(user, true)()
+
+	monday := time.Date(2019, time.January, 7, 8, 0, 0, 0, time.Local)
+
+	snoozedTicket := globals.Tickets["entry123"]
+	snoozedTicket.SnoozedUntil = monday
+	globals.Tickets["entry123"] = snoozedTicket
+
+	mailsBefore := countMailsTo(user.Mail)
+
+	t.Run("notDue", func(t *testing.T) {
+		wakeTickets(monday.Add(-time.Minute))
+
+		assert.True(t, globals.Tickets["entry123"].IsSnoozed(), "ticket should still sleep")
+		assert.Equal(t, mailsBefore, countMailsTo(user.Mail), "no reminder should be sent yet")
+	})
+
+	t.Run("due", func(t *testing.T) {
+		wakeTickets(monday)
+
+		assert.False(t, globals.Tickets["entry123"].IsSnoozed(), "ticket should wake up")
+		assert.True(t, globals.Tickets["entry123"].Reminder, "ticket should be marked with a reminder")
+		assert.Equal(t, mailsBefore+1, countMailsTo(user.Mail), "reminder should be sent to the editor")
+	})
+
+	t.Run("dashboard", func(t *testing.T) {
+		server := httptest.NewServer(&sessionHandler{handleIndex})
+		defer server.Close()
+
+		client := newNonRedirectClient()
+		resp, err := client.Get(server.URL)
+		if !assert.NoError(t, err, "An unexpected error occurred") {
+			return
+		}
+		defer resp.Body.Close()
+
+		body, _ := ioutil.ReadAll(resp.Body)
+
+		assert.Contains(t, string(body), "reminder_entry123", "woken ticket should appear on the dashboard")
+	})
+}
@@ -0,0 +1,80 @@
+// Trivial Tickets Ticketsystem
+// Copyright (C) 2019 The Contributors
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+// Package server implements the web server including
+// shutdown routines and the associated handlers for
+// web requests.
+package server
+
+import (
+	"time"
+
+	"github.com/mortenterhart/trivial-tickets/api/api_out"
+	"github.com/mortenterhart/trivial-tickets/globals"
+	"github.com/mortenterhart/trivial-tickets/log"
+	"github.com/mortenterhart/trivial-tickets/mail_events"
+	"github.com/mortenterhart/trivial-tickets/ticket"
+	"github.com/mortenterhart/trivial-tickets/util/filehandler"
+)
+
+/*
+ * Ticketsystem Trivial Tickets
+ *
+ * Matriculation numbers: 3040018, 6694964, 3478222
+ * Lecture:               Programmieren II, INF16B
+ * Lecturer:              Herr Prof. Dr. Helmut Neemann
+ * Institute:             Duale Hochschule Baden-Württemberg Mosbach
+ *
+ * ---------------
+ *
+ * Package server
+ * Reminders and closing of tickets waiting for the customer
+ */
+
+// checkStaleTickets applies the configured stale ticket policy
+// to all tickets. The customers of tickets waiting too long for
+// their answer are reminded and the tickets are closed if they
+// still do not answer.
+func checkStaleTickets(now time.Time) {
+	config := globals.ServerConfig
+
+	for _, currentTicket := range globals.Tickets {
+		updatedTicket, action := ticket.CheckStale(currentTicket, now,
+			config.StaleReminderDays, config.StaleCloseDays)
+
+		switch action {
+		case ticket.StaleNone:
+			continue
+
+		case ticket.StaleReminder:
+			log.Infof("Reminding customer '%s' of ticket '%s' waiting for an answer",
+				updatedTicket.Customer, updatedTicket.ID)
+			api_out.SendMail(mail_events.StaleReminder, updatedTicket)
+
+		case ticket.StaleClose:
+			log.Infof("Closing ticket '%s' because customer '%s' did not answer",
+				updatedTicket.ID, updatedTicket.Customer)
+			api_out.SendMail(mail_events.StaleClosed, updatedTicket)
+
+		case ticket.StaleReset:
+			log.Infof("Ticket '%s' is no longer waiting for customer '%s'",
+				updatedTicket.ID, updatedTicket.Customer)
+		}
+
+		globals.Tickets[updatedTicket.ID] = updatedTicket
+		filehandler.WriteTicketFile(globals.ServerConfig.Tickets, &updatedTicket)
+	}
+}
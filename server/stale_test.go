@@ -0,0 +1,87 @@
+// Trivial Tickets Ticketsystem
+// Copyright (C) 2019 The Contributors
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+// Package server implements the web server including
+// shutdown routines and the associated handlers for
+// web requests.
+package server
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mortenterhart/trivial-tickets/globals"
+	"github.com/mortenterhart/trivial-tickets/log/testlog"
+	"github.com/mortenterhart/trivial-tickets/structs"
+)
+
+/*
+ * Ticketsystem Trivial Tickets
+ *
+ * Matriculation numbers: 3040018, 6694964, 3478222
+ * Lecture:               Programmieren II, INF16B
+ * Lecturer:              Herr Prof. Dr. Helmut Neemann
+ * Institute:             Duale Hochschule Baden-Württemberg Mosbach
+ *
+ * ---------------
+ *
+ * Package server
+ * Reminders and closing of tickets waiting for the customer
+ */
+
+func TestCheckStaleTickets(t *testing.T) {
+	testlog.BeginTest()
+	defer testlog.EndTest()
+
+	defer resetConfig()
+
+	config := testServerConfig()
+	config.StaleReminderDays = 7
+	config.StaleCloseDays = 3
+	globals.ServerConfig = &config
+	defer cleanupTestFiles(config)
+
+	user, logout := loginResponseUser()
+	defer logout()
+
+	defer mockEntryTicket(user, true)()
+
+	// The editor asked a question which the customer never answered
+	question := time.Date(2019, time.January, 7, 10, 0, 0, 0, time.Local)
+	waitingTicket := globals.Tickets["entry123"]
+	waitingTicket.Entries[1].Date = question
+	waitingTicket.Entries[1].ReplyType = structs.ReplyExternal
+	globals.Tickets["entry123"] = waitingTicket
+
+	mailsBefore := countMailsTo("customer@mail.com")
+
+	t.Run("reminder", func(t *testing.T) {
+		checkStaleTickets(question.AddDate(0, 0, 7))
+
+		assert.False(t, globals.Tickets["entry123"].StaleReminded.IsZero(), "customer should be reminded")
+		assert.Equal(t, mailsBefore+1, countMailsTo("customer@mail.com"), "reminder mail should be sent")
+	})
+
+	t.Run("close", func(t *testing.T) {
+		checkStaleTickets(question.AddDate(0, 0, 10))
+
+		assert.Equal(t, structs.StatusClosed, globals.Tickets["entry123"].Status, "ticket should be closed")
+		assert.Equal(t, mailsBefore+2, countMailsTo("customer@mail.com"), "final notification should be sent")
+		assert.Len(t, globals.Tickets["entry123"].Entries, 4, "both steps should be recorded")
+	})
+}
@@ -0,0 +1,238 @@
+// Trivial Tickets Ticketsystem
+// Copyright (C) 2019 The Contributors
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+// Package server implements the web server including
+// shutdown routines and the associated handlers for
+// web requests.
+package server
+
+import (
+	"html/template"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/mortenterhart/trivial-tickets/globals"
+	"github.com/mortenterhart/trivial-tickets/log"
+	"github.com/mortenterhart/trivial-tickets/session"
+	"github.com/mortenterhart/trivial-tickets/structs"
+	"github.com/mortenterhart/trivial-tickets/survey"
+	"github.com/mortenterhart/trivial-tickets/ticket"
+	"github.com/mortenterhart/trivial-tickets/util/filehandler"
+	"github.com/mortenterhart/trivial-tickets/worklog"
+)
+
+/*
+ * Ticketsystem Trivial Tickets
+ *
+ * Matriculation numbers: 3040018, 6694964, 3478222
+ * Lecture:               Programmieren II, INF16B
+ * Lecturer:              Herr Prof. Dr. Helmut Neemann
+ * Institute:             Duale Hochschule Baden-Württemberg Mosbach
+ *
+ * ---------------
+ *
+ * Package server
+ * Time tracking on tickets and worklog reports
+ */
+
+// handleLogTime logs the time given in the form value "time"
+// on the ticket given in the form value "ticket" for the logged
+// in user. If the form value "entry" contains the index of an
+// entry, the time is logged on this entry. An optional note
+// can be given in the form value "note".
+func handleLogTime(w http.ResponseWriter, r *http.Request) {
+
+	// Get session id
+	sessionID := session.GetSessionID(r)
+
+	// Only react on POST requests of logged in users
+	if r.Method != postMethod || !globals.Sessions[sessionID].Session.IsLoggedIn {
+		http.Redirect(w, r, indexURL, http.StatusMovedPermanently)
+		return
+	}
+
+	currentSession, _ := session.GetSession(sessionID)
+	user := currentSession.User
+
+	ticketID := template.HTMLEscapeString(r.FormValue("ticket"))
+	currentTicket, ticketExists := globals.Tickets[ticketID]
+	if !ticketExists {
+		log.Errorf("%s %s: ticket '%s' not found", r.Method, r.RequestURI, ticketID)
+		http.Redirect(w, r, indexURL, http.StatusMovedPermanently)
+		return
+	}
+
+	ticketURL := "/ticket?" + idParameter + "=" + url.QueryEscape(ticketID)
+
+	minutes, parseErr := worklog.ParseMinutes(r.FormValue("time"))
+	if parseErr != nil {
+		log.Errorf("%s %s: %v", r.Method, r.RequestURI, parseErr)
+		http.Redirect(w, r, ticketURL, http.StatusMovedPermanently)
+		return
+	}
+
+	// Without an entry the time is logged on the whole ticket
+	index := -1
+	if entryValue := r.FormValue("entry"); entryValue != "" {
+		var convertErr error
+		if index, convertErr = strconv.Atoi(entryValue); convertErr != nil {
+			log.Errorf("%s %s: invalid entry '%s' of ticket '%s'", r.Method, r.RequestURI, entryValue, ticketID)
+			http.Redirect(w, r, ticketURL, http.StatusMovedPermanently)
+			return
+		}
+	}
+
+	note := template.HTMLEscapeString(r.FormValue("note"))
+	updatedTicket, logErr := ticket.LogTime(currentTicket, user.Username, minutes, index, note)
+	if logErr != nil {
+		log.Errorf("%s %s: unable to log time on ticket '%s': %v", r.Method, r.RequestURI, ticketID, logErr)
+		http.Redirect(w, r, ticketURL, http.StatusMovedPermanently)
+		return
+	}
+
+	log.Infof("User '%s' logged %d minutes on ticket '%s'", user.Username, minutes, ticketID)
+
+	globals.Tickets[ticketID] = updatedTicket
+	filehandler.WriteTicketFile(globals.ServerConfig.Tickets, &updatedTicket)
+
+	http.Redirect(w, r, ticketURL, http.StatusMovedPermanently)
+}
+
+// handleReport serves the worklog report page which shows the
+// logged time aggregated by period, agent and customer. The
+// report is restricted by the GET parameters "from", "to" and
+// "period".
+func handleReport(w http.ResponseWriter, r *http.Request) {
+	currentSession, data, ok := newReportData(w, r)
+	if !ok {
+		return
+	}
+
+	executeErr := tmpl.Lookup("report.html").ExecuteTemplate(w, "report", data)
+	if executeErr != nil {
+		log.Errorf("unable to render report for user '%s': %v", currentSession.User.Username, executeErr)
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+}
+
+// handleReportCSV exports the worklog report with the same
+// parameters as the report page as CSV file.
+func handleReportCSV(w http.ResponseWriter, r *http.Request) {
+	currentSession, data, ok := newReportData(w, r)
+	if !ok {
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.Header().Set("Content-Disposition",
+		`attachment; filename="worklog_`+data.From+`_`+data.To+`.csv"`)
+
+	if writeErr := worklog.WriteCSV(w, data.Rows); writeErr != nil {
+		log.Errorf("unable to export report for user '%s': %v", currentSession.User.Username, writeErr)
+	}
+}
+
+// handleSatisfactionCSV exports the customer satisfaction
+// report with the same parameters as the report page as
+// CSV file.
+func handleSatisfactionCSV(w http.ResponseWriter, r *http.Request) {
+	currentSession, data, ok := newReportData(w, r)
+	if !ok {
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.Header().Set("Content-Disposition",
+		`attachment; filename="csat_`+data.From+`_`+data.To+`.csv"`)
+
+	if writeErr := survey.WriteCSV(w, data.Ratings); writeErr != nil {
+		log.Errorf("unable to export satisfaction report for user '%s': %v", currentSession.User.Username, writeErr)
+	}
+}
+
+// newReportData checks that the request is a GET request of a
+// logged in user and aggregates the report for the requested
+// time range. If the request cannot be served, the client is
+// redirected or an error is returned and ok is false.
+func newReportData(w http.ResponseWriter, r *http.Request) (currentSession structs.Session, data structs.DataReport, ok bool) {
+
+	// Get session id
+	sessionID := session.GetSessionID(r)
+
+	if r.Method != getMethod || !globals.Sessions[sessionID].Session.IsLoggedIn {
+		http.Redirect(w, r, indexURL, http.StatusMovedPermanently)
+		return
+	}
+
+	currentSession, _ = session.GetSession(sessionID)
+
+	from, to, period, filterErr := parseReportFilter(r.URL.Query(), time.Now())
+	if filterErr != nil {
+		log.Errorf("%s %s: %v", r.Method, r.RequestURI, filterErr)
+		http.Error(w, filterErr.Error(), http.StatusBadRequest)
+		return
+	}
+
+	rows := worklog.Report(globals.Tickets, from, to.AddDate(0, 0, 1), period)
+
+	return currentSession, structs.DataReport{
+		Session:      currentSession,
+		From:         from.Format(dateFormat),
+		To:           to.Format(dateFormat),
+		Period:       period,
+		Rows:         rows,
+		TotalMinutes: worklog.TotalMinutes(rows),
+		Ratings:      survey.Report(globals.Tickets, from, to.AddDate(0, 0, 1), period),
+	}, true
+}
+
+// parseReportFilter reads the first and the last day as well
+// as the period of a report from the given parameters. By
+// default, the current month is aggregated by day.
+func parseReportFilter(params url.Values, now time.Time) (from, to time.Time, period structs.ReportPeriod, err error) {
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.Local)
+	from = today.AddDate(0, 0, 1-today.Day())
+	to = today
+	period = structs.PeriodDay
+
+	if fromValue := params.Get("from"); fromValue != "" {
+		if from, err = time.ParseInLocation(dateFormat, fromValue, time.Local); err != nil {
+			return from, to, period, errors.Errorf("invalid start date '%s'", fromValue)
+		}
+	}
+
+	if toValue := params.Get("to"); toValue != "" {
+		if to, err = time.ParseInLocation(dateFormat, toValue, time.Local); err != nil {
+			return from, to, period, errors.Errorf("invalid end date '%s'", toValue)
+		}
+	}
+
+	if to.Before(from) {
+		return from, to, period, errors.New("the end date must not be before the start date")
+	}
+
+	if periodValue := params.Get("period"); periodValue != "" {
+		if period = structs.AsReportPeriod(periodValue); period < 0 {
+			return from, to, period, errors.Errorf("invalid period '%s'", periodValue)
+		}
+	}
+
+	return from, to, period, nil
+}
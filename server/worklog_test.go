@@ -0,0 +1,268 @@
+// Trivial Tickets Ticketsystem
+// Copyright (C) 2019 The Contributors
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+// Package server implements the web server including
+// shutdown routines and the associated handlers for
+// web requests.
+package server
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mortenterhart/trivial-tickets/globals"
+	"github.com/mortenterhart/trivial-tickets/log/testlog"
+	"github.com/mortenterhart/trivial-tickets/structs"
+	"github.com/mortenterhart/trivial-tickets/structs/defaults"
+)
+
+/*
+ * Ticketsystem Trivial Tickets
+ *
+ * Matriculation numbers: 3040018, 6694964, 3478222
+ * Lecture:               Programmieren II, INF16B
+ * Lecturer:              Herr Prof. Dr. Helmut Neemann
+ * Institute:             Duale Hochschule Baden-Württemberg Mosbach
+ *
+ * ---------------
+ *
+ * Package server
+ * Time tracking on tickets and worklog reports
+ */
+
+// mockWorkLogTicket stores a ticket with time logged on
+// the given date and returns a function removing the
+// ticket again.
+func mockWorkLogTicket(date time.Time) func() {
+	globals.Tickets["worklog123"] = structs.Ticket{
+		ID:       "worklog123",
+		Customer: "customer@mail.com",
+		WorkLogs: []structs.WorkLog{
+			{Date: date, User: "responseuser", Minutes: 90},
+		},
+	}
+
+	return func() {
+		delete(globals.Tickets, "worklog123")
+	}
+}
+
+func TestHandleLogTime(t *testing.T) {
+	testlog.BeginTest()
+	defer testlog.EndTest()
+
+	defer resetConfig()
+
+	config := testServerConfig()
+	defer cleanupTestFiles(config)
+
+	user, logout := loginResponseUser()
+	defer logout()
+
+	defer mockEntryTicket(user, true)()
+
+	entryTicket := globals.Tickets["entry123"]
+	entryTicket.Entries[1].Date = time.Now()
+	globals.Tickets["entry123"] = entryTicket
+
+	server := httptest.NewServer(&sessionHandler{handleLogTime})
+	defer server.Close()
+
+	client := newNonRedirectClient()
+
+	t.Run("ticketLevel", func(t *testing.T) {
+		resp, err := client.PostForm(server.URL, url.Values{"ticket": {"entry123"}, "time": {"1h30m"}, "note": {"Analysis"}})
+		if err == nil {
+			resp.Body.Close()
+		}
+
+		assert.NoError(t, err, "An unexpected error occurred")
+		assert.Equal(t, http.StatusMovedPermanently, resp.StatusCode, "Status code did not match 301")
+		assert.Equal(t, "/ticket?id=entry123", resp.Header.Get("Location"), "should redirect to the ticket")
+
+		workLogs := globals.Tickets["entry123"].WorkLogs
+		if assert.Len(t, workLogs, 1, "time should be logged") {
+			assert.Equal(t, "responseuser", workLogs[0].User)
+			assert.Equal(t, 90, workLogs[0].Minutes)
+			assert.Equal(t, "Analysis", workLogs[0].Note)
+			assert.True(t, workLogs[0].IsTicketLevel())
+		}
+	})
+
+	t.Run("entryLevel", func(t *testing.T) {
+		resp, err := client.PostForm(server.URL, url.Values{"ticket": {"entry123"}, "time": {"15"}, "entry": {"1"}})
+		if err == nil {
+			resp.Body.Close()
+		}
+
+		currentTicket := globals.Tickets["entry123"]
+
+		assert.NoError(t, err, "An unexpected error occurred")
+		assert.Equal(t, 15, currentTicket.EntryMinutes(currentTicket.Entries[1]), "time should be logged on the entry")
+		assert.Equal(t, 105, currentTicket.TotalMinutes())
+	})
+
+	t.Run("invalidTime", func(t *testing.T) {
+		resp, err := client.PostForm(server.URL, url.Values{"ticket": {"entry123"}, "time": {"-5"}})
+		if err == nil {
+			resp.Body.Close()
+		}
+
+		assert.NoError(t, err, "An unexpected error occurred")
+		assert.Equal(t, "/ticket?id=entry123", resp.Header.Get("Location"), "should redirect to the ticket")
+		assert.Equal(t, 105, globals.Tickets["entry123"].TotalMinutes(), "invalid time should not be logged")
+	})
+
+	t.Run("notLoggedIn", func(t *testing.T) {
+		anonymousServer := httptest.NewServer(http.HandlerFunc(handleLogTime))
+		defer anonymousServer.Close()
+
+		resp, err := client.PostForm(anonymousServer.URL, url.Values{"ticket": {"entry123"}, "time": {"10"}})
+		if err == nil {
+			resp.Body.Close()
+		}
+
+		assert.NoError(t, err, "An unexpected error occurred")
+		assert.Equal(t, "/", resp.Header.Get("Location"), "should redirect to the index")
+		assert.Equal(t, 105, globals.Tickets["entry123"].TotalMinutes(), "customers should not log time")
+	})
+}
+
+func TestHandleReport(t *testing.T) {
+	testlog.BeginTest()
+	defer testlog.EndTest()
+
+	defer resetConfig()
+
+	config := testServerConfig()
+	defer cleanupTestFiles(config)
+
+	tmpl = getTemplates(defaults.TestWebTrimmed)
+
+	_, logout := loginResponseUser()
+	defer logout()
+
+	defer mockWorkLogTicket(time.Date(2019, time.January, 7, 10, 0, 0, 0, time.Local))()
+
+	server := httptest.NewServer(&sessionHandler{handleReport})
+	defer server.Close()
+
+	client := newNonRedirectClient()
+
+	t.Run("report", func(t *testing.T) {
+		resp, err := client.Get(server.URL + "/report?from=2019-01-01&to=2019-01-31&period=month")
+		if !assert.NoError(t, err, "An unexpected error occurred") {
+			return
+		}
+		defer resp.Body.Close()
+
+		body, _ := ioutil.ReadAll(resp.Body)
+
+		assert.Equal(t, http.StatusOK, resp.StatusCode, "The http status is not 200")
+		assert.Contains(t, string(body), "2019-01", "report should contain the period")
+		assert.Contains(t, string(body), "customer@mail.com", "report should contain the customer")
+		assert.Contains(t, string(body), "<td>90</td>", "report should contain the logged time")
+	})
+
+	t.Run("invalidPeriod", func(t *testing.T) {
+		resp, err := client.Get(server.URL + "/report?period=year")
+		if err == nil {
+			resp.Body.Close()
+		}
+
+		assert.NoError(t, err, "An unexpected error occurred")
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode, "Status code did not match 400")
+	})
+
+	t.Run("notLoggedIn", func(t *testing.T) {
+		anonymousServer := httptest.NewServer(http.HandlerFunc(handleReport))
+		defer anonymousServer.Close()
+
+		resp, err := client.Get(anonymousServer.URL + "/report")
+		if err == nil {
+			resp.Body.Close()
+		}
+
+		assert.NoError(t, err, "An unexpected error occurred")
+		assert.Equal(t, http.StatusMovedPermanently, resp.StatusCode, "Status code did not match 301")
+	})
+}
+
+func TestHandleReportCSV(t *testing.T) {
+	testlog.BeginTest()
+	defer testlog.EndTest()
+
+	defer resetConfig()
+
+	config := testServerConfig()
+	defer cleanupTestFiles(config)
+
+	_, logout := loginResponseUser()
+	defer logout()
+
+	defer mockWorkLogTicket(time.Date(2019, time.January, 7, 10, 0, 0, 0, time.Local))()
+
+	server := httptest.NewServer(&sessionHandler{handleReportCSV})
+	defer server.Close()
+
+	client := newNonRedirectClient()
+	resp, err := client.Get(server.URL + "/report.csv?from=2019-01-01&to=2019-01-31&period=week")
+	if !assert.NoError(t, err, "An unexpected error occurred") {
+		return
+	}
+	defer resp.Body.Close()
+
+	body, _ := ioutil.ReadAll(resp.Body)
+
+	assert.Equal(t, http.StatusOK, resp.StatusCode, "The http status is not 200")
+	assert.Equal(t, "text/csv; charset=utf-8", resp.Header.Get("Content-Type"))
+	assert.Contains(t, resp.Header.Get("Content-Disposition"), "worklog_2019-01-01_2019-01-31.csv")
+	assert.Equal(t, "period,agent,customer,minutes,hours\n2019-W02,responseuser,customer@mail.com,90,1.50\n", string(body))
+}
+
+func TestParseReportFilter(t *testing.T) {
+	testlog.BeginTest()
+	defer testlog.EndTest()
+
+	now := time.Date(2019, time.January, 17, 15, 30, 0, 0, time.Local)
+
+	t.Run("defaults", func(t *testing.T) {
+		from, to, period, err := parseReportFilter(url.Values{}, now)
+
+		assert.NoError(t, err)
+		assert.Equal(t, "2019-01-01", from.Format(dateFormat), "report should start at the beginning of the month")
+		assert.Equal(t, "2019-01-17", to.Format(dateFormat), "report should end today")
+		assert.Equal(t, structs.PeriodDay, period)
+	})
+
+	t.Run("invalidDate", func(t *testing.T) {
+		_, _, _, err := parseReportFilter(url.Values{"from": {"yesterday"}}, now)
+
+		assert.Error(t, err)
+	})
+
+	t.Run("reversedRange", func(t *testing.T) {
+		_, _, _, err := parseReportFilter(url.Values{"from": {"2019-02-01"}, "to": {"2019-01-01"}}, now)
+
+		assert.Error(t, err)
+	})
+}
@@ -76,10 +76,8 @@ func CreateSession(sessionID string) structs.SessionManager {
 // with a given session id.
 func GetSession(sessionID string) (structs.Session, error) {
 
-	session := globals.Sessions[sessionID].Session
-
-	if session != (structs.Session{}) {
-		return globals.Sessions[sessionID].Session, nil
+	if sessionManager, sessionExists := globals.Sessions[sessionID]; sessionExists {
+		return sessionManager.Session, nil
 	}
 
 	return structs.Session{}, errors.New("unable to find session with id: " + sessionID)
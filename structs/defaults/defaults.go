@@ -43,13 +43,40 @@ const (
 	// The following constants are the default settings
 	// for the productive server. Do not modify these or
 	// use them in test cases.
-	ServerPort        uint16 = 8443                       // The default server port
-	ServerTickets     string = "./files/tickets"          // The default ticket directory path
-	ServerUsers       string = "./files/users/users.json" // The default user file path
-	ServerMails       string = "./files/mails"            // The default mail directory path
-	ServerCertificate string = "./ssl/server.cert"        // The default SSL certificate file
-	ServerKey         string = "./ssl/server.key"         // The default SSL private key file
-	ServerWeb         string = "./www"                    // The default web directory
+	ServerPort        uint16 = 8443                               // The default server port
+	ServerTickets     string = "./files/tickets"                  // The default ticket directory path
+	ServerUsers       string = "./files/users/users.json"         // The default user file path
+	ServerMails       string = "./files/mails"                    // The default mail directory path
+	ServerCertificate string = "./ssl/server.cert"                // The default SSL certificate file
+	ServerKey         string = "./ssl/server.key"                 // The default SSL private key file
+	ServerWeb         string = "./www"                            // The default web directory
+	ServerResponses   string = "./files/responses/responses.json" // The default responses file path
+	ServerCustomers   string = "./files/customers/customers.json" // The default customer directory file path
+	ServerSequence    string = "./files/sequence/sequence.json"   // The default ticket sequence file path
+	ServerRules       string = "./files/rules/rules.json"         // The default automation rules file path
+	ServerAttachments string = "./files/attachments"              // The default attachment directory path
+	ServerAssign      string = "none"                             // The default assignment strategy
+	ServerHoliday     string = "keep"                             // The default holiday ticket policy
+	ServerStaleRemind uint   = 0                                  // The default number of days until a customer is reminded
+	ServerStaleClose  uint   = 0                                  // The default number of days until a stale ticket is closed
+	ServerPrefix      string = "TT"                               // The default prefix of the ticket numbers
+	ServerDuplicates  string = "flag"                             // The default duplicate ticket policy
+	ServerDupWindow   uint   = 24                                 // The default number of hours to look for duplicate tickets
+	ServerSMTPRelay   string = ""                                 // The default SMTP relay (disabled)
+	ServerSMTPUser    string = ""                                 // The default SMTP user (no authentication)
+	ServerSMTPPass    string = ""                                 // The default SMTP password
+	ServerSMTPTLS     bool   = true                               // The default value for the required STARTTLS
+	ServerSMTPListen  string = ""                                 // The default address of the SMTP server (disabled)
+	ServerSupport     string = "support@trivial-tickets.com"      // The default support addresses accepted by the SMTP server
+	ServerMaxMailKB   uint   = 10240                              // The default maximum size of received mails in kilobytes
+	ServerMailbox     string = ""                                 // The default mailbox URL (disabled)
+	ServerMailFolder  string = ""                                 // The default folder for processed mails (mark as seen)
+	ServerMailPoll    uint   = 60                                 // The default number of seconds between two mailbox polls
+	ServerMailRate    uint   = 20                                 // The default maximum number of mails per sender and hour
+	ServerMailTmpl    string = "./www/mail_templates"             // The default mail template directory path
+	ServerMailLang    string = "en"                               // The default language of the mails
+	ServerSLAHours    uint   = 0                                  // The default response time in hours (disabled)
+	ServerDigest      string = ""                                 // The default time of the daily digest (disabled)
 
 	// The following values are an addition to the default
 	// server configuration. They can be used in packages
@@ -70,28 +97,33 @@ const (
 	CliPort        uint16 = 8443                // The default CLI port
 	CliCertificate string = "./ssl/server.cert" // The default SSL certificate file
 	CliFetch       bool   = false               // The default value for the fetch option
+	CliMIME        bool   = false               // The default value for the MIME fetch option
 	CliSubmit      bool   = false               // The default value for the submit option
 
 	// These constants are testing values for the server
 	// configuration. The directories for tickets and
 	// mails have been changed.
-	TestPort        uint16 = 8444                           // The default test port
-	TestTickets     string = "../../files/testtickets"      // The default path to the test ticket directory
-	TestUsers       string = "../../files/users/users.json" // The default path to the users file
-	TestMails       string = "../../files/testmails"        // The default path to the test mail directory
-	TestCertificate string = "../../ssl/server.cert"        // The default file path to the SSL certificate
-	TestKey         string = "../../ssl/server.key"         // The default file path to the SSL private key
-	TestWeb         string = "../../www"                    // The default path to the web directory
+	TestPort        uint16 = 8444                                       // The default test port
+	TestTickets     string = "../../files/testtickets"                  // The default path to the test ticket directory
+	TestUsers       string = "../../files/users/users.json"             // The default path to the users file
+	TestMails       string = "../../files/testmails"                    // The default path to the test mail directory
+	TestCertificate string = "../../ssl/server.cert"                    // The default file path to the SSL certificate
+	TestKey         string = "../../ssl/server.key"                     // The default file path to the SSL private key
+	TestWeb         string = "../../www"                                // The default path to the web directory
+	TestResponses   string = "../../files/testresponses/responses.json" // The default path to the test responses file
+	TestMailTmpl    string = "../../www/mail_templates"                 // The default path to the mail template directory
 
 	// These constants are testing values as well, but
 	// for packages which are only "one directory deep"
 	// as seen from the project's root directory.
-	TestTicketsTrimmed     string = "../files/testtickets"          // The trimmed default path to the test ticket directory
-	TestUsersTrimmed       string = "../files/testusers/users.json" // The trimmed default path to the test users file
-	TestMailsTrimmed       string = "../files/testmails"            // The trimmed default path to the test mail directory
-	TestCertificateTrimmed string = "../ssl/server.cert"            // The trimmed default file path to the SSL certificate
-	TestKeyTrimmed         string = "../ssl/server.key"             // The trimmed default file path to the SSL private key
-	TestWebTrimmed         string = "../www"                        // The trimmed default path to the web directory
+	TestTicketsTrimmed     string = "../files/testtickets"                  // The trimmed default path to the test ticket directory
+	TestUsersTrimmed       string = "../files/testusers/users.json"         // The trimmed default path to the test users file
+	TestMailsTrimmed       string = "../files/testmails"                    // The trimmed default path to the test mail directory
+	TestCertificateTrimmed string = "../ssl/server.cert"                    // The trimmed default file path to the SSL certificate
+	TestKeyTrimmed         string = "../ssl/server.key"                     // The trimmed default file path to the SSL private key
+	TestWebTrimmed         string = "../www"                                // The trimmed default path to the web directory
+	TestResponsesTrimmed   string = "../files/testresponses/responses.json" // The trimmed default path to the test responses file
+	TestMailTmplTrimmed    string = "../www/mail_templates"                 // The trimmed default path to the mail template directory
 )
 
 // Standard file modes for writing of ticket
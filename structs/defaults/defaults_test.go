@@ -53,6 +53,33 @@ func TestDefaultValues(t *testing.T) {
 	assert.NotNil(t, ServerCertificate)
 	assert.NotNil(t, ServerKey)
 	assert.NotNil(t, ServerWeb)
+	assert.NotNil(t, ServerResponses)
+	assert.NotNil(t, ServerAssign)
+	assert.NotNil(t, ServerHoliday)
+	assert.NotNil(t, ServerStaleRemind)
+	assert.NotNil(t, ServerStaleClose)
+	assert.NotNil(t, ServerPrefix)
+	assert.NotNil(t, ServerDuplicates)
+	assert.NotNil(t, ServerDupWindow)
+	assert.NotNil(t, ServerSequence)
+	assert.NotNil(t, ServerRules)
+	assert.NotNil(t, ServerAttachments)
+	assert.NotNil(t, ServerSMTPRelay)
+	assert.NotNil(t, ServerSMTPUser)
+	assert.NotNil(t, ServerSMTPPass)
+	assert.NotNil(t, ServerSMTPTLS)
+	assert.NotNil(t, ServerSMTPListen)
+	assert.NotNil(t, ServerSupport)
+	assert.NotNil(t, ServerMaxMailKB)
+	assert.NotNil(t, ServerMailbox)
+	assert.NotNil(t, ServerMailFolder)
+	assert.NotNil(t, ServerMailPoll)
+	assert.NotNil(t, ServerMailRate)
+	assert.NotNil(t, ServerMailTmpl)
+	assert.NotNil(t, ServerMailLang)
+	assert.NotNil(t, ServerSLAHours)
+	assert.NotNil(t, ServerDigest)
+	assert.NotNil(t, ServerCustomers)
 
 	assert.NotNil(t, TestTicketsTrimmed)
 	assert.NotNil(t, TestUsersTrimmed)
@@ -60,6 +87,8 @@ func TestDefaultValues(t *testing.T) {
 	assert.NotNil(t, TestCertificateTrimmed)
 	assert.NotNil(t, TestKeyTrimmed)
 	assert.NotNil(t, TestWebTrimmed)
+	assert.NotNil(t, TestResponsesTrimmed)
+	assert.NotNil(t, TestMailTmplTrimmed)
 
 	assert.NotNil(t, LogVerbose)
 	assert.NotNil(t, LogFullPaths)
@@ -69,6 +98,7 @@ func TestDefaultValues(t *testing.T) {
 	assert.NotNil(t, CliPort)
 	assert.NotNil(t, CliCertificate)
 	assert.NotNil(t, CliFetch)
+	assert.NotNil(t, CliMIME)
 	assert.NotNil(t, CliSubmit)
 
 	assert.NotNil(t, TestPort)
@@ -78,6 +108,8 @@ func TestDefaultValues(t *testing.T) {
 	assert.NotNil(t, TestCertificate)
 	assert.NotNil(t, TestKey)
 	assert.NotNil(t, TestWeb)
+	assert.NotNil(t, TestResponses)
+	assert.NotNil(t, TestMailTmpl)
 
 	assert.NotNil(t, FileModeRegular)
 
@@ -21,6 +21,7 @@ package structs
 
 import (
 	"strconv"
+	"strings"
 	"time"
 )
 
@@ -65,8 +66,137 @@ type ServerConfig struct {
 	// Web is the root directory of the server
 	// where web resources are located.
 	Web string
+
+	// Responses is the path to the file with
+	// the canned responses and macros.
+	Responses string
+
+	// AssignStrategy is the strategy used to
+	// assign new tickets automatically to an
+	// editor.
+	AssignStrategy AssignStrategy
+
+	// HolidayPolicy defines what happens to the
+	// tickets of an editor going on holiday.
+	HolidayPolicy HolidayPolicy
+
+	// StaleReminderDays is the number of days
+	// without an answer of the customer after
+	// which the customer is reminded. Zero
+	// disables the reminders.
+	StaleReminderDays uint
+
+	// StaleCloseDays is the number of days after
+	// the reminder after which a ticket still
+	// waiting for the customer is closed. Zero
+	// disables the closing.
+	StaleCloseDays uint
+
+	// DuplicatePolicy defines what happens to
+	// new tickets looking like a duplicate of
+	// an open ticket of the same customer.
+	DuplicatePolicy DuplicatePolicy
+
+	// DuplicateWindowHours is the number of
+	// hours within which a ticket of the same
+	// customer is considered as original.
+	DuplicateWindowHours uint
+
+	// Customers is the path to the file with
+	// the customer directory.
+	Customers string
+
+	// Sequence is the path to the file which
+	// persists the sequence of the ticket
+	// numbers.
+	Sequence string
+
+	// TicketPrefix is the prefix of the
+	// sequential ticket numbers.
+	TicketPrefix string
+
+	// Rules is the path to the file with the
+	// automation rules.
+	Rules string
+
+	// SMTPRelay is the address (host:port) of the
+	// SMTP relay to which the outgoing mails are
+	// delivered. An empty relay disables the
+	// built-in delivery.
+	SMTPRelay string
+
+	// SMTPUser and SMTPPassword are the credentials
+	// for the relay. Without user, the mails are
+	// sent without authentication.
+	SMTPUser     string
+	SMTPPassword string
+
+	// SMTPStartTLS requires the relay to support
+	// STARTTLS before any mail is sent.
+	SMTPStartTLS bool
+
+	// SMTPListen is the address (host:port) on which
+	// the built-in SMTP server receives mails. An empty
+	// address disables the SMTP server.
+	SMTPListen string
+
+	// SupportAddresses are the recipient addresses
+	// accepted by the SMTP server.
+	SupportAddresses []string
+
+	// MaxMailSize is the maximum size of a received
+	// mail in bytes.
+	MaxMailSize int64
+
+	// Attachments is the path to the directory in
+	// which the attachments of the entries are stored.
+	Attachments string
+
+	// Mailbox is the URL of an IMAP or POP3 mailbox
+	// which is polled for new mails. An empty URL
+	// disables the polling.
+	Mailbox string
+
+	// MailboxFolder is the IMAP folder to which the
+	// processed mails are moved. If it is empty, the
+	// mails are only marked as seen.
+	MailboxFolder string
+
+	// MailboxInterval is the number of seconds
+	// between two polls of the mailbox.
+	MailboxInterval uint
+
+	// MailRateLimit is the maximum number of mails
+	// accepted per sender and hour. A sender exceeding
+	// it is considered to be looping. 0 disables the
+	// limit.
+	MailRateLimit uint
+
+	// MailTemplates is the path to the directory
+	// holding the mail templates with one
+	// subdirectory per language.
+	MailTemplates string
+
+	// MailLanguage is the language of the mails
+	// sent to recipients without a known language.
+	MailLanguage string
+
+	// SLAHours is the number of hours within which
+	// an answer of the customer has to be answered.
+	// The editors are warned before it passes. Zero
+	// disables the warnings.
+	SLAHours uint
+
+	// DailyDigest is the time of day (15:04) at which
+	// the editors get a summary of their open tickets.
+	// An empty time disables the digest.
+	DailyDigest string
 }
 
+// DailyDigestFormat is the format of the time of day
+// at which the daily digest is sent.
+const DailyDigestFormat string = "15:04"
+
 // CLIConfig is a struct to hold the CLI config
 // parameters provided on startup.
 type CLIConfig struct {
@@ -88,6 +218,18 @@ type LogConfig struct {
 // mail ids.
 const RandomIDLength int = 10
 
+// TicketNumberDigits is the number of digits of the
+// sequence number in a ticket id such as TT-2019-000123.
+const TicketNumberDigits int = 6
+
+// TicketSequence is the persisted state of the sequential
+// ticket numbers. Number is the last number assigned in
+// the given year.
+type TicketSequence struct {
+	Year   int `json:"year"`
+	Number int `json:"number"`
+}
+
 // LogLevel is a type that defines the level of logging.
 // A high log level such as INFO means that more
 // information and actions are logged to the console.
@@ -159,6 +301,254 @@ func AsLogLevel(logLevelString string) LogLevel {
 	return LogLevel(-1)
 }
 
+// AssignStrategy is a type that defines how new tickets
+// are distributed across the editors automatically.
+type AssignStrategy int
+
+const (
+	// AssignNone disables the automatic assignment, new
+	// tickets stay unassigned (default).
+	AssignNone AssignStrategy = iota
+
+	// AssignRoundRobin assigns new tickets to the editors
+	// in turns.
+	AssignRoundRobin
+
+	// AssignLeastOpen assigns new tickets to the editor
+	// with the fewest tickets in progress.
+	AssignLeastOpen
+
+	// AssignSkills assigns new tickets to the editor whose
+	// skills match the ticket's tags and subject best.
+	AssignSkills
+)
+
+// String converts an assignment strategy to its
+// corresponding configuration string.
+func (strategy AssignStrategy) String() string {
+	switch strategy {
+	case AssignNone:
+		return "none"
+
+	case AssignRoundRobin:
+		return "round-robin"
+
+	case AssignLeastOpen:
+		return "least-open"
+
+	case AssignSkills:
+		return "skills"
+	}
+
+	return "undefined"
+}
+
+// AsAssignStrategy converts a given strategy string
+// to an assignment strategy. If the strategy string
+// is not defined, the return value is -1.
+func AsAssignStrategy(strategyString string) AssignStrategy {
+	switch strategyString {
+	case "none":
+		return AssignNone
+
+	case "round-robin":
+		return AssignRoundRobin
+
+	case "least-open":
+		return AssignLeastOpen
+
+	case "skills":
+		return AssignSkills
+	}
+
+	return AssignStrategy(-1)
+}
+
+// HolidayPolicy is a type that defines what happens to
+// the tickets in progress of an editor who enables the
+// vacation mode.
+type HolidayPolicy int
+
+const (
+	// HolidayKeep leaves the tickets assigned to the
+	// editor on holiday (default).
+	HolidayKeep HolidayPolicy = iota
+
+	// HolidayRelease returns the tickets to the queue
+	// of open tickets.
+	HolidayRelease
+
+	// HolidayReassign hands the tickets over to other
+	// editors using the assignment strategy.
+	HolidayReassign
+)
+
+// String converts a holiday policy to its corresponding
+// configuration string.
+func (policy HolidayPolicy) String() string {
+	switch policy {
+	case HolidayKeep:
+		return "keep"
+
+	case HolidayRelease:
+		return "release"
+
+	case HolidayReassign:
+		return "reassign"
+	}
+
+	return "undefined"
+}
+
+// DuplicatePolicy defines what happens to a new ticket
+// which looks like a duplicate of an open ticket of the
+// same customer.
+type DuplicatePolicy int
+
+const (
+	// DuplicateNone disables the duplicate detection.
+	DuplicateNone DuplicatePolicy = iota
+
+	// DuplicateFlag marks the new ticket as possible
+	// duplicate which an editor has to confirm.
+	DuplicateFlag
+
+	// DuplicateMerge merges the new ticket into the
+	// open ticket automatically.
+	DuplicateMerge
+)
+
+// String converts a duplicate policy to its corresponding
+// configuration string.
+func (policy DuplicatePolicy) String() string {
+	switch policy {
+	case DuplicateNone:
+		return "none"
+
+	case DuplicateFlag:
+		return "flag"
+
+	case DuplicateMerge:
+		return "merge"
+	}
+
+	return "undefined"
+}
+
+// AsDuplicatePolicy converts a given policy string to a
+// duplicate policy. If the policy string is not defined,
+// the return value is -1.
+func AsDuplicatePolicy(policyString string) DuplicatePolicy {
+	switch policyString {
+	case "none":
+		return DuplicateNone
+
+	case "flag":
+		return DuplicateFlag
+
+	case "merge":
+		return DuplicateMerge
+	}
+
+	return DuplicatePolicy(-1)
+}
+
+// Role is the role of a user which defines whom the
+// user may assign tickets to.
+type Role int
+
+const (
+	// RoleAgent may only assign open tickets to
+	// themselves.
+	RoleAgent Role = iota
+
+	// RoleSupervisor may assign and reassign tickets
+	// to every editor.
+	RoleSupervisor
+)
+
+// String converts a role to its corresponding
+// description.
+func (role Role) String() string {
+	switch role {
+	case RoleAgent:
+		return "agent"
+
+	case RoleSupervisor:
+		return "supervisor"
+	}
+
+	return "undefined"
+}
+
+// Priority is the priority of a ticket. Tickets have
+// a normal priority unless it is changed by a rule.
+type Priority int
+
+const (
+	// PriorityNormal is the priority of new tickets.
+	PriorityNormal Priority = iota
+
+	// PriorityLow marks tickets which can wait.
+	PriorityLow
+
+	// PriorityHigh marks urgent tickets.
+	PriorityHigh
+)
+
+// String converts a priority to its corresponding
+// description.
+func (priority Priority) String() string {
+	switch priority {
+	case PriorityNormal:
+		return "normal"
+
+	case PriorityLow:
+		return "low"
+
+	case PriorityHigh:
+		return "high"
+	}
+
+	return "undefined"
+}
+
+// AsPriority converts a given priority string to a
+// priority. If the priority string is not defined,
+// the return value is -1.
+func AsPriority(priorityString string) Priority {
+	switch priorityString {
+	case "normal":
+		return PriorityNormal
+
+	case "low":
+		return PriorityLow
+
+	case "high":
+		return PriorityHigh
+	}
+
+	return Priority(-1)
+}
+
+// AsHolidayPolicy converts a given policy string to a
+// holiday policy. If the policy string is not defined,
+// the return value is -1.
+func AsHolidayPolicy(policyString string) HolidayPolicy {
+	switch policyString {
+	case "keep":
+		return HolidayKeep
+
+	case "release":
+		return HolidayRelease
+
+	case "reassign":
+		return HolidayReassign
+	}
+
+	return HolidayPolicy(-1)
+}
+
 // Session is a struct that holds session variables
 // for a certain user.
 type Session struct {
@@ -178,49 +568,606 @@ type SessionManager struct {
 
 // User is the model for a user that works on tickets.
 type User struct {
-	ID          string `json:"id"`
-	Name        string `json:"name"`
-	Username    string `json:"username"`
-	Mail        string `json:"mail"`
-	Hash        string `json:"hash"`
-	IsOnHoliday bool   `json:"isOnHoliday"`
+	ID          string   `json:"id"`
+	Name        string   `json:"name"`
+	Username    string   `json:"username"`
+	Mail        string   `json:"mail"`
+	Hash        string   `json:"hash"`
+	IsOnHoliday bool     `json:"isOnHoliday"`
+	Skills      []string `json:"skills"`
+	Role        Role     `json:"role"`
+
+	// Holidays are the scheduled absences of the
+	// user. ScheduledHoliday is set while the vacation
+	// mode was enabled by one of these schedules.
+	Holidays         []Holiday `json:"holidays"`
+	ScheduledHoliday bool      `json:"scheduledHoliday"`
+
+	// Notifications are the notification mails the
+	// user has turned off. DigestSent is the time at
+	// which the last daily digest was sent.
+	Notifications Notifications `json:"notifications"`
+	DigestSent    time.Time     `json:"digestSent"`
+}
+
+// IsSupervisor reports whether the user may assign
+// tickets to other editors.
+func (user User) IsSupervisor() bool {
+	return user.Role == RoleSupervisor
+}
+
+// Holiday is a scheduled absence of a user. The
+// vacation mode is enabled from Start until End.
+type Holiday struct {
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"`
+}
+
+// IsActive reports whether the given time lies within
+// the holiday.
+func (holiday Holiday) IsActive(now time.Time) bool {
+	return !now.Before(holiday.Start) && now.Before(holiday.End)
+}
+
+// LastDay returns the last day of the holiday. The end
+// of a holiday is exclusive, so this is the day before.
+func (holiday Holiday) LastDay() time.Time {
+	return holiday.End.AddDate(0, 0, -1)
+}
+
+// Notifications are the preferences of a user which
+// notification mails about the own tickets are sent.
+// All notifications are sent unless they are muted.
+type Notifications struct {
+	MuteCustomerReply bool `json:"muteCustomerReply"`
+	MuteAssignment    bool `json:"muteAssignment"`
+	MuteSLAWarning    bool `json:"muteSlaWarning"`
+	MuteMention       bool `json:"muteMention"`
+	MuteDigest        bool `json:"muteDigest"`
 }
 
 // Data holds session and ticket data to parse
 // to the web templates.
 type Data struct {
-	Session Session
-	Tickets map[string]Ticket
-	Users   map[string]User
+	Session   Session
+	Tickets   map[string]Ticket
+	Users     map[string]User
+	Responses []CannedResponse
+	Macros    []Macro
 }
 
 // DataSingleTicket holds the session and ticket
-// data for a call to a single ticket.
+// data for a call to a single ticket. The rendered
+// responses contain the canned responses filled
+// with the data of the ticket.
 type DataSingleTicket struct {
-	Session Session
-	Ticket  Ticket
-	Tickets map[string]Ticket
-	Users   map[string]User
+	Session           Session
+	Ticket            Ticket
+	Tickets           map[string]Ticket
+	Users             map[string]User
+	Responses         []CannedResponse
+	RenderedResponses []CannedResponse
+	Macros            []Macro
+}
+
+// CannedResponse is a predefined reply which can be
+// inserted into the answer of a ticket. The text is
+// a template which is filled with the ticket data,
+// e.g. {{.Customer}} or {{.ID}}. A response without
+// an owner is shared among all users, otherwise it is
+// only available to the user with the owner's username.
+type CannedResponse struct {
+	ID    string `json:"id"`
+	Title string `json:"title"`
+	Text  string `json:"text"`
+	Owner string `json:"owner"`
+}
+
+// IsShared reports whether the response is available
+// to all users.
+func (response CannedResponse) IsShared() bool {
+	return response.Owner == ""
+}
+
+// MacroAssignSelf is the value of Macro.AssignTo that
+// assigns the ticket to the user applying the macro.
+const MacroAssignSelf string = "@me"
+
+// Macro is a set of actions which are applied to a
+// ticket in one step. The reply is a template like
+// the text of a canned response and is only added if
+// it is not empty. The status is only changed if
+// ChangeStatus is set and AssignTo contains either
+// the username of the new editor, MacroAssignSelf or
+// nothing to keep the current editor. Macros are
+// shared or personal like canned responses.
+type Macro struct {
+	ID           string   `json:"id"`
+	Title        string   `json:"title"`
+	Owner        string   `json:"owner"`
+	Reply        string   `json:"reply"`
+	ReplyType    string   `json:"replyType"`
+	ChangeStatus bool     `json:"changeStatus"`
+	Status       Status   `json:"status"`
+	Tags         []string `json:"tags"`
+	AssignTo     string   `json:"assignTo"`
+}
+
+// IsShared reports whether the macro is available
+// to all users.
+func (macro Macro) IsShared() bool {
+	return macro.Owner == ""
+}
+
+// Rule is an automation rule of the form "when an event
+// occurs, if all conditions match, then apply the actions".
+// Events lists the ticket events on which the rule is
+// evaluated; a rule without events is evaluated on every
+// event. Disabled rules are never evaluated.
+type Rule struct {
+	ID         string          `json:"id"`
+	Title      string          `json:"title"`
+	Events     []string        `json:"events"`
+	Conditions []RuleCondition `json:"conditions"`
+	Actions    []RuleAction    `json:"actions"`
+	Disabled   bool            `json:"disabled"`
+}
+
+// RuleCondition compares a field of a ticket, such as the
+// subject or the domain of the customer, with a value
+// using the operator.
+type RuleCondition struct {
+	Field    string `json:"field"`
+	Operator string `json:"operator"`
+	Value    string `json:"value"`
+}
+
+// RuleAction changes a ticket, e.g. by adding a tag or
+// assigning an editor. The meaning of the value depends
+// on the type of the action.
+type RuleAction struct {
+	Type  string `json:"type"`
+	Value string `json:"value"`
+}
+
+// FiredRule records that a rule was applied to a ticket
+// on the given event.
+type FiredRule struct {
+	Rule  string    `json:"rule"`
+	Title string    `json:"title"`
+	Event string    `json:"event"`
+	Date  time.Time `json:"date"`
+}
+
+// Customer is an entry of the customer directory. A customer
+// can write from several mail addresses, all of which link
+// new tickets to the customer.
+type Customer struct {
+	ID           string   `json:"id"`
+	Name         string   `json:"name"`
+	Organization string   `json:"organization"`
+	Mails        []string `json:"mails"`
+	Phone        string   `json:"phone"`
+	Notes        string   `json:"notes"`
+	Language     string   `json:"language,omitempty"`
+}
+
+// HasMail reports whether the given mail address belongs
+// to the customer. Mail addresses are compared case
+// insensitively.
+func (customer Customer) HasMail(mail string) bool {
+	for _, customerMail := range customer.Mails {
+		if strings.EqualFold(customerMail, mail) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// DisplayName returns the name of the customer or the
+// first mail address if no name is known yet.
+func (customer Customer) DisplayName() string {
+	if customer.Name != "" || len(customer.Mails) == 0 {
+		return customer.Name
+	}
+
+	return customer.Mails[0]
+}
+
+// HistoryEntry is an entry of one of the tickets of a
+// customer shown in the history on the customer page.
+type HistoryEntry struct {
+	TicketID string
+	Subject  string
+	Entry    Entry
+}
+
+// BulkResult is the outcome of a bulk action for a single
+// ticket. Message explains why the action could not be
+// applied to the ticket.
+type BulkResult struct {
+	Ticket  string `json:"ticket"`
+	Success bool   `json:"success"`
+	Message string `json:"message"`
 }
 
+// AccessTokenLength is the number of random bytes of
+// the token which authorizes customers to access their
+// ticket on the web.
+const AccessTokenLength int = 16
+
 // Ticket represents a ticket.
 type Ticket struct {
-	ID       string  `json:"id"`
-	Subject  string  `json:"subject"`
-	Status   Status  `json:"status"`
-	User     User    `json:"user"`
-	Customer string  `json:"customer"`
-	Entries  []Entry `json:"entries"`
-	MergeTo  string  `json:"mergeTo"`
+	ID       string    `json:"id"`
+	Subject  string    `json:"subject"`
+	Status   Status    `json:"status"`
+	User     User      `json:"user"`
+	Customer string    `json:"customer"`
+	Entries  []Entry   `json:"entries"`
+	MergeTo  string    `json:"mergeTo"`
+	Tags     []string  `json:"tags"`
+	WorkLogs []WorkLog `json:"workLogs"`
+
+	// SnoozedUntil hides the ticket from the dashboard of
+	// the editor until the given time. FollowUp marks the
+	// time at which the editor wants to be reminded of the
+	// ticket. Reminder is set as soon as one of them is due
+	// and cleared when the editor works on the ticket.
+	SnoozedUntil time.Time `json:"snoozedUntil"`
+	FollowUp     time.Time `json:"followUp"`
+	Reminder     bool      `json:"reminder"`
+
+	// StaleReminded is the time at which the customer
+	// was reminded to answer the ticket. It is zero
+	// if no reminder is pending.
+	StaleReminded time.Time `json:"staleReminded"`
+
+	// SLAWarned is the time at which the editor was
+	// warned that the response time of the latest
+	// answer of the customer is about to pass.
+	SLAWarned time.Time `json:"slaWarned"`
+
+	// AccessToken authorizes customers to view and
+	// answer the ticket on the web without a login.
+	AccessToken string `json:"accessToken"`
+
+	// MessageIDs are the Message-IDs of the mails
+	// which were sent about the ticket. Only replies
+	// to one of them are threaded into the ticket.
+	MessageIDs []string `json:"messageIds,omitempty"`
+
+	// Rating holds the satisfaction survey of the
+	// customer after the ticket was closed.
+	Rating Rating `json:"rating"`
+
+	// CustomerID links the ticket to the customer
+	// in the customer directory.
+	CustomerID string `json:"customerId"`
+
+	// DuplicateOf holds the id of the ticket of which
+	// this ticket is a possible duplicate until an
+	// editor confirms or dismisses it.
+	DuplicateOf string `json:"duplicateOf"`
+
+	// Priority is the priority of the ticket and
+	// FiredRules the log of the automation rules
+	// applied to the ticket.
+	Priority   Priority    `json:"priority"`
+	FiredRules []FiredRule `json:"firedRules"`
+}
+
+// IsSnoozed reports whether the ticket is parked until
+// a later time.
+func (ticket Ticket) IsSnoozed() bool {
+	return !ticket.SnoozedUntil.IsZero()
+}
+
+// HasFollowUp reports whether a follow-up is scheduled
+// for the ticket.
+func (ticket Ticket) HasFollowUp() bool {
+	return !ticket.FollowUp.IsZero()
+}
+
+// TotalMinutes returns the time in minutes which was
+// logged on the ticket and all its entries.
+func (ticket Ticket) TotalMinutes() int {
+	total := 0
+	for _, workLog := range ticket.WorkLogs {
+		total += workLog.Minutes
+	}
+
+	return total
+}
+
+// EntryMinutes returns the time in minutes which was
+// logged on the given entry of the ticket.
+func (ticket Ticket) EntryMinutes(entry Entry) int {
+	total := 0
+	for _, workLog := range ticket.WorkLogs {
+		if !workLog.IsTicketLevel() && workLog.Entry.Equal(entry.Date) {
+			total += workLog.Minutes
+		}
+	}
+
+	return total
 }
 
 // Entry describes a single reply within a ticket.
+// Revisions hold the audit trail of all changes to
+// the entry after it has been written. Entries out
+// of incoming mails keep the mail's Message-ID and,
+// if quoted text was removed, the full message.
 type Entry struct {
-	Date          time.Time `json:"id"`
+	Date          time.Time    `json:"id"`
+	FormattedDate string       `json:"formattedDate"`
+	User          string       `json:"user"`
+	Text          string       `json:"text"`
+	ReplyType     string       `json:"replyType"`
+	Revisions     []Revision   `json:"revisions"`
+	Redacted      bool         `json:"redacted"`
+	Attachments   []Attachment `json:"attachments,omitempty"`
+	MessageID     string       `json:"messageId,omitempty"`
+	FullText      string       `json:"fullText,omitempty"`
+}
+
+// Attachment describes a file attached to an entry,
+// e.g. out of an incoming mail. The content is stored
+// in the attachment directory under the id.
+type Attachment struct {
+	ID          string `json:"id"`
+	Name        string `json:"name"`
+	ContentType string `json:"contentType"`
+	Size        int    `json:"size"`
+}
+
+// IsInternal reports whether the entry is an internal
+// comment which must not be shown to customers.
+func (entry Entry) IsInternal() bool {
+	return NormalizeReplyType(entry.ReplyType) == ReplyInternal
+}
+
+// The reply types define the visibility of an entry.
+const (
+	// ReplyInternal marks an internal comment which is
+	// only visible to logged in users.
+	ReplyInternal string = "internal"
+
+	// ReplyExternal marks an answer which is visible to
+	// the customer.
+	ReplyExternal string = "external"
+)
+
+// NormalizeReplyType maps a given reply type to either
+// ReplyInternal or ReplyExternal. The abbreviations
+// "intern" and "extern" are accepted as well as an empty
+// reply type which was written for the first entry of
+// a ticket. Every other value is treated as internal so
+// that unknown entries are never shown to customers.
+func NormalizeReplyType(replyType string) string {
+	switch strings.ToLower(strings.TrimSpace(replyType)) {
+	case ReplyExternal, "extern", "":
+		return ReplyExternal
+	}
+
+	return ReplyInternal
+}
+
+// IsEdited reports whether the entry was changed after
+// it has been written.
+func (entry Entry) IsEdited() bool {
+	return len(entry.Revisions) > 0
+}
+
+// RedactedText replaces the text of redacted entries
+// and of all their previous revisions.
+const RedactedText string = "[redacted]"
+
+// SystemUser is the author of the entries which
+// are written by the ticket system itself.
+const SystemUser string = "Trivial Tickets"
+
+// Revision records a change to an entry. It contains
+// the text of the entry before the change, the user
+// who changed it and whether the change was a
+// redaction.
+type Revision struct {
+	Date          time.Time `json:"date"`
 	FormattedDate string    `json:"formattedDate"`
 	User          string    `json:"user"`
 	Text          string    `json:"text"`
-	ReplyType     string    `json:"replyType"`
+	Redaction     bool      `json:"redaction"`
+}
+
+// The bounds of the satisfaction scores a customer
+// can give to a closed ticket.
+const (
+	// MinRatingScore is the worst satisfaction score.
+	MinRatingScore int = 1
+
+	// MaxRatingScore is the best satisfaction score.
+	MaxRatingScore int = 5
+
+	// SurveyTokenLength is the number of random bytes
+	// of the token which authorizes a rating.
+	SurveyTokenLength int = 16
+)
+
+// Rating is the answer of the customer to the satisfaction
+// survey sent with the closing mail of a ticket. The token
+// authorizes the public rating link. The agent is the
+// username of the editor who was assigned to the ticket
+// when it was rated.
+type Rating struct {
+	Token         string    `json:"token"`
+	Score         int       `json:"score"`
+	Comment       string    `json:"comment"`
+	Agent         string    `json:"agent"`
+	Date          time.Time `json:"date"`
+	FormattedDate string    `json:"formattedDate"`
+}
+
+// IsRated reports whether the customer has answered
+// the survey.
+func (rating Rating) IsRated() bool {
+	return rating.Score >= MinRatingScore
+}
+
+// RatingRow holds the satisfaction scores given to one
+// agent within one period. Satisfied counts the ratings
+// with one of the two best scores.
+type RatingRow struct {
+	Period     string
+	Agent      string
+	Ratings    int
+	TotalScore int
+	Satisfied  int
+}
+
+// AverageScore returns the average score of the row
+// formatted with one decimal place.
+func (row RatingRow) AverageScore() string {
+	if row.Ratings == 0 {
+		return "-"
+	}
+
+	return strconv.FormatFloat(float64(row.TotalScore)/float64(row.Ratings), 'f', 1, 64)
+}
+
+// SatisfactionPercent returns the share of satisfied
+// customers in percent, also known as CSAT score.
+func (row RatingRow) SatisfactionPercent() int {
+	if row.Ratings == 0 {
+		return 0
+	}
+
+	return row.Satisfied * 100 / row.Ratings
+}
+
+// DataRating holds the data for the public page on
+// which a customer rates a closed ticket. Score is the
+// score of the followed link and Recorded is set once
+// the customer confirmed it.
+type DataRating struct {
+	Ticket   Ticket
+	URL      string
+	Score    int
+	Recorded bool
+}
+
+// WorkLog records the time a user spent on a ticket.
+// The time is either logged on the whole ticket or on
+// a single entry which is referenced by its date. The
+// user is stored by the username.
+type WorkLog struct {
+	Date          time.Time `json:"date"`
+	FormattedDate string    `json:"formattedDate"`
+	User          string    `json:"user"`
+	Minutes       int       `json:"minutes"`
+	Entry         time.Time `json:"entry"`
+	Note          string    `json:"note"`
+}
+
+// IsTicketLevel reports whether the time was logged
+// on the whole ticket instead of a single entry.
+func (workLog WorkLog) IsTicketLevel() bool {
+	return workLog.Entry.IsZero()
+}
+
+// ReportPeriod is an enum to represent the period
+// by which the logged time is aggregated in the
+// worklog report.
+type ReportPeriod int
+
+const (
+	// PeriodDay aggregates the logged time by day.
+	PeriodDay ReportPeriod = iota
+
+	// PeriodWeek aggregates the logged time by
+	// calendar week.
+	PeriodWeek
+
+	// PeriodMonth aggregates the logged time by
+	// month.
+	PeriodMonth
+)
+
+// String converts a report period to its string
+// representation.
+func (period ReportPeriod) String() string {
+	switch period {
+	case PeriodDay:
+		return "day"
+
+	case PeriodWeek:
+		return "week"
+
+	case PeriodMonth:
+		return "month"
+	}
+
+	return "undefined period"
+}
+
+// AsReportPeriod converts a string to the
+// corresponding report period. If the string
+// does not match any period -1 is returned.
+func AsReportPeriod(periodString string) ReportPeriod {
+	switch periodString {
+	case "day":
+		return PeriodDay
+
+	case "week":
+		return PeriodWeek
+
+	case "month":
+		return PeriodMonth
+	}
+
+	return ReportPeriod(-1)
+}
+
+// ReportRow holds the time logged by one agent for
+// one customer within one period.
+type ReportRow struct {
+	Period   string
+	Agent    string
+	Customer string
+	Minutes  int
+}
+
+// DataReport holds the session and the aggregated
+// worklog for the report page.
+type DataReport struct {
+	Session      Session
+	From         string
+	To           string
+	Period       ReportPeriod
+	Rows         []ReportRow
+	TotalMinutes int
+	Ratings      []RatingRow
+}
+
+// DataCustomers holds the session and the customers
+// of the customer directory, optionally restricted to
+// a single organization.
+type DataCustomers struct {
+	Session       Session
+	Customers     []Customer
+	Organizations []string
+	Organization  string
+	Languages     []string
+}
+
+// DataCustomer holds the session and the customer as
+// well as the tickets and their history for the page
+// of a single customer.
+type DataCustomer struct {
+	Session   Session
+	Customer  Customer
+	Tickets   []Ticket
+	History   []HistoryEntry
+	Languages []string
 }
 
 // Status is an enum to represent the current
@@ -260,13 +1207,23 @@ func (status Status) String() string {
 
 // Mail struct holds the information for a
 // received email in order to create new
-// tickets or answers.
+// tickets or answers. Outgoing mails carry
+// their Message-ID and the ticket they
+// belong to.
 type Mail struct {
-	ID      string `json:"id"`
-	From    string `json:"from"`
-	To      string `json:"to"`
-	Subject string `json:"subject"`
-	Message string `json:"message"`
+	ID          string `json:"id"`
+	From        string `json:"from"`
+	To          string `json:"to"`
+	Subject     string `json:"subject"`
+	Message     string `json:"message"`
+	HTMLMessage string `json:"htmlMessage,omitempty"`
+	MessageID   string `json:"messageId,omitempty"`
+	TicketID    string `json:"ticketId,omitempty"`
+
+	// MIME is the complete message in the Internet
+	// Message Format. It is only set in responses of
+	// the mail API requesting the MIME format.
+	MIME string `json:"mime,omitempty"`
 }
 
 // JSONMap is a type for mapping JSON keys to
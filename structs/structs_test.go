@@ -21,6 +21,7 @@ package structs
 
 import (
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 
@@ -92,6 +93,324 @@ func TestAsLogLevel(t *testing.T) {
 	})
 }
 
+func TestAssignStrategy_String(t *testing.T) {
+	testlog.BeginTest()
+	defer testlog.EndTest()
+
+	t.Run("noneString", func(t *testing.T) {
+		assert.Equal(t, "none", AssignNone.String())
+	})
+
+	t.Run("roundRobinString", func(t *testing.T) {
+		assert.Equal(t, "round-robin", AssignRoundRobin.String())
+	})
+
+	t.Run("leastOpenString", func(t *testing.T) {
+		assert.Equal(t, "least-open", AssignLeastOpen.String())
+	})
+
+	t.Run("skillsString", func(t *testing.T) {
+		assert.Equal(t, "skills", AssignSkills.String())
+	})
+
+	t.Run("undefinedString", func(t *testing.T) {
+		assert.Equal(t, "undefined", AssignStrategy(7).String())
+	})
+}
+
+func TestAsAssignStrategy(t *testing.T) {
+	testlog.BeginTest()
+	defer testlog.EndTest()
+
+	t.Run("noneString", func(t *testing.T) {
+		assert.Equal(t, AssignNone, AsAssignStrategy("none"))
+	})
+
+	t.Run("roundRobinString", func(t *testing.T) {
+		assert.Equal(t, AssignRoundRobin, AsAssignStrategy("round-robin"))
+	})
+
+	t.Run("leastOpenString", func(t *testing.T) {
+		assert.Equal(t, AssignLeastOpen, AsAssignStrategy("least-open"))
+	})
+
+	t.Run("skillsString", func(t *testing.T) {
+		assert.Equal(t, AssignSkills, AsAssignStrategy("skills"))
+	})
+
+	t.Run("undefinedString", func(t *testing.T) {
+		assert.Equal(t, AssignStrategy(-1), AsAssignStrategy("undefined"))
+	})
+}
+
+func TestHolidayPolicy_String(t *testing.T) {
+	testlog.BeginTest()
+	defer testlog.EndTest()
+
+	t.Run("keepString", func(t *testing.T) {
+		assert.Equal(t, "keep", HolidayKeep.String())
+	})
+
+	t.Run("releaseString", func(t *testing.T) {
+		assert.Equal(t, "release", HolidayRelease.String())
+	})
+
+	t.Run("reassignString", func(t *testing.T) {
+		assert.Equal(t, "reassign", HolidayReassign.String())
+	})
+
+	t.Run("undefinedString", func(t *testing.T) {
+		assert.Equal(t, "undefined", HolidayPolicy(7).String())
+	})
+}
+
+func TestAsHolidayPolicy(t *testing.T) {
+	t.Run("keepString", func(t *testing.T) {
+		assert.Equal(t, HolidayKeep, AsHolidayPolicy("keep"))
+	})
+
+	t.Run("releaseString", func(t *testing.T) {
+		assert.Equal(t, HolidayRelease, AsHolidayPolicy("release"))
+	})
+
+	t.Run("reassignString", func(t *testing.T) {
+		assert.Equal(t, HolidayReassign, AsHolidayPolicy("reassign"))
+	})
+
+	t.Run("undefinedString", func(t *testing.T) {
+		assert.Equal(t, HolidayPolicy(-1), AsHolidayPolicy("undefined"))
+	})
+}
+
+func TestDuplicatePolicy_String(t *testing.T) {
+	testlog.BeginTest()
+	defer testlog.EndTest()
+
+	t.Run("noneString", func(t *testing.T) {
+		assert.Equal(t, "none", DuplicateNone.String())
+	})
+
+	t.Run("flagString", func(t *testing.T) {
+		assert.Equal(t, "flag", DuplicateFlag.String())
+	})
+
+	t.Run("mergeString", func(t *testing.T) {
+		assert.Equal(t, "merge", DuplicateMerge.String())
+	})
+
+	t.Run("undefinedString", func(t *testing.T) {
+		assert.Equal(t, "undefined", DuplicatePolicy(7).String())
+	})
+}
+
+func TestAsDuplicatePolicy(t *testing.T) {
+	t.Run("noneString", func(t *testing.T) {
+		assert.Equal(t, DuplicateNone, AsDuplicatePolicy("none"))
+	})
+
+	t.Run("flagString", func(t *testing.T) {
+		assert.Equal(t, DuplicateFlag, AsDuplicatePolicy("flag"))
+	})
+
+	t.Run("mergeString", func(t *testing.T) {
+		assert.Equal(t, DuplicateMerge, AsDuplicatePolicy("merge"))
+	})
+
+	t.Run("undefinedString", func(t *testing.T) {
+		assert.Equal(t, DuplicatePolicy(-1), AsDuplicatePolicy("undefined"))
+	})
+}
+
+func TestRole_String(t *testing.T) {
+	testlog.BeginTest()
+	defer testlog.EndTest()
+
+	t.Run("agentString", func(t *testing.T) {
+		assert.Equal(t, "agent", RoleAgent.String())
+	})
+
+	t.Run("supervisorString", func(t *testing.T) {
+		assert.Equal(t, "supervisor", RoleSupervisor.String())
+	})
+
+	t.Run("undefinedString", func(t *testing.T) {
+		assert.Equal(t, "undefined", Role(7).String())
+	})
+}
+
+func TestPriority_String(t *testing.T) {
+	testlog.BeginTest()
+	defer testlog.EndTest()
+
+	t.Run("normalString", func(t *testing.T) {
+		assert.Equal(t, "normal", PriorityNormal.String())
+	})
+
+	t.Run("lowString", func(t *testing.T) {
+		assert.Equal(t, "low", PriorityLow.String())
+	})
+
+	t.Run("highString", func(t *testing.T) {
+		assert.Equal(t, "high", PriorityHigh.String())
+	})
+
+	t.Run("undefinedString", func(t *testing.T) {
+		assert.Equal(t, "undefined", Priority(7).String())
+	})
+}
+
+func TestAsPriority(t *testing.T) {
+	t.Run("normalString", func(t *testing.T) {
+		assert.Equal(t, PriorityNormal, AsPriority("normal"))
+	})
+
+	t.Run("lowString", func(t *testing.T) {
+		assert.Equal(t, PriorityLow, AsPriority("low"))
+	})
+
+	t.Run("highString", func(t *testing.T) {
+		assert.Equal(t, PriorityHigh, AsPriority("high"))
+	})
+
+	t.Run("undefinedString", func(t *testing.T) {
+		assert.Equal(t, Priority(-1), AsPriority("undefined"))
+	})
+}
+
+func TestReportPeriod_String(t *testing.T) {
+	testlog.BeginTest()
+	defer testlog.EndTest()
+
+	t.Run("dayString", func(t *testing.T) {
+		assert.Equal(t, "day", PeriodDay.String())
+	})
+
+	t.Run("weekString", func(t *testing.T) {
+		assert.Equal(t, "week", PeriodWeek.String())
+	})
+
+	t.Run("monthString", func(t *testing.T) {
+		assert.Equal(t, "month", PeriodMonth.String())
+	})
+
+	t.Run("undefinedString", func(t *testing.T) {
+		assert.Equal(t, "undefined period", ReportPeriod(7).String())
+	})
+}
+
+func TestAsReportPeriod(t *testing.T) {
+	t.Run("dayString", func(t *testing.T) {
+		assert.Equal(t, PeriodDay, AsReportPeriod("day"))
+	})
+
+	t.Run("weekString", func(t *testing.T) {
+		assert.Equal(t, PeriodWeek, AsReportPeriod("week"))
+	})
+
+	t.Run("monthString", func(t *testing.T) {
+		assert.Equal(t, PeriodMonth, AsReportPeriod("month"))
+	})
+
+	t.Run("undefinedString", func(t *testing.T) {
+		assert.Equal(t, ReportPeriod(-1), AsReportPeriod("year"))
+	})
+}
+
+func TestTicket_TotalMinutes(t *testing.T) {
+	testlog.BeginTest()
+	defer testlog.EndTest()
+
+	entryDate := time.Date(2019, time.January, 7, 10, 0, 0, 0, time.UTC)
+	ticket := Ticket{
+		Entries: []Entry{{Date: entryDate}, {Date: entryDate.Add(time.Hour)}},
+		WorkLogs: []WorkLog{
+			{Minutes: 30},
+			{Minutes: 15, Entry: entryDate},
+			{Minutes: 20, Entry: entryDate},
+		},
+	}
+
+	t.Run("total", func(t *testing.T) {
+		assert.Equal(t, 65, ticket.TotalMinutes())
+	})
+
+	t.Run("entry", func(t *testing.T) {
+		assert.Equal(t, 35, ticket.EntryMinutes(ticket.Entries[0]))
+		assert.Equal(t, 0, ticket.EntryMinutes(ticket.Entries[1]))
+	})
+
+	t.Run("ticketLevel", func(t *testing.T) {
+		assert.True(t, ticket.WorkLogs[0].IsTicketLevel())
+		assert.False(t, ticket.WorkLogs[1].IsTicketLevel())
+	})
+}
+
+func TestHoliday_IsActive(t *testing.T) {
+	testlog.BeginTest()
+	defer testlog.EndTest()
+
+	start := time.Date(2019, time.January, 7, 0, 0, 0, 0, time.UTC)
+	holiday := Holiday{Start: start, End: start.AddDate(0, 0, 5)}
+
+	t.Run("beforeStart", func(t *testing.T) {
+		assert.False(t, holiday.IsActive(start.Add(-time.Minute)))
+	})
+
+	t.Run("atStart", func(t *testing.T) {
+		assert.True(t, holiday.IsActive(start))
+	})
+
+	t.Run("atEnd", func(t *testing.T) {
+		assert.False(t, holiday.IsActive(holiday.End))
+	})
+}
+
+func TestNormalizeReplyType(t *testing.T) {
+	testlog.BeginTest()
+	defer testlog.EndTest()
+
+	t.Run("internal", func(t *testing.T) {
+		assert.Equal(t, ReplyInternal, NormalizeReplyType("internal"))
+		assert.Equal(t, ReplyInternal, NormalizeReplyType("intern"))
+	})
+
+	t.Run("external", func(t *testing.T) {
+		assert.Equal(t, ReplyExternal, NormalizeReplyType("external"))
+		assert.Equal(t, ReplyExternal, NormalizeReplyType("Extern"))
+		assert.Equal(t, ReplyExternal, NormalizeReplyType(""))
+	})
+
+	t.Run("unknown", func(t *testing.T) {
+		assert.Equal(t, ReplyInternal, NormalizeReplyType("something"), "unknown types should be internal")
+	})
+}
+
+func TestEntry_IsInternal(t *testing.T) {
+	testlog.BeginTest()
+	defer testlog.EndTest()
+
+	assert.True(t, Entry{ReplyType: "intern"}.IsInternal())
+	assert.False(t, Entry{ReplyType: "extern"}.IsInternal())
+}
+
+func TestEntry_IsEdited(t *testing.T) {
+	testlog.BeginTest()
+	defer testlog.EndTest()
+
+	assert.False(t, Entry{Text: "text"}.IsEdited())
+	assert.True(t, Entry{Text: "text", Revisions: []Revision{{Text: "old"}}}.IsEdited())
+}
+
+func TestHoliday_LastDay(t *testing.T) {
+	testlog.BeginTest()
+	defer testlog.EndTest()
+
+	start := time.Date(2019, time.January, 7, 0, 0, 0, 0, time.UTC)
+	holiday := Holiday{Start: start, End: start.AddDate(0, 0, 5)}
+
+	assert.Equal(t, start.AddDate(0, 0, 4), holiday.LastDay())
+}
+
 func TestStatus_String(t *testing.T) {
 	testlog.BeginTest()
 	defer testlog.EndTest()
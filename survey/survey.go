@@ -0,0 +1,121 @@
+// Trivial Tickets Ticketsystem
+// Copyright (C) 2019 The Contributors
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+// Package survey aggregates the satisfaction ratings of
+// closed tickets to CSAT reports per agent and period.
+package survey
+
+import (
+	"encoding/csv"
+	"io"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/mortenterhart/trivial-tickets/structs"
+	"github.com/mortenterhart/trivial-tickets/worklog"
+)
+
+/*
+ * Ticketsystem Trivial Tickets
+ *
+ * Matriculation numbers: 3040018, 6694964, 3478222
+ * Lecture:               Programmieren II, INF16B
+ * Lecturer:              Herr Prof. Dr. Helmut Neemann
+ * Institute:             Duale Hochschule Baden-Württemberg Mosbach
+ *
+ * ---------------
+ *
+ * Package survey
+ * Reports of the customer satisfaction
+ */
+
+// satisfiedScore is the lowest score which counts
+// as a satisfied customer.
+const satisfiedScore = structs.MaxRatingScore - 1
+
+// Report aggregates the ratings given between from (inclusive)
+// and to (exclusive) by period and agent. The rows are sorted
+// in this order.
+func Report(tickets map[string]structs.Ticket, from, to time.Time, period structs.ReportPeriod) []structs.RatingRow {
+	rowIndex := make(map[structs.RatingRow]int)
+	var rows []structs.RatingRow
+
+	for _, currentTicket := range tickets {
+		rating := currentTicket.Rating
+		if !rating.IsRated() || rating.Date.Before(from) || !rating.Date.Before(to) {
+			continue
+		}
+
+		key := structs.RatingRow{
+			Period: worklog.PeriodLabel(rating.Date, period),
+			Agent:  rating.Agent,
+		}
+
+		index, exists := rowIndex[key]
+		if !exists {
+			index = len(rows)
+			rowIndex[key] = index
+			rows = append(rows, key)
+		}
+
+		rows[index].Ratings++
+		rows[index].TotalScore += rating.Score
+		if rating.Score >= satisfiedScore {
+			rows[index].Satisfied++
+		}
+	}
+
+	sort.Slice(rows, func(i, j int) bool {
+		if rows[i].Period != rows[j].Period {
+			return rows[i].Period < rows[j].Period
+		}
+
+		return rows[i].Agent < rows[j].Agent
+	})
+
+	return rows
+}
+
+// WriteCSV writes the rating rows as CSV with a header
+// line to the given writer.
+func WriteCSV(writer io.Writer, rows []structs.RatingRow) error {
+	csvWriter := csv.NewWriter(writer)
+
+	if writeErr := csvWriter.Write([]string{"period", "agent", "ratings", "average", "csat"}); writeErr != nil {
+		return errors.Wrap(writeErr, "could not write CSV header")
+	}
+
+	for _, row := range rows {
+		record := []string{
+			row.Period,
+			row.Agent,
+			strconv.Itoa(row.Ratings),
+			row.AverageScore(),
+			strconv.Itoa(row.SatisfactionPercent()),
+		}
+
+		if writeErr := csvWriter.Write(record); writeErr != nil {
+			return errors.Wrap(writeErr, "could not write CSV record")
+		}
+	}
+
+	csvWriter.Flush()
+
+	return errors.Wrap(csvWriter.Error(), "could not flush CSV report")
+}
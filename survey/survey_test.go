@@ -0,0 +1,92 @@
+// Trivial Tickets Ticketsystem
+// Copyright (C) 2019 The Contributors
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+// Package survey aggregates the satisfaction ratings of
+// closed tickets to CSAT reports per agent and period.
+package survey
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mortenterhart/trivial-tickets/log/testlog"
+	"github.com/mortenterhart/trivial-tickets/structs"
+)
+
+/*
+ * Ticketsystem Trivial Tickets
+ *
+ * Matriculation numbers: 3040018, 6694964, 3478222
+ * Lecture:               Programmieren II, INF16B
+ * Lecturer:              Herr Prof. Dr. Helmut Neemann
+ * Institute:             Duale Hochschule Baden-Württemberg Mosbach
+ *
+ * ---------------
+ *
+ * Package survey
+ * Reports of the customer satisfaction
+ */
+
+// mockRatedTickets returns three rated tickets of two agents
+// and one ticket which was not rated.
+func mockRatedTickets() map[string]structs.Ticket {
+	january := time.Date(2019, time.January, 7, 10, 0, 0, 0, time.UTC)
+
+	return map[string]structs.Ticket{
+		"abc123": {ID: "abc123", Rating: structs.Rating{Score: 5, Agent: "admin", Date: january}},
+		"def456": {ID: "def456", Rating: structs.Rating{Score: 2, Agent: "admin", Date: january}},
+		"ghi789": {ID: "ghi789", Rating: structs.Rating{Score: 4, Agent: "editor", Date: january}},
+		"jkl012": {ID: "jkl012", Rating: structs.Rating{Token: "token"}},
+	}
+}
+
+func TestReport(t *testing.T) {
+	testlog.BeginTest()
+	defer testlog.EndTest()
+
+	from := time.Date(2019, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+	t.Run("perAgent", func(t *testing.T) {
+		rows := Report(mockRatedTickets(), from, from.AddDate(0, 1, 0), structs.PeriodMonth)
+
+		if assert.Len(t, rows, 2, "ratings should be grouped by agent") {
+			assert.Equal(t, structs.RatingRow{Period: "2019-01", Agent: "admin", Ratings: 2, TotalScore: 7, Satisfied: 1}, rows[0])
+			assert.Equal(t, "3.5", rows[0].AverageScore())
+			assert.Equal(t, 50, rows[0].SatisfactionPercent())
+			assert.Equal(t, "editor", rows[1].Agent)
+		}
+	})
+
+	t.Run("outsidePeriod", func(t *testing.T) {
+		rows := Report(mockRatedTickets(), from.AddDate(0, 1, 0), from.AddDate(0, 2, 0), structs.PeriodMonth)
+
+		assert.Empty(t, rows, "ratings outside of the period should be ignored")
+	})
+}
+
+func TestWriteCSV(t *testing.T) {
+	testlog.BeginTest()
+	defer testlog.EndTest()
+
+	var buffer bytes.Buffer
+	err := WriteCSV(&buffer, []structs.RatingRow{{Period: "2019-01", Agent: "admin", Ratings: 2, TotalScore: 7, Satisfied: 1}})
+
+	assert.NoError(t, err, "writing the CSV should not fail")
+	assert.Equal(t, "period,agent,ratings,average,csat\n2019-01,admin,2,3.5,50\n", buffer.String())
+}
@@ -19,11 +19,20 @@
 package ticket
 
 import (
+	"crypto/subtle"
+	"fmt"
+	"regexp"
 	"sort"
 	"strconv"
+	"strings"
 	"time"
 
+	"github.com/pkg/errors"
+
+	"github.com/mortenterhart/trivial-tickets/globals"
 	"github.com/mortenterhart/trivial-tickets/structs"
+	"github.com/mortenterhart/trivial-tickets/structs/defaults"
+	"github.com/mortenterhart/trivial-tickets/util/filehandler"
 	"github.com/mortenterhart/trivial-tickets/util/random"
 )
 
@@ -51,6 +60,7 @@ func CreateTicket(mail, subject, text string) structs.Ticket {
 		FormattedDate: time.Now().Format(time.ANSIC),
 		User:          mail,
 		Text:          text,
+		ReplyType:     structs.ReplyExternal,
 	}
 
 	var entries []structs.Entry
@@ -58,16 +68,71 @@ func CreateTicket(mail, subject, text string) structs.Ticket {
 
 	// Construct the ticket
 	return structs.Ticket{
-		ID:       random.CreateRandomID(structs.RandomIDLength),
+		ID:       newTicketID(time.Now()),
 		Subject:  subject,
 		Status:   structs.StatusOpen,
 		User:     structs.User{},
 		Customer: mail,
 		Entries:  entries,
 		MergeTo:  "",
+
+		AccessToken: random.CreateSecureToken(structs.AccessTokenLength),
+		Rating: structs.Rating{
+			Token: random.CreateSecureToken(structs.SurveyTokenLength),
+		},
 	}
 }
 
+// NextTicketID increments the given sequence and returns the
+// next ticket id of the form PREFIX-YEAR-NUMBER, e.g.
+// TT-2019-000123. The numbers start again at 1 every year.
+// Numbers of ids which already exist are skipped, so that
+// no ticket is overwritten even if the sequence was lost.
+func NextTicketID(prefix string, sequence *structs.TicketSequence, now time.Time, exists func(id string) bool) string {
+	if sequence.Year != now.Year() {
+		sequence.Year = now.Year()
+		sequence.Number = 0
+	}
+
+	for {
+		sequence.Number++
+
+		id := fmt.Sprintf("%s-%d-%0*d", prefix, sequence.Year, structs.TicketNumberDigits, sequence.Number)
+		if !exists(id) {
+			return id
+		}
+	}
+}
+
+// newTicketID returns the next sequential id for a new ticket
+// using the configured prefix. Without a server configuration
+// the default prefix is used. The sequence has to be persisted
+// with SaveSequence along with the new ticket.
+func newTicketID(now time.Time) string {
+	prefix := defaults.ServerPrefix
+	if globals.ServerConfig != nil && globals.ServerConfig.TicketPrefix != "" {
+		prefix = globals.ServerConfig.TicketPrefix
+	}
+
+	id := NextTicketID(prefix, &globals.TicketSequence, now, func(id string) bool {
+		_, exists := globals.Tickets[id]
+		return exists
+	})
+
+	return id
+}
+
+// SaveSequence persists the sequence of the ticket numbers in
+// the configured sequence file. Without a configured sequence
+// file the sequence is only kept in memory.
+func SaveSequence() error {
+	if globals.ServerConfig == nil || globals.ServerConfig.Sequence == "" {
+		return nil
+	}
+
+	return filehandler.WriteSequenceFile(globals.ServerConfig.Sequence, &globals.TicketSequence)
+}
+
 // UpdateTicket gets update parameters as well as the
 // ticket to be updated and returns it with the values
 // overwritten.
@@ -85,7 +150,7 @@ func UpdateTicket(status, mail, reply, replyType string, currentTicket structs.T
 			FormattedDate: time.Now().Format(time.ANSIC),
 			User:          mail,
 			Text:          reply,
-			ReplyType:     replyType,
+			ReplyType:     structs.NormalizeReplyType(replyType),
 		}
 
 		entries := currentTicket.Entries
@@ -94,16 +159,59 @@ func UpdateTicket(status, mail, reply, replyType string, currentTicket structs.T
 		currentTicket.Entries = entries
 	}
 
+	return EnsureSurveyToken(currentTicket)
+}
+
+// EnsureSurveyToken creates the token for the satisfaction
+// survey of a closed ticket if the ticket does not have one
+// yet, e.g. because it was created by an older version.
+func EnsureSurveyToken(currentTicket structs.Ticket) structs.Ticket {
+	if currentTicket.Status == structs.StatusClosed && currentTicket.Rating.Token == "" {
+		currentTicket.Rating.Token = random.CreateSecureToken(structs.SurveyTokenLength)
+	}
+
 	return currentTicket
 }
 
+// HasAccess reports whether the given token authorizes the
+// access to the ticket. Tickets created before the access
+// tokens were introduced have no token and can be accessed
+// without one, so that the links in old mails keep working.
+func HasAccess(currentTicket structs.Ticket, token string) bool {
+	return currentTicket.AccessToken == "" ||
+		subtle.ConstantTimeCompare([]byte(token), []byte(currentTicket.AccessToken)) == 1
+}
+
+// Rate records the satisfaction score and the comment of the
+// customer on the closed ticket. The editor assigned to the
+// ticket is credited with the rating. An error is returned if
+// the ticket is not closed or the score is out of range.
+func Rate(currentTicket structs.Ticket, score int, comment string, now time.Time) (structs.Ticket, error) {
+	if currentTicket.Status != structs.StatusClosed {
+		return currentTicket, fmt.Errorf("ticket '%s' is not closed", currentTicket.ID)
+	}
+
+	if score < structs.MinRatingScore || score > structs.MaxRatingScore {
+		return currentTicket, fmt.Errorf("score %d is not between %d and %d", score,
+			structs.MinRatingScore, structs.MaxRatingScore)
+	}
+
+	currentTicket.Rating.Score = score
+	currentTicket.Rating.Comment = comment
+	currentTicket.Rating.Agent = currentTicket.User.Username
+	currentTicket.Rating.Date = now
+	currentTicket.Rating.FormattedDate = now.Format(time.ANSIC)
+
+	return currentTicket, nil
+}
+
 // MergeTickets merges two tickets if they share the
 // same customer. The entries of the mergeFromTicket
 // are appended to the mergeToTicket and all entries
 // are sorted by their creation time.
 func MergeTickets(mergeToTicket, mergeFromTicket structs.Ticket) (structs.Ticket, structs.Ticket) {
 
-	if mergeToTicket.Customer == mergeFromTicket.Customer {
+	if SameCustomer(mergeToTicket, mergeFromTicket) {
 		// Get and merge the entries
 		entriesMerged := append(mergeFromTicket.Entries, mergeToTicket.Entries...)
 
@@ -115,6 +223,10 @@ func MergeTickets(mergeToTicket, mergeFromTicket structs.Ticket) (structs.Ticket
 		// Assign the merged entries
 		mergeToTicket.Entries = entriesMerged
 
+		// Move the logged time so that it is not counted twice
+		mergeToTicket.WorkLogs = append(mergeToTicket.WorkLogs, mergeFromTicket.WorkLogs...)
+		mergeFromTicket.WorkLogs = nil
+
 		// Point to the newly merged ticket
 		mergeFromTicket.MergeTo = mergeToTicket.ID
 		mergeFromTicket.Status = structs.StatusClosed
@@ -124,6 +236,18 @@ func MergeTickets(mergeToTicket, mergeFromTicket structs.Ticket) (structs.Ticket
 	return mergeToTicket, mergeFromTicket
 }
 
+// SameCustomer reports whether both tickets were written
+// by the same customer. Tickets linked to the same entry
+// of the customer directory share the customer even if
+// they were written from different addresses.
+func SameCustomer(first, second structs.Ticket) bool {
+	if first.CustomerID != "" && first.CustomerID == second.CustomerID {
+		return true
+	}
+
+	return strings.EqualFold(first.Customer, second.Customer)
+}
+
 // AssignTicket adds a user to a ticket.
 func AssignTicket(user structs.User, currentTicket structs.Ticket) structs.Ticket {
 
@@ -145,3 +269,464 @@ func UnassignTicket(currentTicket structs.Ticket) structs.Ticket {
 
 	return currentTicket
 }
+
+// FilterInternalEntries returns a copy of the ticket without
+// internal entries. It is used for every view of a ticket
+// which is not restricted to logged in users.
+func FilterInternalEntries(currentTicket structs.Ticket) structs.Ticket {
+	var externalEntries []structs.Entry
+	for _, entry := range currentTicket.Entries {
+		if !entry.IsInternal() {
+			externalEntries = append(externalEntries, entry)
+		}
+	}
+
+	currentTicket.Entries = externalEntries
+
+	return currentTicket
+}
+
+// CustomerView returns a copy of the ticket as customers may
+// see it. Besides the internal entries, the logged time, the
+// fired automation rules and all data of the assigned editor
+// except for the name and the contact are left out.
+func CustomerView(currentTicket structs.Ticket) structs.Ticket {
+	currentTicket = FilterInternalEntries(currentTicket)
+	currentTicket.WorkLogs = nil
+	currentTicket.FiredRules = nil
+	currentTicket.User = structs.User{
+		ID:       currentTicket.User.ID,
+		Name:     currentTicket.User.Name,
+		Username: currentTicket.User.Username,
+		Mail:     currentTicket.User.Mail,
+	}
+
+	return currentTicket
+}
+
+// LogTime adds the given number of minutes spent by the user
+// with the given username to the ticket. A negative entry index
+// logs the time on the whole ticket, otherwise on the entry at
+// the index. An error is returned if the number of minutes is
+// not positive or if the entry does not exist.
+func LogTime(currentTicket structs.Ticket, username string, minutes, index int, note string) (structs.Ticket, error) {
+	if minutes <= 0 {
+		return currentTicket, fmt.Errorf("logged time has to be positive, got %d minutes", minutes)
+	}
+
+	if index >= len(currentTicket.Entries) {
+		return currentTicket, fmt.Errorf("entry %d does not exist in ticket '%s'", index, currentTicket.ID)
+	}
+
+	now := time.Now()
+	workLog := structs.WorkLog{
+		Date:          now,
+		FormattedDate: now.Format(time.ANSIC),
+		User:          username,
+		Minutes:       minutes,
+		Note:          note,
+	}
+
+	if index >= 0 {
+		workLog.Entry = currentTicket.Entries[index].Date
+	}
+
+	workLogs := make([]structs.WorkLog, len(currentTicket.WorkLogs), len(currentTicket.WorkLogs)+1)
+	copy(workLogs, currentTicket.WorkLogs)
+	currentTicket.WorkLogs = append(workLogs, workLog)
+
+	return currentTicket, nil
+}
+
+// Snooze parks the ticket until the given time. The ticket is
+// hidden from the dashboard of the editor until it wakes up.
+// An error is returned if the time is not in the future or
+// if no editor is assigned who could be reminded.
+func Snooze(currentTicket structs.Ticket, until, now time.Time) (structs.Ticket, error) {
+	if validateErr := validateReminder(currentTicket, until, now); validateErr != nil {
+		return currentTicket, validateErr
+	}
+
+	currentTicket.SnoozedUntil = until
+	currentTicket.Reminder = false
+
+	return currentTicket, nil
+}
+
+// ScheduleFollowUp sets a follow-up at the given time at which
+// the editor is reminded of the ticket. The ticket stays on
+// the dashboard in the meantime.
+func ScheduleFollowUp(currentTicket structs.Ticket, at, now time.Time) (structs.Ticket, error) {
+	if validateErr := validateReminder(currentTicket, at, now); validateErr != nil {
+		return currentTicket, validateErr
+	}
+
+	currentTicket.FollowUp = at
+	currentTicket.Reminder = false
+
+	return currentTicket, nil
+}
+
+// validateReminder checks that a snooze or follow-up time lies
+// in the future and that an editor is assigned to the ticket.
+func validateReminder(currentTicket structs.Ticket, at, now time.Time) error {
+	if currentTicket.User.ID == "" {
+		return fmt.Errorf("ticket '%s' has no editor who could be reminded", currentTicket.ID)
+	}
+
+	if !at.After(now) {
+		return fmt.Errorf("reminder time %s is not in the future", at.Format(time.ANSIC))
+	}
+
+	return nil
+}
+
+// ClearReminders removes the snooze, the follow-up and the
+// reminder flag from the ticket.
+func ClearReminders(currentTicket structs.Ticket) structs.Ticket {
+	currentTicket.SnoozedUntil = time.Time{}
+	currentTicket.FollowUp = time.Time{}
+	currentTicket.Reminder = false
+
+	return currentTicket
+}
+
+// Wake checks whether the snooze or the follow-up of the ticket
+// is due at the given time. A due ticket is woken up and marked
+// with a reminder. The second return value reports whether the
+// ticket was woken up.
+func Wake(currentTicket structs.Ticket, now time.Time) (structs.Ticket, bool) {
+	woken := false
+
+	if currentTicket.IsSnoozed() && !now.Before(currentTicket.SnoozedUntil) {
+		currentTicket.SnoozedUntil = time.Time{}
+		woken = true
+	}
+
+	if currentTicket.HasFollowUp() && !now.Before(currentTicket.FollowUp) {
+		currentTicket.FollowUp = time.Time{}
+		woken = true
+	}
+
+	if woken {
+		currentTicket.Reminder = true
+	}
+
+	return currentTicket, woken
+}
+
+// StaleAction is the step of the stale ticket policy which
+// was applied to a ticket waiting for the customer.
+type StaleAction int
+
+const (
+	// StaleNone means that nothing has changed.
+	StaleNone StaleAction = iota
+
+	// StaleReminder means that the customer has to be
+	// reminded to answer the ticket.
+	StaleReminder
+
+	// StaleClose means that the ticket was closed
+	// because the customer did not answer.
+	StaleClose
+
+	// StaleReset means that a pending reminder was
+	// cleared because the ticket is no longer waiting
+	// for the customer.
+	StaleReset
+)
+
+// WaitingForCustomer reports whether the ticket is in progress
+// and the latest external entry was not written by the
+// customer. The date of this entry is returned as the time
+// since which the ticket is waiting.
+func WaitingForCustomer(currentTicket structs.Ticket) (time.Time, bool) {
+	if currentTicket.Status != structs.StatusInProgress {
+		return time.Time{}, false
+	}
+
+	for index := len(currentTicket.Entries) - 1; index >= 0; index-- {
+		entry := currentTicket.Entries[index]
+		if !entry.IsInternal() {
+			return entry.Date, !IsCustomerMail(currentTicket, entry.User)
+		}
+	}
+
+	return time.Time{}, false
+}
+
+// IsCustomerMail reports whether the mail address belongs to
+// the customer of the ticket. Besides the address of the
+// ticket, all addresses of the linked customer count. Mail
+// addresses are compared case insensitively.
+func IsCustomerMail(currentTicket structs.Ticket, mail string) bool {
+	if strings.EqualFold(mail, currentTicket.Customer) {
+		return true
+	}
+
+	linkedCustomer, customerExists := globals.Customers[currentTicket.CustomerID]
+	return currentTicket.CustomerID != "" && customerExists && linkedCustomer.HasMail(mail)
+}
+
+// CheckStale applies the stale ticket policy to the ticket. If
+// the ticket has been waiting for the customer for reminderDays
+// days, the customer has to be reminded. If the customer still
+// does not answer within closeDays days after the reminder, the
+// ticket is closed. Each step is recorded as internal entry. A
+// value of zero days disables the corresponding step.
+func CheckStale(currentTicket structs.Ticket, now time.Time, reminderDays, closeDays uint) (structs.Ticket, StaleAction) {
+	since, waiting := WaitingForCustomer(currentTicket)
+	reminded := !currentTicket.StaleReminded.IsZero()
+
+	// The timer starts again if the ticket is no longer waiting
+	// or if the editor has written another answer since the reminder
+	if !waiting || reminderDays == 0 || (reminded && since.After(currentTicket.StaleReminded)) {
+		if !reminded {
+			return currentTicket, StaleNone
+		}
+
+		return ResetStaleTimer(currentTicket), StaleReset
+	}
+
+	if !reminded {
+		if now.Before(since.AddDate(0, 0, int(reminderDays))) {
+			return currentTicket, StaleNone
+		}
+
+		currentTicket.StaleReminded = now
+		currentTicket = addSystemEntry(currentTicket, now,
+			fmt.Sprintf("Reminded the customer after %d days without an answer.", reminderDays))
+
+		return currentTicket, StaleReminder
+	}
+
+	if closeDays == 0 || now.Before(currentTicket.StaleReminded.AddDate(0, 0, int(closeDays))) {
+		return currentTicket, StaleNone
+	}
+
+	currentTicket.Status = structs.StatusClosed
+	currentTicket.StaleReminded = time.Time{}
+	currentTicket = EnsureSurveyToken(currentTicket)
+	currentTicket = addSystemEntry(currentTicket, now,
+		fmt.Sprintf("Closed the ticket because the customer did not answer within %d days after the reminder.", closeDays))
+
+	return currentTicket, StaleClose
+}
+
+// ResetStaleTimer clears a pending reminder of the stale ticket
+// policy, e.g. because the customer has answered.
+func ResetStaleTimer(currentTicket structs.Ticket) structs.Ticket {
+	currentTicket.StaleReminded = time.Time{}
+
+	return currentTicket
+}
+
+// slaWarningShare is the share of the response time which
+// is left when the editor is warned, i.e. a quarter.
+const slaWarningShare = 4
+
+// mentionRegex matches mentions of users like "@max4711"
+// which are not part of a mail address.
+var mentionRegex = regexp.MustCompile(`(^|[^\w.@])@([\w.-]*\w)`)
+
+// WaitingForEditor reports whether the ticket is not closed
+// and the latest external entry was written by the customer.
+// The date of this entry is returned as the time since which
+// the ticket is waiting.
+func WaitingForEditor(currentTicket structs.Ticket) (time.Time, bool) {
+	if currentTicket.Status == structs.StatusClosed {
+		return time.Time{}, false
+	}
+
+	for index := len(currentTicket.Entries) - 1; index >= 0; index-- {
+		entry := currentTicket.Entries[index]
+		if !entry.IsInternal() {
+			return entry.Date, entry.User == currentTicket.Customer
+		}
+	}
+
+	return time.Time{}, false
+}
+
+// SLADue returns the time until which the latest answer of
+// the customer has to be answered if the ticket is waiting
+// for the editor. A response time of zero hours disables
+// the due time.
+func SLADue(currentTicket structs.Ticket, slaHours uint) (time.Time, bool) {
+	since, waiting := WaitingForEditor(currentTicket)
+	if !waiting || slaHours == 0 {
+		return time.Time{}, false
+	}
+
+	return since.Add(time.Duration(slaHours) * time.Hour), true
+}
+
+// IsOverdue reports whether the response time of the ticket
+// has passed at the given time.
+func IsOverdue(currentTicket structs.Ticket, now time.Time, slaHours uint) bool {
+	due, hasDue := SLADue(currentTicket, slaHours)
+
+	return hasDue && !now.Before(due)
+}
+
+// CheckSLA reports whether the editor has to be warned that
+// the response time of the ticket is about to pass. This is
+// the case as soon as only a quarter of the response time is
+// left. The warning is recorded on the ticket so that it is
+// given only once per answer of the customer.
+func CheckSLA(currentTicket structs.Ticket, now time.Time, slaHours uint) (structs.Ticket, bool) {
+	since, waiting := WaitingForEditor(currentTicket)
+	if !waiting || slaHours == 0 || !currentTicket.SLAWarned.Before(since) {
+		return currentTicket, false
+	}
+
+	responseTime := time.Duration(slaHours) * time.Hour
+	if now.Before(since.Add(responseTime - responseTime/slaWarningShare)) {
+		return currentTicket, false
+	}
+
+	currentTicket.SLAWarned = now
+
+	return currentTicket, true
+}
+
+// Mentions returns the usernames mentioned in the text with
+// a leading "@", each only once.
+func Mentions(text string) []string {
+	var usernames []string
+	mentioned := make(map[string]bool)
+	for _, match := range mentionRegex.FindAllStringSubmatch(text, -1) {
+		if !mentioned[match[2]] {
+			mentioned[match[2]] = true
+			usernames = append(usernames, match[2])
+		}
+	}
+
+	return usernames
+}
+
+// AddSystemNote appends an internal note written by the
+// ticket system to the ticket.
+func AddSystemNote(currentTicket structs.Ticket, now time.Time, text string) structs.Ticket {
+	return addSystemEntry(currentTicket, now, text)
+}
+
+// addSystemEntry appends an internal entry written by the
+// ticket system to the ticket.
+func addSystemEntry(currentTicket structs.Ticket, now time.Time, text string) structs.Ticket {
+	entries := make([]structs.Entry, len(currentTicket.Entries), len(currentTicket.Entries)+1)
+	copy(entries, currentTicket.Entries)
+
+	currentTicket.Entries = append(entries, structs.Entry{
+		Date:          now,
+		FormattedDate: now.Format(time.ANSIC),
+		User:          structs.SystemUser,
+		Text:          text,
+		ReplyType:     structs.ReplyInternal,
+	})
+
+	return currentTicket
+}
+
+// CanEditEntry reports whether the user is allowed to edit
+// the entry. Only the author of an entry can edit it.
+func CanEditEntry(user structs.User, entry structs.Entry) bool {
+	return user.ID != "" && user.Mail == entry.User && !entry.Redacted
+}
+
+// CanRedactEntry reports whether the user is allowed to redact
+// the entry. Besides the author, the editor assigned to the
+// ticket can redact any entry, e.g. if a customer sent a
+// password by mistake.
+func CanRedactEntry(user structs.User, currentTicket structs.Ticket, entry structs.Entry) bool {
+	if user.ID == "" || entry.Redacted {
+		return false
+	}
+
+	return user.Mail == entry.User || user.ID == currentTicket.User.ID
+}
+
+// EditEntry replaces the text of the entry at the given index
+// with the new text. The previous text is kept as revision
+// along with the name of the editor. An error is returned if
+// the entry does not exist, has been redacted or if the text
+// is empty or unchanged.
+func EditEntry(currentTicket structs.Ticket, index int, text, editor string) (structs.Ticket, error) {
+	if index < 0 || index >= len(currentTicket.Entries) {
+		return currentTicket, fmt.Errorf("entry %d does not exist in ticket '%s'", index, currentTicket.ID)
+	}
+
+	entry := currentTicket.Entries[index]
+	if entry.Redacted {
+		return currentTicket, errors.New("a redacted entry cannot be edited")
+	}
+
+	if text == "" || text == entry.Text {
+		return currentTicket, errors.New("the text of the entry is empty or unchanged")
+	}
+
+	entry.Revisions = append(copyRevisions(entry.Revisions), newRevision(editor, entry.Text, false))
+	entry.Text = text
+
+	return replaceEntry(currentTicket, index, entry), nil
+}
+
+// RedactEntry removes the text of the entry at the given index
+// and of all its previous revisions. A revision marking the
+// redaction with the name of the editor is added to the audit
+// trail. An error is returned if the entry does not exist or
+// has been redacted already.
+func RedactEntry(currentTicket structs.Ticket, index int, editor string) (structs.Ticket, error) {
+	if index < 0 || index >= len(currentTicket.Entries) {
+		return currentTicket, fmt.Errorf("entry %d does not exist in ticket '%s'", index, currentTicket.ID)
+	}
+
+	entry := currentTicket.Entries[index]
+	if entry.Redacted {
+		return currentTicket, errors.New("the entry has already been redacted")
+	}
+
+	revisions := copyRevisions(entry.Revisions)
+	for i := range revisions {
+		revisions[i].Text = structs.RedactedText
+	}
+
+	entry.Revisions = append(revisions, newRevision(editor, structs.RedactedText, true))
+	entry.Text = structs.RedactedText
+	entry.FullText = ""
+	entry.Redacted = true
+
+	return replaceEntry(currentTicket, index, entry), nil
+}
+
+// newRevision creates a revision written now by the given
+// editor.
+func newRevision(editor, text string, redaction bool) structs.Revision {
+	now := time.Now()
+
+	return structs.Revision{
+		Date:          now,
+		FormattedDate: now.Format(time.ANSIC),
+		User:          editor,
+		Text:          text,
+		Redaction:     redaction,
+	}
+}
+
+// copyRevisions returns a copy of the revisions so that
+// changes do not affect other copies of the ticket.
+func copyRevisions(revisions []structs.Revision) []structs.Revision {
+	return append([]structs.Revision(nil), revisions...)
+}
+
+// replaceEntry returns the ticket with the entry at the given
+// index replaced. The entries are copied so that other copies
+// of the ticket are not affected.
+func replaceEntry(currentTicket structs.Ticket, index int, entry structs.Entry) structs.Ticket {
+	entries := append([]structs.Entry(nil), currentTicket.Entries...)
+	entries[index] = entry
+	currentTicket.Entries = entries
+
+	return currentTicket
+}
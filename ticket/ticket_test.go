@@ -19,13 +19,19 @@
 package ticket
 
 import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"testing"
 	"time"
 
 	"github.com/stretchr/testify/assert"
 
+	"github.com/mortenterhart/trivial-tickets/globals"
 	"github.com/mortenterhart/trivial-tickets/log/testlog"
 	"github.com/mortenterhart/trivial-tickets/structs"
+	"github.com/mortenterhart/trivial-tickets/structs/defaults"
+	"github.com/mortenterhart/trivial-tickets/util/filehandler"
 )
 
 /*
@@ -55,6 +61,7 @@ func TestCreateTicket(t *testing.T) {
 	assert.NotNil(t, ticket, "No ticket was returned")
 	assert.Equal(t, mail, ticket.Customer, "Mail in created ticket did not match")
 	assert.Equal(t, subject, ticket.Subject, "Subject does not match")
+	assert.Len(t, ticket.AccessToken, 2*structs.AccessTokenLength, "access token should be created")
 }
 
 func TestUpdateTicket(t *testing.T) {
@@ -107,6 +114,34 @@ func TestMergeTickets(t *testing.T) {
 	assert.NotNil(t, ticketMergeToAfterMerge, "No ticket was returned")
 	assert.True(t, len(ticketMergeToAfterMerge.Entries) == 6, "The entries have not been added to the ticket")
 	assert.Equal(t, "abcdef123", ticketMergeFromAfterMerge.MergeTo, "Merge to id does not match")
+
+	t.Run("linkedCustomer", func(t *testing.T) {
+		linkedTo := structs.Ticket{ID: "abcdef123", Customer: "jane@example.com", CustomerID: "cust1"}
+		linkedFrom := structs.Ticket{ID: "abcdef456", Customer: "jane@private.example.com", CustomerID: "cust1"}
+
+		_, mergedFrom := MergeTickets(linkedTo, linkedFrom)
+
+		assert.Equal(t, "abcdef123", mergedFrom.MergeTo, "tickets of the same linked customer should be merged")
+	})
+
+	t.Run("otherCustomer", func(t *testing.T) {
+		otherTo := structs.Ticket{ID: "abcdef123", Customer: "jane@example.com"}
+		otherFrom := structs.Ticket{ID: "abcdef456", Customer: "max@example.com"}
+
+		_, mergedFrom := MergeTickets(otherTo, otherFrom)
+
+		assert.Empty(t, mergedFrom.MergeTo, "tickets of other customers should not be merged")
+	})
+
+	t.Run("workLogs", func(t *testing.T) {
+		ticketMergeTo.WorkLogs = []structs.WorkLog{{Minutes: 10}}
+		ticketMergeFrom.WorkLogs = []structs.WorkLog{{Minutes: 20}}
+
+		ticketMergeToAfterMerge, ticketMergeFromAfterMerge := MergeTickets(ticketMergeTo, ticketMergeFrom)
+
+		assert.Equal(t, 30, ticketMergeToAfterMerge.TotalMinutes(), "logged time should be moved")
+		assert.Empty(t, ticketMergeFromAfterMerge.WorkLogs, "logged time should not be counted twice")
+	})
 }
 
 // TestAssignAndUnassignTicket tests that assign and
@@ -130,3 +165,581 @@ func TestAssignAndUnassignTicket(t *testing.T) {
 
 	assert.Equal(t, structs.StatusOpen, updatedTicket2.Status, "Status of unassigned ticket is not StatusOpen")
 }
+
+func TestLogTime(t *testing.T) {
+	testlog.BeginTest()
+	defer testlog.EndTest()
+
+	currentTicket, _ := mockTicketWithEntries()
+	currentTicket.Entries[0].Date = time.Date(2019, time.January, 7, 10, 0, 0, 0, time.UTC)
+	currentTicket.Entries[1].Date = time.Date(2019, time.January, 7, 11, 0, 0, 0, time.UTC)
+
+	t.Run("ticketLevel", func(t *testing.T) {
+		loggedTicket, err := LogTime(currentTicket, "admin", 30, -1, "Research")
+
+		assert.NoError(t, err)
+		if assert.Len(t, loggedTicket.WorkLogs, 1) {
+			assert.Equal(t, "admin", loggedTicket.WorkLogs[0].User)
+			assert.Equal(t, 30, loggedTicket.WorkLogs[0].Minutes)
+			assert.Equal(t, "Research", loggedTicket.WorkLogs[0].Note)
+			assert.True(t, loggedTicket.WorkLogs[0].IsTicketLevel())
+		}
+		assert.Empty(t, currentTicket.WorkLogs, "original ticket should not be changed")
+	})
+
+	t.Run("entryLevel", func(t *testing.T) {
+		loggedTicket, err := LogTime(currentTicket, "admin", 15, 1, "")
+
+		assert.NoError(t, err)
+		assert.Equal(t, 15, loggedTicket.EntryMinutes(loggedTicket.Entries[1]))
+	})
+
+	t.Run("invalidMinutes", func(t *testing.T) {
+		_, err := LogTime(currentTicket, "admin", 0, -1, "")
+
+		assert.Error(t, err, "zero minutes should be rejected")
+	})
+
+	t.Run("missingEntry", func(t *testing.T) {
+		_, err := LogTime(currentTicket, "admin", 10, 5, "")
+
+		assert.Error(t, err, "nonexistent entry should be rejected")
+	})
+}
+
+func TestSnoozeAndWake(t *testing.T) {
+	testlog.BeginTest()
+	defer testlog.EndTest()
+
+	currentTicket, _ := mockTicketWithEntries()
+	now := time.Date(2019, time.January, 7, 10, 0, 0, 0, time.UTC)
+	monday := now.AddDate(0, 0, 7)
+
+	t.Run("snooze", func(t *testing.T) {
+		snoozedTicket, err := Snooze(currentTicket, monday, now)
+
+		assert.NoError(t, err)
+		assert.True(t, snoozedTicket.IsSnoozed())
+
+		t.Run("notDue", func(t *testing.T) {
+			_, woken := Wake(snoozedTicket, monday.Add(-time.Minute))
+
+			assert.False(t, woken, "ticket should sleep until the snooze time")
+		})
+
+		t.Run("due", func(t *testing.T) {
+			wokenTicket, woken := Wake(snoozedTicket, monday)
+
+			assert.True(t, woken, "ticket should wake up at the snooze time")
+			assert.False(t, wokenTicket.IsSnoozed())
+			assert.True(t, wokenTicket.Reminder)
+		})
+	})
+
+	t.Run("followUp", func(t *testing.T) {
+		followUpTicket, err := ScheduleFollowUp(currentTicket, monday, now)
+
+		assert.NoError(t, err)
+		assert.False(t, followUpTicket.IsSnoozed(), "follow-up should not hide the ticket")
+
+		wokenTicket, woken := Wake(followUpTicket, monday.Add(time.Hour))
+
+		assert.True(t, woken, "follow-up should be due")
+		assert.False(t, wokenTicket.HasFollowUp())
+		assert.True(t, wokenTicket.Reminder)
+		assert.False(t, ClearReminders(wokenTicket).Reminder)
+	})
+
+	t.Run("pastTime", func(t *testing.T) {
+		_, err := Snooze(currentTicket, now.Add(-time.Hour), now)
+
+		assert.Error(t, err, "snooze time has to be in the future")
+	})
+
+	t.Run("unassigned", func(t *testing.T) {
+		_, err := ScheduleFollowUp(UnassignTicket(currentTicket), monday, now)
+
+		assert.Error(t, err, "unassigned ticket cannot be followed up")
+	})
+}
+
+func TestCheckStale(t *testing.T) {
+	testlog.BeginTest()
+	defer testlog.EndTest()
+
+	question := time.Date(2019, time.January, 7, 10, 0, 0, 0, time.UTC)
+
+	waitingTicket, _ := mockTicketWithEntries()
+	waitingTicket.Status = structs.StatusInProgress
+	waitingTicket.Entries[1].Date = question
+
+	t.Run("waitingForCustomer", func(t *testing.T) {
+		since, waiting := WaitingForCustomer(waitingTicket)
+
+		assert.True(t, waiting, "editor has written the latest entry")
+		assert.Equal(t, question, since)
+	})
+
+	t.Run("notWaiting", func(t *testing.T) {
+		answeredTicket := UpdateTicket("1", "customer@example.com", "Answer", structs.ReplyExternal, waitingTicket)
+
+		_, waiting := WaitingForCustomer(answeredTicket)
+
+		assert.False(t, waiting, "customer has written the latest entry")
+	})
+
+	t.Run("differentCase", func(t *testing.T) {
+		answeredTicket := UpdateTicket("1", "Customer@Example.com", "Answer", structs.ReplyExternal, waitingTicket)
+
+		_, waiting := WaitingForCustomer(answeredTicket)
+
+		assert.False(t, waiting, "customer address should be compared case insensitively")
+	})
+
+	t.Run("linkedCustomerAlias", func(t *testing.T) {
+		customers := globals.Customers
+		defer func() { globals.Customers = customers }()
+
+		globals.Customers = map[string]structs.Customer{
+			"customer-id": {ID: "customer-id", Mails: []string{"customer@example.com", "alias@example.com"}},
+		}
+
+		linkedTicket := waitingTicket
+		linkedTicket.CustomerID = "customer-id"
+		answeredTicket := UpdateTicket("1", "alias@example.com", "Answer", structs.ReplyExternal, linkedTicket)
+
+		_, waiting := WaitingForCustomer(answeredTicket)
+
+		assert.False(t, waiting, "alias of the linked customer has written the latest entry")
+	})
+
+	t.Run("notDue", func(t *testing.T) {
+		_, action := CheckStale(waitingTicket, question.AddDate(0, 0, 6), 7, 3)
+
+		assert.Equal(t, StaleNone, action)
+	})
+
+	remindedTicket, action := CheckStale(waitingTicket, question.AddDate(0, 0, 7), 7, 3)
+
+	t.Run("reminder", func(t *testing.T) {
+		assert.Equal(t, StaleReminder, action)
+		assert.False(t, remindedTicket.StaleReminded.IsZero(), "reminder should be recorded")
+		assert.Len(t, remindedTicket.Entries, 3, "reminder should be recorded as entry")
+		assert.True(t, remindedTicket.Entries[2].IsInternal(), "recorded step should be internal")
+		assert.Equal(t, structs.SystemUser, remindedTicket.Entries[2].User)
+	})
+
+	t.Run("noSecondReminder", func(t *testing.T) {
+		_, action := CheckStale(remindedTicket, question.AddDate(0, 0, 9), 7, 3)
+
+		assert.Equal(t, StaleNone, action)
+	})
+
+	t.Run("close", func(t *testing.T) {
+		closedTicket, action := CheckStale(remindedTicket, question.AddDate(0, 0, 10), 7, 3)
+
+		assert.Equal(t, StaleClose, action)
+		assert.Equal(t, structs.StatusClosed, closedTicket.Status)
+		assert.Len(t, closedTicket.Entries, 4, "closing should be recorded as entry")
+	})
+
+	t.Run("closeDisabled", func(t *testing.T) {
+		_, action := CheckStale(remindedTicket, question.AddDate(0, 1, 0), 7, 0)
+
+		assert.Equal(t, StaleNone, action)
+	})
+
+	t.Run("customerAnswered", func(t *testing.T) {
+		answeredTicket := UpdateTicket("1", "customer@example.com", "Answer", structs.ReplyExternal, remindedTicket)
+
+		resetTicket, action := CheckStale(answeredTicket, question.AddDate(0, 0, 10), 7, 3)
+
+		assert.Equal(t, StaleReset, action)
+		assert.True(t, resetTicket.StaleReminded.IsZero(), "reminder should be reset")
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		_, action := CheckStale(waitingTicket, question.AddDate(1, 0, 0), 0, 3)
+
+		assert.Equal(t, StaleNone, action)
+	})
+}
+
+func TestCheckSLA(t *testing.T) {
+	testlog.BeginTest()
+	defer testlog.EndTest()
+
+	question := time.Date(2019, time.January, 7, 10, 0, 0, 0, time.UTC)
+
+	waitingTicket, _ := mockTicketWithEntries()
+	waitingTicket.Status = structs.StatusInProgress
+	waitingTicket.Entries = waitingTicket.Entries[:1]
+	waitingTicket.Entries[0].Date = question
+
+	t.Run("waitingForEditor", func(t *testing.T) {
+		since, waiting := WaitingForEditor(waitingTicket)
+
+		assert.True(t, waiting, "customer has written the latest entry")
+		assert.Equal(t, question, since)
+
+		due, hasDue := SLADue(waitingTicket, 8)
+
+		assert.True(t, hasDue)
+		assert.Equal(t, question.Add(8*time.Hour), due)
+	})
+
+	t.Run("notDue", func(t *testing.T) {
+		_, warn := CheckSLA(waitingTicket, question.Add(5*time.Hour), 8)
+
+		assert.False(t, warn, "more than a quarter of the response time is left")
+		assert.False(t, IsOverdue(waitingTicket, question.Add(5*time.Hour), 8))
+	})
+
+	warnedTicket, warn := CheckSLA(waitingTicket, question.Add(6*time.Hour), 8)
+
+	t.Run("warning", func(t *testing.T) {
+		assert.True(t, warn, "editor should be warned")
+		assert.Equal(t, question.Add(6*time.Hour), warnedTicket.SLAWarned, "warning should be recorded")
+	})
+
+	t.Run("noSecondWarning", func(t *testing.T) {
+		_, warn := CheckSLA(warnedTicket, question.Add(9*time.Hour), 8)
+
+		assert.False(t, warn)
+		assert.True(t, IsOverdue(warnedTicket, question.Add(9*time.Hour), 8), "response time should have passed")
+	})
+
+	t.Run("nextAnswer", func(t *testing.T) {
+		answeredTicket := warnedTicket
+		answeredTicket.Entries = append(answeredTicket.Entries,
+			structs.Entry{Date: question.AddDate(0, 0, 1), User: "customer@example.com", Text: "Any news?"})
+
+		_, warn := CheckSLA(answeredTicket, question.AddDate(0, 0, 1).Add(7*time.Hour), 8)
+
+		assert.True(t, warn, "a new answer of the customer should be warned about again")
+	})
+
+	t.Run("editorAnswered", func(t *testing.T) {
+		answeredTicket := UpdateTicket("1", "editor@example.com", "Answer", structs.ReplyExternal, waitingTicket)
+
+		_, warn := CheckSLA(answeredTicket, question.AddDate(0, 0, 1), 8)
+
+		assert.False(t, warn, "ticket is not waiting for the editor")
+		assert.False(t, IsOverdue(answeredTicket, question.AddDate(0, 0, 1), 8))
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		_, warn := CheckSLA(waitingTicket, question.AddDate(1, 0, 0), 0)
+
+		assert.False(t, warn)
+		assert.False(t, IsOverdue(waitingTicket, question.AddDate(1, 0, 0), 0))
+	})
+}
+
+func TestMentions(t *testing.T) {
+	testlog.BeginTest()
+	defer testlog.EndTest()
+
+	t.Run("mentions", func(t *testing.T) {
+		assert.Equal(t, []string{"max4711", "admin"}, Mentions("@max4711 please ask @admin.\n(cc @max4711)"))
+	})
+
+	t.Run("mailAddress", func(t *testing.T) {
+		assert.Empty(t, Mentions("Write to support@trivial-tickets.com"), "mail addresses are no mentions")
+	})
+}
+
+func TestFilterInternalEntries(t *testing.T) {
+	testlog.BeginTest()
+	defer testlog.EndTest()
+
+	currentTicket := structs.Ticket{
+		ID: "abc123",
+		Entries: []structs.Entry{
+			{Text: "first", ReplyType: ""},
+			{Text: "internal", ReplyType: structs.ReplyInternal},
+			{Text: "external", ReplyType: "extern"},
+		},
+	}
+
+	filteredTicket := FilterInternalEntries(currentTicket)
+
+	assert.Len(t, filteredTicket.Entries, 2, "internal entry should be removed")
+	assert.Equal(t, "first", filteredTicket.Entries[0].Text)
+	assert.Equal(t, "external", filteredTicket.Entries[1].Text)
+	assert.Len(t, currentTicket.Entries, 3, "original ticket should not be changed")
+}
+
+func TestCustomerView(t *testing.T) {
+	testlog.BeginTest()
+	defer testlog.EndTest()
+
+	currentTicket := structs.Ticket{
+		ID:   "abc123",
+		User: structs.User{ID: "1", Name: "Editor", Username: "editor", Mail: "editor@example.com", Hash: "$2a$12$secret"},
+		Entries: []structs.Entry{
+			{Text: "external", ReplyType: structs.ReplyExternal},
+			{Text: "internal", ReplyType: structs.ReplyInternal},
+		},
+		WorkLogs:   []structs.WorkLog{{User: "editor", Minutes: 15}},
+		FiredRules: []structs.FiredRule{{Rule: "vip"}},
+	}
+
+	customerTicket := CustomerView(currentTicket)
+
+	assert.Len(t, customerTicket.Entries, 1, "internal entry should be removed")
+	assert.Empty(t, customerTicket.WorkLogs, "logged time should be removed")
+	assert.Empty(t, customerTicket.FiredRules, "fired rules should be removed")
+	assert.Empty(t, customerTicket.User.Hash, "password hash of the editor should be removed")
+	assert.Equal(t, "Editor", customerTicket.User.Name, "name of the editor should be kept")
+	assert.Equal(t, "editor@example.com", customerTicket.User.Mail, "mail of the editor should be kept")
+	assert.Equal(t, "$2a$12$secret", currentTicket.User.Hash, "original ticket should not be changed")
+}
+
+// mockTicketWithEntries returns a ticket assigned to the
+// editor with one entry by the customer and one by the
+// editor.
+func mockTicketWithEntries() (structs.Ticket, structs.User) {
+	editor := structs.User{ID: "1", Username: "editor", Mail: "editor@example.com"}
+
+	return structs.Ticket{
+		ID:       "abc123",
+		Customer: "customer@example.com",
+		User:     editor,
+		Entries: []structs.Entry{
+			{User: "customer@example.com", Text: "My password is secret"},
+			{User: "editor@example.com", Text: "Thank you"},
+		},
+	}, editor
+}
+
+func TestCanEditAndRedactEntry(t *testing.T) {
+	testlog.BeginTest()
+	defer testlog.EndTest()
+
+	currentTicket, editor := mockTicketWithEntries()
+	otherUser := structs.User{ID: "2", Username: "other", Mail: "other@example.com"}
+
+	t.Run("editOwnEntry", func(t *testing.T) {
+		assert.True(t, CanEditEntry(editor, currentTicket.Entries[1]))
+	})
+
+	t.Run("editForeignEntry", func(t *testing.T) {
+		assert.False(t, CanEditEntry(editor, currentTicket.Entries[0]))
+	})
+
+	t.Run("redactAsAssignedEditor", func(t *testing.T) {
+		assert.True(t, CanRedactEntry(editor, currentTicket, currentTicket.Entries[0]))
+	})
+
+	t.Run("redactAsOtherUser", func(t *testing.T) {
+		assert.False(t, CanRedactEntry(otherUser, currentTicket, currentTicket.Entries[0]))
+	})
+
+	t.Run("redactWithoutLogin", func(t *testing.T) {
+		assert.False(t, CanRedactEntry(structs.User{}, currentTicket, currentTicket.Entries[0]))
+	})
+}
+
+func TestEditEntry(t *testing.T) {
+	testlog.BeginTest()
+	defer testlog.EndTest()
+
+	currentTicket, _ := mockTicketWithEntries()
+
+	t.Run("validEdit", func(t *testing.T) {
+		editedTicket, err := EditEntry(currentTicket, 1, "Thank you very much", "editor")
+
+		assert.NoError(t, err)
+		assert.Equal(t, "Thank you very much", editedTicket.Entries[1].Text)
+		assert.True(t, editedTicket.Entries[1].IsEdited(), "entry should be marked as edited")
+		assert.Equal(t, "Thank you", editedTicket.Entries[1].Revisions[0].Text, "previous text should be kept")
+		assert.Equal(t, "editor", editedTicket.Entries[1].Revisions[0].User)
+		assert.Equal(t, "Thank you", currentTicket.Entries[1].Text, "original ticket should not be changed")
+	})
+
+	t.Run("invalidIndex", func(t *testing.T) {
+		_, err := EditEntry(currentTicket, 2, "text", "editor")
+
+		assert.Error(t, err)
+	})
+
+	t.Run("unchangedText", func(t *testing.T) {
+		_, err := EditEntry(currentTicket, 1, "Thank you", "editor")
+
+		assert.Error(t, err)
+	})
+}
+
+func TestRedactEntry(t *testing.T) {
+	testlog.BeginTest()
+	defer testlog.EndTest()
+
+	currentTicket, _ := mockTicketWithEntries()
+	currentTicket, _ = EditEntry(currentTicket, 0, "My password is still secret", "editor")
+	currentTicket.Entries[0].FullText = "My password is secret\n> quoted"
+
+	redactedTicket, err := RedactEntry(currentTicket, 0, "editor")
+
+	assert.NoError(t, err)
+	assert.True(t, redactedTicket.Entries[0].Redacted, "entry should be redacted")
+	assert.Equal(t, structs.RedactedText, redactedTicket.Entries[0].Text, "text should be removed")
+	assert.Empty(t, redactedTicket.Entries[0].FullText, "full message should be removed")
+	assert.Len(t, redactedTicket.Entries[0].Revisions, 2, "redaction should be recorded")
+	for _, revision := range redactedTicket.Entries[0].Revisions {
+		assert.Equal(t, structs.RedactedText, revision.Text, "previous revisions should be removed")
+	}
+	assert.True(t, redactedTicket.Entries[0].Revisions[1].Redaction, "redaction should be marked")
+
+	t.Run("alreadyRedacted", func(t *testing.T) {
+		_, err := RedactEntry(redactedTicket, 0, "editor")
+
+		assert.Error(t, err)
+	})
+
+	t.Run("editRedacted", func(t *testing.T) {
+		_, err := EditEntry(redactedTicket, 0, "new text", "editor")
+
+		assert.Error(t, err)
+	})
+}
+
+func TestAccessToken(t *testing.T) {
+	testlog.BeginTest()
+	defer testlog.EndTest()
+
+	t.Run("oldTicket", func(t *testing.T) {
+		oldTicket := structs.Ticket{ID: "abcdef12345"}
+
+		assert.True(t, HasAccess(oldTicket, ""), "tickets without a token should keep working with old links")
+	})
+
+	currentTicket := CreateTicket("customer@example.com", "Subject", "Text")
+
+	t.Run("access", func(t *testing.T) {
+		assert.True(t, HasAccess(currentTicket, currentTicket.AccessToken), "valid token should grant access")
+		assert.False(t, HasAccess(currentTicket, "wrong"), "invalid token should not grant access")
+		assert.False(t, HasAccess(currentTicket, ""), "missing token should not grant access")
+	})
+}
+
+func TestRate(t *testing.T) {
+	testlog.BeginTest()
+	defer testlog.EndTest()
+
+	now := time.Date(2019, time.January, 7, 10, 0, 0, 0, time.UTC)
+
+	openTicket, editor := mockTicketWithEntries()
+
+	t.Run("openTicket", func(t *testing.T) {
+		_, err := Rate(openTicket, 5, "", now)
+
+		assert.Error(t, err, "only closed tickets can be rated")
+	})
+
+	closedTicket := UpdateTicket("2", "", "", structs.ReplyExternal, openTicket)
+
+	t.Run("tokenOnClose", func(t *testing.T) {
+		assert.NotEmpty(t, closedTicket.Rating.Token, "closing should create the survey token")
+	})
+
+	t.Run("invalidScore", func(t *testing.T) {
+		_, err := Rate(closedTicket, 6, "", now)
+
+		assert.Error(t, err, "score should be between 1 and 5")
+	})
+
+	t.Run("rated", func(t *testing.T) {
+		ratedTicket, err := Rate(closedTicket, 4, "Thanks", now)
+
+		assert.NoError(t, err)
+		assert.True(t, ratedTicket.Rating.IsRated())
+		assert.Equal(t, editor.Username, ratedTicket.Rating.Agent, "assigned editor should be credited")
+		assert.Equal(t, now, ratedTicket.Rating.Date)
+	})
+}
+
+func TestNextTicketID(t *testing.T) {
+	testlog.BeginTest()
+	defer testlog.EndTest()
+
+	now := time.Date(2019, time.January, 7, 10, 0, 0, 0, time.UTC)
+	noTickets := func(id string) bool { return false }
+
+	t.Run("firstNumber", func(t *testing.T) {
+		var sequence structs.TicketSequence
+
+		assert.Equal(t, "TT-2019-000001", NextTicketID("TT", &sequence, now, noTickets))
+		assert.Equal(t, structs.TicketSequence{Year: 2019, Number: 1}, sequence, "sequence should be incremented")
+	})
+
+	t.Run("continued", func(t *testing.T) {
+		sequence := structs.TicketSequence{Year: 2019, Number: 122}
+
+		assert.Equal(t, "HD-2019-000123", NextTicketID("HD", &sequence, now, noTickets))
+	})
+
+	t.Run("newYear", func(t *testing.T) {
+		sequence := structs.TicketSequence{Year: 2018, Number: 999}
+
+		assert.Equal(t, "TT-2019-000001", NextTicketID("TT", &sequence, now, noTickets),
+			"numbers should start again in a new year")
+	})
+
+	t.Run("skipExisting", func(t *testing.T) {
+		var sequence structs.TicketSequence
+		existing := func(id string) bool { return id == "TT-2019-000001" }
+
+		assert.Equal(t, "TT-2019-000002", NextTicketID("TT", &sequence, now, existing),
+			"existing ticket ids should be skipped")
+	})
+}
+
+func TestSaveSequence(t *testing.T) {
+	testlog.BeginTest()
+	defer testlog.EndTest()
+
+	directory, tempErr := ioutil.TempDir("", "sequence")
+	if !assert.NoError(t, tempErr) {
+		return
+	}
+	defer os.RemoveAll(directory)
+
+	serverConfig, logConfig, sequence := globals.ServerConfig, globals.LogConfig, globals.TicketSequence
+	defer func() {
+		globals.ServerConfig, globals.LogConfig, globals.TicketSequence = serverConfig, logConfig, sequence
+	}()
+
+	globals.LogConfig = &structs.LogConfig{
+		LogLevel:  structs.AsLogLevel(defaults.LogLevelString),
+		Verbose:   defaults.LogVerbose,
+		FullPaths: defaults.LogFullPaths,
+	}
+
+	globals.TicketSequence = structs.TicketSequence{Year: 2019, Number: 42}
+
+	t.Run("withoutConfig", func(t *testing.T) {
+		globals.ServerConfig = nil
+
+		assert.NoError(t, SaveSequence(), "sequence should only be kept in memory")
+	})
+
+	t.Run("saved", func(t *testing.T) {
+		sequenceFile := filepath.Join(directory, "sequence.json")
+		globals.ServerConfig = &structs.ServerConfig{Sequence: sequenceFile}
+
+		assert.NoError(t, SaveSequence())
+
+		var savedSequence structs.TicketSequence
+		assert.NoError(t, filehandler.ReadSequenceFile(sequenceFile, &savedSequence))
+		assert.Equal(t, globals.TicketSequence, savedSequence, "saved sequence does not match")
+	})
+
+	t.Run("writeError", func(t *testing.T) {
+		blockingFile := filepath.Join(directory, "file")
+		assert.NoError(t, ioutil.WriteFile(blockingFile, nil, 0644))
+		globals.ServerConfig = &structs.ServerConfig{Sequence: filepath.Join(blockingFile, "sequence.json")}
+
+		assert.Error(t, SaveSequence(), "error writing the sequence should be returned")
+	})
+}
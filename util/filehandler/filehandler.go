@@ -81,6 +81,72 @@ func WriteUserFile(destFile string, users *map[string]structs.User) error {
 	return ioutil.WriteFile(destFile, usersMarshal, defaults.FileModeRegular)
 }
 
+// responseFile is the structure of the JSON file
+// storing the canned responses and macros.
+type responseFile struct {
+	Responses map[string]structs.CannedResponse `json:"responses"`
+	Macros    map[string]structs.Macro          `json:"macros"`
+}
+
+// ReadResponseFile reads the canned responses and macros
+// from the given file into the hash maps. If the file
+// does not exist yet, the hash maps are left untouched
+// and no error is returned.
+func ReadResponseFile(srcFile string, responses *map[string]structs.CannedResponse,
+	macros *map[string]structs.Macro) error {
+
+	if !FileExists(srcFile) {
+		log.Info("Responses file", srcFile, "does not exist yet, starting without canned responses")
+		return nil
+	}
+
+	fileContent, errReadFile := ioutil.ReadFile(srcFile)
+	if errReadFile != nil {
+		return wrapAndLogError(errReadFile, "unable to read responses file")
+	}
+
+	var content responseFile
+	if errUnmarshal := json.Unmarshal(fileContent, &content); errUnmarshal != nil {
+		return wrapAndLogErrorf(errUnmarshal, "unable to decode JSON in responses file '%s'", srcFile)
+	}
+
+	if content.Responses != nil {
+		*responses = content.Responses
+	}
+
+	if content.Macros != nil {
+		*macros = content.Macros
+	}
+
+	return nil
+}
+
+// WriteResponseFile writes the canned responses and macros
+// to the given file to persist any changes. The directory
+// of the file is created if it does not exist yet.
+func WriteResponseFile(destFile string, responses *map[string]structs.CannedResponse,
+	macros *map[string]structs.Macro) error {
+
+	directory := filepath.Dir(destFile)
+	if !DirectoryExists(directory) {
+		log.Info("Creating missing responses directory", directory)
+		if createFoldersErr := CreateFolders(directory); createFoldersErr != nil {
+			return wrapAndLogErrorf(createFoldersErr, "could not create directory '%s'", directory)
+		}
+	}
+
+	marshaledResponses, marshalErr := json.MarshalIndent(responseFile{Responses: *responses, Macros: *macros}, "", "    ")
+	if marshalErr != nil {
+		return wrapAndLogError(marshalErr, "could not convert responses to JSON")
+	}
+
+	if writeErr := ioutil.WriteFile(destFile, marshaledResponses, defaults.FileModeRegular); writeErr != nil {
+		return wrapAndLogErrorf(writeErr, "error while writing file '%s'", destFile)
+	}
+
+	return nil
+}
+
 // ReadTicketFiles reads all the tickets into memory at
 // the server start.
 func ReadTicketFiles(directory string, tickets *map[string]structs.Ticket) error {
@@ -157,6 +223,121 @@ func WriteTicketFile(directory string, ticket *structs.Ticket) error {
 	return ioutil.WriteFile(finalPath, marshalTicket, defaults.FileModeRegular)
 }
 
+// ReadCustomerFile reads the customer directory from the
+// given file into the hash map. If the file does not exist
+// yet, the hash map is left untouched and no error is
+// returned.
+func ReadCustomerFile(srcFile string, customers *map[string]structs.Customer) error {
+	if !FileExists(srcFile) {
+		log.Info("Customers file", srcFile, "does not exist yet, starting with an empty customer directory")
+		return nil
+	}
+
+	fileContent, errReadFile := ioutil.ReadFile(srcFile)
+	if errReadFile != nil {
+		return wrapAndLogError(errReadFile, "unable to read customers file")
+	}
+
+	if errUnmarshal := json.Unmarshal(fileContent, customers); errUnmarshal != nil {
+		return wrapAndLogErrorf(errUnmarshal, "unable to decode JSON in customers file '%s'", srcFile)
+	}
+
+	return nil
+}
+
+// WriteCustomerFile writes the customer directory to the
+// given file to persist any changes. The directory of the
+// file is created if it does not exist yet.
+func WriteCustomerFile(destFile string, customers *map[string]structs.Customer) error {
+	directory := filepath.Dir(destFile)
+	if !DirectoryExists(directory) {
+		log.Info("Creating missing customers directory", directory)
+		if createFoldersErr := CreateFolders(directory); createFoldersErr != nil {
+			return wrapAndLogErrorf(createFoldersErr, "could not create directory '%s'", directory)
+		}
+	}
+
+	marshaledCustomers, marshalErr := json.MarshalIndent(customers, "", "    ")
+	if marshalErr != nil {
+		return wrapAndLogError(marshalErr, "could not convert customers to JSON")
+	}
+
+	if writeErr := ioutil.WriteFile(destFile, marshaledCustomers, defaults.FileModeRegular); writeErr != nil {
+		return wrapAndLogErrorf(writeErr, "error while writing file '%s'", destFile)
+	}
+
+	return nil
+}
+
+// ReadRuleFile reads the automation rules from the given
+// file in the order they are defined. If the file does not
+// exist, the rules are left untouched and no error is
+// returned.
+func ReadRuleFile(srcFile string, rules *[]structs.Rule) error {
+	if !FileExists(srcFile) {
+		log.Info("Rules file", srcFile, "does not exist, no automation rules are applied")
+		return nil
+	}
+
+	fileContent, errReadFile := ioutil.ReadFile(srcFile)
+	if errReadFile != nil {
+		return wrapAndLogError(errReadFile, "unable to read rules file")
+	}
+
+	if errUnmarshal := json.Unmarshal(fileContent, rules); errUnmarshal != nil {
+		return wrapAndLogErrorf(errUnmarshal, "unable to decode JSON in rules file '%s'", srcFile)
+	}
+
+	return nil
+}
+
+// ReadSequenceFile reads the state of the sequential ticket
+// numbers from the given file. If the file does not exist
+// yet, the sequence is left untouched and no error is
+// returned.
+func ReadSequenceFile(srcFile string, sequence *structs.TicketSequence) error {
+	if !FileExists(srcFile) {
+		log.Info("Sequence file", srcFile, "does not exist yet, starting with the first ticket number")
+		return nil
+	}
+
+	fileContent, errReadFile := ioutil.ReadFile(srcFile)
+	if errReadFile != nil {
+		return wrapAndLogError(errReadFile, "unable to read sequence file")
+	}
+
+	if errUnmarshal := json.Unmarshal(fileContent, sequence); errUnmarshal != nil {
+		return wrapAndLogErrorf(errUnmarshal, "unable to decode JSON in sequence file '%s'", srcFile)
+	}
+
+	return nil
+}
+
+// WriteSequenceFile writes the state of the sequential ticket
+// numbers to the given file to persist it across restarts.
+// The directory of the file is created if it does not exist
+// yet.
+func WriteSequenceFile(destFile string, sequence *structs.TicketSequence) error {
+	directory := filepath.Dir(destFile)
+	if !DirectoryExists(directory) {
+		log.Info("Creating missing sequence directory", directory)
+		if createFoldersErr := CreateFolders(directory); createFoldersErr != nil {
+			return wrapAndLogErrorf(createFoldersErr, "could not create directory '%s'", directory)
+		}
+	}
+
+	marshaledSequence, marshalErr := json.MarshalIndent(sequence, "", "    ")
+	if marshalErr != nil {
+		return wrapAndLogError(marshalErr, "could not convert sequence to JSON")
+	}
+
+	if writeErr := ioutil.WriteFile(destFile, marshaledSequence, defaults.FileModeRegular); writeErr != nil {
+		return wrapAndLogErrorf(writeErr, "error while writing file '%s'", destFile)
+	}
+
+	return nil
+}
+
 // ReadMailFiles lookups the files in the given directory,
 // reads them and decodes JSON files into mail structures.
 // Those structures are added to a mail hash map with its
@@ -233,6 +414,38 @@ func WriteMailFile(directory string, mail *structs.Mail) error {
 	return nil
 }
 
+// WriteAttachmentFile writes the content of the attachment
+// with the given id into the directory. The directory is
+// created if it does not exist yet.
+func WriteAttachmentFile(directory string, attachmentID string, data []byte) error {
+
+	// If the directory does not exist yet, create it
+	if !DirectoryExists(directory) {
+
+		log.Info("Creating missing attachment directory", directory, "for new attachment")
+		createFoldersErr := CreateFolders(directory)
+		if createFoldersErr != nil {
+			return wrapAndLogError(createFoldersErr, fmt.Sprintf("could not create directory '%s'", directory))
+		}
+	}
+
+	attachmentPath := AttachmentPath(directory, attachmentID)
+
+	log.Info("Writing attachment file", attachmentPath, "to file system (Permission = 0644 [rw-r--r--])")
+	writeErr := ioutil.WriteFile(attachmentPath, data, defaults.FileModeRegular)
+	if writeErr != nil {
+		return wrapAndLogError(writeErr, fmt.Sprintf("error while writing file '%s'", attachmentPath))
+	}
+
+	return nil
+}
+
+// AttachmentPath returns the path of the file of the
+// attachment with the given id.
+func AttachmentPath(directory string, attachmentID string) string {
+	return path.Join(directory, path.Base(attachmentID))
+}
+
 // RemoveMailFile attempts to remove a mail with a given id
 // in a given directory. If the file does not exist, it
 // returns an non-nil error.
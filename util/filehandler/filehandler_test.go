@@ -220,6 +220,156 @@ func TestReadUserFileInvalidJson(t *testing.T) {
 	})
 }
 
+func TestWriteReadResponseFile(t *testing.T) {
+	testlog.BeginTest()
+	defer testlog.EndTest()
+
+	const responseDirectory string = "testFiles/testResponses"
+	const responseFile string = responseDirectory + "/responses.json"
+
+	responses := map[string]structs.CannedResponse{
+		"r1": {ID: "r1", Title: "Greeting", Text: "Hello {{.Customer}}"},
+		"r2": {ID: "r2", Title: "Personal", Text: "Regards", Owner: "admin"},
+	}
+
+	macros := map[string]structs.Macro{
+		"m1": {ID: "m1", Title: "Close", ChangeStatus: true, Status: structs.StatusClosed, Tags: []string{"done"}},
+	}
+
+	writeErr := WriteResponseFile(responseFile, &responses, &macros)
+	assert.NoError(t, writeErr, "writing the responses file should not error")
+
+	readResponses := make(map[string]structs.CannedResponse)
+	readMacros := make(map[string]structs.Macro)
+	readErr := ReadResponseFile(responseFile, &readResponses, &readMacros)
+
+	assert.NoError(t, readErr, "reading the responses file should not error")
+	assert.Equal(t, responses, readResponses, "canned responses do not match")
+	assert.Equal(t, macros, readMacros, "macros do not match")
+
+	removeErr := os.RemoveAll("testFiles")
+	assert.NoError(t, removeErr, "removing the test directory should not error")
+}
+
+func TestReadResponseFileMissing(t *testing.T) {
+	testlog.BeginTest()
+	defer testlog.EndTest()
+
+	responses := make(map[string]structs.CannedResponse)
+	macros := make(map[string]structs.Macro)
+	readErr := ReadResponseFile("missing/responses.json", &responses, &macros)
+
+	assert.NoError(t, readErr, "a missing responses file should not be an error")
+	assert.Empty(t, responses, "canned responses should be empty")
+	assert.Empty(t, macros, "macros should be empty")
+}
+
+func TestReadResponseFileInvalidJson(t *testing.T) {
+	testlog.BeginTest()
+	defer testlog.EndTest()
+
+	const responseFile string = "testResponses.json"
+
+	writeErr := ioutil.WriteFile(responseFile, []byte("{"), defaults.FileModeRegular)
+	assert.NoError(t, writeErr, "writing invalid responses file should not error")
+	defer os.Remove(responseFile)
+
+	responses := make(map[string]structs.CannedResponse)
+	macros := make(map[string]structs.Macro)
+	readErr := ReadResponseFile(responseFile, &responses, &macros)
+
+	assert.Error(t, readErr, "reading invalid JSON should be an error")
+}
+
+func TestWriteReadCustomerFile(t *testing.T) {
+	testlog.BeginTest()
+	defer testlog.EndTest()
+
+	const customerFile string = "testFiles/testCustomers/customers.json"
+
+	customers := map[string]structs.Customer{
+		"c1": {ID: "c1", Name: "Jane Doe", Organization: "ACME", Mails: []string{"jane@acme.com", "doe@acme.com"}},
+	}
+
+	writeErr := WriteCustomerFile(customerFile, &customers)
+	assert.NoError(t, writeErr, "writing the customers file should not error")
+
+	readCustomers := make(map[string]structs.Customer)
+	readErr := ReadCustomerFile(customerFile, &readCustomers)
+
+	assert.NoError(t, readErr, "reading the customers file should not error")
+	assert.Equal(t, customers, readCustomers, "customers do not match")
+
+	removeErr := os.RemoveAll("testFiles")
+	assert.NoError(t, removeErr, "removing the test directory should not error")
+}
+
+func TestReadRuleFile(t *testing.T) {
+	testlog.BeginTest()
+	defer testlog.EndTest()
+
+	const ruleFile string = "testFiles/testRules/rules.json"
+
+	var rules []structs.Rule
+	readErr := ReadRuleFile(ruleFile, &rules)
+
+	assert.NoError(t, readErr, "a missing rules file should not be an error")
+	assert.Empty(t, rules, "rules should be untouched")
+
+	createErr := CreateFolders("testFiles/testRules")
+	assert.NoError(t, createErr, "creating the test directory should not error")
+
+	writeErr := ioutil.WriteFile(ruleFile, []byte(`[{"id": "billing", "title": "Billing",
+		"conditions": [{"field": "subject", "operator": "contains", "value": "invoice"}],
+		"actions": [{"type": "tag", "value": "billing"}]}]`), defaults.FileModeRegular)
+	assert.NoError(t, writeErr, "writing the rules file should not error")
+
+	readErr = ReadRuleFile(ruleFile, &rules)
+
+	assert.NoError(t, readErr, "reading the rules file should not error")
+	assert.Equal(t, []structs.Rule{{
+		ID:         "billing",
+		Title:      "Billing",
+		Conditions: []structs.RuleCondition{{Field: "subject", Operator: "contains", Value: "invoice"}},
+		Actions:    []structs.RuleAction{{Type: "tag", Value: "billing"}},
+	}}, rules, "rules do not match")
+
+	writeErr = ioutil.WriteFile(ruleFile, []byte("{invalid"), defaults.FileModeRegular)
+	assert.NoError(t, writeErr, "writing the rules file should not error")
+
+	readErr = ReadRuleFile(ruleFile, &rules)
+	assert.Error(t, readErr, "invalid JSON should be an error")
+
+	removeErr := os.RemoveAll("testFiles")
+	assert.NoError(t, removeErr, "removing the test directory should not error")
+}
+
+func TestWriteReadSequenceFile(t *testing.T) {
+	testlog.BeginTest()
+	defer testlog.EndTest()
+
+	const sequenceFile string = "testFiles/testSequence/sequence.json"
+
+	var missingSequence structs.TicketSequence
+	readErr := ReadSequenceFile(sequenceFile, &missingSequence)
+
+	assert.NoError(t, readErr, "a missing sequence file should not be an error")
+	assert.Equal(t, structs.TicketSequence{}, missingSequence, "sequence should be untouched")
+
+	sequence := structs.TicketSequence{Year: 2019, Number: 123}
+	writeErr := WriteSequenceFile(sequenceFile, &sequence)
+	assert.NoError(t, writeErr, "writing the sequence file should not error")
+
+	var readSequence structs.TicketSequence
+	readErr = ReadSequenceFile(sequenceFile, &readSequence)
+
+	assert.NoError(t, readErr, "reading the sequence file should not error")
+	assert.Equal(t, sequence, readSequence, "sequence does not match")
+
+	removeErr := os.RemoveAll("testFiles")
+	assert.NoError(t, removeErr, "removing the test directory should not error")
+}
+
 func TestWriteTicketFile(t *testing.T) {
 	testlog.BeginTest()
 	defer testlog.EndTest()
@@ -491,6 +641,25 @@ func TestRemoveMailFile(t *testing.T) {
 	assert.NoError(t, removeErr, "removing mail directory should not return an error because the directory exists")
 }
 
+func TestWriteAttachmentFile(t *testing.T) {
+	testlog.BeginTest()
+	defer testlog.EndTest()
+
+	const attachmentDirectory string = "../../files/testattachments"
+	defer os.RemoveAll(attachmentDirectory)
+
+	writeErr := WriteAttachmentFile(attachmentDirectory, "attachment1", []byte("content"))
+
+	assert.NoError(t, writeErr, "writing attachment file should not return an error")
+
+	content, readErr := ioutil.ReadFile(AttachmentPath(attachmentDirectory, "attachment1"))
+	assert.NoError(t, readErr, "attachment file should exist")
+	assert.Equal(t, "content", string(content))
+
+	assert.Equal(t, attachmentDirectory+"/passwd", AttachmentPath(attachmentDirectory, "../../passwd"),
+		"attachment path should stay inside the directory")
+}
+
 func TestFileExists(t *testing.T) {
 	testlog.BeginTest()
 	defer testlog.EndTest()
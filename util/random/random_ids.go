@@ -19,6 +19,8 @@
 package random
 
 import (
+	cryptorand "crypto/rand"
+	"encoding/hex"
 	"math/rand"
 	"time"
 )
@@ -58,3 +60,19 @@ func CreateRandomID(n int) string {
 
 	return string(b)
 }
+
+// CreateSecureToken generates a token of n random bytes
+// from a cryptographically secure source and returns it
+// hex encoded. Tokens are used for public links which
+// must not be guessable, unlike the ticket ids.
+func CreateSecureToken(n int) string {
+	b := make([]byte, n)
+
+	// Fall back to the pseudo-random ids if the secure
+	// source is not available
+	if _, readErr := cryptorand.Read(b); readErr != nil {
+		return CreateRandomID(2 * n)
+	}
+
+	return hex.EncodeToString(b)
+}
@@ -50,3 +50,15 @@ func TestCreateRandomId(t *testing.T) {
 
 	assert.True(t, len(ticketID) == structs.RandomIDLength, "Random id has the wrong length")
 }
+
+// TestCreateSecureToken makes sure that the tokens are hex
+// encoded and differ from each other
+func TestCreateSecureToken(t *testing.T) {
+	testlog.BeginTest()
+	defer testlog.EndTest()
+
+	token := CreateSecureToken(16)
+
+	assert.Len(t, token, 32, "Token has the wrong length")
+	assert.NotEqual(t, token, CreateSecureToken(16), "Tokens should be unique")
+}
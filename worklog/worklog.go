@@ -0,0 +1,178 @@
+// Trivial Tickets Ticketsystem
+// Copyright (C) 2019 The Contributors
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+// Package worklog aggregates the time logged on tickets
+// to reports which can be exported as CSV.
+package worklog
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/mortenterhart/trivial-tickets/structs"
+)
+
+/*
+ * Ticketsystem Trivial Tickets
+ *
+ * Matriculation numbers: 3040018, 6694964, 3478222
+ * Lecture:               Programmieren II, INF16B
+ * Lecturer:              Herr Prof. Dr. Helmut Neemann
+ * Institute:             Duale Hochschule Baden-Württemberg Mosbach
+ *
+ * ---------------
+ *
+ * Package worklog
+ * Reports of the time logged on tickets
+ */
+
+// ParseMinutes converts the time entered by a user to
+// minutes. The time is either a plain number of minutes,
+// e.g. "90", or a duration such as "1h30m".
+func ParseMinutes(value string) (int, error) {
+	value = strings.TrimSpace(value)
+
+	if minutes, atoiErr := strconv.Atoi(value); atoiErr == nil {
+		return minutes, nil
+	}
+
+	duration, parseErr := time.ParseDuration(value)
+	if parseErr != nil {
+		return 0, errors.Errorf("invalid time '%s', expected minutes or a duration like 1h30m", value)
+	}
+
+	return int(duration.Round(time.Minute) / time.Minute), nil
+}
+
+// PeriodLabel returns the label of the period the given
+// date belongs to, e.g. "2019-01-07" for a day, "2019-W02"
+// for a calendar week or "2019-01" for a month.
+func PeriodLabel(date time.Time, period structs.ReportPeriod) string {
+	switch period {
+	case structs.PeriodDay:
+		return date.Format("2006-01-02")
+
+	case structs.PeriodWeek:
+		year, week := date.ISOWeek()
+		return fmt.Sprintf("%d-W%02d", year, week)
+	}
+
+	return date.Format("2006-01")
+}
+
+// Report aggregates the time logged on the given tickets
+// between from (inclusive) and to (exclusive) by period,
+// agent and customer. The rows are sorted in this order.
+func Report(tickets map[string]structs.Ticket, from, to time.Time, period structs.ReportPeriod) []structs.ReportRow {
+	rowIndex := make(map[structs.ReportRow]int)
+	var rows []structs.ReportRow
+
+	for _, currentTicket := range tickets {
+		for _, workLog := range currentTicket.WorkLogs {
+			if workLog.Date.Before(from) || !workLog.Date.Before(to) {
+				continue
+			}
+
+			key := structs.ReportRow{
+				Period:   PeriodLabel(workLog.Date, period),
+				Agent:    workLog.User,
+				Customer: currentTicket.Customer,
+			}
+
+			index, exists := rowIndex[key]
+			if !exists {
+				index = len(rows)
+				rowIndex[key] = index
+				rows = append(rows, key)
+			}
+
+			rows[index].Minutes += workLog.Minutes
+		}
+	}
+
+	sort.Slice(rows, func(i, j int) bool {
+		if rows[i].Period != rows[j].Period {
+			return rows[i].Period < rows[j].Period
+		}
+
+		if rows[i].Agent != rows[j].Agent {
+			return rows[i].Agent < rows[j].Agent
+		}
+
+		return rows[i].Customer < rows[j].Customer
+	})
+
+	return rows
+}
+
+// TotalMinutes sums up the minutes of all report rows.
+func TotalMinutes(rows []structs.ReportRow) int {
+	total := 0
+	for _, row := range rows {
+		total += row.Minutes
+	}
+
+	return total
+}
+
+// WriteCSV writes the report rows as CSV with a header
+// line to the given writer. The time is written both in
+// minutes and in decimal hours for the billing. Text cells
+// are neutralized so that spreadsheets do not evaluate them
+// as formulas.
+func WriteCSV(writer io.Writer, rows []structs.ReportRow) error {
+	csvWriter := csv.NewWriter(writer)
+
+	if writeErr := csvWriter.Write([]string{"period", "agent", "customer", "minutes", "hours"}); writeErr != nil {
+		return errors.Wrap(writeErr, "could not write CSV header")
+	}
+
+	for _, row := range rows {
+		record := []string{
+			csvText(row.Period),
+			csvText(row.Agent),
+			csvText(row.Customer),
+			strconv.Itoa(row.Minutes),
+			strconv.FormatFloat(float64(row.Minutes)/60, 'f', 2, 64),
+		}
+
+		if writeErr := csvWriter.Write(record); writeErr != nil {
+			return errors.Wrap(writeErr, "could not write CSV record")
+		}
+	}
+
+	csvWriter.Flush()
+
+	return errors.Wrap(csvWriter.Error(), "could not flush CSV report")
+}
+
+// csvText prefixes a text cell with an apostrophe if it
+// starts with a character which spreadsheets interpret as
+// the beginning of a formula.
+func csvText(cell string) string {
+	if cell != "" && strings.ContainsAny(cell[:1], "=+-@\t\r") {
+		return "'" + cell
+	}
+
+	return cell
+}
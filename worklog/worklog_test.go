@@ -0,0 +1,168 @@
+// Trivial Tickets Ticketsystem
+// Copyright (C) 2019 The Contributors
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+// Package worklog aggregates the time logged on tickets
+// to reports which can be exported as CSV.
+package worklog
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mortenterhart/trivial-tickets/log/testlog"
+	"github.com/mortenterhart/trivial-tickets/structs"
+)
+
+/*
+ * Ticketsystem Trivial Tickets
+ *
+ * Matriculation numbers: 3040018, 6694964, 3478222
+ * Lecture:               Programmieren II, INF16B
+ * Lecturer:              Herr Prof. Dr. Helmut Neemann
+ * Institute:             Duale Hochschule Baden-Württemberg Mosbach
+ *
+ * ---------------
+ *
+ * Package worklog
+ * Reports of the time logged on tickets
+ */
+
+// mockTickets returns two tickets of different customers
+// with time logged by two agents in January and February.
+func mockTickets() map[string]structs.Ticket {
+	january := time.Date(2019, time.January, 7, 10, 0, 0, 0, time.UTC)
+	february := time.Date(2019, time.February, 4, 10, 0, 0, 0, time.UTC)
+
+	return map[string]structs.Ticket{
+		"abc123": {
+			ID:       "abc123",
+			Customer: "first@example.com",
+			WorkLogs: []structs.WorkLog{
+				{Date: january, User: "admin", Minutes: 30},
+				{Date: january.Add(time.Hour), User: "admin", Minutes: 15},
+				{Date: january, User: "editor", Minutes: 60},
+				{Date: february, User: "admin", Minutes: 10},
+			},
+		},
+		"def456": {
+			ID:       "def456",
+			Customer: "second@example.com",
+			WorkLogs: []structs.WorkLog{
+				{Date: january.AddDate(0, 0, 1), User: "admin", Minutes: 20},
+			},
+		},
+	}
+}
+
+func TestParseMinutes(t *testing.T) {
+	testlog.BeginTest()
+	defer testlog.EndTest()
+
+	t.Run("minutes", func(t *testing.T) {
+		minutes, err := ParseMinutes(" 90 ")
+
+		assert.NoError(t, err)
+		assert.Equal(t, 90, minutes)
+	})
+
+	t.Run("duration", func(t *testing.T) {
+		minutes, err := ParseMinutes("1h30m")
+
+		assert.NoError(t, err)
+		assert.Equal(t, 90, minutes)
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		_, err := ParseMinutes("an hour")
+
+		assert.Error(t, err)
+	})
+}
+
+func TestPeriodLabel(t *testing.T) {
+	testlog.BeginTest()
+	defer testlog.EndTest()
+
+	date := time.Date(2019, time.January, 7, 10, 0, 0, 0, time.UTC)
+
+	assert.Equal(t, "2019-01-07", PeriodLabel(date, structs.PeriodDay))
+	assert.Equal(t, "2019-W02", PeriodLabel(date, structs.PeriodWeek))
+	assert.Equal(t, "2019-01", PeriodLabel(date, structs.PeriodMonth))
+}
+
+func TestReport(t *testing.T) {
+	testlog.BeginTest()
+	defer testlog.EndTest()
+
+	from := time.Date(2019, time.January, 1, 0, 0, 0, 0, time.UTC)
+	to := time.Date(2019, time.March, 1, 0, 0, 0, 0, time.UTC)
+
+	t.Run("byMonth", func(t *testing.T) {
+		rows := Report(mockTickets(), from, to, structs.PeriodMonth)
+
+		assert.Equal(t, []structs.ReportRow{
+			{Period: "2019-01", Agent: "admin", Customer: "first@example.com", Minutes: 45},
+			{Period: "2019-01", Agent: "admin", Customer: "second@example.com", Minutes: 20},
+			{Period: "2019-01", Agent: "editor", Customer: "first@example.com", Minutes: 60},
+			{Period: "2019-02", Agent: "admin", Customer: "first@example.com", Minutes: 10},
+		}, rows)
+		assert.Equal(t, 135, TotalMinutes(rows))
+	})
+
+	t.Run("byDay", func(t *testing.T) {
+		rows := Report(mockTickets(), from, to, structs.PeriodDay)
+
+		assert.Len(t, rows, 4)
+		assert.Equal(t, "2019-01-07", rows[0].Period)
+	})
+
+	t.Run("timeRange", func(t *testing.T) {
+		rows := Report(mockTickets(), from, time.Date(2019, time.February, 1, 0, 0, 0, 0, time.UTC), structs.PeriodMonth)
+
+		assert.Equal(t, 125, TotalMinutes(rows), "time logged after the end should be excluded")
+	})
+}
+
+func TestWriteCSV(t *testing.T) {
+	testlog.BeginTest()
+	defer testlog.EndTest()
+
+	var output bytes.Buffer
+	err := WriteCSV(&output, []structs.ReportRow{
+		{Period: "2019-01", Agent: "admin", Customer: "first@example.com", Minutes: 90},
+	})
+
+	assert.NoError(t, err)
+	assert.Equal(t, "period,agent,customer,minutes,hours\n2019-01,admin,first@example.com,90,1.50\n", output.String())
+
+	t.Run("formulaInjection", func(t *testing.T) {
+		var output bytes.Buffer
+		err := WriteCSV(&output, []structs.ReportRow{
+			{Period: "2019-01", Agent: "admin", Customer: "=HYPERLINK(\"http://evil.example\")", Minutes: 30},
+			{Period: "2019-01", Agent: "@admin", Customer: "+1@example.com", Minutes: 15},
+			{Period: "2019-01", Agent: "-admin", Customer: "\tcustomer@example.com", Minutes: 10},
+		})
+
+		assert.NoError(t, err)
+		assert.Equal(t, "period,agent,customer,minutes,hours\n"+
+			"2019-01,admin,\"'=HYPERLINK(\"\"http://evil.example\"\")\",30,0.50\n"+
+			"2019-01,'@admin,'+1@example.com,15,0.25\n"+
+			"2019-01,'-admin,'\tcustomer@example.com,10,0.17\n", output.String())
+	})
+}
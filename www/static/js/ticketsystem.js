@@ -124,7 +124,8 @@ function unassignTicket(button) {
 
 /**
  * assignTicket assigns the ticket in the UI and blocks the ticket
- * from further manipulation by disabling the button.
+ * from further manipulation by disabling the button. If the
+ * assignment is rejected, the reason is shown to the user.
  * @param {String} button The button id of the specific ticket
  */
 function assignTicket(button) {
@@ -134,19 +135,120 @@ function assignTicket(button) {
 
     let request = createAJAXObject();
 
-    let url = "/assignTicket?id=" + id + "&user=" + user;
-
-    request.open("GET", encodeURI(url), true);
+    request.open("POST", "/assignTicket", true);
+    request.setRequestHeader("Content-Type", "application/x-www-form-urlencoded");
     request.onreadystatechange = () => {
-        if (request.readyState === 4 && request.status === 200) {
-            document.querySelector("#" + button.replace("btn_", "td_")).innerHTML = request.responseText;
+        if (request.readyState !== 4) {
+            return;
+        }
+
+        if (request.status === 200) {
+            document.querySelector("#" + button.replace("btn_", "td_")).textContent = request.responseText;
             document.querySelector("#" + button).disabled = true;
             document.querySelector("#" + button).style.opacity = "0.25";
             document.querySelector("#" + button.replace("btn_", "td_status_")).innerHTML = "In Progress";
+        } else {
+            alert(request.responseText);
         }
     };
 
-    request.send(null);
+    request.send("id=" + encodeURIComponent(id) + "&user=" + encodeURIComponent(user));
+}
+
+/**
+ * selectAllTickets selects or deselects all tickets in the
+ * all tickets view for a bulk action.
+ * @param {Boolean} checked Whether the tickets are selected
+ */
+function selectAllTickets(checked) {
+
+    document.querySelectorAll(".bulk_select").forEach((checkbox) => {
+        checkbox.checked = checked;
+    });
+}
+
+/**
+ * showBulkParameter shows the input for the parameter of the
+ * selected bulk action and hides the other ones.
+ * @param {String} action The selected bulk action
+ */
+function showBulkParameter(action) {
+
+    let parameters = {assign: "bulk_user", status: "bulk_status", tag: "bulk_tag", merge: "bulk_merge"};
+
+    document.querySelectorAll(".bulk_parameter").forEach((input) => {
+        input.style.display = input.id === parameters[action] ? "" : "none";
+    });
+}
+
+/**
+ * applyBulkAction applies the selected bulk action to all
+ * selected tickets and lists the result for every ticket.
+ * The page is reloaded if the action was applied.
+ */
+function applyBulkAction() {
+
+    let action = document.querySelector("#bulk_action").value;
+    let form = new FormData();
+
+    form.append("action", action);
+    form.append("user", document.querySelector("#bulk_user").value);
+    form.append("status", document.querySelector("#bulk_status").value);
+    form.append("tag", document.querySelector("#bulk_tag").value);
+    form.append("merge", document.querySelector("#bulk_merge").value);
+
+    document.querySelectorAll(".bulk_select:checked").forEach((checkbox) => {
+        form.append("tickets", checkbox.value);
+    });
+
+    let request = createAJAXObject();
+
+    request.open("POST", "/bulkAction", true);
+    request.onreadystatechange = () => {
+        if (request.readyState !== 4) {
+            return;
+        }
+
+        let results = document.querySelector("#bulk_results");
+
+        if (request.status !== 200 && request.status !== 409) {
+            results.textContent = request.responseText;
+            return;
+        }
+
+        let response = JSON.parse(request.responseText);
+
+        if (response.applied) {
+            window.location.reload();
+            return;
+        }
+
+        results.innerHTML = "";
+        response.results.forEach((result) => {
+            let item = document.createElement("li");
+            item.textContent = result.ticket + ": " + (result.success ? "ok" : result.message);
+            results.appendChild(item);
+        });
+    };
+
+    request.send(new URLSearchParams(form));
+}
+
+/**
+ * insertCannedResponse appends the text of the selected canned
+ * response to the reply and resets the selection afterwards.
+ * @param {HTMLSelectElement} select The select element with the
+ *                                   canned responses
+ */
+function insertCannedResponse(select) {
+
+    let reply = document.querySelector("#ticket textarea[name=reply]");
+
+    if (select.value !== "") {
+        reply.value += select.value;
+        select.value = "";
+        reply.focus();
+    }
 }
 
 /**